@@ -2,12 +2,36 @@ package main
 
 import (
 	"github.com/stickermule/rump/pkg/config"
+	"github.com/stickermule/rump/pkg/message"
 	"github.com/stickermule/rump/pkg/run"
 )
 
 func main() {
 	// parse config flags, will exit in case of errors.
 	cfg := config.Parse()
+	// render key names per key-encoding-output, whatever the command
+	message.KeyEncoding = cfg.KeyEncoding
 
-	run.Run(cfg)
+	switch cfg.Command {
+	case config.SampleKeys:
+		run.Sample(cfg)
+	case config.ListKeys:
+		run.Keys(cfg)
+	case config.Compare:
+		run.Compare(cfg)
+	case config.GetKey:
+		run.GetKey(cfg)
+	case config.VerifyAudit:
+		run.VerifyAudit(cfg)
+	case config.Validate:
+		run.Validate(cfg)
+	case config.Benchmark:
+		run.Bench(cfg)
+	case config.GenerateData:
+		run.Generate(cfg)
+	case config.Promote:
+		run.Promote(cfg)
+	default:
+		run.Run(cfg)
+	}
 }
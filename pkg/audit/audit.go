@@ -0,0 +1,250 @@
+// Package audit writes a ledger of the restored keys, an entry per key
+// written as soon as it's restored, appended to a JSON lines file or a Redis
+// Stream. Entries can be hash chained, each one hashing the previous hash,
+// to make edits and deletions evident, see Verify.
+// All methods are safe for concurrent use, and are noops on a nil Log.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mediocregopher/radix/v3"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// Entry is a restored key. Key names that aren't valid UTF-8 are base64
+// encoded in Key64 rather than Key, as in JSONL files, JSON replacing their
+// invalid bytes. Size is the payload size, TTL is in milliseconds, 0 when
+// persistent, Time is RFC 3339 in UTC.
+// Prev and Hash are set when chained, Hash being the hex SHA-256 of Prev and
+// the entry JSON without Hash.
+type Entry struct {
+	Key    string `json:"key"`
+	Key64  []byte `json:"key64,omitempty"`
+	Size   int    `json:"size"`
+	TTL    int64  `json:"ttl"`
+	Time   string `json:"time"`
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Prev   string `json:"prev,omitempty"`
+	Hash   string `json:"hash,omitempty"`
+}
+
+// Name returns the key name of e.
+func (e Entry) Name() string {
+	if e.Key64 != nil {
+		return string(e.Key64)
+	}
+
+	return e.Key
+}
+
+// hash returns the chain hash of e.
+func (e Entry) hash() (string, error) {
+	e.Hash = ""
+	b, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte(e.Prev+"\n"), b...))
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Log appends the Entries of restored keys from Source to Target, the
+// identifiers of both ends, e.g. redacted URIs.
+type Log struct {
+	Source string
+	Target string
+	Chain  bool
+
+	mu   sync.Mutex
+	last string
+	add  func(Entry) error
+	f    *os.File
+}
+
+// NewFile creates a Log appending to the file path, created when missing.
+// Chained, it carries on from the hash of the file last entry.
+func NewFile(path string, chain bool) (*Log, error) {
+	l := &Log{Chain: chain}
+	if chain {
+		last, err := lastFileHash(path)
+		if err != nil {
+			return nil, err
+		}
+		l.last = last
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening audit log: %w", err)
+	}
+	l.f = f
+
+	// Unbuffered, entries survive a crash of the run
+	l.add = func(e Entry) error {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(append(b, '\n'))
+		return err
+	}
+
+	return l, nil
+}
+
+// lastFileHash returns the hash of the last entry of path, empty when the
+// file is missing or empty.
+func lastFileHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading audit log: %w", err)
+	}
+	defer f.Close()
+
+	var last Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		last = Entry{}
+		if err := json.Unmarshal(scanner.Bytes(), &last); err != nil {
+			return "", fmt.Errorf("error reading audit log: %w", err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("error reading audit log: %w", err)
+	}
+
+	return last.Hash, nil
+}
+
+// NewStream creates a Log adding entries to the stream name with XADD.
+// Chained, it carries on from the hash of the stream last entry.
+func NewStream(client radix.Client, name string, chain bool) (*Log, error) {
+	l := &Log{Chain: chain}
+	if chain {
+		var entries []radix.StreamEntry
+		if err := client.Do(radix.Cmd(&entries, "XREVRANGE", name, "+", "-", "COUNT", "1")); err != nil {
+			return nil, fmt.Errorf("error reading audit stream %s: %w", name, err)
+		}
+		if len(entries) > 0 {
+			l.last = entries[0].Fields["hash"]
+		}
+	}
+
+	l.add = func(e Entry) error {
+		args := []string{name, "*",
+			"key", e.Name(),
+			"size", strconv.Itoa(e.Size),
+			"ttl", strconv.FormatInt(e.TTL, 10),
+			"time", e.Time,
+			"source", e.Source,
+			"target", e.Target,
+		}
+		if e.Hash != "" {
+			args = append(args, "prev", e.Prev, "hash", e.Hash)
+		}
+		return client.Do(radix.Cmd(nil, "XADD", args...))
+	}
+
+	return l, nil
+}
+
+// Add appends the Entry of a restored key.
+func (l *Log) Add(key string, size int, ttl int64) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e := Entry{
+		Size:   size,
+		TTL:    ttl,
+		Time:   time.Now().UTC().Format(time.RFC3339Nano),
+		Source: l.Source,
+		Target: l.Target,
+	}
+	if utf8.ValidString(key) {
+		e.Key = key
+	} else {
+		e.Key64 = []byte(key)
+	}
+	if l.Chain {
+		e.Prev = l.last
+		hash, err := e.hash()
+		if err != nil {
+			return err
+		}
+		e.Hash = hash
+	}
+
+	if err := l.add(e); err != nil {
+		return fmt.Errorf("error writing audit entry of key %s: %w", message.FormatKey(key), err)
+	}
+	l.last = e.Hash
+
+	return nil
+}
+
+// Close closes the audit file.
+func (l *Log) Close() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+
+	return l.f.Close()
+}
+
+// Verify checks the hash chain of a JSON lines audit log, returning the
+// count of entries. Every entry must be chained to the previous one, the
+// first one to none: unchained entries, written without Chain or appended
+// since, fail it.
+func Verify(r io.Reader) (int, error) {
+	var n int
+	var last string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		n++
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return n, fmt.Errorf("audit log line %d: %w", n, err)
+		}
+		if e.Hash == "" {
+			return n, fmt.Errorf("audit log line %d: entry not chained", n)
+		}
+
+		hash, err := e.hash()
+		if err != nil {
+			return n, err
+		}
+		switch {
+		case e.Prev != last:
+			return n, fmt.Errorf("audit log line %d: chain broken, previous entries were edited or deleted", n)
+		case e.Hash != hash:
+			return n, fmt.Errorf("audit log line %d: wrong hash, the entry was edited", n)
+		}
+		last = e.Hash
+	}
+	if err := scanner.Err(); err != nil {
+		return n, fmt.Errorf("error reading audit log: %w", err)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,153 @@
+package audit_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mediocregopher/radix/v3"
+
+	"github.com/stickermule/rump/pkg/audit"
+)
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rump-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := dir + "/audit.jsonl"
+
+	// Two runs, the second one carrying on the chain
+	for _, key := range []string{"key1", "key2"} {
+		l, err := audit.NewFile(path, true)
+		if err != nil {
+			t.Fatal("error: ", err)
+		}
+		l.Source, l.Target = "redis://s", "redis://t"
+		if err := l.Add(key, 10, 30000); err != nil {
+			t.Error("error: ", err)
+		}
+		l.Close()
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 entries, got %s", data)
+	}
+	var first, second audit.Entry
+	json.Unmarshal([]byte(lines[0]), &first)
+	json.Unmarshal([]byte(lines[1]), &second)
+	if first.Key != "key1" || first.Size != 10 || first.TTL != 30000 || first.Source != "redis://s" || first.Target != "redis://t" {
+		t.Errorf("wrong entry: %+v", first)
+	}
+	if first.Prev != "" || first.Hash == "" || second.Prev != first.Hash {
+		t.Errorf("entries aren't chained: %+v %+v", first, second)
+	}
+
+	if n, err := audit.Verify(bytes.NewReader(data)); n != 2 || err != nil {
+		t.Errorf("expected 2 verified entries, got %d, %v", n, err)
+	}
+
+	// Edits and deletions break the chain
+	edited := strings.Replace(string(data), `"size":10`, `"size":11`, 1)
+	if _, err := audit.Verify(strings.NewReader(edited)); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("edit should be detected on line 1, got %v", err)
+	}
+	if _, err := audit.Verify(strings.NewReader(lines[1])); err == nil {
+		t.Error("deletion should be detected")
+	}
+
+	// Unchained entries, appended or in between, fail on the first one
+	unchained := `{"key":"key3","size":10,"ttl":0,"time":"","source":"","target":""}`
+	for _, c := range []struct {
+		log  []string
+		line int
+	}{
+		{[]string{lines[0], lines[1], unchained, unchained}, 3},
+		{[]string{lines[0], unchained, lines[1]}, 2},
+		{[]string{unchained}, 1},
+	} {
+		expected := fmt.Sprintf("line %d: entry not chained", c.line)
+		if _, err := audit.Verify(strings.NewReader(strings.Join(c.log, "\n"))); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q, got %v", expected, err)
+		}
+	}
+}
+
+// Test key names that aren't valid UTF-8 are kept, base64 encoded, and chained
+func TestFileBinaryKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rump-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := dir + "/audit.jsonl"
+
+	l, err := audit.NewFile(path, true)
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	for _, key := range []string{"bin\xff\xfe", "key1"} {
+		if err := l.Add(key, 10, 0); err != nil {
+			t.Error("error: ", err)
+		}
+	}
+	l.Close()
+
+	data, _ := ioutil.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	var first, second audit.Entry
+	json.Unmarshal([]byte(lines[0]), &first)
+	json.Unmarshal([]byte(lines[1]), &second)
+	if first.Key != "" || first.Name() != "bin\xff\xfe" || !strings.Contains(lines[0], `"key64":"Ymlu//4="`) {
+		t.Errorf("wrong binary key entry: %s", lines[0])
+	}
+	if second.Name() != "key1" || strings.Contains(lines[1], "key64") {
+		t.Errorf("wrong entry: %s", lines[1])
+	}
+	if n, err := audit.Verify(bytes.NewReader(data)); n != 2 || err != nil {
+		t.Errorf("expected 2 verified entries, got %d, %v", n, err)
+	}
+}
+
+func TestStream(t *testing.T) {
+	var xadds [][]string
+	db := radix.Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		switch args[0] {
+		case "XREVRANGE":
+			return []interface{}{[]interface{}{"1-0", []interface{}{"key", "key0", "hash", "abc"}}}
+		case "XADD":
+			xadds = append(xadds, args)
+			return "2-0"
+		}
+		return nil
+	})
+
+	l, err := audit.NewStream(db, "rump:audit", true)
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	if err := l.Add("key1", 10, 0); err != nil {
+		t.Fatal("error: ", err)
+	}
+	if err := l.Add("key2", 10, 0); err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	if len(xadds) != 2 || xadds[0][1] != "rump:audit" || xadds[0][4] != "key1" {
+		t.Fatalf("wrong XADDs: %v", xadds)
+	}
+	// prev, hash are the last fields
+	if prev := xadds[0][len(xadds[0])-3]; prev != "abc" {
+		t.Errorf("chain should carry on from the stream last hash, got prev %s", prev)
+	}
+	if prev := xadds[1][len(xadds[1])-3]; prev != xadds[0][len(xadds[0])-1] {
+		t.Errorf("entries aren't chained: %v", xadds)
+	}
+}
@@ -0,0 +1,170 @@
+// Package bloom builds a Bloom filter of the key names restored by a sync,
+// for downstream systems to test whether a key was migrated without a full
+// key list: no false negatives, false positives at about the rate it's sized
+// for. Files start with a text header line of its parameters, e.g.
+// rump-bloom v1 m=9585059 k=7 n=1000000 fp=0.01 added=998012 hash=fnv1a64
+// followed by the m bits, 8 per byte, bit p being bit p%8 of byte p/8,
+// counted from the least significant. Bit positions of a key are (h1 + i*h2) mod m, for i in
+// [0, k), h1 and h2 the high and low 32 bits of the FNV-1a 64 hash of its
+// name, h2 forced odd.
+// All methods are safe for concurrent use, and are noops on a nil Filter.
+package bloom
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Filter is a Bloom filter of M bits and K hashes, sized for N keys at a
+// false positive rate of FP. Added counts the keys added, past N the rate
+// rising above FP.
+type Filter struct {
+	M     uint64
+	K     uint64
+	N     uint64
+	FP    float64
+	Added uint64
+
+	mu   sync.Mutex
+	bits []byte
+}
+
+// New creates an empty Filter sized for n keys at the false positive rate
+// fp, between 0 and 1.
+func New(n uint64, fp float64) *Filter {
+	if n < 1 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(fp) / (math.Ln2 * math.Ln2)))
+	if m < 8 {
+		m = 8
+	}
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+
+	return &Filter{M: m, K: k, N: n, FP: fp, bits: make([]byte, (m+7)/8)}
+}
+
+// positions calls do with the bit positions of key.
+func (f *Filter) positions(key string, do func(uint64)) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := sum>>32, sum&0xffffffff|1
+	for i := uint64(0); i < f.K; i++ {
+		do((h1 + i*h2) % f.M)
+	}
+}
+
+// Add adds key to the Filter.
+func (f *Filter) Add(key string) {
+	if f == nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.positions(key, func(p uint64) {
+		f.bits[p/8] |= 1 << (p % 8)
+	})
+	f.Added++
+}
+
+// Test reports whether key may have been added, false when it surely
+// wasn't.
+func (f *Filter) Test(key string) bool {
+	if f == nil {
+		return false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	found := true
+	f.positions(key, func(p uint64) {
+		found = found && f.bits[p/8]&(1<<(p%8)) != 0
+	})
+
+	return found
+}
+
+// WriteTo writes the header line and the bits of the Filter to w.
+func (f *Filter) WriteTo(w io.Writer) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n, err := fmt.Fprintf(w, "rump-bloom v1 m=%d k=%d n=%d fp=%g added=%d hash=fnv1a64\n", f.M, f.K, f.N, f.FP, f.Added)
+	if err != nil {
+		return int64(n), err
+	}
+	b, err := w.Write(f.bits)
+
+	return int64(n + b), err
+}
+
+// WriteFile writes the Filter to path, through a temporary file renamed
+// once complete, for readers never to load it half written.
+func (f *Filter) WriteFile(path string) error {
+	if f == nil {
+		return nil
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("error writing bloom filter: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	if _, err := f.WriteTo(w); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing bloom filter: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing bloom filter: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing bloom filter: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error writing bloom filter: %w", err)
+	}
+
+	return nil
+}
+
+// Read reads a Filter written by WriteTo.
+func Read(r io.Reader) (*Filter, error) {
+	br := bufio.NewReader(r)
+	header, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("error reading bloom filter header: %w", err)
+	}
+
+	f := &Filter{}
+	var hash string
+	if _, err := fmt.Sscanf(header, "rump-bloom v1 m=%d k=%d n=%d fp=%g added=%d hash=%s\n", &f.M, &f.K, &f.N, &f.FP, &f.Added, &hash); err != nil {
+		return nil, fmt.Errorf("invalid bloom filter header %q: %w", header, err)
+	}
+	if hash != "fnv1a64" || f.M == 0 || f.K == 0 {
+		return nil, fmt.Errorf("invalid bloom filter header %q", header)
+	}
+
+	f.bits = make([]byte, (f.M+7)/8)
+	if _, err := io.ReadFull(br, f.bits); err != nil {
+		return nil, fmt.Errorf("error reading bloom filter bits: %w", err)
+	}
+
+	return f, nil
+}
@@ -0,0 +1,56 @@
+package bloom_test
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stickermule/rump/pkg/bloom"
+)
+
+// Test added keys are all found, once written and read back, and others at
+// about the false positive rate
+func TestFilter(t *testing.T) {
+	f := bloom.New(10000, 0.01)
+	for i := 0; i < 10000; i++ {
+		f.Add("user:" + strconv.Itoa(i))
+	}
+
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatal("error: ", err)
+	}
+	header := strings.SplitN(buf.String(), "\n", 2)[0]
+	if header != "rump-bloom v1 m=95851 k=7 n=10000 fp=0.01 added=10000 hash=fnv1a64" {
+		t.Errorf("wrong header: %s", header)
+	}
+
+	read, err := bloom.Read(&buf)
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	if read.M != f.M || read.K != f.K || read.Added != 10000 {
+		t.Errorf("wrong parameters read: %+v", read)
+	}
+	for i := 0; i < 10000; i++ {
+		if !read.Test("user:" + strconv.Itoa(i)) {
+			t.Fatalf("expected user:%d found", i)
+		}
+	}
+	positives := 0
+	for i := 0; i < 10000; i++ {
+		if read.Test("order:" + strconv.Itoa(i)) {
+			positives++
+		}
+	}
+	if positives > 200 {
+		t.Errorf("expected about 1%% of false positives, result: %d", positives)
+	}
+
+	for _, s := range []string{"", "rump-bloom v2 m=8 k=1 n=1 fp=0.01 added=0 hash=fnv1a64\n\x00", "rump-bloom v1 m=800 k=1 n=1 fp=0.01 added=0 hash=fnv1a64\n\x00"} {
+		if _, err := bloom.Read(strings.NewReader(s)); err == nil {
+			t.Errorf("%q should be invalid", s)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package file
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/stickermule/rump/pkg/message"
+	"github.com/stickermule/rump/pkg/rdb"
+	"github.com/stickermule/rump/pkg/resp"
+)
+
+// aofManifest is the suffix of Redis 7 multi part AOF manifests.
+const aofManifest = ".manifest"
+
+// readManifest reads the base and incremental files listed by a multi part
+// AOF manifest, in order, from its directory. History files are skipped,
+// they were rewritten into the base.
+func (f *File) readManifest(ctx context.Context, path string) error {
+	manifest, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error opening aof manifest %s: %w", path, err)
+	}
+
+	var base string
+	var incrs []string
+	for i, line := range strings.Split(string(manifest), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		// file <name> seq <n> type <b|h|i>
+		if len(fields)%2 != 0 {
+			return fmt.Errorf("error reading aof manifest %s: line %d: invalid line %q", path, i+1, line)
+		}
+		entry := map[string]string{}
+		for j := 0; j < len(fields); j += 2 {
+			entry[fields[j]] = fields[j+1]
+		}
+
+		switch entry["type"] {
+		case "b":
+			base = entry["file"]
+		case "i":
+			incrs = append(incrs, entry["file"])
+		case "h":
+		default:
+			return fmt.Errorf("error reading aof manifest %s: line %d: unknown file type %q", path, i+1, entry["type"])
+		}
+	}
+
+	files := incrs
+	if base != "" {
+		files = append([]string{base}, incrs...)
+	}
+	for _, name := range files {
+		if err := f.readAOFFile(ctx, filepath.Join(filepath.Dir(path), name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readAOFFile reads a single part of a multi part AOF.
+func (f *File) readAOFFile(ctx context.Context, path string) error {
+	d, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening file %s: %w", path, err)
+	}
+	defer d.Close()
+
+	if err := f.readAOF(ctx, d); err != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+
+	return nil
+}
+
+// readAOF reads an append-only file: the keys of its RDB preamble, if any,
+// as readRDB does, then its commands, sent to the message bus as commands
+// Payloads keyed by their first argument. SELECT switches the database
+// commands apply to, only DB ones are sent unless it's -1. MULTI and EXEC
+// aren't sent, commands are replayed one by one.
+func (f *File) readAOF(ctx context.Context, r io.Reader) error {
+	// The RDB and RESP readers share the buffer, reading on where the
+	// preamble ends.
+	br := bufio.NewReader(r)
+
+	var preamble int64
+	if magic, _ := br.Peek(5); string(magic) == "REDIS" {
+		snapshot, err := rdb.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("error reading aof rdb preamble: %w", err)
+		}
+		if err := f.readSnapshot(ctx, snapshot); err != nil {
+			return fmt.Errorf("error reading aof rdb preamble: %w", err)
+		}
+		preamble = snapshot.Offset()
+	}
+
+	cmds := resp.NewReader(br)
+	db := 0
+	for {
+		args, err := cmds.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if perr, ok := err.(*resp.ParseError); ok {
+			perr.Offset += preamble
+		}
+		if err != nil {
+			return fmt.Errorf("error reading aof file: %w", err)
+		}
+
+		switch strings.ToUpper(args[0]) {
+		case "SELECT":
+			if len(args) != 2 {
+				return fmt.Errorf("error reading aof file: invalid SELECT %q", args)
+			}
+			db, err = strconv.Atoi(args[1])
+			if err != nil {
+				return fmt.Errorf("error reading aof file: invalid SELECT database %q", args[1])
+			}
+			continue
+		case "MULTI", "EXEC":
+			continue
+		}
+		if f.DB >= 0 && db != f.DB {
+			f.Summary.Incr("other-db")
+			continue
+		}
+
+		var key string
+		if len(args) > 1 {
+			key = args[1]
+		}
+
+		select {
+		case <-ctx.Done():
+			fmt.Println("file: done")
+			return ctx.Err()
+		case f.Bus <- message.Payload{Key: key, Value: resp.Encode(args...), TTL: "0", Commands: true, DB: strconv.Itoa(db)}:
+			f.Summary.Incr("read")
+			f.logKey("file: read %s %s\n", args[0], message.FormatKey(key))
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package file
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// manifestPath is the path of the manifest listing the chunks of path.
+func manifestPath(path string) string {
+	return path + ".manifest"
+}
+
+// chunkPath is the path of the nth chunk of path, e.g. dump.rump.0001.
+func chunkPath(path string, n int) string {
+	return fmt.Sprintf("%s.%04d", path, n)
+}
+
+// chunkWriter writes records to path, or when size is set, to chunks of path
+// rotated once size would be exceeded. Records are never split across chunks.
+type chunkWriter struct {
+	path    string
+	size    int64
+	chunks  []string
+	written int64
+	d       *os.File
+	w       *bufio.Writer
+}
+
+// newChunkWriter creates the first file to write to.
+func newChunkWriter(path string, size int64) (*chunkWriter, error) {
+	c := &chunkWriter{
+		path: path,
+		size: size,
+	}
+
+	// Remove leftovers of a previous dump using the other layout,
+	// readers can then tell a chunked dump from a plain one.
+	leftover := manifestPath(path)
+	if size > 0 {
+		leftover = path
+	}
+	if err := os.Remove(leftover); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error removing %s: %w", leftover, err)
+	}
+
+	return c, c.rotate()
+}
+
+// rotate closes the current file, if any, and creates the next one.
+func (c *chunkWriter) rotate() error {
+	if err := c.closeCurrent(); err != nil {
+		return err
+	}
+
+	path := c.path
+	if c.size > 0 {
+		path = chunkPath(c.path, len(c.chunks)+1)
+	}
+
+	d, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating file %s: %w", path, err)
+	}
+
+	c.d = d
+	// Buffered write to limit system IO calls
+	c.w = bufio.NewWriter(d)
+	c.written = 0
+	c.chunks = append(c.chunks, filepath.Base(path))
+
+	return nil
+}
+
+// closeCurrent flushes and closes the current file.
+func (c *chunkWriter) closeCurrent() error {
+	if c.d == nil {
+		return nil
+	}
+
+	if err := c.w.Flush(); err != nil {
+		c.d.Close()
+		return fmt.Errorf("error flushing file %s: %w", c.d.Name(), err)
+	}
+
+	err := c.d.Close()
+	c.d = nil
+
+	return err
+}
+
+// WriteString writes a whole record, rotating beforehand if needed.
+func (c *chunkWriter) WriteString(record string) (int, error) {
+	if c.size > 0 && c.written > 0 && c.written+int64(len(record)) > c.size {
+		if err := c.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := c.w.WriteString(record)
+	c.written += int64(n)
+
+	return n, err
+}
+
+// Write writes a whole record, see WriteString.
+func (c *chunkWriter) Write(record []byte) (int, error) {
+	return c.WriteString(string(record))
+}
+
+// Close closes the last file and, when chunking, writes the manifest.
+func (c *chunkWriter) Close() error {
+	if err := c.closeCurrent(); err != nil {
+		return err
+	}
+
+	if c.size == 0 {
+		return nil
+	}
+
+	manifest := strings.Join(c.chunks, "\n") + "\n"
+	err := ioutil.WriteFile(manifestPath(c.path), []byte(manifest), 0644)
+	if err != nil {
+		return fmt.Errorf("error writing manifest for %s: %w", c.path, err)
+	}
+
+	return nil
+}
+
+// chunkReader reads path, or all the chunks listed in its manifest in order
+// when path itself doesn't exist.
+type chunkReader struct {
+	io.Reader
+	files []*os.File
+}
+
+// openChunks opens path, or its chunks.
+func openChunks(path string) (*chunkReader, error) {
+	d, err := os.Open(path)
+	if err == nil {
+		return &chunkReader{Reader: d, files: []*os.File{d}}, nil
+	}
+
+	manifest, merr := ioutil.ReadFile(manifestPath(path))
+	if merr != nil {
+		// No manifest either, report the original error.
+		return nil, fmt.Errorf("error opening file %s: %w", path, err)
+	}
+
+	c := &chunkReader{}
+	readers := []io.Reader{}
+	dir := filepath.Dir(path)
+	for _, chunk := range manifestLines(manifest) {
+		d, err := os.Open(filepath.Join(dir, chunk))
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("error opening chunk %s: %w", chunk, err)
+		}
+		c.files = append(c.files, d)
+		readers = append(readers, d)
+	}
+	c.Reader = io.MultiReader(readers...)
+
+	return c, nil
+}
+
+// manifestLines returns the file names of a manifest, one per line, kept
+// whole since file names may hold spaces.
+func manifestLines(manifest []byte) []string {
+	var names []string
+	for _, name := range strings.Split(string(manifest), "\n") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// Close closes all the opened files.
+func (c *chunkReader) Close() error {
+	for _, d := range c.files {
+		d.Close()
+	}
+
+	return nil
+}
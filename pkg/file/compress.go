@@ -0,0 +1,71 @@
+package file
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Gzip and Flate are the codecs of the values compressed in Dump records,
+// flagged by a ;z=codec suffix of their ttl field, see File.CompressAbove.
+const (
+	Gzip  = "gzip"
+	Flate = "flate"
+)
+
+// Codecs are the known value codecs.
+var Codecs = map[string]bool{
+	Gzip:  true,
+	Flate: true,
+}
+
+// compressValue compresses value with codec.
+func compressValue(codec, value string) (string, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch codec {
+	case Gzip:
+		w = gzip.NewWriter(&buf)
+	case Flate:
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	default:
+		return "", fmt.Errorf("unknown codec %s", codec)
+	}
+	if _, err := io.WriteString(w, value); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// decompressValue decompresses a value compressed with codec.
+func decompressValue(codec, value string) (string, error) {
+	var r io.ReadCloser
+	switch codec {
+	case Gzip:
+		gz, err := gzip.NewReader(strings.NewReader(value))
+		if err != nil {
+			return "", err
+		}
+		r = gz
+	case Flate:
+		r = flate.NewReader(strings.NewReader(value))
+	default:
+		return "", fmt.Errorf("unknown codec %s", codec)
+	}
+	defer r.Close()
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
@@ -1,24 +1,95 @@
 // Package file allows reading/writing from/to a Rump file.
 // Rump file protocol is key✝✝value✝✝ttl✝✝key✝✝value✝✝ttl✝✝...
+// The ttl field may carry the LRU/LFU metadata and the source database of the
+// key, as ;name=value suffixes, e.g. 30000;idle=120 or 0;freq=5;db=1, absent
+// from older dumps, and the codec of compressed values, e.g. 0;z=gzip.
 package file
 
 import (
 	"bufio"
 	"context"
 	"fmt"
-	"os"
+	"io"
+	"sort"
 	"strings"
+	"sync/atomic"
 
+	"github.com/stickermule/rump/pkg/filter"
 	"github.com/stickermule/rump/pkg/message"
+	"github.com/stickermule/rump/pkg/resp"
+	"github.com/stickermule/rump/pkg/summary"
 )
 
+// Dump is the default Format, storing DUMP payloads in the Rump protocol.
+const Dump = "dump"
+
+// Commands is the Format storing the RESP commands recreating each key,
+// portable across Redis versions and replayable with redis-cli --pipe.
+// Reading it accepts any redis-cli compatible command stream.
+const Commands = "commands"
+
+// RDB is the read only Format of Redis RDB snapshots, e.g. dump.rdb.
+const RDB = "rdb"
+
+// AOF is the read only Format of Redis append-only files, e.g.
+// appendonly.aof, with or without an RDB preamble, or of the manifest of a
+// Redis 7 multi part AOF, e.g. appendonly.aof.manifest.
+const AOF = "aof"
+
+// Tar is the Format of tar archives of a file per key, its DUMP payload,
+// with a JSON sidecar of the key name and TTL, see tar.go. Archives ending
+// in .gz or .tgz are gzipped.
+const Tar = "tar"
+
 // File can read and write, to a file Path, using the message Bus.
+// Format is either Dump (default), Commands, RDB, AOF or Tar.
+// DB is the RDB or AOF database read, -1 for all of them.
+// TargetVersion is the RDB version of the target, the snapshot one when 0:
+// keys it can't RESTORE are sent as commands.
+// ChunkSize, when set, rotates written files once they reach that many bytes.
+// Shards, when above 1, writes to that many files in parallel, by key hash.
+// PartitionByType writes a file per key type, e.g. dump.rump.hash, from the
+// Payloads Type.
+// Types, when set, only reads the partitions of these key types.
+// Filter selects the RDB keys read, client-side.
+// LogEvery, when above 1, only logs the read and write lines of every
+// LogEvery key.
+// Sort reads all Payloads in memory, then sends them sorted by key.
+// QuietErrors only counts skipped keys, without logging them.
+// Checksums writes the checksums manifest of the dump, SumsPath.
+// CompressAbove, when set, compresses the values of Dump records of at least
+// that many bytes with Codec, when it makes them smaller.
+// Serializer is the name of the Serializers encoding written Dump records,
+// Native when empty. Reads select theirs from the file header.
+// Base, when set, is the checksums manifest of a base dump: only keys changed
+// since are written, and tombstones of the ones deleted, see incremental.go.
+// Summary collects the run counters.
 type File struct {
-	Path   string
-	Bus    message.Bus
-	Silent bool
-	TTL    bool
-	MaxBuf int
+	Path            string
+	Bus             message.Bus
+	Silent          bool
+	TTL             bool
+	MaxBuf          int
+	Format          string
+	DB              int
+	TargetVersion   int
+	ChunkSize       int64
+	Shards          int
+	PartitionByType bool
+	Types           []string
+	Filter          filter.Filter
+	Sort            bool
+	Checksums       bool
+	CompressAbove   int
+	Codec           string
+	Serializer      string
+	Base            string
+	LogEvery        int
+	QuietErrors     bool
+	Summary         *summary.Summary
+
+	// logged counts the keys logKey was called for, by concurrent shards.
+	logged int64
 }
 
 // splitCross is a double-cross (✝✝) custom Scanner Split.
@@ -49,6 +120,15 @@ func New(path string, bus message.Bus, silent, ttl bool, maxBuf int) *File {
 	}
 }
 
+// logKey logs a per-key line, unless silent, for every LogEvery key.
+func (f *File) logKey(format string, args ...interface{}) {
+	n := atomic.AddInt64(&f.logged, 1)
+	if f.LogEvery > 1 && n%int64(f.LogEvery) != 0 {
+		return
+	}
+	f.maybeLog(fmt.Sprintf(format, args...))
+}
+
 // Log read/write operations unless silent mode enabled
 func (f *File) maybeLog(s string) {
 	if f.Silent {
@@ -57,83 +137,290 @@ func (f *File) maybeLog(s string) {
 	fmt.Print(s)
 }
 
-// Read scans a Rump file and sends Payloads to the message bus.
+// logError logs a per-key skip line, Silent or not, unless QuietErrors.
+func (f *File) logError(format string, args ...interface{}) {
+	if f.QuietErrors {
+		return
+	}
+	fmt.Printf(format, args...)
+}
+
+// Read scans a Rump file, its chunks, its shards or its type partitions, and
+// sends Payloads to the message bus.
 func (f *File) Read(ctx context.Context) error {
+	if f.Sort {
+		return f.readSorted(ctx)
+	}
+	defer close(f.Bus)
+
+	shards, err := readShards(f.Path)
+	if err != nil {
+		return err
+	}
+	if shards != nil {
+		shards, err = selectTypes(f.Path, shards, f.Types)
+		if err != nil {
+			return err
+		}
+		return f.readShards(ctx, shards)
+	}
+	if len(f.Types) > 0 {
+		return fmt.Errorf("%s isn't partitioned by type", f.Path)
+	}
+
+	return f.read(ctx, f.Path)
+}
+
+// readSorted reads all Payloads, then sends them to the message bus sorted
+// by key, in the order they were read for the same key.
+func (f *File) readSorted(ctx context.Context) error {
 	defer close(f.Bus)
 
-	d, err := os.Open(f.Path)
+	unsorted := *f
+	unsorted.Sort = false
+	unsorted.Bus = make(message.Bus, 100)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- unsorted.Read(ctx)
+	}()
+
+	var payloads []message.Payload
+	for p := range unsorted.Bus {
+		payloads = append(payloads, p)
+	}
+	if err := <-errs; err != nil {
+		return err
+	}
+
+	sort.SliceStable(payloads, func(i, j int) bool { return payloads[i].Key < payloads[j].Key })
+	fmt.Printf("file: sorted %d keys\n", len(payloads))
+
+	for _, p := range payloads {
+		select {
+		case <-ctx.Done():
+			fmt.Println("file: done")
+			return ctx.Err()
+		case f.Bus <- p:
+		}
+	}
+
+	return nil
+}
+
+// read scans a single Rump file, or its chunks.
+func (f *File) read(ctx context.Context, path string) error {
+	if f.Format == AOF && strings.HasSuffix(path, aofManifest) {
+		return f.readManifest(ctx, path)
+	}
+	if f.Format == Tar {
+		return f.readTar(ctx, path)
+	}
+
+	d, err := openChunks(path)
 	if err != nil {
-		return fmt.Errorf("error opening file %s: %W", f.Path, err)
+		return err
 	}
 	defer d.Close()
 
-	// Scan file, split by double-cross separator
-	scanner := bufio.NewScanner(d)
-	buf := make([]byte, 0, bufio.MaxScanTokenSize)
-	scanner.Buffer(buf, f.MaxBuf)
-	scanner.Split(splitCross)
-
-	// Scan line by line
-	// file protocol is key✝✝value✝✝ttl✝✝
-	for scanner.Scan() {
-		// Get key
-		key := scanner.Text()
-		// trigger next scan to get value
-		scanner.Scan()
-		value := scanner.Text()
-		// trigger next scan to get ttl
-		scanner.Scan()
-		ttl := scanner.Text()
+	switch f.Format {
+	case Commands:
+		return f.readCommands(ctx, d)
+	case RDB:
+		return f.readRDB(ctx, d)
+	case AOF:
+		return f.readAOF(ctx, d)
+	}
+
+	// Records are decoded by the Serializer of the file header
+	r := bufio.NewReader(d)
+	s, _, err := readHeader(r)
+	if err != nil {
+		return err
+	}
+	dec := s.NewDecoder(r, f.MaxBuf)
+	for {
+		p, err := dec.Decode()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading from file: %w", err)
+		}
+		select {
+		case <-ctx.Done():
+			fmt.Println("file: done")
+			return ctx.Err()
+		case f.Bus <- p:
+			f.Summary.Incr("read")
+			f.logKey("file: read %s => ttl=%s, size=%d\n", message.FormatKey(p.Key), p.TTL, len(p.Value))
+		}
+	}
+}
+
+// readCommands parses a RESP command stream, and sends each command to the
+// message bus as a Payload keyed by its first argument.
+func (f *File) readCommands(ctx context.Context, r io.Reader) error {
+	cmds := resp.NewReader(r)
+
+	for {
+		args, err := cmds.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading commands from file: %w", err)
+		}
+
+		var key string
+		if len(args) > 1 {
+			key = args[1]
+		}
+
 		select {
 		case <-ctx.Done():
 			fmt.Println("file: done")
 			return ctx.Err()
-		case f.Bus <- message.Payload{Key: key, Value: value, TTL: ttl}:
-			fmt.Printf("file: read %s => ttl=%s, size=%d\n", key, ttl, len(value))
+		case f.Bus <- message.Payload{Key: key, Value: resp.Encode(args...), TTL: "0"}:
+			f.Summary.Incr("read")
+			f.logKey("file: read %s %s\n", args[0], message.FormatKey(key))
 		}
 	}
+}
 
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error reading from file: %W", err)
+// ttlField returns the ttl field of p, followed by its LRU/LFU metadata and
+// source database when known.
+func ttlField(p message.Payload) string {
+	field := p.TTL
+	if p.Idle != "" {
+		field += ";idle=" + p.Idle
+	}
+	if p.Freq != "" {
+		field += ";freq=" + p.Freq
+	}
+	if p.DB != "" {
+		field += ";db=" + p.DB
 	}
 
-	return nil
+	return field
 }
 
-// Write writes to a Rump file Payloads from the message bus.
+// parseTTLField splits a ttl field in the TTL, the LRU/LFU metadata, the
+// source database of the key and the codec of its value, empty when absent.
+// Unknown metadata is ignored.
+func parseTTLField(field string) (ttl, idle, freq, db, codec string) {
+	parts := strings.Split(field, ";")
+	for _, part := range parts[1:] {
+		i := strings.Index(part, "=")
+		if i < 0 {
+			continue
+		}
+		switch part[:i] {
+		case "idle":
+			idle = part[i+1:]
+		case "freq":
+			freq = part[i+1:]
+		case "db":
+			db = part[i+1:]
+		case "z":
+			codec = part[i+1:]
+		}
+	}
+
+	return parts[0], idle, freq, db, codec
+}
+
+// Write writes to a Rump file, its chunks, its shards or its type partitions,
+// Payloads from the message bus.
 func (f *File) Write(ctx context.Context) error {
-	d, err := os.Create(f.Path)
+	if f.PartitionByType {
+		return f.writeTypes(ctx)
+	}
+	if f.Shards > 1 {
+		return f.writeShards(ctx)
+	}
+
+	// Remove leftovers of a previous sharded dump.
+	if err := removeShards(f.Path); err != nil {
+		return err
+	}
+
+	return f.write(ctx, f.Bus, f.Path)
+}
+
+// write writes Payloads from bus to a single Rump file, or its chunks.
+func (f *File) write(ctx context.Context, bus message.Bus, path string) (err error) {
+	if f.Format == Tar {
+		return f.writeTar(ctx, bus, path)
+	}
+
+	w, err := newChunkWriter(path, f.ChunkSize)
 	if err != nil {
-		return fmt.Errorf("error creating file %s: %W", f.Path, err)
+		return err
 	}
-	defer d.Close()
 
-	// Buffered write to limit system IO calls
-	w := bufio.NewWriter(d)
+	// Flush last open buffers, write manifest
+	defer func() {
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+	}()
 
-	// Flush last open buffers
-	defer w.Flush()
+	enc, err := f.encoder(w)
+	if err != nil {
+		return err
+	}
+
+	var sums *checksums
+	if f.Checksums {
+		sums, err = newChecksums(SumsPath(path), f.Base)
+		if err != nil {
+			return err
+		}
+		defer sums.remove()
+	}
 
-	for f.Bus != nil {
+	for bus != nil {
 		select {
 		// Exit early if context done.
 		case <-ctx.Done():
 			fmt.Println("file: done")
 			return ctx.Err()
 		// Get Messages from Bus
-		case p, ok := <-f.Bus:
+		case p, ok := <-bus:
 			// if channel closed, set to nil, break loop
 			if !ok {
-				f.Bus = nil
+				bus = nil
 				continue
 			}
-			_, err := w.WriteString(p.Key + "✝✝" + p.Value + "✝✝" + p.TTL + "✝✝")
-			if err != nil {
-				return fmt.Errorf("error writing key '%s' to file with size %d: %W", p.Key, len(p.Value), err)
+			f.Summary.Track(p.Key)
+			if sums != nil {
+				changed, err := sums.changed(p)
+				if err != nil {
+					return err
+				}
+				if !changed {
+					f.Summary.Incr("unchanged")
+					continue
+				}
+			}
+			if err := enc.Encode(p); err != nil {
+				return fmt.Errorf("error writing key %s to file with size %d: %w", message.FormatKey(p.Key), len(p.Value), err)
 			}
-			fmt.Printf("file: write %s => ttl=%s, size=%d\n", p.Key, p.TTL, len(p.Value))
+			f.Summary.Incr("written")
+			f.logKey("file: write %s => ttl=%s, size=%d\n", message.FormatKey(p.Key), p.TTL, len(p.Value))
 		}
 	}
 
-	return nil
+	if sums == nil {
+		return nil
+	}
+	for _, key := range sums.deleted() {
+		if err := enc.Encode(message.Payload{Key: key, Tombstone: true}); err != nil {
+			return fmt.Errorf("error writing tombstone of key %s to file: %w", message.FormatKey(key), err)
+		}
+		f.Summary.Incr("tombstones")
+		f.logKey("file: write tombstone %s\n", message.FormatKey(key))
+	}
+
+	return sums.Close()
 }
@@ -5,10 +5,18 @@
 package file_test
 
 import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
 	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/mediocregopher/radix/v3"
@@ -16,6 +24,8 @@ import (
 	"github.com/stickermule/rump/pkg/file"
 	"github.com/stickermule/rump/pkg/message"
 	"github.com/stickermule/rump/pkg/redis"
+	"github.com/stickermule/rump/pkg/resp"
+	"github.com/stickermule/rump/pkg/summary"
 )
 
 var db1 *radix.Pool
@@ -25,6 +35,9 @@ var expected map[string]string
 var path string
 var ctx context.Context
 
+// maxBuf is the config default file read buffer.
+const maxBuf = 20 * 1024 * 1024
+
 func setup() {
 	db1, _ = radix.NewPool("tcp", "redis://redis:6379/5", 1)
 	db2, _ = radix.NewPool("tcp", "redis://redis:6379/6", 1)
@@ -46,8 +59,12 @@ func teardown() {
 	// Reset test dbs
 	db1.Do(radix.Cmd(nil, "FLUSHDB"))
 	db2.Do(radix.Cmd(nil, "FLUSHDB"))
-	// Delete dump file
+	// Delete dump files
 	os.Remove(path)
+	files, _ := filepath.Glob(path + ".*")
+	for _, f := range files {
+		os.Remove(f)
+	}
 }
 
 func TestMain(m *testing.M) {
@@ -65,7 +82,7 @@ func TestWriteRead(t *testing.T) {
 	}
 
 	// Write rump dump from shared message bus
-	target := file.New(path, ch, false, false)
+	target := file.New(path, ch, false, false, maxBuf)
 	if err := target.Write(ctx); err != nil {
 		t.Error("error: ", err)
 	}
@@ -74,7 +91,7 @@ func TestWriteRead(t *testing.T) {
 	ch2 := make(message.Bus, 100)
 
 	// Read rump dump file
-	source2 := file.New(path, ch2, false, false)
+	source2 := file.New(path, ch2, false, false, maxBuf)
 	if err := source2.Read(ctx); err != nil {
 		t.Error("error: ", err)
 	}
@@ -98,3 +115,973 @@ func TestWriteRead(t *testing.T) {
 		t.Errorf("expected: %v, result: %v", expected, result)
 	}
 }
+
+// Test exporting to the commands format, and replaying it on db2
+func TestWriteReadCommands(t *testing.T) {
+	db2.Do(radix.Cmd(nil, "FLUSHDB"))
+	ch := make(message.Bus, 100)
+
+	source := redis.New(db1, ch, false, false)
+	source.Commands = true
+	if err := source.Read(ctx); err != nil {
+		t.Error("error: ", err)
+	}
+
+	target := file.New(path, ch, false, false, maxBuf)
+	target.Format = file.Commands
+	if err := target.Write(ctx); err != nil {
+		t.Error("error: ", err)
+	}
+
+	ch2 := make(message.Bus, 100)
+	source2 := file.New(path, ch2, false, false, maxBuf)
+	source2.Format = file.Commands
+	if err := source2.Read(ctx); err != nil {
+		t.Error("error: ", err)
+	}
+
+	target2 := redis.New(db2, ch2, false, false)
+	target2.Commands = true
+	if err := target2.Write(ctx); err != nil {
+		t.Error("error: ", err)
+	}
+
+	result := map[string]string{}
+	var v string
+	for k := range expected {
+		db2.Do(radix.Cmd(&v, "GET", k))
+		result[k] = v
+	}
+
+	if !reflect.DeepEqual(expected, result) {
+		t.Errorf("expected: %v, result: %v", expected, result)
+	}
+}
+
+// Test malformed command streams report their position
+func TestReadCommandsError(t *testing.T) {
+	p := filepath.Join(os.TempDir(), "rump-bad.resp")
+	defer os.Remove(p)
+	if err := ioutil.WriteFile(p, []byte("PING\r\n*2\r\n$3\r\nGET\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	source := file.New(p, make(message.Bus, 100), false, false, maxBuf)
+	source.Format = file.Commands
+	err := source.Read(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "line 5, offset 19") {
+		t.Errorf("expected a positioned parse error, got %v", err)
+	}
+}
+
+// Test RDB keys the target predates are recreated with commands, others
+// sent as DUMP payloads of the target version
+func TestReadRDB(t *testing.T) {
+	p := filepath.Join(os.TempDir(), "rump.rdb")
+	defer os.Remove(p)
+	hash := "\x0d\x00\x00\x00\x02\x00\x81f\x02\x81v\x02\xff"
+	snapshot := "REDIS0011" +
+		"\x00\x01s\x01v" +
+		"\x10\x01h\x0d" + hash +
+		"\xff\x00\x00\x00\x00\x00\x00\x00\x00"
+	if err := ioutil.WriteFile(p, []byte(snapshot), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	bus := make(message.Bus, 100)
+	source := file.New(p, bus, false, false, maxBuf)
+	source.Format = file.RDB
+	source.TargetVersion = 9
+	if err := source.Read(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	s := <-bus
+	if s.Commands || s.Value[:4] != "\x00\x01v\x09" {
+		t.Errorf("expected a version 9 DUMP payload, got %q", s.Value)
+	}
+	h := <-bus
+	expected := resp.Encode("DEL", "h") + resp.Encode("HSET", "h", "f", "v")
+	if !h.Commands || h.Value != expected {
+		t.Errorf("expected: %q, result: %q", expected, h.Value)
+	}
+}
+
+func TestWriteReadChunked(t *testing.T) {
+	ch := make(message.Bus, 100)
+
+	// Read all keys from db1, push to shared message bus
+	source := redis.New(db1, ch, false, false)
+	if err := source.Read(ctx); err != nil {
+		t.Error("error: ", err)
+	}
+
+	// Write rump dump chunks from shared message bus
+	target := file.New(path, ch, false, false, maxBuf)
+	target.ChunkSize = 100
+	if err := target.Write(ctx); err != nil {
+		t.Error("error: ", err)
+	}
+
+	// Every chunk is listed in the manifest, none exceeds the chunk size
+	// unless it holds a single record.
+	manifest, err := ioutil.ReadFile(path + ".manifest")
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	chunks := strings.Fields(string(manifest))
+	if len(chunks) < 2 {
+		t.Errorf("expected multiple chunks, got %v", chunks)
+	}
+	for _, c := range chunks {
+		data, err := ioutil.ReadFile(filepath.Join(filepath.Dir(path), c))
+		if err != nil {
+			t.Error("error: ", err)
+		}
+		if len(data) > 100 && strings.Count(string(data), "✝✝") > 3 {
+			t.Errorf("chunk %s exceeds chunk size", c)
+		}
+	}
+
+	// Read rump dump chunks
+	ch2 := make(message.Bus, 100)
+	source2 := file.New(path, ch2, false, false, maxBuf)
+	if err := source2.Read(ctx); err != nil {
+		t.Error("error: ", err)
+	}
+
+	// Write from shared message bus to db2
+	target2 := redis.New(db2, ch2, false, false)
+	if err := target2.Write(ctx); err != nil {
+		t.Error("error: ", err)
+	}
+
+	// Compare db1 keys with db2 keys
+	result := map[string]string{}
+	var v string
+	for k := range expected {
+		db2.Do(radix.Cmd(&v, "GET", k))
+		result[k] = v
+	}
+
+	if !reflect.DeepEqual(expected, result) {
+		t.Errorf("expected: %v, result: %v", expected, result)
+	}
+}
+
+// Test incremental dumps only write changed keys, and tombstones of deleted
+// ones, read back as Tombstone Payloads
+func TestWriteReadIncremental(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rump-incremental")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dump := func(path, base string, payloads ...message.Payload) {
+		ch := make(message.Bus, 100)
+		for _, p := range payloads {
+			ch <- p
+		}
+		close(ch)
+		target := file.New(path, ch, false, false, maxBuf)
+		target.Checksums = true
+		target.Base = base
+		if err := target.Write(context.Background()); err != nil {
+			t.Fatal("error: ", err)
+		}
+	}
+
+	full := filepath.Join(dir, "full.rump")
+	dump(full, "",
+		message.Payload{Key: "a", Value: "v1", TTL: "0"},
+		message.Payload{Key: "b", Value: "v1", TTL: "0"},
+		message.Payload{Key: "c", Value: "v1", TTL: "0"},
+	)
+	incremental := filepath.Join(dir, "incremental.rump")
+	dump(incremental, file.SumsPath(full),
+		message.Payload{Key: "a", Value: "v1", TTL: "0"},
+		message.Payload{Key: "b", Value: "v2", TTL: "0"},
+		message.Payload{Key: "d", Value: "v1", TTL: "0"},
+	)
+
+	data, _ := ioutil.ReadFile(incremental)
+	if string(data) != "b✝✝v2✝✝0✝✝d✝✝v1✝✝0✝✝c✝✝✝✝tombstone✝✝" {
+		t.Errorf("wrong incremental dump: %s", data)
+	}
+	sums, _ := ioutil.ReadFile(file.SumsPath(incremental))
+	if n := strings.Count(string(sums), "\n"); n != 3 {
+		t.Errorf("expected the checksums of the 3 keys, got %s", sums)
+	}
+
+	ch := make(message.Bus, 100)
+	source := file.New(incremental, ch, false, false, maxBuf)
+	if err := source.Read(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+	var got []message.Payload
+	for p := range ch {
+		got = append(got, p)
+	}
+	if len(got) != 3 || got[2].Key != "c" || !got[2].Tombstone || got[0].Tombstone {
+		t.Errorf("wrong payloads: %+v", got)
+	}
+}
+
+// Test dump records are validated one by one, with the offset of problems
+func TestValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rump-validate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dump.rump")
+
+	// A valid DUMP payload of the string "10", RDB version 9
+	valid := "\x00\xc0\n\t\x00\xbem\x06\x89Z(\x00\n"
+	corrupted := "\x00\xc0\x0b\t\x00\xbem\x06\x89Z(\x00\n"
+	records := "a✝✝" + valid + "✝✝0✝✝" +
+		"b✝✝" + corrupted + "✝✝0✝✝" +
+		"c✝✝" + valid + "✝✝-5✝✝" +
+		"d✝✝✝✝tombstone✝✝" +
+		"e✝✝" + valid
+	if err := ioutil.WriteFile(path, []byte(records), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := file.New(path, nil, false, false, maxBuf).Validate(context.Background())
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	if v.Records != 4 || v.Bytes != int64(3*len(valid)) {
+		t.Errorf("wrong counts: records=%d bytes=%d", v.Records, v.Bytes)
+	}
+	b := len("a✝✝" + valid + "✝✝0✝✝")
+	c := b + len("b✝✝"+corrupted+"✝✝0✝✝")
+	e := c + len("c✝✝"+valid+"✝✝-5✝✝") + len("d✝✝✝✝tombstone✝✝")
+	expected := []string{
+		fmt.Sprintf("dump.rump: offset %d: key \"b\": wrong CRC64", b),
+		fmt.Sprintf("dump.rump: offset %d: key \"c\": invalid TTL \"-5\"", c),
+		fmt.Sprintf("dump.rump: offset %d: truncated record", e),
+	}
+	if len(v.Problems) != len(expected) {
+		t.Fatalf("expected %d problems, got %v", len(expected), v.Problems)
+	}
+	for i, p := range v.Problems {
+		if !strings.HasPrefix(p, expected[i]) {
+			t.Errorf("expected: %s, result: %s", expected[i], p)
+		}
+	}
+
+	// Checksums are verified when the dump has them
+	if err := ioutil.WriteFile(path, []byte("a✝✝"+valid+"✝✝0✝✝"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file.SumsPath(path), []byte(`{"key":"a","sum":"0000"}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	v, err = file.New(path, nil, false, false, maxBuf).Validate(context.Background())
+	if err != nil || len(v.Problems) != 1 || !strings.HasSuffix(v.Problems[0], "checksum mismatch") {
+		t.Errorf("expected a checksum mismatch, got %v, %v", v.Problems, err)
+	}
+
+	// Other formats stop at their reader first error
+	resp := filepath.Join(dir, "dump.resp")
+	if err := ioutil.WriteFile(resp, []byte("*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\n1\r\n*2\r\n$3\r\nDEL"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	source := file.New(resp, nil, false, false, maxBuf)
+	source.Format = file.Commands
+	v, err = source.Validate(context.Background())
+	if err != nil || v.Records != 1 || len(v.Problems) != 1 {
+		t.Errorf("expected 1 record and 1 problem, got %d, %v, %v", v.Records, v.Problems, err)
+	}
+}
+
+// Test the LRU/LFU metadata of dump records round-trips, older dumps without
+// it reading as before
+func TestWriteReadMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rump-metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dump.rump")
+
+	payloads := []message.Payload{
+		{Key: "a", Value: "v1", TTL: "0", Idle: "120"},
+		{Key: "b", Value: "v2", TTL: "3000", Freq: "5"},
+		{Key: "c", Value: "v3", TTL: "0"},
+		{Key: "d", Value: "v4", TTL: "0", Freq: "1", DB: "2"},
+	}
+	ch := make(message.Bus, 100)
+	for _, p := range payloads {
+		ch <- p
+	}
+	close(ch)
+	if err := file.New(path, ch, false, false, maxBuf).Write(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	if string(data) != "a✝✝v1✝✝0;idle=120✝✝b✝✝v2✝✝3000;freq=5✝✝c✝✝v3✝✝0✝✝d✝✝v4✝✝0;freq=1;db=2✝✝" {
+		t.Errorf("wrong dump: %s", data)
+	}
+
+	read := func() []message.Payload {
+		ch := make(message.Bus, 100)
+		if err := file.New(path, ch, false, false, maxBuf).Read(context.Background()); err != nil {
+			t.Fatal("error: ", err)
+		}
+		var got []message.Payload
+		for p := range ch {
+			got = append(got, p)
+		}
+		return got
+	}
+	if got := read(); !reflect.DeepEqual(got, payloads) {
+		t.Errorf("expected: %+v, result: %+v", payloads, got)
+	}
+
+	// Older dumps, and unknown metadata of newer ones
+	old := "a✝✝v1✝✝0✝✝b✝✝v2✝✝3000;idle=7;other=1✝✝"
+	if err := ioutil.WriteFile(path, []byte(old), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expected := []message.Payload{
+		{Key: "a", Value: "v1", TTL: "0"},
+		{Key: "b", Value: "v2", TTL: "3000", Idle: "7"},
+	}
+	if got := read(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected: %+v, result: %+v", expected, got)
+	}
+
+	// Invalid metadata is reported by Validate
+	valid := "\x00\xc0\n\t\x00\xbem\x06\x89Z(\x00\n"
+	records := "a✝✝" + valid + "✝✝0;idle=120✝✝b✝✝" + valid + "✝✝0;freq=300✝✝c✝✝" + valid + "✝✝0;idle=x✝✝"
+	if err := ioutil.WriteFile(path, []byte(records), 0644); err != nil {
+		t.Fatal(err)
+	}
+	v, err := file.New(path, nil, false, false, maxBuf).Validate(context.Background())
+	if err != nil || len(v.Problems) != 2 ||
+		!strings.HasSuffix(v.Problems[0], `invalid LFU frequency "300"`) ||
+		!strings.HasSuffix(v.Problems[1], `invalid idle time "x"`) {
+		t.Errorf("expected 2 invalid metadata problems, got %v, %v", v.Problems, err)
+	}
+}
+
+// Test writing a gzipped tar archive of a file per key, unsafe key names
+// hashed, and reading it back
+func TestWriteReadTar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rump-tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dump.tar.gz")
+
+	payloads := []message.Payload{
+		{Key: "user:1", Value: "v1", TTL: "0", Idle: "120"},
+		{Key: "../etc/passwd", Value: "v2", TTL: "3000"},
+		{Key: "a.json", Value: "v3", TTL: "0", Freq: "5", DB: "1"},
+	}
+	ch := make(message.Bus, 100)
+	for _, p := range payloads {
+		ch <- p
+	}
+	close(ch)
+	write := file.New(path, ch, true, false, maxBuf)
+	write.Format = file.Tar
+	if err := write.Write(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	d, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	gz, err := gzip.NewReader(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, hdr.Name)
+	}
+	if len(names) != 6 || names[0] != "keys/user:1.json" || names[1] != "keys/user:1" ||
+		!strings.HasPrefix(names[3], "hashed/") || !strings.HasPrefix(names[5], "hashed/") {
+		t.Errorf("wrong archive entries: %v", names)
+	}
+
+	read := make(message.Bus, 100)
+	r := file.New(path, read, true, false, maxBuf)
+	r.Format = file.Tar
+	if err := r.Read(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+	var got []message.Payload
+	for p := range read {
+		got = append(got, p)
+	}
+	if !reflect.DeepEqual(got, payloads) {
+		t.Errorf("expected: %+v, result: %+v", payloads, got)
+	}
+}
+
+// Test binary and UTF-8 key names of tar archives are named after their hex
+// or base64 encoding with those key encodings, and read back raw
+func TestWriteReadTarKeyEncoding(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rump-tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func() { message.KeyEncoding = message.KeyQuoted }()
+
+	payloads := []message.Payload{
+		{Key: "line\nbreak", Value: "v1", TTL: "0"},
+		{Key: "nul\x00key", Value: "v2", TTL: "0"},
+		{Key: "clé:été", Value: "v3", TTL: "0"},
+	}
+	expected := map[string][]string{
+		message.KeyHex:    {"hex/6c696e650a627265616b", "hex/6e756c006b6579", "hex/636cc3a93ac3a974c3a9"},
+		message.KeyBase64: {"base64/bGluZQpicmVhaw", "base64/bnVsAGtleQ", "base64/Y2zDqTrDqXTDqQ"},
+		message.KeyQuoted: {"hashed/", "hashed/", "hashed/"},
+	}
+	for encoding, prefixes := range expected {
+		message.KeyEncoding = encoding
+		path := filepath.Join(dir, encoding+".tar")
+		ch := make(message.Bus, 100)
+		for _, p := range payloads {
+			ch <- p
+		}
+		close(ch)
+		write := file.New(path, ch, true, false, maxBuf)
+		write.Format = file.Tar
+		if err := write.Write(context.Background()); err != nil {
+			t.Fatal("error: ", err)
+		}
+
+		d, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		tr := tar.NewReader(d)
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				break
+			}
+			if !strings.HasSuffix(hdr.Name, ".json") {
+				names = append(names, hdr.Name)
+			}
+		}
+		d.Close()
+		for i, prefix := range prefixes {
+			if len(names) != len(prefixes) || !strings.HasPrefix(names[i], prefix) {
+				t.Fatalf("%s: wrong archive entries: %v", encoding, names)
+			}
+		}
+
+		read := make(message.Bus, 100)
+		r := file.New(path, read, true, false, maxBuf)
+		r.Format = file.Tar
+		if err := r.Read(context.Background()); err != nil {
+			t.Fatal("error: ", err)
+		}
+		var got []message.Payload
+		for p := range read {
+			got = append(got, p)
+		}
+		if !reflect.DeepEqual(got, payloads) {
+			t.Errorf("%s: expected: %+v, result: %+v", encoding, payloads, got)
+		}
+	}
+}
+
+// Test values past the threshold are compressed, flagged in their record,
+// then decompressed once read
+func TestWriteReadCompressed(t *testing.T) {
+	for _, codec := range []string{file.Gzip, file.Flate} {
+		dir, err := ioutil.TempDir("", "rump-compressed")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "dump.rump")
+
+		large := strings.Repeat("value", 100)
+		payloads := []message.Payload{
+			{Key: "small", Value: "v1", TTL: "0"},
+			{Key: "large", Value: large, TTL: "3000", Idle: "5"},
+		}
+		ch := make(message.Bus, 100)
+		for _, p := range payloads {
+			ch <- p
+		}
+		close(ch)
+		write := file.New(path, ch, true, false, maxBuf)
+		write.CompressAbove = 100
+		write.Codec = codec
+		write.Summary = summary.New()
+		if err := write.Write(context.Background()); err != nil {
+			t.Fatal("error: ", err)
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), "small✝✝v1✝✝0✝✝") || !strings.Contains(string(data), "✝✝3000;idle=5;z="+codec+"✝✝") ||
+			strings.Contains(string(data), large) {
+			t.Errorf("wrong %s records: %q", codec, data)
+		}
+		if n := write.Summary.Get("compressed"); n != 1 {
+			t.Errorf("expected 1 compressed value, result: %d", n)
+		}
+
+		read := make(message.Bus, 100)
+		r := file.New(path, read, true, false, maxBuf)
+		if err := r.Read(context.Background()); err != nil {
+			t.Fatal("error: ", err)
+		}
+		var got []message.Payload
+		for p := range read {
+			got = append(got, p)
+		}
+		if !reflect.DeepEqual(got, payloads) {
+			t.Errorf("expected: %+v, result: %+v", payloads, got)
+		}
+	}
+}
+
+// lines is a test Serializer, of a Go quoted key, value and TTL per line.
+type lines struct{}
+
+type linesCodec struct {
+	w       io.Writer
+	scanner *bufio.Scanner
+}
+
+func (lines) NewEncoder(w io.Writer) file.Encoder {
+	return linesCodec{w: w}
+}
+
+func (lines) NewDecoder(r io.Reader, maxBuf int) file.Decoder {
+	return linesCodec{scanner: bufio.NewScanner(r)}
+}
+
+func (c linesCodec) Encode(p message.Payload) error {
+	_, err := fmt.Fprintf(c.w, "%q %q %q\n", p.Key, p.Value, p.TTL)
+	return err
+}
+
+func (c linesCodec) Decode() (message.Payload, error) {
+	if !c.scanner.Scan() {
+		return message.Payload{}, io.EOF
+	}
+	var p message.Payload
+	_, err := fmt.Sscanf(c.scanner.Text(), "%q %q %q", &p.Key, &p.Value, &p.TTL)
+	return p, err
+}
+
+func TestSerializers(t *testing.T) {
+	file.RegisterSerializer("lines", lines{})
+	dir, err := ioutil.TempDir("", "rump-serializers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	payloads := []message.Payload{
+		{Key: "key1", Value: "\x00\xffvalue1", TTL: "0"},
+		{Key: "key\xfe2", Value: "value2", TTL: "3000"},
+	}
+	for _, name := range []string{file.Native, file.JSONL, "lines"} {
+		path := filepath.Join(dir, name+".rump")
+		ch := make(message.Bus, 100)
+		for _, p := range payloads {
+			ch <- p
+		}
+		close(ch)
+		write := file.New(path, ch, true, false, maxBuf)
+		write.Serializer = name
+		if err := write.Write(context.Background()); err != nil {
+			t.Fatal("error: ", err)
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header := strings.HasPrefix(string(data), "#rump-serializer "+name+"\n"); header == (name == file.Native) {
+			t.Errorf("%s header expected: %v, result: %q", name, name != file.Native, data)
+		}
+
+		// Reads select the serializer from the header
+		read := make(message.Bus, 100)
+		if err := file.New(path, read, true, false, maxBuf).Read(context.Background()); err != nil {
+			t.Fatal("error: ", err)
+		}
+		var got []message.Payload
+		for p := range read {
+			got = append(got, p)
+		}
+		if !reflect.DeepEqual(got, payloads) {
+			t.Errorf("%s expected: %+v, result: %+v", name, payloads, got)
+		}
+	}
+
+	// JSONL tombstones
+	path := filepath.Join(dir, "incremental.rump")
+	if err := ioutil.WriteFile(path, []byte("#rump-serializer jsonl\n{\"key\":\"gone\",\"ttl\":\"0\",\"tombstone\":true}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	read := make(message.Bus, 100)
+	if err := file.New(path, read, true, false, maxBuf).Read(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+	if p := <-read; !p.Tombstone || p.Key != "gone" {
+		t.Errorf("expected a tombstone, result: %+v", p)
+	}
+
+	// Unknown serializers fail reads
+	if err := ioutil.WriteFile(path, []byte("#rump-serializer protobuf\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.New(path, make(message.Bus, 100), true, false, maxBuf).Read(context.Background()); err == nil {
+		t.Error("unknown serializers should fail")
+	}
+}
+
+// Test chunks of a dump whose file name holds spaces are read back
+func TestWriteReadChunkedSpaces(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rump-chunks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "my dump.rump")
+
+	ch := make(message.Bus, 100)
+	var keys []string
+	for i := 0; i < 10; i++ {
+		keys = append(keys, fmt.Sprintf("key%d", i))
+		ch <- message.Payload{Key: keys[i], Value: "value", TTL: "0"}
+	}
+	close(ch)
+	target := file.New(path, ch, false, false, maxBuf)
+	target.ChunkSize = 50
+	if err := target.Write(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	ch2 := make(message.Bus, 100)
+	source := file.New(path, ch2, false, false, maxBuf)
+	if err := source.Read(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+	var read []string
+	for p := range ch2 {
+		read = append(read, p.Key)
+	}
+	if !reflect.DeepEqual(read, keys) {
+		t.Errorf("expected %v, got %v", keys, read)
+	}
+}
+
+func TestShard(t *testing.T) {
+	// Sharding must be stable across runs.
+	if file.Shard("key1", 4) != file.Shard("key1", 4) {
+		t.Error("sharding should be deterministic")
+	}
+
+	for i := 0; i < 100; i++ {
+		if s := file.Shard(fmt.Sprintf("key%d", i), 4); s < 0 || s >= 4 {
+			t.Errorf("shard out of range: %d", s)
+		}
+	}
+}
+
+func TestWriteReadSharded(t *testing.T) {
+	ch := make(message.Bus, 100)
+
+	// Read all keys from db1, push to shared message bus
+	source := redis.New(db1, ch, false, false)
+	if err := source.Read(ctx); err != nil {
+		t.Error("error: ", err)
+	}
+
+	// Write rump dump shards from shared message bus
+	target := file.New(path, ch, false, false, maxBuf)
+	target.Shards = 4
+	if err := target.Write(ctx); err != nil {
+		t.Error("error: ", err)
+	}
+
+	index, err := ioutil.ReadFile(path + ".shards")
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	if len(strings.Fields(string(index))) != 4 {
+		t.Errorf("expected 4 shards, got %s", index)
+	}
+
+	// Read all shards concurrently
+	ch2 := make(message.Bus, 100)
+	source2 := file.New(path, ch2, false, false, maxBuf)
+	if err := source2.Read(ctx); err != nil {
+		t.Error("error: ", err)
+	}
+
+	// Write from shared message bus to db2
+	target2 := redis.New(db2, ch2, false, false)
+	if err := target2.Write(ctx); err != nil {
+		t.Error("error: ", err)
+	}
+
+	// Compare db1 keys with db2 keys
+	result := map[string]string{}
+	var v string
+	for k := range expected {
+		db2.Do(radix.Cmd(&v, "GET", k))
+		result[k] = v
+	}
+
+	if !reflect.DeepEqual(expected, result) {
+		t.Errorf("expected: %v, result: %v", expected, result)
+	}
+}
+
+// Test shards of a dump whose file name holds spaces are read back
+func TestWriteReadShardedSpaces(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rump-shards")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "my dump.rump")
+
+	ch := make(message.Bus, 100)
+	var keys []string
+	for i := 0; i < 10; i++ {
+		keys = append(keys, fmt.Sprintf("key%d", i))
+		ch <- message.Payload{Key: keys[i], Value: "value", TTL: "0"}
+	}
+	close(ch)
+	target := file.New(path, ch, false, false, maxBuf)
+	target.Shards = 4
+	if err := target.Write(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	ch2 := make(message.Bus, 100)
+	source := file.New(path, ch2, false, false, maxBuf)
+	if err := source.Read(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+	var read []string
+	for p := range ch2 {
+		read = append(read, p.Key)
+	}
+	// Shards are merged concurrently, in no particular order
+	sort.Strings(read)
+	if !reflect.DeepEqual(read, keys) {
+		t.Errorf("expected %v, got %v", keys, read)
+	}
+}
+
+func TestWriteReadByType(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rump-types")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dump.rump")
+
+	ch := make(message.Bus, 100)
+	ch <- message.Payload{Key: "s1", Value: "v1", TTL: "0", Type: "string"}
+	ch <- message.Payload{Key: "h1", Value: "v2", TTL: "0", Type: "hash"}
+	ch <- message.Payload{Key: "s2", Value: "v3", TTL: "0", Type: "string"}
+	close(ch)
+
+	target := file.New(path, ch, false, false, maxBuf)
+	target.PartitionByType = true
+	if err := target.Write(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	for _, name := range []string{"dump.rump.string", "dump.rump.hash"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Error("error: ", err)
+		}
+	}
+
+	// Restore the strings only
+	ch2 := make(message.Bus, 100)
+	source := file.New(path, ch2, false, false, maxBuf)
+	source.Types = []string{"string"}
+	if err := source.Read(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+	var keys []string
+	for p := range ch2 {
+		keys = append(keys, p.Key)
+	}
+	if !reflect.DeepEqual(keys, []string{"s1", "s2"}) {
+		t.Errorf("expected the string keys, got %v", keys)
+	}
+
+	source = file.New(path, make(message.Bus, 100), false, false, maxBuf)
+	source.Types = []string{"zset"}
+	if err := source.Read(context.Background()); err == nil {
+		t.Error("expected an error for a missing partition")
+	}
+}
+
+func TestReadSorted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rump-sort")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dump.rump")
+	if err := ioutil.WriteFile(path, []byte("b✝✝v1✝✝0✝✝c✝✝v2✝✝0✝✝a✝✝v3✝✝0✝✝"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(message.Bus, 100)
+	source := file.New(path, ch, false, false, maxBuf)
+	source.Sort = true
+	if err := source.Read(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	var keys []string
+	for p := range ch {
+		keys = append(keys, p.Key)
+	}
+	if !reflect.DeepEqual(keys, []string{"a", "b", "c"}) {
+		t.Errorf("expected sorted keys, got %v", keys)
+	}
+}
+
+// Test AOF files are read past their RDB preamble, following SELECT
+func TestReadAOF(t *testing.T) {
+	p := filepath.Join(os.TempDir(), "rump.aof")
+	defer os.Remove(p)
+	preamble := "REDIS0011\x00\x01s\x01v\xff\x00\x00\x00\x00\x00\x00\x00\x00"
+	aof := preamble +
+		resp.Encode("SELECT", "1") + resp.Encode("SET", "a", "1") +
+		resp.Encode("SELECT", "0") + resp.Encode("MULTI") + resp.Encode("SET", "b", "2") + resp.Encode("EXEC")
+	if err := ioutil.WriteFile(p, []byte(aof), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	bus := make(message.Bus, 100)
+	source := file.New(p, bus, false, false, maxBuf)
+	source.Format = file.AOF
+	if err := source.Read(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	var result []message.Payload
+	for p := range bus {
+		result = append(result, p)
+	}
+	if len(result) != 2 || result[0].Key != "s" || result[0].Commands {
+		t.Fatalf("expected the preamble DUMP payload then SET b, got %+v", result)
+	}
+	if !result[1].Commands || result[1].Value != resp.Encode("SET", "b", "2") {
+		t.Errorf("expected SET b, got %q", result[1].Value)
+	}
+
+	// Offsets count the preamble
+	if err := ioutil.WriteFile(p, []byte(preamble+"PING\r\n*2\r\n$3\r\nGET\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	source = file.New(p, make(message.Bus, 100), false, false, maxBuf)
+	source.Format = file.AOF
+	err := source.Read(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "line 5, offset 42") {
+		t.Errorf("expected a positioned parse error, got %v", err)
+	}
+}
+
+// Test multi part AOF manifests read the base, then the incremental files
+func TestReadAOFManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rump-aof")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"appendonly.aof.manifest": "file appendonly.aof.1.base.rdb seq 1 type b\n" +
+			"file appendonly.aof.1.incr.aof seq 1 type h\n" +
+			"file appendonly.aof.2.incr.aof seq 2 type i\n",
+		"appendonly.aof.1.base.rdb": "REDIS0011\x00\x01s\x01v\xff\x00\x00\x00\x00\x00\x00\x00\x00",
+		"appendonly.aof.1.incr.aof": resp.Encode("SET", "old", "1"),
+		"appendonly.aof.2.incr.aof": resp.Encode("SELECT", "0") + resp.Encode("DEL", "s"),
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bus := make(message.Bus, 100)
+	source := file.New(filepath.Join(dir, "appendonly.aof.manifest"), bus, false, false, maxBuf)
+	source.Format = file.AOF
+	if err := source.Read(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	var keys []string
+	for p := range bus {
+		keys = append(keys, p.Key)
+	}
+	if !reflect.DeepEqual(keys, []string{"s", "s"}) {
+		t.Errorf("expected the base key then its DEL, got %v", keys)
+	}
+}
+
+// Test only every LogEvery key is logged
+func TestLogEvery(t *testing.T) {
+	p := filepath.Join(os.TempDir(), "rump-log.rump")
+	defer os.Remove(p)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	bus := make(message.Bus, 100)
+	target := file.New(p, bus, false, false, maxBuf)
+	target.LogEvery = 2
+	for i := 1; i <= 5; i++ {
+		bus <- message.Payload{Key: fmt.Sprintf("key%d", i), Value: "v", TTL: "0"}
+	}
+	close(bus)
+	err = target.Write(context.Background())
+	os.Stdout = stdout
+	w.Close()
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	out, _ := ioutil.ReadAll(r)
+	if n := strings.Count(string(out), "file: write"); n != 2 {
+		t.Errorf("expected 2 of 5 keys logged, got %d: %s", n, out)
+	}
+}
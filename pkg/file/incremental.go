@@ -0,0 +1,145 @@
+package file
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// Incremental dumps only write the keys changed since a base dump, and
+// tombstones of the keys deleted since. Dumps written with Checksums record
+// the checksum of every source key in a sidecar manifest, path.sums, the base
+// of the next incremental dump, one JSON line per key:
+//
+//	{"key":"user:1","sum":"<hex SHA-256 of the DUMP payload>"}
+//
+// Tombstones are records with an empty value and the tombstone TTL, e.g.
+// user:2✝✝✝✝tombstone✝✝, read as Tombstone Payloads.
+// Restoring the base dump, then each incremental dump in order, recreates
+// the keys of the last one.
+
+// tombstone is the TTL of tombstone records.
+const tombstone = "tombstone"
+
+// SumsPath is the path of the checksums manifest of the dump path.
+func SumsPath(path string) string {
+	return path + ".sums"
+}
+
+// checksum is a line of a checksums manifest.
+type checksum struct {
+	Key string `json:"key"`
+	Sum string `json:"sum"`
+}
+
+// checksums writes the checksums manifest of a dump, to a temporary file
+// renamed once complete, comparing them with the base dump ones.
+type checksums struct {
+	path string
+	base map[string]string
+	seen map[string]bool
+	tmp  *os.File
+	w    *bufio.Writer
+	enc  *json.Encoder
+}
+
+// readChecksums reads the checksums manifest path, by key.
+func readChecksums(path string) (map[string]string, error) {
+	d, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening checksums %s: %w", path, err)
+	}
+	defer d.Close()
+
+	sums := map[string]string{}
+	dec := json.NewDecoder(d)
+	for dec.More() {
+		var c checksum
+		if err := dec.Decode(&c); err != nil {
+			return nil, fmt.Errorf("error reading checksums %s: %w", path, err)
+		}
+		sums[c.Key] = c.Sum
+	}
+
+	return sums, nil
+}
+
+// newChecksums creates the checksums manifest path, of an incremental dump
+// of base when set, the checksums manifest of the base dump.
+func newChecksums(path, base string) (*checksums, error) {
+	c := &checksums{path: path, seen: map[string]bool{}}
+	if base != "" {
+		sums, err := readChecksums(base)
+		if err != nil {
+			return nil, err
+		}
+		c.base = sums
+	}
+
+	tmp, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, fmt.Errorf("error creating checksums %s: %w", path, err)
+	}
+	c.tmp = tmp
+	c.w = bufio.NewWriter(tmp)
+	c.enc = json.NewEncoder(c.w)
+
+	return c, nil
+}
+
+// changed records the checksum of p, reporting whether p changed since the
+// base dump, always true without base. Keys seen twice, e.g. SCANned twice,
+// are only written once.
+func (c *checksums) changed(p message.Payload) (bool, error) {
+	if c.seen[p.Key] {
+		return false, nil
+	}
+	c.seen[p.Key] = true
+
+	hash := sha256.Sum256([]byte(p.Value))
+	sum := hex.EncodeToString(hash[:])
+	if err := c.enc.Encode(checksum{Key: p.Key, Sum: sum}); err != nil {
+		return false, fmt.Errorf("error writing checksums %s: %w", c.path, err)
+	}
+
+	return c.base[p.Key] != sum, nil
+}
+
+// deleted returns the keys of the base dump not seen since, sorted.
+func (c *checksums) deleted() []string {
+	var keys []string
+	for key := range c.base {
+		if !c.seen[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Close writes the manifest, replacing the previous one.
+func (c *checksums) Close() error {
+	if err := c.w.Flush(); err != nil {
+		c.tmp.Close()
+		return fmt.Errorf("error writing checksums %s: %w", c.path, err)
+	}
+	if err := c.tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(c.tmp.Name(), c.path)
+}
+
+// remove removes the temporary manifest of an interrupted dump, a noop once
+// closed.
+func (c *checksums) remove() {
+	c.tmp.Close()
+	os.Remove(c.tmp.Name())
+}
@@ -0,0 +1,96 @@
+package file
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// jsonlRecord is a JSONL record, a JSON object per line. Values are base64
+// encoded, DUMP payloads being binary, as are key names that aren't valid
+// UTF-8, in Key64 rather than Key.
+type jsonlRecord struct {
+	Key       string `json:"key,omitempty"`
+	Key64     []byte `json:"key64,omitempty"`
+	Value     []byte `json:"value,omitempty"`
+	TTL       string `json:"ttl"`
+	Idle      string `json:"idle,omitempty"`
+	Freq      string `json:"freq,omitempty"`
+	DB        string `json:"db,omitempty"`
+	Tombstone bool   `json:"tombstone,omitempty"`
+}
+
+// jsonl is the JSONL Serializer, for interop with line oriented pipelines.
+type jsonl struct{}
+
+func (jsonl) NewEncoder(w io.Writer) Encoder {
+	return jsonlEncoder{w: w}
+}
+
+func (jsonl) NewDecoder(r io.Reader, maxBuf int) Decoder {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxBuf)
+
+	return &jsonlDecoder{scanner: scanner}
+}
+
+// jsonlEncoder writes JSONL records.
+type jsonlEncoder struct {
+	w io.Writer
+}
+
+func (e jsonlEncoder) Encode(p message.Payload) error {
+	r := jsonlRecord{TTL: p.TTL, Idle: p.Idle, Freq: p.Freq, DB: p.DB, Tombstone: p.Tombstone}
+	if utf8.ValidString(p.Key) {
+		r.Key = p.Key
+	} else {
+		r.Key64 = []byte(p.Key)
+	}
+	if p.Value != "" {
+		r.Value = []byte(p.Value)
+	}
+	if r.TTL == "" {
+		r.TTL = "0"
+	}
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(append(line, '\n'))
+
+	return err
+}
+
+// jsonlDecoder reads JSONL records, counting them for errors.
+type jsonlDecoder struct {
+	scanner *bufio.Scanner
+	records int
+}
+
+func (d *jsonlDecoder) Decode() (message.Payload, error) {
+	if !d.scanner.Scan() {
+		if err := d.scanner.Err(); err != nil {
+			return message.Payload{}, err
+		}
+		return message.Payload{}, io.EOF
+	}
+	d.records++
+
+	var r jsonlRecord
+	if err := json.Unmarshal(d.scanner.Bytes(), &r); err != nil {
+		return message.Payload{}, fmt.Errorf("invalid jsonl record %d: %w", d.records, err)
+	}
+	key := r.Key
+	if r.Key64 != nil {
+		key = string(r.Key64)
+	}
+	if r.Tombstone {
+		return message.Payload{Key: key, TTL: "0", Tombstone: true}, nil
+	}
+
+	return message.Payload{Key: key, Value: string(r.Value), TTL: r.TTL, Idle: r.Idle, Freq: r.Freq, DB: r.DB}, nil
+}
@@ -0,0 +1,117 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// typePath is the path of the partition of path holding keys of keyType,
+// e.g. dump.rump.hash.
+func typePath(path, keyType string) string {
+	return path + "." + keyType
+}
+
+// selectTypes returns the partitions of shards holding keys of types,
+// all of them when types is empty.
+func selectTypes(path string, shards, types []string) ([]string, error) {
+	if len(types) == 0 {
+		return shards, nil
+	}
+
+	var selected []string
+	for _, keyType := range types {
+		name := filepath.Base(typePath(path, keyType))
+		for _, shard := range shards {
+			if shard == name {
+				selected = append(selected, shard)
+			}
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no %s partition in %s", strings.Join(types, ", "), path)
+	}
+
+	return selected, nil
+}
+
+// writeTypes routes each Payload to the partition of its key type, with one
+// writer goroutine per type seen, then writes the partitions, as the shards
+// index: reading restores either all of them, or the Types selected.
+func (f *File) writeTypes(ctx context.Context) error {
+	// Remove leftovers of a previous unpartitioned dump.
+	for _, leftover := range []string{f.Path, manifestPath(f.Path)} {
+		if err := os.Remove(leftover); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing %s: %w", leftover, err)
+		}
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	buses := make(map[string]message.Bus)
+	var partitions []string
+
+	// Dispatch Payloads to the type writers, started on the first key of
+	// each type.
+	g.Go(func() error {
+		defer func() {
+			for _, bus := range buses {
+				close(bus)
+			}
+		}()
+
+		for f.Bus != nil {
+			select {
+			case <-gctx.Done():
+				return gctx.Err()
+			case p, ok := <-f.Bus:
+				if !ok {
+					f.Bus = nil
+					continue
+				}
+
+				keyType := p.Type
+				if keyType == "" {
+					keyType = "none"
+				}
+				bus, ok := buses[keyType]
+				if !ok {
+					bus = make(message.Bus, 100)
+					path := typePath(f.Path, keyType)
+					buses[keyType] = bus
+					partitions = append(partitions, filepath.Base(path))
+
+					g.Go(func() error {
+						return f.write(gctx, bus, path)
+					})
+				}
+
+				select {
+				case <-gctx.Done():
+					return gctx.Err()
+				case bus <- p:
+				}
+			}
+		}
+
+		return nil
+	})
+
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	index := strings.Join(partitions, "\n") + "\n"
+	err := ioutil.WriteFile(shardsPath(f.Path), []byte(index), 0644)
+	if err != nil {
+		return fmt.Errorf("error writing partitions index for %s: %w", f.Path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/stickermule/rump/pkg/message"
+	"github.com/stickermule/rump/pkg/rdb"
+	"github.com/stickermule/rump/pkg/resp"
+)
+
+// batchSize caps the elements of reconstructed commands, as for logical
+// reads of pkg/redis.
+const batchSize = 1000
+
+// readRDB reads the keys of an RDB snapshot, and sends them to the message
+// bus as DUMP payloads when the target loads their encoding, as the commands
+// recreating them otherwise.
+func (f *File) readRDB(ctx context.Context, r io.Reader) error {
+	snapshot, err := rdb.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("error reading rdb file: %w", err)
+	}
+
+	return f.readSnapshot(ctx, snapshot)
+}
+
+// readSnapshot sends the keys of snapshot to the message bus, see readRDB.
+func (f *File) readSnapshot(ctx context.Context, snapshot *rdb.Reader) error {
+	snapshot.Warn = func(msg string) {
+		fmt.Printf("file: %s\n", msg)
+		f.Summary.Note(msg)
+	}
+
+	version := snapshot.Version
+	if f.TargetVersion > 0 {
+		version = f.TargetVersion
+	}
+
+	for {
+		e, err := snapshot.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading rdb file: %w", err)
+		}
+
+		p, ok := f.rdbPayload(e, version)
+		if !ok {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			fmt.Println("file: done")
+			return ctx.Err()
+		case f.Bus <- p:
+			f.Summary.Incr("read")
+			f.logKey("file: read %s => ttl=%s, size=%d\n", message.FormatKey(p.Key), p.TTL, len(p.Value))
+		}
+	}
+}
+
+// rdbPayload converts an entry to a Payload for servers of RDB version,
+// false when skipped: from another DB, expired, or not loadable.
+func (f *File) rdbPayload(e rdb.Entry, version int) (message.Payload, bool) {
+	if f.DB >= 0 && e.DB != f.DB {
+		f.Summary.Incr("other-db")
+		return message.Payload{}, false
+	}
+	if rule := f.Filter.SelectsRule(e.Key); rule != "" {
+		f.Summary.Incr("excluded")
+		f.Summary.Incr("excluded-" + rule)
+		return message.Payload{}, false
+	}
+
+	db := strconv.Itoa(e.DB)
+	ttl := "0"
+	if e.ExpireAt > 0 {
+		left := e.ExpireAt - time.Now().UnixNano()/int64(time.Millisecond)
+		if left <= 0 {
+			f.Summary.Incr("expired")
+			return message.Payload{}, false
+		}
+		if f.TTL {
+			ttl = strconv.FormatInt(left, 10)
+		}
+	}
+
+	if rdb.Loads(e.Type, version) {
+		p := message.Payload{Key: e.Key, Value: string(rdb.Dump(e.Raw, version)), TTL: ttl, DB: db}
+		if e.Idle >= 0 {
+			p.Idle = strconv.FormatInt(e.Idle, 10)
+		}
+		if e.Freq >= 0 {
+			p.Freq = strconv.Itoa(e.Freq)
+		}
+		return p, true
+	}
+
+	// Encodings the target predates are sent as commands
+	l := e.Logical
+	if l == nil {
+		kind := fmt.Sprintf("type %d", e.Type)
+		if e.Module != "" {
+			kind = "module " + e.Module
+		}
+		f.Summary.Incr("skipped")
+		f.logError("file: skipping %s, RDB version %d can't load its %s values\n", message.FormatKey(e.Key), version, kind)
+		return message.Payload{}, false
+	}
+
+	cmds := resp.Recreate(l.Cmd, e.Key, l.Args, l.Step, batchSize)
+	if ttl != "0" {
+		cmds += resp.Encode("PEXPIRE", e.Key, ttl)
+	}
+	f.Summary.Incr("reconstructed")
+
+	return message.Payload{Key: e.Key, Value: cmds, TTL: ttl, Commands: true, DB: db}, true
+}
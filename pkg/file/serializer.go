@@ -0,0 +1,209 @@
+package file
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// Native and JSONL are the built-in Serializers of Dump files. Native is the
+// key✝✝value✝✝ttl✝✝ record format, the default, JSONL a JSON object per line.
+const (
+	Native = "native"
+	JSONL  = "jsonl"
+)
+
+// Serializer encodes and decodes the records of Dump files, see Serializers.
+// Files of other Serializers than Native start with a header naming theirs,
+// for reads to select it.
+type Serializer interface {
+	NewEncoder(w io.Writer) Encoder
+	NewDecoder(r io.Reader, maxBuf int) Decoder
+}
+
+// Encoder writes a record per Payload, in a single Write, for chunked files
+// to rotate between records.
+type Encoder interface {
+	Encode(p message.Payload) error
+}
+
+// Decoder reads a Payload per record, io.EOF after the last one.
+type Decoder interface {
+	Decode() (message.Payload, error)
+}
+
+// Serializers are the Serializers by name, more can be registered with
+// RegisterSerializer.
+var Serializers = map[string]Serializer{
+	Native: native{},
+	JSONL:  jsonl{},
+}
+
+// RegisterSerializer adds a Serializer, e.g. for a protobuf or msgpack
+// pipeline, named in the header of the files it writes. Names are case
+// sensitive, without spaces.
+func RegisterSerializer(name string, s Serializer) {
+	Serializers[name] = s
+}
+
+// SerializerNames returns the names of the Serializers, sorted.
+func SerializerNames() []string {
+	var names []string
+	for name := range Serializers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// serializerHeader prefixes the name of the Serializer on the first line of
+// the files it writes.
+const serializerHeader = "#rump-serializer "
+
+// writeHeader writes the header of the serializer name, none for Native.
+func writeHeader(w io.Writer, name string) error {
+	if name == "" || name == Native {
+		return nil
+	}
+	_, err := io.WriteString(w, serializerHeader+name+"\n")
+
+	return err
+}
+
+// readHeader reads the header of r, returning the Serializer it names,
+// Native for files without.
+func readHeader(r *bufio.Reader) (Serializer, string, error) {
+	prefix, err := r.Peek(len(serializerHeader))
+	if err != nil || string(prefix) != serializerHeader {
+		return Serializers[Native], Native, nil
+	}
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading the serializer header: %w", err)
+	}
+	name := strings.TrimSpace(strings.TrimPrefix(line, serializerHeader))
+	s, ok := Serializers[name]
+	if !ok {
+		return nil, "", fmt.Errorf("unknown serializer %s, register it with file.RegisterSerializer", name)
+	}
+
+	return s, name, nil
+}
+
+// native is the Native Serializer.
+type native struct{}
+
+func (native) NewEncoder(w io.Writer) Encoder {
+	return &nativeEncoder{w: w}
+}
+
+func (native) NewDecoder(r io.Reader, maxBuf int) Decoder {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxBuf)
+	scanner.Split(splitCross)
+
+	return &nativeDecoder{scanner: scanner}
+}
+
+// nativeEncoder writes Native records, compressing values past the
+// CompressAbove of f, when set.
+type nativeEncoder struct {
+	w io.Writer
+	f *File
+}
+
+func (e *nativeEncoder) Encode(p message.Payload) error {
+	if p.Tombstone {
+		_, err := io.WriteString(e.w, p.Key+"✝✝✝✝"+tombstone+"✝✝")
+		return err
+	}
+
+	value, field := p.Value, ttlField(p)
+	if e.f != nil && e.f.CompressAbove > 0 && len(value) >= e.f.CompressAbove {
+		compressed, err := compressValue(e.f.Codec, value)
+		if err != nil {
+			return fmt.Errorf("error compressing key %s: %w", message.FormatKey(p.Key), err)
+		}
+		if len(compressed) < len(value) {
+			value, field = compressed, field+";z="+e.f.Codec
+			e.f.Summary.Incr("compressed")
+		}
+	}
+	_, err := io.WriteString(e.w, p.Key+"✝✝"+value+"✝✝"+field+"✝✝")
+
+	return err
+}
+
+// commandsEncoder writes the RESP commands of the Payloads of the Commands
+// Format as is.
+type commandsEncoder struct {
+	w io.Writer
+}
+
+func (e commandsEncoder) Encode(p message.Payload) error {
+	_, err := io.WriteString(e.w, p.Value)
+
+	return err
+}
+
+// encoder returns the Encoder of the File Format and Serializer, writing
+// the header of the Serializer to w.
+func (f *File) encoder(w io.Writer) (Encoder, error) {
+	if f.Format == Commands {
+		return commandsEncoder{w: w}, nil
+	}
+
+	name := f.Serializer
+	if name == "" {
+		name = Native
+	}
+	s, ok := Serializers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown serializer %s", name)
+	}
+	enc := s.NewEncoder(w)
+	if n, ok := enc.(*nativeEncoder); ok {
+		n.f = f
+	}
+	if err := writeHeader(w, name); err != nil {
+		return nil, fmt.Errorf("error writing the serializer header: %w", err)
+	}
+
+	return enc, nil
+}
+
+// nativeDecoder reads Native records, decompressing their values.
+type nativeDecoder struct {
+	scanner *bufio.Scanner
+}
+
+func (d *nativeDecoder) Decode() (message.Payload, error) {
+	// file protocol is key✝✝value✝✝ttl✝✝
+	if !d.scanner.Scan() {
+		if err := d.scanner.Err(); err != nil {
+			return message.Payload{}, err
+		}
+		return message.Payload{}, io.EOF
+	}
+	key := d.scanner.Text()
+	d.scanner.Scan()
+	value := d.scanner.Text()
+	d.scanner.Scan()
+	ttl, idle, freq, db, codec := parseTTLField(d.scanner.Text())
+	if ttl == tombstone {
+		return message.Payload{Key: key, TTL: "0", Tombstone: true}, nil
+	}
+	if codec != "" {
+		var err error
+		if value, err = decompressValue(codec, value); err != nil {
+			return message.Payload{}, fmt.Errorf("error decompressing key %s from file: %w", message.FormatKey(key), err)
+		}
+	}
+
+	return message.Payload{Key: key, Value: value, TTL: ttl, Idle: idle, Freq: freq, DB: db}, nil
+}
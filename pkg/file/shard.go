@@ -0,0 +1,139 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// shardsPath is the path of the index listing the shards of path.
+func shardsPath(path string) string {
+	return path + ".shards"
+}
+
+// shardPath is the path of the nth shard of path, e.g. dump.rump.s00.
+func shardPath(path string, n int) string {
+	return fmt.Sprintf("%s.s%02d", path, n)
+}
+
+// Shard returns the shard of key, out of m shards.
+// It's deterministic: the FNV-1a hash of the key, modulo m.
+func Shard(key string, m int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+
+	return int(h.Sum32() % uint32(m))
+}
+
+// readShards returns the shards listed in the index of path,
+// nil when path isn't sharded.
+func readShards(path string) ([]string, error) {
+	index, err := ioutil.ReadFile(shardsPath(path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading shards index for %s: %w", path, err)
+	}
+
+	return manifestLines(index), nil
+}
+
+// removeShards removes the shards index of path, if any.
+func removeShards(path string) error {
+	err := os.Remove(shardsPath(path))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing %s: %w", shardsPath(path), err)
+	}
+
+	return nil
+}
+
+// readShards reads all shards concurrently, merging them on the Bus.
+func (f *File) readShards(ctx context.Context, shards []string) error {
+	g, gctx := errgroup.WithContext(ctx)
+	dir := filepath.Dir(f.Path)
+
+	for _, shard := range shards {
+		path := filepath.Join(dir, shard)
+		g.Go(func() error {
+			return f.read(gctx, path)
+		})
+	}
+
+	return g.Wait()
+}
+
+// writeShards routes each Payload to a shard by key hash, with one writer
+// goroutine per shard, then writes the shards index.
+func (f *File) writeShards(ctx context.Context) error {
+	// Remove leftovers of a previous unsharded dump.
+	for _, leftover := range []string{f.Path, manifestPath(f.Path)} {
+		if err := os.Remove(leftover); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing %s: %w", leftover, err)
+		}
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	buses := make([]message.Bus, f.Shards)
+	shards := make([]string, f.Shards)
+
+	for i := range buses {
+		bus := make(message.Bus, 100)
+		path := shardPath(f.Path, i)
+		buses[i] = bus
+		shards[i] = filepath.Base(path)
+
+		g.Go(func() error {
+			return f.write(gctx, bus, path)
+		})
+	}
+
+	// Dispatch Payloads to the shard writers
+	g.Go(func() error {
+		defer func() {
+			for _, bus := range buses {
+				close(bus)
+			}
+		}()
+
+		for f.Bus != nil {
+			select {
+			case <-gctx.Done():
+				return gctx.Err()
+			case p, ok := <-f.Bus:
+				if !ok {
+					f.Bus = nil
+					continue
+				}
+				select {
+				case <-gctx.Done():
+					return gctx.Err()
+				case buses[Shard(p.Key, f.Shards)] <- p:
+				}
+			}
+		}
+
+		return nil
+	})
+
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	index := strings.Join(shards, "\n") + "\n"
+	err := ioutil.WriteFile(shardsPath(f.Path), []byte(index), 0644)
+	if err != nil {
+		return fmt.Errorf("error writing shards index for %s: %w", f.Path, err)
+	}
+
+	return nil
+}
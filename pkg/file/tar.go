@@ -0,0 +1,270 @@
+package file
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// Key files of Tar archives are named after their key under keys/, when it's
+// a safe file name, or else after its SHA-256 under hashed/, or hex/ and
+// base64/ after its encoding, per message.KeyEncoding, each followed by its
+// .json sidecar.
+const (
+	tarKeys    = "keys/"
+	tarHashed  = "hashed/"
+	tarHex     = "hex/"
+	tarBase64  = "base64/"
+	tarSidecar = ".json"
+)
+
+// tarMaxName is the longest encoded key name of a key file, as tarSafe names,
+// longer ones hashed.
+const tarMaxName = 100
+
+// tarSafe matches the keys kept as file names: no path separators, dot
+// files, or names too long for the tar header.
+var tarSafe = regexp.MustCompile(`^[A-Za-z0-9_:@+=,-][A-Za-z0-9._:@+=,-]{0,99}$`)
+
+// tarEntry is the sidecar of a key file, the key name, TTL, LRU/LFU metadata
+// and source database of its DUMP payload.
+type tarEntry struct {
+	Key  string `json:"key"`
+	TTL  string `json:"ttl"`
+	Idle string `json:"idle,omitempty"`
+	Freq string `json:"freq,omitempty"`
+	DB   string `json:"db,omitempty"`
+}
+
+// tarName is the name of the key file of key in Tar archives. Keys ending
+// in .json are hashed, they'd read as sidecars. Unsafe keys are hex or URL
+// safe base64 encoded with those encodings, when short enough. Names are
+// only informative, the sidecar has the key.
+func tarName(key string) string {
+	if tarSafe.MatchString(key) && !strings.HasSuffix(key, tarSidecar) {
+		return tarKeys + key
+	}
+	switch message.KeyEncoding {
+	case message.KeyHex:
+		if name := hex.EncodeToString([]byte(key)); len(name) <= tarMaxName {
+			return tarHex + name
+		}
+	case message.KeyBase64:
+		if name := base64.RawURLEncoding.EncodeToString([]byte(key)); len(name) <= tarMaxName {
+			return tarBase64 + name
+		}
+	}
+	sum := sha256.Sum256([]byte(key))
+
+	return tarHashed + hex.EncodeToString(sum[:])
+}
+
+// gzipped tells if the Tar archive path is gzipped, from its extension.
+func gzipped(path string) bool {
+	return strings.HasSuffix(path, ".gz") || strings.HasSuffix(path, ".tgz")
+}
+
+// writeTar writes Payloads from bus to the Tar archive path, a key file
+// and its sidecar per key.
+func (f *File) writeTar(ctx context.Context, bus message.Bus, path string) (err error) {
+	d, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating file %s: %w", path, err)
+	}
+	bw := bufio.NewWriter(d)
+	w := io.Writer(bw)
+	var gz *gzip.Writer
+	if gzipped(path) {
+		gz = gzip.NewWriter(bw)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+
+	// Close the archive, its gzip stream, then flush the file.
+	defer func() {
+		cerr := tw.Close()
+		if cerr == nil && gz != nil {
+			cerr = gz.Close()
+		}
+		if cerr == nil {
+			cerr = bw.Flush()
+		}
+		if derr := d.Close(); cerr == nil {
+			cerr = derr
+		}
+		if err == nil && cerr != nil {
+			err = fmt.Errorf("error closing file %s: %w", path, cerr)
+		}
+	}()
+
+	now := time.Now()
+	for bus != nil {
+		select {
+		case <-ctx.Done():
+			fmt.Println("file: done")
+			return ctx.Err()
+		case p, ok := <-bus:
+			if !ok {
+				bus = nil
+				continue
+			}
+			f.Summary.Track(p.Key)
+			if err := addTar(tw, p, now); err != nil {
+				return fmt.Errorf("error writing key %s to file with size %d: %w", message.FormatKey(p.Key), len(p.Value), err)
+			}
+			f.Summary.Incr("written")
+			f.logKey("file: write %s => ttl=%s, size=%d\n", message.FormatKey(p.Key), p.TTL, len(p.Value))
+		}
+	}
+
+	return nil
+}
+
+// addTar adds the sidecar and key file of p to tw.
+func addTar(tw *tar.Writer, p message.Payload, modTime time.Time) error {
+	sidecar, err := json.Marshal(tarEntry{Key: p.Key, TTL: p.TTL, Idle: p.Idle, Freq: p.Freq, DB: p.DB})
+	if err != nil {
+		return err
+	}
+
+	name := tarName(p.Key)
+	files := []struct {
+		name string
+		body []byte
+	}{
+		{name + tarSidecar, append(sidecar, '\n')},
+		{name, []byte(p.Value)},
+	}
+	for _, file := range files {
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     file.name,
+			Mode:     0644,
+			Size:     int64(len(file.body)),
+			ModTime:  modTime,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(file.body); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readTar reads the Tar archive path, sending a Payload per key file once
+// both it and its sidecar are read, in either order, e.g. once re-archived
+// by tar tools. Key files or sidecars missing their pair are skipped.
+func (f *File) readTar(ctx context.Context, path string) error {
+	d, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening file %s: %w", path, err)
+	}
+	defer d.Close()
+
+	r := io.Reader(bufio.NewReader(d))
+	if gzipped(path) {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("error reading gzip file %s: %w", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+
+	sidecars := map[string]tarEntry{}
+	values := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading tar file %s: %w", path, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		body, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("error reading %s from tar file %s: %w", hdr.Name, path, err)
+		}
+
+		name := strings.TrimPrefix(hdr.Name, "./")
+		if strings.HasSuffix(name, tarSidecar) {
+			var e tarEntry
+			if err := json.Unmarshal(body, &e); err != nil {
+				return fmt.Errorf("error reading %s from tar file %s: %w", hdr.Name, path, err)
+			}
+			name = strings.TrimSuffix(name, tarSidecar)
+			value, ok := values[name]
+			if !ok {
+				sidecars[name] = e
+				continue
+			}
+			delete(values, name)
+			if err := f.sendTar(ctx, e, value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		e, ok := sidecars[name]
+		if !ok {
+			values[name] = string(body)
+			continue
+		}
+		delete(sidecars, name)
+		if err := f.sendTar(ctx, e, string(body)); err != nil {
+			return err
+		}
+	}
+
+	var orphans []string
+	for name := range values {
+		orphans = append(orphans, name)
+	}
+	for name := range sidecars {
+		orphans = append(orphans, name+tarSidecar)
+	}
+	sort.Strings(orphans)
+	for _, name := range orphans {
+		f.Summary.Incr("skipped")
+		f.logError("file: skipping %s, missing its key file or sidecar\n", name)
+	}
+
+	return nil
+}
+
+// sendTar sends the Payload of a key file to the message bus.
+func (f *File) sendTar(ctx context.Context, e tarEntry, value string) error {
+	p := message.Payload{Key: e.Key, Value: value, TTL: e.TTL, Idle: e.Idle, Freq: e.Freq, DB: e.DB}
+	select {
+	case <-ctx.Done():
+		fmt.Println("file: done")
+		return ctx.Err()
+	case f.Bus <- p:
+		f.Summary.Incr("read")
+		f.logKey("file: read %s => ttl=%s, size=%d\n", message.FormatKey(e.Key), e.TTL, len(value))
+	}
+
+	return nil
+}
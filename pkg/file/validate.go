@@ -0,0 +1,265 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/stickermule/rump/pkg/message"
+	"github.com/stickermule/rump/pkg/rdb"
+)
+
+// Validation is the report of Validate: the Records read, Bytes the size of
+// their values, and Problems, each giving the file and byte offset of its
+// record.
+type Validation struct {
+	Records  int64
+	Bytes    int64
+	Problems []string
+}
+
+// errTruncated is a dump ending in the middle of a record.
+var errTruncated = errors.New("truncated record")
+
+// Validate reads the whole file, its chunks, its shards or its type
+// partitions, without sending anything, reporting the records that wouldn't
+// restore. Dump records are checked one by one: framing, TTL and LRU/LFU
+// metadata, DUMP payload footer and, when the dump has a checksums manifest, their checksum.
+// Other formats are parsed by their reader, the first error is the only
+// Problem.
+func (f *File) Validate(ctx context.Context) (Validation, error) {
+	var v Validation
+	switch f.Format {
+	case Commands, RDB, AOF, Tar:
+		return v, f.validateRead(ctx, &v)
+	}
+
+	var sums map[string]string
+	if _, err := os.Stat(SumsPath(f.Path)); err == nil {
+		sums, err = readChecksums(SumsPath(f.Path))
+		if err != nil {
+			return v, err
+		}
+	}
+
+	paths := []string{f.Path}
+	shards, err := readShards(f.Path)
+	if err != nil {
+		return v, err
+	}
+	if shards != nil {
+		paths = paths[:0]
+		for _, shard := range shards {
+			paths = append(paths, filepath.Join(filepath.Dir(f.Path), shard))
+		}
+	}
+
+	for _, path := range paths {
+		if err := f.validateDump(ctx, path, sums, &v); err != nil {
+			return v, err
+		}
+	}
+
+	return v, nil
+}
+
+// validateRead reads the file with its Format reader, discarding Payloads.
+func (f *File) validateRead(ctx context.Context, v *Validation) error {
+	read := *f
+	read.Sort = false
+	read.Silent = true
+	read.Bus = make(message.Bus, 100)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- read.Read(ctx)
+	}()
+
+	for p := range read.Bus {
+		v.Records++
+		v.Bytes += int64(len(p.Value))
+	}
+	err := <-errs
+	if err == ctx.Err() {
+		return err
+	}
+	if err != nil {
+		v.Problems = append(v.Problems, err.Error())
+	}
+
+	return nil
+}
+
+// validateDump checks the records of the dump path, or of its chunks.
+func (f *File) validateDump(ctx context.Context, path string, sums map[string]string, v *Validation) error {
+	d, err := openChunks(path)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	r := bufio.NewReader(d)
+	s, name, err := readHeader(r)
+	if err != nil {
+		v.Problems = append(v.Problems, fmt.Sprintf("%s: %s", filepath.Base(path), err))
+		return nil
+	}
+	if name != Native {
+		return validateDecoded(ctx, path, s.NewDecoder(r, f.MaxBuf), sums, v)
+	}
+
+	// Offsets of the current token, and of the record it's part of
+	var offset, start int64
+	sep := []byte("✝✝")
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), f.MaxBuf)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.Index(data, sep); i >= 0 {
+			return i + len(sep), data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return 0, nil, errTruncated
+		}
+		return 0, nil, nil
+	})
+
+	problem := func(key, msg string) {
+		v.Problems = append(v.Problems, fmt.Sprintf("%s: offset %d: key %s: %s", filepath.Base(path), start, message.FormatKey(key), msg))
+	}
+
+	var fields []string
+	for scanner.Scan() {
+		if len(fields) == 0 {
+			start = offset
+		}
+		offset += int64(len(scanner.Bytes()) + len(sep))
+		fields = append(fields, scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+
+		key, value, field := fields[0], fields[1], fields[2]
+		ttl, idle, freq, db, codec := parseTTLField(field)
+		fields = fields[:0]
+		v.Records++
+		v.Bytes += int64(len(value))
+		if v.Records%10000 == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		switch parsed, err := strconv.ParseInt(ttl, 10, 64); {
+		case key == "":
+			problem(key, "empty key name")
+			continue
+		case ttl == tombstone && value != "":
+			problem(key, "tombstone with a value")
+			continue
+		case ttl == tombstone:
+			continue
+		case err != nil || parsed < 0:
+			problem(key, fmt.Sprintf("invalid TTL %q", ttl))
+		}
+		if n, err := strconv.ParseInt(idle, 10, 64); idle != "" && (err != nil || n < 0) {
+			problem(key, fmt.Sprintf("invalid idle time %q", idle))
+		}
+		if n, err := strconv.Atoi(freq); freq != "" && (err != nil || n < 0 || n > 255) {
+			problem(key, fmt.Sprintf("invalid LFU frequency %q", freq))
+		}
+		if n, err := strconv.Atoi(db); db != "" && (err != nil || n < 0) {
+			problem(key, fmt.Sprintf("invalid database %q", db))
+		}
+
+		if codec != "" {
+			decompressed, err := decompressValue(codec, value)
+			if err != nil {
+				problem(key, fmt.Sprintf("invalid %s compressed value: %s", codec, err))
+				continue
+			}
+			value = decompressed
+		}
+		for _, msg := range checkValue(key, value, sums) {
+			problem(key, msg)
+		}
+	}
+
+	err = scanner.Err()
+	switch {
+	case err == errTruncated || (err == nil && len(fields) > 0):
+		if len(fields) == 0 {
+			start = offset
+		}
+		v.Problems = append(v.Problems, fmt.Sprintf("%s: offset %d: %s", filepath.Base(path), start, errTruncated))
+	case err == bufio.ErrTooLong:
+		v.Problems = append(v.Problems, fmt.Sprintf("%s: offset %d: record larger than the buffer, %d bytes", filepath.Base(path), offset, f.MaxBuf))
+	case err != nil:
+		return fmt.Errorf("error reading from file: %w", err)
+	}
+
+	return nil
+}
+
+// checkValue checks the DUMP payload value of key, and its checksum in sums
+// when set, returning the problems found.
+func checkValue(key, value string, sums map[string]string) []string {
+	var problems []string
+	if err := rdb.CheckDump([]byte(value)); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if sums != nil {
+		hash := sha256.Sum256([]byte(value))
+		sum, ok := sums[key]
+		switch {
+		case !ok:
+			problems = append(problems, "missing from the checksums manifest")
+		case sum != hex.EncodeToString(hash[:]):
+			problems = append(problems, "checksum mismatch")
+		}
+	}
+
+	return problems
+}
+
+// validateDecoded checks the records of a dump of another Serializer than
+// Native, decoded by dec, by record number rather than byte offset. The
+// first decoding error is the last Problem.
+func validateDecoded(ctx context.Context, path string, dec Decoder, sums map[string]string, v *Validation) error {
+	for {
+		p, err := dec.Decode()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			v.Problems = append(v.Problems, fmt.Sprintf("%s: record %d: %s", filepath.Base(path), v.Records+1, err))
+			return nil
+		}
+		v.Records++
+		v.Bytes += int64(len(p.Value))
+		if v.Records%10000 == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		problem := func(msg string) {
+			v.Problems = append(v.Problems, fmt.Sprintf("%s: record %d: key %s: %s", filepath.Base(path), v.Records, message.FormatKey(p.Key), msg))
+		}
+		if p.Key == "" {
+			problem("empty key name")
+			continue
+		}
+		if p.Tombstone {
+			continue
+		}
+		if n, err := strconv.ParseInt(p.TTL, 10, 64); err != nil || n < 0 {
+			problem(fmt.Sprintf("invalid TTL %q", p.TTL))
+		}
+		for _, msg := range checkValue(p.Key, p.Value, sums) {
+			problem(msg)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// Package filter selects which keys are transferred.
+// Patterns follow the Redis glob-style syntax used by SCAN MATCH.
+package filter
+
+import "regexp"
+
+// Rules keys fail, as returned by KeepRule and SelectsRule.
+const (
+	RuleMatch        = "match"
+	RuleExclude      = "exclude"
+	RuleRange        = "range"
+	RuleRegex        = "regex"
+	RuleExcludeRegex = "exclude-regex"
+	RuleLength       = "length"
+)
+
+// Filter holds the key selection rules, keys must pass all of them.
+// Match patterns select keys matching any of them: a single pattern is sent
+// to the server as SCAN MATCH, several are applied client-side, after SCAN.
+// Exclude patterns are applied client-side, after SCAN, and win over Match.
+// Range, when set, is applied client-side too, after SCAN, see Pattern.
+// Regex and ExcludeRegex are Match and Exclude as regular expressions on the
+// full key name, both applied client-side, after SCAN.
+// MinLength and MaxLength, when set, bound the key name length, in bytes.
+type Filter struct {
+	Match        []string
+	Exclude      []string
+	Range        Range
+	Regex        []*regexp.Regexp
+	ExcludeRegex []*regexp.Regexp
+	MinLength    int
+	MaxLength    int
+}
+
+// Pattern returns the SCAN MATCH pattern: the single Match pattern or,
+// without Match patterns, the prefix shared by the Range keys, e.g. user:*
+// for user:a..user:m. Empty otherwise, every key is SCANned.
+func (f Filter) Pattern() string {
+	switch {
+	case len(f.Match) == 1:
+		return f.Match[0]
+	case len(f.Match) == 0 && f.Range.prefix() != "":
+		return Escape(f.Range.prefix()) + "*"
+	}
+
+	return ""
+}
+
+// Keep reports whether a key listed by SCAN, with the Pattern MATCH, passes
+// the filter.
+func (f Filter) Keep(key string) bool {
+	return f.KeepRule(key) == ""
+}
+
+// KeepRule returns the rule a key listed by SCAN, with the Pattern MATCH,
+// fails, empty when it passes the filter.
+func (f Filter) KeepRule(key string) string {
+	// A single Match is already applied server-side.
+	return f.rule(key, len(f.Match) < 2)
+}
+
+// Selects reports whether key passes the filter, applying every pattern
+// client-side, for keys not listed by SCAN.
+func (f Filter) Selects(key string) bool {
+	return f.SelectsRule(key) == ""
+}
+
+// SelectsRule returns the rule key fails, applying every pattern
+// client-side, empty when it passes the filter.
+func (f Filter) SelectsRule(key string) string {
+	return f.rule(key, false)
+}
+
+// rule returns the first rule key fails, skipping Match once matched.
+func (f Filter) rule(key string, matched bool) string {
+	switch {
+	case len(key) < f.MinLength || (f.MaxLength > 0 && len(key) > f.MaxLength):
+		return RuleLength
+	case !f.Range.Contains(key):
+		return RuleRange
+	case f.excluded(key):
+		return RuleExclude
+	case anyRegex(f.ExcludeRegex, key):
+		return RuleExcludeRegex
+	case !matched && !f.matched(key):
+		return RuleMatch
+	case len(f.Regex) > 0 && !anyRegex(f.Regex, key):
+		return RuleRegex
+	}
+
+	return ""
+}
+
+// matched reports whether key matches any Match pattern, true without them.
+func (f Filter) matched(key string) bool {
+	if len(f.Match) == 0 {
+		return true
+	}
+
+	for _, pattern := range f.Match {
+		if Glob(pattern, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// excluded reports whether key matches any Exclude pattern.
+func (f Filter) excluded(key string) bool {
+	for _, pattern := range f.Exclude {
+		if Glob(pattern, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// anyRegex reports whether key matches any of the regular expressions.
+func anyRegex(res []*regexp.Regexp, key string) bool {
+	for _, re := range res {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Glob reports whether key matches the Redis glob-style pattern.
+// Supports *, ?, [abc], [^abc], [a-z] and \ escaping.
+func Glob(pattern, key string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			// Collapse consecutive stars.
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(key); i++ {
+				if Glob(pattern[1:], key[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(key) == 0 {
+				return false
+			}
+			key = key[1:]
+			pattern = pattern[1:]
+		case '[':
+			if len(key) == 0 {
+				return false
+			}
+			n, ok := class(pattern, key[0])
+			if !ok {
+				return false
+			}
+			key = key[1:]
+			pattern = pattern[n:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(key) == 0 || pattern[0] != key[0] {
+				return false
+			}
+			key = key[1:]
+			pattern = pattern[1:]
+		}
+	}
+
+	return len(key) == 0
+}
+
+// class matches c against the [...] class at the start of pattern,
+// returning the class length and whether c is part of it.
+func class(pattern string, c byte) (int, bool) {
+	i := 1
+	not := i < len(pattern) && pattern[i] == '^'
+	if not {
+		i++
+	}
+
+	match := false
+	for ; i < len(pattern) && pattern[i] != ']'; i++ {
+		switch {
+		case pattern[i] == '\\' && i+1 < len(pattern):
+			i++
+			if pattern[i] == c {
+				match = true
+			}
+		case i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']':
+			start, end := pattern[i], pattern[i+2]
+			if start > end {
+				start, end = end, start
+			}
+			if c >= start && c <= end {
+				match = true
+			}
+			i += 2
+		case pattern[i] == c:
+			match = true
+		}
+	}
+
+	// Skip the closing bracket, an unterminated class ends the pattern.
+	if i < len(pattern) {
+		i++
+	}
+
+	return i, match != not
+}
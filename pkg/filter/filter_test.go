@@ -0,0 +1,142 @@
+package filter
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestGlob(t *testing.T) {
+	cases := []struct {
+		pattern string
+		key     string
+		match   bool
+	}{
+		{"*", "anything", true},
+		{"user:*", "user:1", true},
+		{"user:*", "order:1", false},
+		{"user:*:name", "user:1/2:name", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{"key", "key", true},
+		{"key", "keys", false},
+	}
+
+	for _, c := range cases {
+		if Glob(c.pattern, c.key) != c.match {
+			t.Errorf("pattern %s with key %s should be %v", c.pattern, c.key, c.match)
+		}
+	}
+}
+
+func TestExclude(t *testing.T) {
+	f := Filter{Exclude: []string{"tmp:*", "lock:*"}}
+
+	if !f.Keep("user:1") {
+		t.Error("user:1 should be kept")
+	}
+
+	if f.Keep("tmp:1") || f.Keep("lock:1") {
+		t.Error("excluded keys should not be kept")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	f := Filter{Match: []string{"user:*", "order:*"}, Exclude: []string{"user:tmp:*"}}
+
+	if f.Pattern() != "" {
+		t.Error("multiple patterns should not be sent as SCAN MATCH")
+	}
+
+	if !f.Keep("user:1") || !f.Keep("order:1") {
+		t.Error("keys matching any pattern should be kept")
+	}
+
+	if f.Keep("cart:1") || f.Keep("user:tmp:1") {
+		t.Error("unmatched and excluded keys should not be kept")
+	}
+
+	if (Filter{Match: []string{"user:*"}}).Pattern() != "user:*" {
+		t.Error("a single pattern should be sent as SCAN MATCH")
+	}
+
+	if (Filter{Match: []string{"user:*"}}).Selects("order:1") {
+		t.Error("a single pattern should be applied to keys not listed by SCAN")
+	}
+}
+
+func TestRange(t *testing.T) {
+	for _, s := range []string{"a", "m..a", "a..a"} {
+		if _, err := ParseRange(s); err == nil {
+			t.Errorf("%s should be invalid", s)
+		}
+	}
+
+	r, err := ParseRange("user:a..user:m")
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	f := Filter{Range: r}
+	if !f.Keep("user:a") || !f.Keep("user:lz") || f.Keep("user:m") || f.Keep("order:b") {
+		t.Error("keys should be kept from start included to end excluded")
+	}
+	if f.Pattern() != "user:*" || r.String() != "user:a..user:m" {
+		t.Errorf("wrong pattern %s or range %s", f.Pattern(), r)
+	}
+
+	// Unbounded sides, and prefixes escaped
+	r, _ = ParseRange("m..")
+	if !(Filter{Range: r}).Selects("zz") || (Filter{Range: r}).Selects("a") || (Filter{Range: r}).Pattern() != "" {
+		t.Error("m.. should hold keys from m, without pattern")
+	}
+	r, _ = ParseRange("a*[1..a*[5")
+	if p := (Filter{Range: r}).Pattern(); p != `a\*\[*` {
+		t.Errorf("wrong escaped pattern %s", p)
+	}
+	if p := (Filter{Match: []string{"user:*", "order:*"}, Range: r}).Pattern(); p != "" {
+		t.Errorf("match patterns should win over the range prefix, got %s", p)
+	}
+}
+
+func TestRules(t *testing.T) {
+	f := Filter{
+		Match:        []string{"user:*", "order:*"},
+		Exclude:      []string{"user:tmp:*"},
+		Regex:        []*regexp.Regexp{regexp.MustCompile(`:[0-9]+$`)},
+		ExcludeRegex: []*regexp.Regexp{regexp.MustCompile(`^order:0`)},
+		MinLength:    7,
+		MaxLength:    12,
+	}
+
+	cases := []struct {
+		key  string
+		rule string
+	}{
+		{"user:42", ""},
+		{"order:7", ""},
+		{"user:1", RuleLength},
+		{"user:1234567890", RuleLength},
+		{"user:tmp:1", RuleExclude},
+		{"order:01", RuleExcludeRegex},
+		{"cart:123", RuleMatch},
+		{"user:abc", RuleRegex},
+	}
+	for _, c := range cases {
+		if rule := f.SelectsRule(c.key); rule != c.rule {
+			t.Errorf("key %s should fail rule %q, result: %q", c.key, c.rule, rule)
+		}
+	}
+
+	// A single Match is applied by SCAN, regular expressions still apply
+	f = Filter{Match: []string{"user:*"}, Regex: []*regexp.Regexp{regexp.MustCompile(`^user:[0-9]+$`)}}
+	if f.KeepRule("cart:1") != RuleRegex || f.KeepRule("user:1") != "" || f.SelectsRule("cart:1") != RuleMatch {
+		t.Error("regular expressions should apply client-side to SCANned keys")
+	}
+}
@@ -0,0 +1,74 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Range is a lexical range of key names, from Start included to End
+// excluded, byte-wise as Go compares strings. An empty Start or End leaves
+// that side unbounded, the zero Range holds every key.
+type Range struct {
+	Start string
+	End   string
+}
+
+// ParseRange parses a start..end Range, either side may be empty, e.g.
+// "a..m", "..m", "m..".
+func ParseRange(s string) (Range, error) {
+	i := strings.Index(s, "..")
+	if i < 0 {
+		return Range{}, fmt.Errorf("key range must be start..end, got %s", s)
+	}
+
+	r := Range{Start: s[:i], End: s[i+2:]}
+	if r.End != "" && r.Start >= r.End {
+		return Range{}, fmt.Errorf("key range start must be before its end, got %s", s)
+	}
+
+	return r, nil
+}
+
+// String formats r as ParseRange parses it.
+func (r Range) String() string {
+	return r.Start + ".." + r.End
+}
+
+// IsSet reports whether r is bounded on either side.
+func (r Range) IsSet() bool {
+	return r.Start != "" || r.End != ""
+}
+
+// Contains reports whether key is within r.
+func (r Range) Contains(key string) bool {
+	return key >= r.Start && (r.End == "" || key < r.End)
+}
+
+// prefix returns the prefix shared by every key of r, the common prefix of
+// Start and End when both are set, empty otherwise.
+func (r Range) prefix() string {
+	if r.Start == "" || r.End == "" {
+		return ""
+	}
+
+	n := 0
+	for n < len(r.Start) && n < len(r.End) && r.Start[n] == r.End[n] {
+		n++
+	}
+
+	return r.Start[:n]
+}
+
+// Escape escapes the glob special characters of s, e.g. of a literal key
+// prefix MATCHed by SCAN.
+func Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(`*?[]\`, s[i]) >= 0 {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
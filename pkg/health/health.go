@@ -0,0 +1,157 @@
+// Package health serves liveness and readiness probes over HTTP, e.g. for
+// Kubernetes: /healthz while the process is alive, /readyz while the source
+// and target connections are healthy.
+// All methods are safe for concurrent use, and are noops on a nil Checker.
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Check returns an error when a connection is unhealthy, e.g. a PING.
+type Check func() error
+
+// Checker runs named Checks, and is ready until one of them has been failing
+// for longer than Threshold.
+type Checker struct {
+	Threshold time.Duration
+
+	mu      sync.Mutex
+	checks  map[string]Check
+	failing map[string]time.Time
+	errs    map[string]error
+	checked bool
+}
+
+// New creates a Checker, not ready until the checks first ran.
+func New(threshold time.Duration) *Checker {
+	return &Checker{
+		Threshold: threshold,
+		checks:    map[string]Check{},
+		failing:   map[string]time.Time{},
+		errs:      map[string]error{},
+	}
+}
+
+// Add adds the named check.
+func (c *Checker) Add(name string, check Check) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checks[name] = check
+}
+
+// Check runs all checks, noting since when each failing one fails.
+func (c *Checker) Check(now time.Time) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	checks := map[string]Check{}
+	for name, check := range c.checks {
+		checks[name] = check
+	}
+	c.mu.Unlock()
+
+	// Checks may block, run them unlocked
+	errs := map[string]error{}
+	for name, check := range checks {
+		errs[name] = check()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checked = true
+	for name, err := range errs {
+		c.errs[name] = err
+		if err == nil {
+			delete(c.failing, name)
+			continue
+		}
+		if _, ok := c.failing[name]; !ok {
+			c.failing[name] = now
+		}
+	}
+}
+
+// Ready returns nil when ready, or the errors of the checks failing for
+// longer than Threshold.
+func (c *Checker) Ready(now time.Time) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.checked {
+		return fmt.Errorf("not checked yet")
+	}
+
+	var failed []string
+	for name, since := range c.failing {
+		if now.Sub(since) > c.Threshold {
+			failed = append(failed, fmt.Sprintf("%s failing for %s: %s", name, now.Sub(since).Round(time.Second), c.errs[name]))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+
+	sort.Strings(failed)
+	return fmt.Errorf("%s", strings.Join(failed, ", "))
+}
+
+// Handler serves /healthz, always ok, and /readyz, 503 when not Ready.
+func (c *Checker) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if err := c.Ready(time.Now()); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+
+	return mux
+}
+
+// Run serves the probes on addr, running the checks every interval, until
+// the context is done.
+// It will be run in an ErrGroup supervisor.
+func (c *Checker) Run(ctx context.Context, addr string, interval time.Duration) error {
+	server := &http.Server{Addr: addr, Handler: c.Handler()}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		c.Check(time.Now())
+
+		select {
+		case err := <-errs:
+			return fmt.Errorf("error serving health probes on %s: %w", addr, err)
+		case <-ticker.C:
+		case <-ctx.Done():
+			server.Close()
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package health
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func status(t *testing.T, h http.Handler, path string) int {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	return w.Code
+}
+
+func TestReady(t *testing.T) {
+	var err error
+	c := New(30 * time.Second)
+	c.Add("source", func() error { return nil })
+	c.Add("target", func() error { return err })
+	h := c.Handler()
+
+	if status(t, h, "/healthz") != http.StatusOK {
+		t.Error("should be alive")
+	}
+	if status(t, h, "/readyz") != http.StatusServiceUnavailable {
+		t.Error("should not be ready before the first check")
+	}
+
+	now := time.Now()
+	c.Check(now)
+	if status(t, h, "/readyz") != http.StatusOK {
+		t.Error("should be ready")
+	}
+
+	// Failures within the threshold are tolerated
+	err = errors.New("connection refused")
+	c.Check(now)
+	c.Check(now.Add(20 * time.Second))
+	if err := c.Ready(now.Add(20 * time.Second)); err != nil {
+		t.Error("should still be ready: ", err)
+	}
+	if err := c.Ready(now.Add(31 * time.Second)); err == nil {
+		t.Error("should not be ready after the threshold")
+	}
+
+	err = nil
+	c.Check(now.Add(40 * time.Second))
+	if err := c.Ready(now.Add(40 * time.Second)); err != nil {
+		t.Error("should be ready again: ", err)
+	}
+}
+
+func TestNil(t *testing.T) {
+	var c *Checker
+	c.Add("source", func() error { return nil })
+	c.Check(time.Now())
+	if err := c.Ready(time.Now()); err != nil {
+		t.Error("nil Checker should be ready: ", err)
+	}
+}
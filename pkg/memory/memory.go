@@ -0,0 +1,214 @@
+// Package memory allows reading/writing from/to a keyspace held in memory,
+// a Go map, in place of a Redis server, e.g. in the tests of code embedding
+// rump, or of filters and transforms.
+// Values are opaque, DUMP payloads or commands as read, and TTLs logical:
+// keys expire per the Memory clock, Now, without being evicted.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/stickermule/rump/pkg/filter"
+	"github.com/stickermule/rump/pkg/message"
+	"github.com/stickermule/rump/pkg/summary"
+)
+
+// Key is a Memory key: its Value, RESP commands recreating it with
+// Commands, and the time it Expires at, zero without expiration.
+type Key struct {
+	Value    string
+	Commands bool
+	Expires  time.Time
+}
+
+// Memory can read and write a keyspace held in memory, using the message Bus.
+// TTL sends and restores the remaining TTL of keys, persistent otherwise.
+// Filter selects the keys read, client-side.
+// Prefix, when set, prefixes the names of the keys read, as a merged source
+// prefix.
+// SkipExisting writes keys only when missing, skipping existing ones.
+// Now is the clock keys expire per, time.Now when nil.
+// Summary collects the run counters.
+type Memory struct {
+	Bus          message.Bus
+	Silent       bool
+	TTL          bool
+	Filter       filter.Filter
+	Prefix       string
+	SkipExisting bool
+	Now          func() time.Time
+	Summary      *summary.Summary
+
+	mu   sync.Mutex
+	keys map[string]Key
+}
+
+// New creates an empty Memory, to be used for reading/writing.
+func New(bus message.Bus, silent, ttl bool) *Memory {
+	return &Memory{
+		Bus:    bus,
+		Silent: silent,
+		TTL:    ttl,
+		keys:   map[string]Key{},
+	}
+}
+
+// now returns the time of the Memory clock.
+func (m *Memory) now() time.Time {
+	if m.Now == nil {
+		return time.Now()
+	}
+
+	return m.Now()
+}
+
+// live returns key unless missing or expired, the mutex held.
+func (m *Memory) live(key string) (Key, bool) {
+	k, ok := m.keys[key]
+	if !ok || (!k.Expires.IsZero() && !k.Expires.After(m.now())) {
+		return Key{}, false
+	}
+
+	return k, true
+}
+
+// Set sets key to value, expiring after ttl, never when 0.
+func (m *Memory) Set(key, value string, ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := Key{Value: value}
+	if ttl > 0 {
+		k.Expires = m.now().Add(ttl)
+	}
+	m.keys[key] = k
+}
+
+// Get returns key, false when missing or expired.
+func (m *Memory) Get(key string) (Key, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.live(key)
+}
+
+// Keys returns the sorted names of the keys not expired.
+func (m *Memory) Keys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var keys []string
+	for key := range m.keys {
+		if _, ok := m.live(key); ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Log read/write operations unless silent mode enabled
+func (m *Memory) maybeLog(s string) {
+	if m.Silent {
+		return
+	}
+	fmt.Print(s)
+}
+
+// Read sends the keys not expired passing the Filter to the message bus,
+// sorted by name, with their remaining TTL in milliseconds with TTL.
+func (m *Memory) Read(ctx context.Context) error {
+	defer close(m.Bus)
+
+	for _, key := range m.Keys() {
+		if !m.Filter.Selects(key) {
+			continue
+		}
+		k, ok := m.Get(key)
+		if !ok {
+			continue
+		}
+
+		p := message.Payload{Key: m.Prefix + key, Value: k.Value, Commands: k.Commands, TTL: "0"}
+		if m.TTL && !k.Expires.IsZero() {
+			// RESTORE TTL 0 is no expiration, keys expiring within 1ms are kept for 1ms
+			ttl := k.Expires.Sub(m.now()) / time.Millisecond
+			if ttl < 1 {
+				ttl = 1
+			}
+			p.TTL = strconv.FormatInt(int64(ttl), 10)
+		}
+
+		select {
+		case <-ctx.Done():
+			fmt.Println("memory: done")
+			return ctx.Err()
+		case m.Bus <- p:
+			m.Summary.Incr("read")
+			m.maybeLog(fmt.Sprintf("memory: read %s => ttl=%s, size=%d\n", message.FormatKey(p.Key), p.TTL, len(p.Value)))
+		}
+	}
+
+	return nil
+}
+
+// Write stores keys as they come on the message bus, with their TTL with
+// TTL, deleting tombstoned ones.
+func (m *Memory) Write(ctx context.Context) error {
+	for m.Bus != nil {
+		select {
+		case <-ctx.Done():
+			fmt.Println("memory: done writing")
+			return ctx.Err()
+		case p, ok := <-m.Bus:
+			if !ok {
+				m.Bus = nil
+				continue
+			}
+			if err := m.write(p); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// write stores or deletes a single Payload.
+func (m *Memory) write(p message.Payload) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Summary.Track(p.Key)
+	if p.Tombstone {
+		delete(m.keys, p.Key)
+		m.Summary.Incr("tombstoned")
+		m.maybeLog(fmt.Sprintf("memory: delete %s\n", message.FormatKey(p.Key)))
+		return nil
+	}
+
+	if _, ok := m.live(p.Key); ok && m.SkipExisting {
+		m.Summary.Incr("skipped-existing")
+		return nil
+	}
+
+	ttl, err := strconv.ParseInt(p.TTL, 10, 64)
+	if err != nil || ttl < 0 {
+		return fmt.Errorf("invalid TTL \"%s\" of key %s", p.TTL, message.FormatKey(p.Key))
+	}
+	k := Key{Value: p.Value, Commands: p.Commands}
+	if m.TTL && ttl > 0 {
+		k.Expires = m.now().Add(time.Duration(ttl) * time.Millisecond)
+	}
+	m.keys[p.Key] = k
+	m.Summary.Incr("restored")
+	m.maybeLog(fmt.Sprintf("memory: write %s => ttl=%d, size=%d\n", message.FormatKey(p.Key), ttl, len(p.Value)))
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package memory_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stickermule/rump/pkg/filter"
+	"github.com/stickermule/rump/pkg/memory"
+	"github.com/stickermule/rump/pkg/message"
+	"github.com/stickermule/rump/pkg/summary"
+)
+
+// Test keys are synced between two Memory keyspaces, filtered, prefixed,
+// expired keys left out and TTLs kept
+func TestReadWrite(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	clock := func() time.Time { return now }
+
+	ch := make(message.Bus, 100)
+	source := memory.New(ch, true, true)
+	source.Now = clock
+	source.Filter = filter.Filter{Exclude: []string{"tmp:*"}}
+	source.Prefix = "eu:"
+	source.Set("user:1", "v1", 0)
+	source.Set("user:2", "v2", time.Minute)
+	source.Set("user:3", "v3", time.Second)
+	source.Set("tmp:1", "v", 0)
+	now = now.Add(2 * time.Second)
+
+	target := memory.New(ch, true, true)
+	target.Now = clock
+	target.Summary = summary.New()
+
+	if err := source.Read(context.Background()); err != nil {
+		t.Error("error: ", err)
+	}
+	if err := target.Write(context.Background()); err != nil {
+		t.Error("error: ", err)
+	}
+
+	if keys := target.Keys(); !reflect.DeepEqual(keys, []string{"eu:user:1", "eu:user:2"}) {
+		t.Errorf("unexpected keys %v", keys)
+	}
+	k, ok := target.Get("eu:user:2")
+	if !ok || k.Value != "v2" || k.Expires != now.Add(58*time.Second) {
+		t.Errorf("unexpected eu:user:2 %+v", k)
+	}
+	if k, _ := target.Get("eu:user:1"); !k.Expires.IsZero() {
+		t.Errorf("expected eu:user:1 persistent, result: %+v", k)
+	}
+	if n := target.Summary.Get("restored"); n != 2 {
+		t.Errorf("expected 2 restored, result: %d", n)
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := target.Get("eu:user:2"); ok {
+		t.Error("expected eu:user:2 expired")
+	}
+}
+
+// Test tombstones delete keys, and existing keys are kept with SkipExisting
+func TestWrite(t *testing.T) {
+	ch := make(message.Bus, 100)
+	target := memory.New(ch, true, false)
+	target.SkipExisting = true
+	target.Summary = summary.New()
+	target.Set("a", "old", 0)
+	target.Set("b", "old", 0)
+
+	ch <- message.Payload{Key: "a", Value: "new", TTL: "0"}
+	ch <- message.Payload{Key: "b", Tombstone: true}
+	ch <- message.Payload{Key: "c", Value: "new", TTL: "5000"}
+	close(ch)
+
+	if err := target.Write(context.Background()); err != nil {
+		t.Error("error: ", err)
+	}
+	if k, _ := target.Get("a"); k.Value != "old" {
+		t.Errorf("expected a kept, result: %+v", k)
+	}
+	if _, ok := target.Get("b"); ok {
+		t.Error("expected b deleted")
+	}
+	// Without TTL, keys are written persistent
+	if k, _ := target.Get("c"); k.Value != "new" || !k.Expires.IsZero() {
+		t.Errorf("unexpected c %+v", k)
+	}
+	if n := target.Summary.Get("skipped-existing"); n != 1 {
+		t.Errorf("expected 1 skipped-existing, result: %d", n)
+	}
+}
@@ -0,0 +1,38 @@
+package message
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+)
+
+// Encodings of the key names in logs, reports and file names: as is, Go
+// quoted, e.g. "a\nb", hex or base64 encoded. Commands always send the raw
+// key.
+const (
+	KeyRaw    = "raw"
+	KeyQuoted = "quoted"
+	KeyHex    = "hex"
+	KeyBase64 = "base64"
+)
+
+// KeyEncodings are the valid KeyEncoding encodings.
+var KeyEncodings = []string{KeyRaw, KeyQuoted, KeyHex, KeyBase64}
+
+// KeyEncoding is the encoding of the key names rendered by FormatKey, set
+// once before a run, KeyQuoted by default, binary keys breaking no lines.
+var KeyEncoding = KeyQuoted
+
+// FormatKey renders key per KeyEncoding, to be logged or reported.
+func FormatKey(key string) string {
+	switch KeyEncoding {
+	case KeyRaw:
+		return key
+	case KeyHex:
+		return hex.EncodeToString([]byte(key))
+	case KeyBase64:
+		return base64.StdEncoding.EncodeToString([]byte(key))
+	}
+
+	return strconv.Quote(key)
+}
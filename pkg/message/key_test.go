@@ -0,0 +1,32 @@
+package message_test
+
+import (
+	"testing"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// Test keys with newlines, NULs and UTF-8 are rendered per KeyEncoding,
+// quoted by default
+func TestFormatKey(t *testing.T) {
+	defer func() { message.KeyEncoding = message.KeyQuoted }()
+
+	keys := []string{"user:1", "line\nbreak", "nul\x00key", "clé:été"}
+	expected := map[string][]string{
+		message.KeyQuoted: {`"user:1"`, `"line\nbreak"`, `"nul\x00key"`, `"clé:été"`},
+		message.KeyRaw:    {"user:1", "line\nbreak", "nul\x00key", "clé:été"},
+		message.KeyHex:    {"757365723a31", "6c696e650a627265616b", "6e756c006b6579", "636cc3a93ac3a974c3a9"},
+		message.KeyBase64: {"dXNlcjox", "bGluZQpicmVhaw==", "bnVsAGtleQ==", "Y2zDqTrDqXTDqQ=="},
+	}
+	if message.KeyEncoding != message.KeyQuoted {
+		t.Errorf("expected keys quoted by default, result: %s", message.KeyEncoding)
+	}
+	for encoding, rendered := range expected {
+		message.KeyEncoding = encoding
+		for i, key := range keys {
+			if s := message.FormatKey(key); s != rendered[i] {
+				t.Errorf("%s: expected %s, result: %s", encoding, rendered[i], s)
+			}
+		}
+	}
+}
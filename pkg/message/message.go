@@ -3,10 +3,31 @@
 package message
 
 // Payload represents a Redis key/value pair with TTL.
+// Commands marks a Value holding the RESP commands recreating the key,
+// in place of a DUMP payload.
+// Type is the key type, e.g. hash, when read, empty otherwise.
+// Tombstone marks a key deleted since the base of an incremental dump, to be
+// deleted, without Value.
+// Idle and Freq are the LRU idle time in seconds and the LFU counter of the
+// key, when known, restored with RESTORE IDLETIME or FREQ, empty otherwise.
+// DB is the source database of the key, when known, e.g. read off an RDB
+// snapshot of several, empty otherwise.
+// Source identifies the source the key was read from, when merging several,
+// empty otherwise.
+// Original is the key name read, when renamed since, e.g. prefixed by a
+// merged source, empty otherwise.
 type Payload struct {
-	Key   string
-	Value string
-	TTL   string
+	Key       string
+	Value     string
+	TTL       string
+	Commands  bool
+	Type      string
+	Tombstone bool
+	Idle      string
+	Freq      string
+	DB        string
+	Source    string
+	Original  string
 }
 
 // Bus is a channel where message Payloads pass.
@@ -0,0 +1,59 @@
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// Checkpoint is the content of a checkpoint file, the SCAN Cursor a run
+// from Source to Target stopped at, Done once a run completed the scan.
+// Keys counts the keys processed by all the runs, Time is RFC 3339 in UTC.
+type Checkpoint struct {
+	Cursor string `json:"cursor"`
+	Done   bool   `json:"done"`
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Keys   int64  `json:"keys"`
+	Time   string `json:"time"`
+}
+
+// ReadCheckpoint reads the checkpoint file path of a run from source to
+// target, starting from cursor 0 when missing. Checkpoints of other runs
+// are errors, rather than resuming a foreign cursor.
+func ReadCheckpoint(path, source, target string) (Checkpoint, error) {
+	c := Checkpoint{Cursor: "0", Source: source, Target: target}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return c, fmt.Errorf("error reading checkpoint: %w", err)
+	}
+
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("error reading checkpoint %s: %w", path, err)
+	}
+	if c.Source != source || c.Target != target {
+		return c, fmt.Errorf("checkpoint %s is of a run from %s to %s", path, c.Source, c.Target)
+	}
+
+	return c, nil
+}
+
+// WriteCheckpoint writes c to path, replacing the previous checkpoint
+// atomically.
+func WriteCheckpoint(path string, c Checkpoint) error {
+	c.Time = time.Now().UTC().Format(time.RFC3339)
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := replace(path, b); err != nil {
+		return fmt.Errorf("error writing checkpoint: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+// Package progress periodically writes the run progress to a JSON file, for
+// job monitoring tools to poll. Files are replaced atomically, so that
+// readers never see a partial write.
+// All methods are safe for concurrent use, and are noops on a nil File.
+package progress
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/stickermule/rump/pkg/summary"
+)
+
+// Run phases, reading and writing overlap until the source is read.
+const (
+	Estimating = "estimating"
+	Reading    = "reading"
+	Writing    = "writing"
+	Done       = "done"
+	Failed     = "error"
+)
+
+// Report is the progress file content. Total is the estimated keys count,
+// 0 when unknown, as is ETA. Durations are in seconds.
+type Report struct {
+	RunID   string  `json:"run_id,omitempty"`
+	Phase   string  `json:"phase"`
+	Keys    int64   `json:"keys"`
+	Total   int64   `json:"total"`
+	Rate    float64 `json:"rate"`
+	Elapsed float64 `json:"elapsed"`
+	ETA     float64 `json:"eta"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// File writes Reports of the Summary processed keys to Path.
+type File struct {
+	Path    string
+	Summary *summary.Summary
+
+	mu    sync.Mutex
+	phase string
+	total int64
+	err   string
+}
+
+// New creates a File, in the Reading phase.
+func New(path string, sum *summary.Summary) *File {
+	return &File{Path: path, Summary: sum, phase: Reading}
+}
+
+// SetPhase sets the current phase.
+func (f *File) SetPhase(phase string) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.phase = phase
+}
+
+// SetTotal sets the estimated keys count.
+func (f *File) SetTotal(total int64) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.total = total
+}
+
+// Report returns the current progress.
+func (f *File) Report() Report {
+	if f == nil {
+		return Report{}
+	}
+	keys, elapsed := f.Summary.Processed()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	r := Report{
+		RunID:   f.Summary.RunID(),
+		Phase:   f.phase,
+		Keys:    keys,
+		Total:   f.total,
+		Elapsed: elapsed.Seconds(),
+		Error:   f.err,
+	}
+	if r.Elapsed > 0 {
+		r.Rate = float64(keys) / r.Elapsed
+	}
+	if r.Rate > 0 && r.Total > keys && r.Phase != Done && r.Phase != Failed {
+		r.ETA = float64(r.Total-keys) / r.Rate
+	}
+
+	return r
+}
+
+// Write writes the current Report, to a temporary file renamed over Path.
+func (f *File) Write() error {
+	if f == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(f.Report())
+	if err != nil {
+		return err
+	}
+	if err := replace(f.Path, b); err != nil {
+		return fmt.Errorf("error writing progress file: %w", err)
+	}
+
+	return nil
+}
+
+// replace writes the JSON b to a temporary file renamed over path.
+func replace(path string, b []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	// Readable by monitoring tools running as other users
+	err = tmp.Chmod(0644)
+	if err == nil {
+		_, err = tmp.Write(append(b, '\n'))
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+
+	return err
+}
+
+// Run writes the progress every interval, until the context is done.
+// Write errors are logged, without stopping the run.
+// It will be run in an ErrGroup supervisor.
+func (f *File) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := f.Write(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Finish writes the terminal Report, Failed with err, Done otherwise.
+func (f *File) Finish(err error) error {
+	if f == nil {
+		return nil
+	}
+
+	f.mu.Lock()
+	f.phase = Done
+	if err != nil {
+		f.phase, f.err = Failed, err.Error()
+	}
+	f.mu.Unlock()
+
+	return f.Write()
+}
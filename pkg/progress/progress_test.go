@@ -0,0 +1,174 @@
+package progress
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stickermule/rump/pkg/summary"
+)
+
+func read(t *testing.T, path string) Report {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	var r Report
+	if err := json.Unmarshal(b, &r); err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	return r
+}
+
+func TestWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rump-progress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "progress.json")
+
+	sum := summary.New()
+	f := New(path, sum)
+	f.SetTotal(4)
+	sum.Track("a")
+	sum.Track("b")
+	f.SetPhase(Writing)
+
+	if err := f.Write(); err != nil {
+		t.Fatal("error: ", err)
+	}
+	r := read(t, path)
+	if r.Phase != Writing || r.Keys != 2 || r.Total != 4 || r.Rate <= 0 || r.ETA <= 0 {
+		t.Errorf("wrong progress: %+v", r)
+	}
+
+	if err := f.Finish(errors.New("boom")); err != nil {
+		t.Fatal("error: ", err)
+	}
+	r = read(t, path)
+	if r.Phase != Failed || r.Error != "boom" || r.ETA != 0 {
+		t.Errorf("wrong final progress: %+v", r)
+	}
+
+	// Temporary files are renamed or removed
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("expected only the progress file, got %d files", len(files))
+	}
+}
+
+func TestNil(t *testing.T) {
+	var f *File
+	f.SetPhase(Done)
+	if err := f.Finish(nil); err != nil {
+		t.Error("error: ", err)
+	}
+}
+
+func TestRanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rump-ranges")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ranges.jsonl")
+
+	if done, err := RangeDone(path, "a..m", "redis://s", "redis://t"); done || err != nil {
+		t.Errorf("a missing manifest should hold no range, error: %v", err)
+	}
+	for _, r := range []string{"a..m", "m.."} {
+		if err := AddRange(path, r, "redis://s", "redis://t", 10); err != nil {
+			t.Fatal("error: ", err)
+		}
+	}
+
+	for _, c := range []struct {
+		r, target string
+		done      bool
+	}{
+		{"a..m", "redis://t", true},
+		{"m..", "redis://t", true},
+		{"a..m", "redis://other", false},
+		{"..a", "redis://t", false},
+	} {
+		if done, err := RangeDone(path, c.r, "redis://s", c.target); done != c.done || err != nil {
+			t.Errorf("%s to %s: expected done=%v, result: %v, error: %v", c.r, c.target, c.done, done, err)
+		}
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rump-checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint.json")
+
+	c, err := ReadCheckpoint(path, "redis://s", "redis://t")
+	if err != nil || c.Cursor != "0" || c.Done {
+		t.Errorf("a missing checkpoint should start from cursor 0, result: %+v, error: %v", c, err)
+	}
+
+	c.Cursor, c.Keys = "1234", 10
+	if err := WriteCheckpoint(path, c); err != nil {
+		t.Fatal("error: ", err)
+	}
+	c, err = ReadCheckpoint(path, "redis://s", "redis://t")
+	if err != nil || c.Cursor != "1234" || c.Keys != 10 || c.Time == "" {
+		t.Errorf("expected cursor 1234 and 10 keys, result: %+v, error: %v", c, err)
+	}
+
+	if _, err := ReadCheckpoint(path, "redis://s", "redis://other"); err == nil {
+		t.Error("a checkpoint of another target should be an error")
+	}
+}
+
+func TestWriteTextfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rump-textfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "rump.prom")
+
+	sum := summary.New()
+	sum.SetRunID("job-42")
+	sum.Track("a")
+	sum.Track("b")
+	sum.Incr("failed")
+	sum.Incr(`odd"name`)
+	if err := WriteTextfile(path, sum, nil); err != nil {
+		t.Fatal("error: ", err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	for _, expected := range []string{
+		"# TYPE rump_last_run_keys_total counter\nrump_last_run_keys_total 2\n",
+		"rump_last_run_errors_total 1\n",
+		"rump_last_run_success 1\n",
+		"rump_last_run_duration_seconds ",
+		`rump_last_run_counter{name="odd\"name"} 1` + "\n",
+		`rump_last_run_info{run_id="job-42"} 1` + "\n",
+	} {
+		if !strings.Contains(string(b), expected) {
+			t.Errorf("expected %q in:\n%s", expected, b)
+		}
+	}
+
+	if err := WriteTextfile(path, sum, errors.New("boom")); err != nil {
+		t.Fatal("error: ", err)
+	}
+	if b, _ := ioutil.ReadFile(path); !strings.Contains(string(b), "rump_last_run_success 0\n") {
+		t.Errorf("expected a failed run, result:\n%s", b)
+	}
+}
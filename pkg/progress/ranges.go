@@ -0,0 +1,77 @@
+package progress
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Range is a line of a ranges manifest, a key range completed from Source
+// to Target, with the Keys processed, Time is RFC 3339 in UTC.
+type Range struct {
+	Range  string `json:"range"`
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Keys   int64  `json:"keys"`
+	Time   string `json:"time"`
+}
+
+// RangeDone reports whether the manifest path holds the key range r,
+// completed from source to target. A missing manifest holds none.
+func RangeDone(path, r, source, target string) (bool, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error reading ranges manifest: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var done Range
+		if err := json.Unmarshal(scanner.Bytes(), &done); err != nil {
+			return false, fmt.Errorf("error reading ranges manifest, line %d: %w", line, err)
+		}
+		if done.Range == r && done.Source == source && done.Target == target {
+			return true, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("error reading ranges manifest: %w", err)
+	}
+
+	return false, nil
+}
+
+// AddRange appends the completed key range r to the manifest path, created
+// when missing. Processes sharing the manifest append whole lines.
+func AddRange(path, r, source, target string, keys int64) error {
+	b, err := json.Marshal(Range{
+		Range:  r,
+		Source: source,
+		Target: target,
+		Keys:   keys,
+		Time:   time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening ranges manifest: %w", err)
+	}
+	_, err = f.Write(append(b, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing ranges manifest: %w", err)
+	}
+
+	return nil
+}
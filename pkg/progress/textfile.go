@@ -0,0 +1,55 @@
+package progress
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stickermule/rump/pkg/summary"
+)
+
+// WriteTextfile writes the final Summary of a run, failed with err when
+// set, to path in the Prometheus text exposition format, for the textfile
+// collector of node_exporter, replacing the previous file atomically.
+// Errors are the failed keys, the summary counters are exported by name
+// as rump_last_run_counter, the run ID as rump_last_run_info, when set.
+func WriteTextfile(path string, sum *summary.Summary, err error) error {
+	s := sum.Snapshot()
+	success := 1
+	if err != nil {
+		success = 0
+	}
+
+	var b strings.Builder
+	metric := func(name, typ, help string, value interface{}) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, typ, name, value)
+	}
+	metric("rump_last_run_success", "gauge", "Whether the last run succeeded, 1, or failed, 0.", success)
+	metric("rump_last_run_keys_total", "counter", "Keys processed by the last run.", s.Keys)
+	metric("rump_last_run_errors_total", "counter", "Keys the last run failed to restore.", s.Counters["failed"])
+	metric("rump_last_run_duration_seconds", "gauge", "Duration of the last run.", s.Elapsed)
+	metric("rump_last_run_timestamp_seconds", "gauge", "Unix time the last run ended at.", time.Now().Unix())
+	if s.RunID != "" {
+		fmt.Fprintf(&b, "# HELP rump_last_run_info ID of the last run.\n# TYPE rump_last_run_info gauge\nrump_last_run_info{run_id=\"%s\"} 1\n", labelEscaper.Replace(s.RunID))
+	}
+
+	var names []string
+	for name := range s.Counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	b.WriteString("# HELP rump_last_run_counter Summary counters of the last run, by name.\n# TYPE rump_last_run_counter gauge\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "rump_last_run_counter{name=\"%s\"} %d\n", labelEscaper.Replace(name), s.Counters[name])
+	}
+
+	if err := replace(path, []byte(strings.TrimSuffix(b.String(), "\n"))); err != nil {
+		return fmt.Errorf("error writing prometheus textfile: %w", err)
+	}
+
+	return nil
+}
+
+// labelEscaper escapes label values as the exposition format requires.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,103 @@
+// Package ratelimit throttles operations using a token bucket.
+// A Limiter can be shared by multiple goroutines, e.g. writers to
+// different destinations, to cap their combined throughput.
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket refilled at Rate tokens per second,
+// holding up to one second worth of tokens.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// New creates a Limiter allowing rate operations per second.
+// A rate of 0 or less means unlimited, and returns a nil Limiter.
+func New(rate float64) *Limiter {
+	if rate <= 0 {
+		return nil
+	}
+
+	return &Limiter{
+		rate:   rate,
+		tokens: 1,
+		last:   time.Now(),
+	}
+}
+
+// Rate returns the current rate, 0 when unlimited.
+func (l *Limiter) Rate() float64 {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.rate
+}
+
+// SetRate changes the rate, e.g. to adapt to the load of a server.
+func (l *Limiter) SetRate(rate float64) {
+	if l == nil || rate <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(time.Now())
+	l.rate = rate
+}
+
+// refill adds the tokens earned since the last refill.
+func (l *Limiter) refill(now time.Time) {
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+}
+
+// Wait blocks until a token is available, or ctx is done.
+// It's a noop on a nil Limiter.
+func (l *Limiter) Wait(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN blocks until n tokens are available, or ctx is done.
+// n larger than the bucket, e.g. bytes of a large value, is allowed and
+// borrows from the future.
+func (l *Limiter) WaitN(ctx context.Context, n float64) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	l.refill(time.Now())
+	l.tokens -= n
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+
+	t := time.NewTimer(wait)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
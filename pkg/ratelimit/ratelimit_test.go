@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUnlimited(t *testing.T) {
+	l := New(0)
+	if l != nil {
+		t.Error("rate 0 should be unlimited")
+	}
+
+	if err := l.Wait(context.Background()); err != nil {
+		t.Error("error: ", err)
+	}
+}
+
+func TestWait(t *testing.T) {
+	l := New(100)
+	start := time.Now()
+
+	// First token is available right away, the next 10 take 100ms.
+	for i := 0; i < 11; i++ {
+		l.Wait(context.Background())
+	}
+
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("rate not respected, elapsed: %s", elapsed)
+	}
+}
+
+func TestShared(t *testing.T) {
+	l := New(100)
+	start := time.Now()
+
+	// Two writers sharing the limiter split the same budget.
+	var wg sync.WaitGroup
+	for w := 0; w < 2; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				l.Wait(context.Background())
+			}
+		}()
+	}
+	wg.Wait()
+
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("aggregate rate not respected, elapsed: %s", elapsed)
+	}
+}
+
+func TestWaitCancel(t *testing.T) {
+	l := New(1)
+	l.Wait(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := l.Wait(ctx); err != context.Canceled {
+		t.Errorf("wait should be canceled, got %v", err)
+	}
+}
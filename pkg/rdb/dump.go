@@ -0,0 +1,89 @@
+package rdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc64"
+	"math/bits"
+)
+
+// crcTable is the CRC-64/Jones table used by Redis, reflected.
+var crcTable = crc64.MakeTable(bits.Reverse64(0xad93d23594c935a9))
+
+// checksum updates the Redis CRC64 crc with p. Redis uses a zero initial
+// value and no final XOR, where hash/crc64 inverts both.
+func checksum(crc uint64, p []byte) uint64 {
+	return ^crc64.Update(^crc, crcTable, p)
+}
+
+// since is the RDB version introducing each value type, older ones being
+// loaded by any Redis with RESTORE.
+var since = map[byte]int{
+	typeZset2:            8,
+	typeModule:           8,
+	typeModule2:          9,
+	typeListQuicklist:    7,
+	typeStreamListpacks:  9,
+	typeHashListpack:     10,
+	typeZsetListpack:     10,
+	typeListQuicklist2:   10,
+	typeStreamListpacks2: 10,
+	typeSetListpack:      11,
+	typeStreamListpacks3: 11,
+}
+
+// Loads tells if Redis servers of RDB version load values of type t.
+func Loads(t byte, version int) bool {
+	return since[t] <= version
+}
+
+// Dump builds the DUMP payload of an Entry Raw value, RESTOREd by Redis
+// servers of RDB version and later: the value, the version and a CRC64.
+func Dump(raw []byte, version int) []byte {
+	payload := make([]byte, len(raw), len(raw)+10)
+	copy(payload, raw)
+
+	var footer [8]byte
+	binary.LittleEndian.PutUint16(footer[:], uint16(version))
+	payload = append(payload, footer[:2]...)
+	binary.LittleEndian.PutUint64(footer[:], checksum(0, payload))
+
+	return append(payload, footer[:]...)
+}
+
+// CheckDump verifies the footer of a DUMP payload, its RDB version and CRC64,
+// as RESTORE does, without loading the value.
+func CheckDump(payload []byte) error {
+	if len(payload) < 10 {
+		return fmt.Errorf("payload of %d bytes, shorter than its footer", len(payload))
+	}
+
+	footer := payload[len(payload)-10:]
+	if version := binary.LittleEndian.Uint16(footer); version > MaxVersion {
+		return fmt.Errorf("unknown RDB version %d, up to %d known", version, MaxVersion)
+	}
+	crc := binary.LittleEndian.Uint64(footer[2:])
+	if sum := checksum(0, payload[:len(payload)-8]); sum != crc {
+		return fmt.Errorf("wrong CRC64 %016x, payload sums to %016x", crc, sum)
+	}
+
+	return nil
+}
+
+// DumpString decodes the value of a string DUMP payload, plain, integer or
+// LZF encoded, false for other types or malformed payloads.
+func DumpString(payload []byte) (string, bool) {
+	if len(payload) < 11 || payload[0] != typeString {
+		return "", false
+	}
+
+	r := &Reader{r: bufio.NewReader(bytes.NewReader(payload[1 : len(payload)-10]))}
+	value, err := r.readString()
+	if err != nil {
+		return "", false
+	}
+
+	return value, true
+}
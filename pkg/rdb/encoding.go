@@ -0,0 +1,296 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"strconv"
+)
+
+// lzfDecompress decompresses LZF compressed strings of size n.
+func lzfDecompress(in []byte, n int) ([]byte, bool) {
+	out := make([]byte, 0, n)
+
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+
+		// Literal run
+		if ctrl < 32 {
+			end := i + ctrl + 1
+			if end > len(in) {
+				return nil, false
+			}
+			out = append(out, in[i:end]...)
+			i = end
+			continue
+		}
+
+		// Back reference
+		length := ctrl >> 5
+		if length == 7 {
+			if i >= len(in) {
+				return nil, false
+			}
+			length += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, false
+		}
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[i]) - 1
+		i++
+		if ref < 0 {
+			return nil, false
+		}
+		for j := 0; j < length+2; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+
+	return out, len(out) == n
+}
+
+// span returns the n bytes of b at i, false when out of bounds.
+func span(b []byte, i, n int) ([]byte, bool) {
+	if n < 0 || i+n > len(b) {
+		return nil, false
+	}
+
+	return b[i : i+n], true
+}
+
+// ziplist decodes the elements of a ziplist.
+func ziplist(b []byte) ([]string, bool) {
+	var elems []string
+
+	// zlbytes, zltail and zllen header
+	i := 10
+	for i < len(b) {
+		if b[i] == 0xff {
+			return elems, true
+		}
+
+		// Previous entry length
+		if b[i] == 0xfe {
+			i += 5
+		} else {
+			i++
+		}
+		if i >= len(b) {
+			return nil, false
+		}
+
+		enc := b[i]
+		var header, size int
+		var integer bool
+		switch {
+		case enc>>6 == 0:
+			header, size = 1, int(enc&0x3f)
+		case enc>>6 == 1:
+			if i+1 >= len(b) {
+				return nil, false
+			}
+			header, size = 2, int(enc&0x3f)<<8|int(b[i+1])
+		case enc>>6 == 2:
+			n, ok := span(b, i+1, 4)
+			if !ok {
+				return nil, false
+			}
+			header, size = 5, int(binary.BigEndian.Uint32(n))
+		case enc == 0xc0:
+			header, size, integer = 1, 2, true
+		case enc == 0xd0:
+			header, size, integer = 1, 4, true
+		case enc == 0xe0:
+			header, size, integer = 1, 8, true
+		case enc == 0xf0:
+			header, size, integer = 1, 3, true
+		case enc == 0xfe:
+			header, size, integer = 1, 1, true
+		case enc >= 0xf1 && enc <= 0xfd:
+			// Immediate 0 to 12
+			elems = append(elems, strconv.Itoa(int(enc&0x0f)-1))
+			i++
+			continue
+		default:
+			return nil, false
+		}
+
+		data, ok := span(b, i+header, size)
+		if !ok {
+			return nil, false
+		}
+		if integer {
+			elems = append(elems, strconv.FormatInt(littleEndian(data), 10))
+		} else {
+			elems = append(elems, string(data))
+		}
+		i += header + size
+	}
+
+	return nil, false
+}
+
+// listpack decodes the elements of a listpack.
+func listpack(b []byte) ([]string, bool) {
+	var elems []string
+
+	// Total bytes and elements count header
+	i := 6
+	for i < len(b) {
+		enc := b[i]
+		if enc == 0xff {
+			return elems, true
+		}
+
+		var header, size int
+		var integer bool
+		switch {
+		case enc&0x80 == 0:
+			// 7 bit unsigned
+			elems = append(elems, strconv.Itoa(int(enc)))
+			i += 2
+			continue
+		case enc&0xc0 == 0x80:
+			header, size = 1, int(enc&0x3f)
+		case enc&0xe0 == 0xc0:
+			// 13 bit signed
+			if i+1 >= len(b) {
+				return nil, false
+			}
+			v := int(enc&0x1f)<<8 | int(b[i+1])
+			if v >= 1<<12 {
+				v -= 1 << 13
+			}
+			elems = append(elems, strconv.Itoa(v))
+			i += 3
+			continue
+		case enc&0xf0 == 0xe0:
+			if i+1 >= len(b) {
+				return nil, false
+			}
+			header, size = 2, int(enc&0x0f)<<8|int(b[i+1])
+		case enc == 0xf0:
+			n, ok := span(b, i+1, 4)
+			if !ok {
+				return nil, false
+			}
+			header, size = 5, int(binary.LittleEndian.Uint32(n))
+		case enc == 0xf1:
+			header, size, integer = 1, 2, true
+		case enc == 0xf2:
+			header, size, integer = 1, 3, true
+		case enc == 0xf3:
+			header, size, integer = 1, 4, true
+		case enc == 0xf4:
+			header, size, integer = 1, 8, true
+		default:
+			return nil, false
+		}
+
+		data, ok := span(b, i+header, size)
+		if !ok {
+			return nil, false
+		}
+		if integer {
+			elems = append(elems, strconv.FormatInt(littleEndian(data), 10))
+		} else {
+			elems = append(elems, string(data))
+		}
+		i += header + size + backlenSize(header+size)
+	}
+
+	return nil, false
+}
+
+// backlenSize is the size of the entry length trailing listpack entries.
+func backlenSize(n int) int {
+	switch {
+	case n < 1<<7:
+		return 1
+	case n < 1<<14:
+		return 2
+	case n < 1<<21:
+		return 3
+	case n < 1<<28:
+		return 4
+	}
+
+	return 5
+}
+
+// intset decodes the integers of an intset.
+func intset(b []byte) ([]string, bool) {
+	header, ok := span(b, 0, 8)
+	if !ok {
+		return nil, false
+	}
+	size := int(binary.LittleEndian.Uint32(header))
+	n := int(binary.LittleEndian.Uint32(header[4:]))
+	if size != 2 && size != 4 && size != 8 {
+		return nil, false
+	}
+	if _, ok := span(b, 8, size*n); !ok {
+		return nil, false
+	}
+
+	elems := make([]string, n)
+	for i := range elems {
+		elems[i] = strconv.FormatInt(littleEndian(b[8+i*size:8+(i+1)*size]), 10)
+	}
+
+	return elems, true
+}
+
+// zipmap decodes the field/value pairs of a zipmap, the hash encoding
+// before ziplists.
+func zipmap(b []byte) ([]string, bool) {
+	var elems []string
+
+	// Length header
+	i := 1
+	for i < len(b) {
+		if b[i] == 0xff {
+			return elems, true
+		}
+
+		for _, value := range []bool{false, true} {
+			size := int(b[i])
+			i++
+			if size == 254 {
+				n, ok := span(b, i, 4)
+				if !ok {
+					return nil, false
+				}
+				size = int(binary.LittleEndian.Uint32(n))
+				i += 4
+			}
+			// Values have unused bytes after them
+			free := 0
+			if value {
+				if i >= len(b) {
+					return nil, false
+				}
+				free = int(b[i])
+				i++
+			}
+			data, ok := span(b, i, size)
+			if !ok {
+				return nil, false
+			}
+			elems = append(elems, string(data))
+			i += size + free
+			if i >= len(b) {
+				return nil, false
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// swapPairs swaps the elements of each pair, in place.
+func swapPairs(elems []string) {
+	for i := 0; i+1 < len(elems); i += 2 {
+		elems[i], elems[i+1] = elems[i+1], elems[i]
+	}
+}
@@ -0,0 +1,824 @@
+// Package rdb reads Redis RDB snapshots, e.g. dump.rdb as saved by BGSAVE,
+// from RDB version 6 (Redis 2.6) to 12 (Redis 7.4).
+package rdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// MaxVersion is the latest RDB version read.
+const MaxVersion = 12
+
+// Opcodes preceding the key/value pairs.
+const (
+	opSlotInfo     = 0xf4
+	opFunction2    = 0xf5
+	opFunction     = 0xf6
+	opModuleAux    = 0xf7
+	opIdle         = 0xf8
+	opFreq         = 0xf9
+	opAux          = 0xfa
+	opResizeDB     = 0xfb
+	opExpireTimeMs = 0xfc
+	opExpireTime   = 0xfd
+	opSelectDB     = 0xfe
+	opEOF          = 0xff
+)
+
+// Value types.
+const (
+	typeString           = 0
+	typeList             = 1
+	typeSet              = 2
+	typeZset             = 3
+	typeHash             = 4
+	typeZset2            = 5
+	typeModule           = 6
+	typeModule2          = 7
+	typeHashZipmap       = 9
+	typeListZiplist      = 10
+	typeSetIntset        = 11
+	typeZsetZiplist      = 12
+	typeHashZiplist      = 13
+	typeListQuicklist    = 14
+	typeStreamListpacks  = 15
+	typeHashListpack     = 16
+	typeZsetListpack     = 17
+	typeListQuicklist2   = 18
+	typeStreamListpacks2 = 19
+	typeSetListpack      = 20
+	typeStreamListpacks3 = 21
+)
+
+// maxLength caps string lengths, so that corrupt files fail instead of
+// allocating any size.
+const maxLength = 1 << 32
+
+// readChunk is the length up to which readFull allocates strings upfront,
+// longer ones growing as read, bounded by the bytes the file holds.
+const readChunk = 1 << 16
+
+// lzfMaxRatio bounds the uncompressed length of LZF strings per compressed
+// byte: a 3 bytes back reference expands to 264 bytes at most.
+const lzfMaxRatio = 88
+
+// ParseError is a malformed snapshot, in the record starting at byte Offset.
+type ParseError struct {
+	Offset int64
+	Msg    string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("rdb: offset %d: %s", e.Offset, e.Msg)
+}
+
+// Logical is a value as the command recreating it, e.g. RPUSH, with Args
+// the elements following the key, Step of them per element, e.g. 2 for HSET
+// field/value pairs.
+type Logical struct {
+	Cmd  string
+	Args []string
+	Step int
+}
+
+// Entry is a key read off a snapshot, from database DB.
+// Raw is its serialized value, type byte first, as in DUMP payloads.
+// ExpireAt is its expiration in ms since epoch, 0 for persistent keys.
+// Logical is the decoded value, nil for streams and module values.
+// Module is the module name of module values.
+// Idle is its LRU idle time in seconds and Freq its LFU counter, -1 when the
+// snapshot doesn't record them, depending on the maxmemory-policy.
+type Entry struct {
+	DB       int
+	Key      string
+	Type     byte
+	Raw      []byte
+	ExpireAt int64
+	Logical  *Logical
+	Module   string
+	Idle     int64
+	Freq     int
+}
+
+// Reader reads the keys of an RDB snapshot, in file order.
+// Aux holds the auxiliary fields read so far, e.g. redis-ver.
+// Warn, when set, is called with the content skipped, e.g. module aux data.
+type Reader struct {
+	Version int
+	Aux     map[string]string
+	Warn    func(msg string)
+
+	r      *bufio.Reader
+	offset int64
+	start  int64
+	crc    uint64
+	raw    *bytes.Buffer
+	db     int
+	done   bool
+}
+
+// NewReader creates a Reader, checking the snapshot header.
+func NewReader(r io.Reader) (*Reader, error) {
+	rd := &Reader{r: bufio.NewReader(r), Aux: make(map[string]string)}
+
+	header, err := rd.readFull(9)
+	if err != nil {
+		return nil, err
+	}
+	if string(header[:5]) != "REDIS" {
+		return nil, rd.errorf("not an RDB file")
+	}
+	rd.Version, err = strconv.Atoi(string(header[5:]))
+	if err != nil || rd.Version < 1 {
+		return nil, rd.errorf("invalid RDB version %q", header[5:])
+	}
+	if rd.Version > MaxVersion {
+		return nil, rd.errorf("unsupported RDB version %d, up to %d supported", rd.Version, MaxVersion)
+	}
+
+	return rd, nil
+}
+
+// Offset returns the number of bytes read so far, the snapshot size once
+// Next returned io.EOF.
+func (r *Reader) Offset() int64 {
+	return r.offset
+}
+
+func (r *Reader) errorf(format string, args ...interface{}) error {
+	return &ParseError{Offset: r.start, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (r *Reader) warn(format string, args ...interface{}) {
+	if r.Warn != nil {
+		r.Warn(fmt.Sprintf(format, args...))
+	}
+}
+
+// readFull reads n bytes, adding them to the checksum and captured value.
+func (r *Reader) readFull(n uint64) ([]byte, error) {
+	if n > maxLength {
+		return nil, r.errorf("invalid length %d", n)
+	}
+	var b []byte
+	var err error
+	if n <= readChunk {
+		b = make([]byte, n)
+		var read int
+		read, err = io.ReadFull(r.r, b)
+		r.offset += int64(read)
+	} else {
+		var buf bytes.Buffer
+		var read int64
+		read, err = io.CopyN(&buf, r.r, int64(n))
+		r.offset += read
+		b = buf.Bytes()
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, r.errorf("unexpected end of file")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.crc = checksum(r.crc, b)
+	if r.raw != nil {
+		r.raw.Write(b)
+	}
+
+	return b, nil
+}
+
+func (r *Reader) readByte() (byte, error) {
+	b, err := r.readFull(1)
+	if err != nil {
+		return 0, err
+	}
+
+	return b[0], nil
+}
+
+// readLength reads a length, or the special string encoding it marks when
+// encoded.
+func (r *Reader) readLength() (n uint64, encoded bool, err error) {
+	b, err := r.readByte()
+	if err != nil {
+		return 0, false, err
+	}
+
+	switch b >> 6 {
+	case 0:
+		return uint64(b & 0x3f), false, nil
+	case 1:
+		next, err := r.readByte()
+		return uint64(b&0x3f)<<8 | uint64(next), false, err
+	case 3:
+		return uint64(b & 0x3f), true, nil
+	}
+
+	switch b {
+	case 0x80:
+		buf, err := r.readFull(4)
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(binary.BigEndian.Uint32(buf)), false, nil
+	case 0x81:
+		buf, err := r.readFull(8)
+		if err != nil {
+			return 0, false, err
+		}
+		return binary.BigEndian.Uint64(buf), false, nil
+	}
+
+	return 0, false, r.errorf("invalid length encoding 0x%x", b)
+}
+
+// length reads a plain length.
+func (r *Reader) length() (uint64, error) {
+	n, encoded, err := r.readLength()
+	if err == nil && encoded {
+		err = r.errorf("unexpected string encoding")
+	}
+
+	return n, err
+}
+
+// readString reads a string, plain, integer or LZF encoded.
+func (r *Reader) readString() (string, error) {
+	n, encoded, err := r.readLength()
+	if err != nil {
+		return "", err
+	}
+	if !encoded {
+		b, err := r.readFull(n)
+		return string(b), err
+	}
+
+	switch n {
+	case 0, 1, 2:
+		b, err := r.readFull(1 << n)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(littleEndian(b), 10), nil
+	case 3:
+		clen, err := r.length()
+		if err != nil {
+			return "", err
+		}
+		ulen, err := r.length()
+		if err != nil {
+			return "", err
+		}
+		if ulen > maxLength || (clen <= maxLength && ulen > clen*lzfMaxRatio) {
+			return "", r.errorf("invalid LZF length %d, of %d compressed bytes", ulen, clen)
+		}
+		compressed, err := r.readFull(clen)
+		if err != nil {
+			return "", err
+		}
+		b, ok := lzfDecompress(compressed, int(ulen))
+		if !ok {
+			return "", r.errorf("invalid LZF string")
+		}
+		return string(b), nil
+	}
+
+	return "", r.errorf("invalid string encoding %d", n)
+}
+
+// readScore reads a zset score, ASCII encoded before RDB_TYPE_ZSET_2.
+func (r *Reader) readScore() (string, error) {
+	n, err := r.readByte()
+	if err != nil {
+		return "", err
+	}
+
+	switch n {
+	case 253:
+		return "nan", nil
+	case 254:
+		return "+inf", nil
+	case 255:
+		return "-inf", nil
+	}
+	b, err := r.readFull(uint64(n))
+
+	return string(b), err
+}
+
+// readBinaryScore reads a little endian float64 zset score.
+func (r *Reader) readBinaryScore() (string, error) {
+	b, err := r.readFull(8)
+	if err != nil {
+		return "", err
+	}
+
+	return formatScore(math.Float64frombits(binary.LittleEndian.Uint64(b))), nil
+}
+
+func formatScore(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+
+	return strconv.FormatFloat(f, 'g', 17, 64)
+}
+
+// littleEndian decodes a signed little endian integer of 1 to 8 bytes.
+func littleEndian(b []byte) int64 {
+	var v uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	shift := uint(64 - 8*len(b))
+
+	return int64(v<<shift) >> shift
+}
+
+// Next returns the next key, and io.EOF at the end of the snapshot.
+func (r *Reader) Next() (Entry, error) {
+	e := Entry{Idle: -1, Freq: -1}
+
+	for !r.done {
+		r.start = r.offset
+		op, err := r.readByte()
+		if err != nil {
+			return e, err
+		}
+
+		switch op {
+		case opEOF:
+			return e, r.readChecksum()
+		case opSelectDB:
+			db, err := r.length()
+			if err != nil {
+				return e, err
+			}
+			r.db = int(db)
+		case opResizeDB:
+			if _, err := r.length(); err != nil {
+				return e, err
+			}
+			if _, err := r.length(); err != nil {
+				return e, err
+			}
+		case opSlotInfo:
+			for i := 0; i < 3; i++ {
+				if _, err := r.length(); err != nil {
+					return e, err
+				}
+			}
+		case opAux:
+			key, err := r.readString()
+			if err != nil {
+				return e, err
+			}
+			value, err := r.readString()
+			if err != nil {
+				return e, err
+			}
+			r.Aux[key] = value
+		case opExpireTime:
+			b, err := r.readFull(4)
+			if err != nil {
+				return e, err
+			}
+			e.ExpireAt = int64(binary.LittleEndian.Uint32(b)) * 1000
+		case opExpireTimeMs:
+			b, err := r.readFull(8)
+			if err != nil {
+				return e, err
+			}
+			e.ExpireAt = int64(binary.LittleEndian.Uint64(b))
+		case opFreq:
+			b, err := r.readByte()
+			if err != nil {
+				return e, err
+			}
+			e.Freq = int(b)
+		case opIdle:
+			n, err := r.length()
+			if err != nil {
+				return e, err
+			}
+			e.Idle = int64(n)
+		case opModuleAux:
+			if err := r.skipModuleAux(); err != nil {
+				return e, err
+			}
+		case opFunction2:
+			if _, err := r.readString(); err != nil {
+				return e, err
+			}
+			r.warn("skipping a function library, restore it with FUNCTION DUMP and FUNCTION RESTORE")
+		case opFunction:
+			return e, r.errorf("unsupported pre-release function library")
+		default:
+			return r.readEntry(e, op)
+		}
+	}
+
+	return e, io.EOF
+}
+
+// readChecksum checks the CRC64 trailing the snapshot, from RDB version 5,
+// zero when disabled by rdbchecksum no.
+func (r *Reader) readChecksum() error {
+	r.done = true
+	if r.Version < 5 {
+		return io.EOF
+	}
+
+	computed := r.crc
+	b, err := r.readFull(8)
+	if err != nil {
+		return err
+	}
+	expected := binary.LittleEndian.Uint64(b)
+	if expected != 0 && expected != computed {
+		return r.errorf("wrong checksum, the file is corrupt")
+	}
+
+	return io.EOF
+}
+
+// readEntry reads the key and value of type t, capturing the raw value.
+func (r *Reader) readEntry(e Entry, t byte) (Entry, error) {
+	key, err := r.readString()
+	if err != nil {
+		return e, err
+	}
+
+	r.raw = bytes.NewBuffer([]byte{t})
+	defer func() { r.raw = nil }()
+
+	e.DB, e.Key, e.Type = r.db, key, t
+	e.Logical, e.Module, err = r.readValue(t)
+	if err != nil {
+		return e, err
+	}
+	e.Raw = r.raw.Bytes()
+
+	return e, nil
+}
+
+// readValue reads a value of type t, decoded when it isn't a stream or a
+// module value, whose module name is returned instead.
+func (r *Reader) readValue(t byte) (*Logical, string, error) {
+	switch t {
+	case typeString:
+		s, err := r.readString()
+		return &Logical{Cmd: "SET", Args: []string{s}, Step: 1}, "", err
+	case typeList:
+		elems, err := r.readStrings(1)
+		return &Logical{Cmd: "RPUSH", Args: elems, Step: 1}, "", err
+	case typeSet:
+		elems, err := r.readStrings(1)
+		return &Logical{Cmd: "SADD", Args: elems, Step: 1}, "", err
+	case typeHash:
+		elems, err := r.readStrings(2)
+		return &Logical{Cmd: "HSET", Args: elems, Step: 2}, "", err
+	case typeZset, typeZset2:
+		elems, err := r.readZset(t == typeZset2)
+		return &Logical{Cmd: "ZADD", Args: elems, Step: 2}, "", err
+	case typeModule:
+		return nil, "", r.errorf("unsupported module value, without the module serialization")
+	case typeModule2:
+		module, err := r.skipModuleValue()
+		return nil, module, err
+	case typeStreamListpacks, typeStreamListpacks2, typeStreamListpacks3:
+		return nil, "", r.skipStream(t)
+	case typeListQuicklist, typeListQuicklist2:
+		elems, err := r.readQuicklist(t == typeListQuicklist2)
+		return &Logical{Cmd: "RPUSH", Args: elems, Step: 1}, "", err
+	case typeHashZipmap, typeListZiplist, typeSetIntset, typeZsetZiplist,
+		typeHashZiplist, typeHashListpack, typeZsetListpack, typeSetListpack:
+	default:
+		return nil, "", r.errorf("unsupported value type %d", t)
+	}
+
+	// All other types are a single blob, of some compact encoding.
+	blob, err := r.readString()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var l *Logical
+	var ok bool
+	switch t {
+	case typeHashZipmap:
+		l = &Logical{Cmd: "HSET", Step: 2}
+		l.Args, ok = zipmap([]byte(blob))
+	case typeListZiplist:
+		l = &Logical{Cmd: "RPUSH", Step: 1}
+		l.Args, ok = ziplist([]byte(blob))
+	case typeSetIntset:
+		l = &Logical{Cmd: "SADD", Step: 1}
+		l.Args, ok = intset([]byte(blob))
+	case typeZsetZiplist:
+		l = &Logical{Cmd: "ZADD", Step: 2}
+		l.Args, ok = ziplist([]byte(blob))
+	case typeHashZiplist:
+		l = &Logical{Cmd: "HSET", Step: 2}
+		l.Args, ok = ziplist([]byte(blob))
+	case typeHashListpack:
+		l = &Logical{Cmd: "HSET", Step: 2}
+		l.Args, ok = listpack([]byte(blob))
+	case typeZsetListpack:
+		l = &Logical{Cmd: "ZADD", Step: 2}
+		l.Args, ok = listpack([]byte(blob))
+	case typeSetListpack:
+		l = &Logical{Cmd: "SADD", Step: 1}
+		l.Args, ok = listpack([]byte(blob))
+	}
+	if !ok || len(l.Args)%l.Step != 0 {
+		return nil, "", r.errorf("invalid value of type %d", t)
+	}
+
+	// Compact zsets hold member then score, ZADD takes score then member.
+	if l.Cmd == "ZADD" {
+		swapPairs(l.Args)
+	}
+
+	return l, "", nil
+}
+
+// readStrings reads a length prefixed sequence of strings, step per element.
+func (r *Reader) readStrings(step uint64) ([]string, error) {
+	n, err := r.length()
+	if err != nil {
+		return nil, err
+	}
+
+	var elems []string
+	for i := uint64(0); i < n*step; i++ {
+		s, err := r.readString()
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, s)
+	}
+
+	return elems, nil
+}
+
+// readZset reads member/score pairs, as score/member ZADD arguments.
+func (r *Reader) readZset(binaryScores bool) ([]string, error) {
+	n, err := r.length()
+	if err != nil {
+		return nil, err
+	}
+
+	var elems []string
+	for i := uint64(0); i < n; i++ {
+		member, err := r.readString()
+		if err != nil {
+			return nil, err
+		}
+		var score string
+		if binaryScores {
+			score, err = r.readBinaryScore()
+		} else {
+			score, err = r.readScore()
+		}
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, score, member)
+	}
+
+	return elems, nil
+}
+
+// readQuicklist reads the nodes of a list, ziplists or, from
+// RDB_TYPE_LIST_QUICKLIST_2, listpacks and plain elements.
+func (r *Reader) readQuicklist(v2 bool) ([]string, error) {
+	n, err := r.length()
+	if err != nil {
+		return nil, err
+	}
+
+	var elems []string
+	for i := uint64(0); i < n; i++ {
+		container := uint64(2)
+		if v2 {
+			if container, err = r.length(); err != nil {
+				return nil, err
+			}
+		}
+		node, err := r.readString()
+		if err != nil {
+			return nil, err
+		}
+
+		var nodeElems []string
+		ok := true
+		switch {
+		case container == 1:
+			nodeElems = []string{node}
+		case v2:
+			nodeElems, ok = listpack([]byte(node))
+		default:
+			nodeElems, ok = ziplist([]byte(node))
+		}
+		if !ok {
+			return nil, r.errorf("invalid list node")
+		}
+		elems = append(elems, nodeElems...)
+	}
+
+	return elems, nil
+}
+
+// skipStream reads a stream of type t, its listpacks and consumer groups.
+func (r *Reader) skipStream(t byte) error {
+	// Listpacks, keyed by their master entry ID
+	n, err := r.length()
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < 2*n; i++ {
+		if _, err := r.readString(); err != nil {
+			return err
+		}
+	}
+
+	// Length and last ID, then first ID, max deleted ID, entries added
+	lengths := 3
+	if t != typeStreamListpacks {
+		lengths += 5
+	}
+	if err := r.skipLengths(lengths); err != nil {
+		return err
+	}
+
+	groups, err := r.length()
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < groups; i++ {
+		if err := r.skipGroup(t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// skipGroup reads a stream consumer group, its pending entries and consumers.
+func (r *Reader) skipGroup(t byte) error {
+	if _, err := r.readString(); err != nil {
+		return err
+	}
+	// Last delivered ID, then entries read
+	lengths := 2
+	if t != typeStreamListpacks {
+		lengths++
+	}
+	if err := r.skipLengths(lengths); err != nil {
+		return err
+	}
+
+	// Pending entries: raw ID, delivery time, delivery count
+	pending, err := r.length()
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < pending; i++ {
+		if _, err := r.readFull(16 + 8); err != nil {
+			return err
+		}
+		if _, err := r.length(); err != nil {
+			return err
+		}
+	}
+
+	consumers, err := r.length()
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < consumers; i++ {
+		if _, err := r.readString(); err != nil {
+			return err
+		}
+		// Seen time, then active time
+		times := uint64(8)
+		if t == typeStreamListpacks3 {
+			times += 8
+		}
+		if _, err := r.readFull(times); err != nil {
+			return err
+		}
+		pending, err := r.length()
+		if err != nil {
+			return err
+		}
+		if _, err := r.readFull(16 * pending); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Reader) skipLengths(n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := r.length(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// moduleCharset encodes module names in module IDs, 6 bits per character.
+const moduleCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+
+// moduleName decodes the 9 characters name of a module ID, the 10 lower bits
+// being the encoding version.
+func moduleName(id uint64) string {
+	name := make([]byte, 9)
+	for i := range name {
+		name[i] = moduleCharset[(id>>(64-6*uint(i+1)))&63]
+	}
+
+	return string(name)
+}
+
+// skipModuleValue reads a module value, self described from RDB version 9,
+// returning the module name.
+func (r *Reader) skipModuleValue() (string, error) {
+	id, err := r.length()
+	if err != nil {
+		return "", err
+	}
+
+	return moduleName(id), r.skipModuleData()
+}
+
+// skipModuleAux reads, and warns about, module auxiliary data.
+func (r *Reader) skipModuleAux() error {
+	id, err := r.length()
+	if err != nil {
+		return err
+	}
+	// When opcode, and when
+	if err := r.skipLengths(2); err != nil {
+		return err
+	}
+	if err := r.skipModuleData(); err != nil {
+		return err
+	}
+	r.warn("skipping aux data of module %s", moduleName(id))
+
+	return nil
+}
+
+// Module data opcodes.
+const (
+	moduleEOF = iota
+	moduleSInt
+	moduleUInt
+	moduleFloat
+	moduleDouble
+	moduleString
+)
+
+// skipModuleData reads opcode prefixed module data, up to its EOF.
+func (r *Reader) skipModuleData() error {
+	for {
+		op, err := r.length()
+		if err != nil {
+			return err
+		}
+
+		switch op {
+		case moduleEOF:
+			return nil
+		case moduleSInt, moduleUInt:
+			_, err = r.length()
+		case moduleFloat:
+			_, err = r.readFull(4)
+		case moduleDouble:
+			_, err = r.readFull(8)
+		case moduleString:
+			_, err = r.readString()
+		default:
+			err = r.errorf("invalid module data opcode %d", op)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
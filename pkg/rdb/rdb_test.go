@@ -0,0 +1,225 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// snapshot builds an RDB file of version, with a valid checksum.
+func snapshot(version string, records ...[]byte) []byte {
+	b := []byte("REDIS" + version)
+	for _, r := range records {
+		b = append(b, r...)
+	}
+	b = append(b, opEOF)
+
+	crc := make([]byte, 8)
+	binary.LittleEndian.PutUint64(crc, checksum(0, b))
+
+	return append(b, crc...)
+}
+
+// str encodes a short plain string.
+func str(s string) []byte {
+	return append([]byte{byte(len(s))}, s...)
+}
+
+func cat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func readAll(t *testing.T, file []byte) ([]Entry, []string) {
+	r, err := NewReader(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	var warnings []string
+	r.Warn = func(msg string) {
+		warnings = append(warnings, msg)
+	}
+
+	var entries []Entry
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			return entries, warnings
+		}
+		if err != nil {
+			t.Fatal("error: ", err)
+		}
+		entries = append(entries, e)
+	}
+}
+
+// Test opcodes, LRU/LFU metadata and compact encodings of a Redis 6 snapshot
+func TestReadVersion9(t *testing.T) {
+	expire := make([]byte, 8)
+	binary.LittleEndian.PutUint64(expire, 1700000000000)
+	intset := []byte{2, 0, 0, 0, 2, 0, 0, 0, 1, 0, 2, 0}
+	zset := []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 'm', 3, 3, '1', '.', '5', 0xff}
+	module := []byte{0x81, 1, 2, 3, 4, 5, 6, 7, 8}
+
+	file := snapshot("0009",
+		cat([]byte{opAux}, str("redis-ver"), str("6.2.6")),
+		cat([]byte{opAux}, str("ctime"), []byte{0xc2, 0x00, 0x5e, 0xd0, 0xb2}),
+		cat([]byte{opModuleAux}, module, []byte{2, 2, moduleUInt, 5, moduleEOF}),
+		[]byte{opSelectDB, 3, opResizeDB, 4, 1},
+		cat([]byte{opExpireTimeMs}, expire, []byte{typeString}, str("s"), str("v")),
+		cat([]byte{opIdle, 42, typeString}, str("n"), []byte{0xc0, 10}),
+		cat([]byte{opFreq, 5, typeString}, str("lzf"), []byte{0xc3, 6, 6, 2, 'a', 'b', 'c', 0x20, 2}),
+		cat([]byte{typeSetIntset}, str("i"), str(string(intset))),
+		cat([]byte{typeZsetZiplist}, str("z"), str(string(zset))),
+	)
+
+	entries, warnings := readAll(t, file)
+
+	expected := []Entry{
+		{DB: 3, Key: "s", Type: typeString, Raw: cat([]byte{typeString}, str("v")), ExpireAt: 1700000000000,
+			Idle: -1, Freq: -1, Logical: &Logical{Cmd: "SET", Args: []string{"v"}, Step: 1}},
+		{DB: 3, Key: "n", Type: typeString, Raw: []byte{typeString, 0xc0, 10},
+			Idle: 42, Freq: -1, Logical: &Logical{Cmd: "SET", Args: []string{"10"}, Step: 1}},
+		{DB: 3, Key: "lzf", Type: typeString, Raw: []byte{typeString, 0xc3, 6, 6, 2, 'a', 'b', 'c', 0x20, 2},
+			Idle: -1, Freq: 5, Logical: &Logical{Cmd: "SET", Args: []string{"abcabc"}, Step: 1}},
+		{DB: 3, Key: "i", Type: typeSetIntset, Raw: cat([]byte{typeSetIntset}, str(string(intset))),
+			Idle: -1, Freq: -1, Logical: &Logical{Cmd: "SADD", Args: []string{"1", "2"}, Step: 1}},
+		{DB: 3, Key: "z", Type: typeZsetZiplist, Raw: cat([]byte{typeZsetZiplist}, str(string(zset))),
+			Idle: -1, Freq: -1, Logical: &Logical{Cmd: "ZADD", Args: []string{"1.5", "m"}, Step: 2}},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected: %+v, result: %+v", expected, entries)
+	}
+
+	if len(warnings) != 1 || !strings.HasPrefix(warnings[0], "skipping aux data of module") {
+		t.Errorf("expected a module aux warning, got %v", warnings)
+	}
+}
+
+// Test listpack encodings of a Redis 7.2 snapshot, and skipped streams
+func TestReadVersion11(t *testing.T) {
+	hash := []byte{18, 0, 0, 0, 4, 0, 0x81, 'f', 2, 0x81, 'v', 2, 0x81, 'n', 2, 5, 1, 0xff}
+	list := []byte{14, 0, 0, 0, 2, 0, 0x81, 'a', 2, 0xdf, 0xfd, 2, 0xff}
+	stream := cat(
+		[]byte{1}, str(strings.Repeat("\x00", 16)), str("lp"),
+		[]byte{1, 1, 0, 1, 0, 0, 0, 1},
+		[]byte{1}, str("g"), []byte{1, 0, 1},
+		[]byte{1}, bytes.Repeat([]byte{0}, 24), []byte{1},
+		[]byte{1}, str("c"), bytes.Repeat([]byte{0}, 16), []byte{1}, bytes.Repeat([]byte{0}, 16),
+	)
+
+	file := snapshot("0011",
+		cat([]byte{typeHashListpack}, str("h"), str(string(hash))),
+		cat([]byte{typeListQuicklist2}, str("l"), []byte{2, 2}, str(string(list)), []byte{1}, str("plain")),
+		cat([]byte{typeStreamListpacks3}, str("st"), stream),
+	)
+
+	entries, _ := readAll(t, file)
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+
+	expected := []*Logical{
+		{Cmd: "HSET", Args: []string{"f", "v", "n", "5"}, Step: 2},
+		{Cmd: "RPUSH", Args: []string{"a", "-3", "plain"}, Step: 1},
+		nil,
+	}
+	for i, e := range entries {
+		if !reflect.DeepEqual(e.Logical, expected[i]) {
+			t.Errorf("expected: %+v, result: %+v", expected[i], e.Logical)
+		}
+	}
+
+	raw := cat([]byte{typeStreamListpacks3}, stream)
+	if !bytes.Equal(entries[2].Raw, raw) {
+		t.Errorf("expected stream raw value: %q, result: %q", raw, entries[2].Raw)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	corrupt := snapshot("0009", cat([]byte{typeString}, str("k"), str("v")))
+	corrupt[len(corrupt)-1] ^= 1
+
+	tests := []struct {
+		file     []byte
+		expected string
+	}{
+		{[]byte("REDIS0013"), "rdb: offset 0: unsupported RDB version 13, up to 12 supported"},
+		{[]byte("NOTRDB000"), "rdb: offset 0: not an RDB file"},
+		{[]byte("REDIS0009\x00\x01k"), "rdb: offset 9: unexpected end of file"},
+		{[]byte("REDIS0009\x00\x01k\x01v\x63\x01k"), "rdb: offset 14: unsupported value type 99"},
+		{corrupt, "rdb: offset 14: wrong checksum, the file is corrupt"},
+		// Corrupt lengths fail on the bytes missing, allocating nothing upfront
+		{[]byte("REDIS0009\x00\x80\xff\xff\xff\xffk"), "rdb: offset 9: unexpected end of file"},
+		{[]byte("REDIS0009\x00\xc3\x02\x80\xff\xff\xff\xff\x00k"), "rdb: offset 9: invalid LZF length 4294967295, of 2 compressed bytes"},
+	}
+
+	for _, tt := range tests {
+		r, err := NewReader(bytes.NewReader(tt.file))
+		for err == nil {
+			_, err = r.Next()
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("expected: %s, result: %v", tt.expected, err)
+		}
+	}
+
+	// Strings longer than a read chunk, grown as read
+	long := strings.Repeat("v", readChunk+1)
+	entries, _ := readAll(t, snapshot("0009", cat([]byte{typeString}, str("k"), []byte{0x80, 0, 1, 0, 1}, []byte(long))))
+	if len(entries) != 1 || !reflect.DeepEqual(entries[0].Logical.Args, []string{long}) {
+		t.Errorf("expected the long string read, result: %d entries", len(entries))
+	}
+}
+
+// Test against the DUMP example of the Redis documentation
+func TestDump(t *testing.T) {
+	expected := "\x00\xc0\n\t\x00\xbem\x06\x89Z(\x00\n"
+	payload := Dump([]byte{typeString, 0xc0, 10}, 9)
+
+	if string(payload) != expected {
+		t.Errorf("expected: %q, result: %q", expected, payload)
+	}
+}
+
+func TestCheckDump(t *testing.T) {
+	payload := Dump([]byte{typeString, 0xc0, 10}, 9)
+	if err := CheckDump(payload); err != nil {
+		t.Error("error: ", err)
+	}
+
+	corrupted := append([]byte{}, payload...)
+	corrupted[1] = 0xc1
+	for _, p := range [][]byte{corrupted, payload[:9], Dump([]byte{typeString, 0xc0, 10}, MaxVersion+1)} {
+		if err := CheckDump(p); err == nil {
+			t.Errorf("%q should be invalid", p)
+		}
+	}
+}
+
+func TestDumpString(t *testing.T) {
+	plain := Dump(append([]byte{typeString, 5}, "hello"...), 9)
+	if value, ok := DumpString(plain); !ok || value != "hello" {
+		t.Errorf("expected: hello, result: %q %v", value, ok)
+	}
+	if value, ok := DumpString(Dump([]byte{typeString, 0xc0, 10}, 9)); !ok || value != "10" {
+		t.Errorf("expected: 10, result: %q %v", value, ok)
+	}
+
+	for _, p := range [][]byte{Dump([]byte{typeList, 0}, 9), Dump([]byte{typeString, 9, 'a'}, 9), plain[:9]} {
+		if _, ok := DumpString(p); ok {
+			t.Errorf("%q should not decode", p)
+		}
+	}
+}
+
+func TestLoads(t *testing.T) {
+	if !Loads(typeHashZiplist, 6) || !Loads(typeHashListpack, 10) {
+		t.Error("types should load from their RDB version")
+	}
+	if Loads(typeSetListpack, 10) {
+		t.Error("set listpacks shouldn't load before RDB 11")
+	}
+}
@@ -0,0 +1,117 @@
+// Package records writes a record per key processed by a sync, its name,
+// type, size, TTL, status, error, time and run ID, to the records table of a
+// SQLite database file, for operators to query with SQL, e.g. with the
+// sqlite3 shell. rump has no SQLite driver of its own, the file is written
+// directly, keeping it dependency free, committed every batch of records.
+// All methods are safe for concurrent use, and are noops on a nil Log.
+package records
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// DefaultBatch is the number of records committed at once.
+const DefaultBatch = 1000
+
+// Record is a processed key. Type is empty when unknown, Size the payload
+// size, TTL in milliseconds, 0 when persistent, Status the outcome, e.g.
+// restored, failed or skipped-existing, and Error the error, if any.
+type Record struct {
+	Key    string
+	Type   string
+	Size   int
+	TTL    int64
+	Status string
+	Error  string
+}
+
+// Log writes the Records of a run, RunID, to a SQLite database, committed
+// every Batch records.
+type Log struct {
+	RunID string
+	Batch int
+
+	mu      sync.Mutex
+	db      *database
+	pending int
+}
+
+// New creates a Log writing to the database path, truncated when existing,
+// a database per run.
+func New(path, runID string) (*Log, error) {
+	db, err := create(path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating records: %w", err)
+	}
+
+	return &Log{RunID: runID, Batch: DefaultBatch, db: db}, nil
+}
+
+// Add inserts the Record of a processed key, committing the database once
+// Batch records are pending.
+func (l *Log) Add(r Record) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Writers may outlive a Log closed on exit
+	if l.db == nil {
+		return nil
+	}
+
+	err := l.db.insert(key(r.Key), r.Type, int64(r.Size), r.TTL, r.Status, r.Error,
+		time.Now().UTC().Format(time.RFC3339Nano), l.RunID)
+	if err == nil {
+		l.pending++
+		if l.pending < l.Batch {
+			return nil
+		}
+		l.pending = 0
+		err = l.db.commit()
+	}
+	if err != nil {
+		return fmt.Errorf("error writing the record of key %s: %w", message.FormatKey(r.Key), err)
+	}
+
+	return nil
+}
+
+// Close commits the pending records and closes the database, once.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.db == nil {
+		return nil
+	}
+	err := l.db.close()
+	l.db = nil
+	if err != nil {
+		return fmt.Errorf("error closing records: %w", err)
+	}
+
+	return nil
+}
+
+// key returns the value of name, a blob when it isn't valid UTF-8 or holds
+// NUL bytes, as binary key names may.
+func key(name string) interface{} {
+	if !utf8.ValidString(name) || strings.IndexByte(name, 0) >= 0 {
+		return []byte(name)
+	}
+
+	return name
+}
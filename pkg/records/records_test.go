@@ -0,0 +1,232 @@
+package records
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// uvarint decodes the SQLite varint at the start of b, and its length.
+func uvarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 8; i++ {
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+
+	return v<<8 | uint64(b[8]), 9
+}
+
+// decode decodes the values of a record.
+func decode(record []byte) []interface{} {
+	size, n := uvarint(record)
+	body := record[size:]
+	var values []interface{}
+	for header := record[n:size]; len(header) > 0; {
+		typ, n := uvarint(header)
+		header = header[n:]
+		switch {
+		case typ == 0:
+			values = append(values, nil)
+		case typ == 8 || typ == 9:
+			values = append(values, int64(typ-8))
+		case typ <= 6:
+			l := []int{0, 1, 2, 3, 4, 6, 8}[typ]
+			b := make([]byte, 8)
+			if body[0] >= 0x80 {
+				copy(b, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+			}
+			copy(b[8-l:], body[:l])
+			values = append(values, int64(binary.BigEndian.Uint64(b)))
+			body = body[l:]
+		case typ%2 == 0:
+			l := (typ - 12) / 2
+			values = append(values, append([]byte{}, body[:l]...))
+			body = body[l:]
+		default:
+			l := (typ - 13) / 2
+			values = append(values, string(body[:l]))
+			body = body[l:]
+		}
+	}
+
+	return values
+}
+
+// rows reads back the rows of the B-tree rooted at page n of data, in order.
+func rows(t *testing.T, data []byte, n uint32) [][]interface{} {
+	page := data[int(n-1)*pageSize : int(n)*pageSize]
+	offset := 0
+	if n == 1 {
+		offset = headerSize
+	}
+	cells := int(binary.BigEndian.Uint16(page[offset+3:]))
+	var all [][]interface{}
+	switch page[offset] {
+	case interiorTable:
+		for i := 0; i < cells; i++ {
+			ptr := binary.BigEndian.Uint16(page[offset+12+2*i:])
+			all = append(all, rows(t, data, binary.BigEndian.Uint32(page[ptr:]))...)
+		}
+		return append(all, rows(t, data, binary.BigEndian.Uint32(page[offset+8:]))...)
+	case leafTable:
+	default:
+		t.Fatalf("unexpected page %d type %d", n, page[offset])
+	}
+
+	for i := 0; i < cells; i++ {
+		cell := page[binary.BigEndian.Uint16(page[offset+8+2*i:]):]
+		size, l := uvarint(cell)
+		_, r := uvarint(cell[l:])
+		cell = cell[l+r:]
+		if size <= maxLocal {
+			all = append(all, decode(cell[:size]))
+			continue
+		}
+
+		local := minLocal + (int(size)-minLocal)%(pageSize-4)
+		if local > maxLocal {
+			local = minLocal
+		}
+		payload := append([]byte{}, cell[:local]...)
+		for next := binary.BigEndian.Uint32(cell[local:]); next != 0; {
+			overflow := data[int(next-1)*pageSize : int(next)*pageSize]
+			end := pageSize
+			if rest := int(size) - len(payload); rest < pageSize-4 {
+				end = 4 + rest
+			}
+			payload = append(payload, overflow[4:end]...)
+			next = binary.BigEndian.Uint32(overflow)
+		}
+		all = append(all, decode(payload))
+	}
+
+	return all
+}
+
+// readTable reads back the rows of the records table of the database path.
+func readTable(t *testing.T, path string) [][]interface{} {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "SQLite format 3\x00") {
+		t.Fatalf("expected a SQLite database, got %q", data[:16])
+	}
+	if pages := binary.BigEndian.Uint32(data[28:]); int(pages)*pageSize != len(data) {
+		t.Fatalf("expected %d pages, got %d bytes", pages, len(data))
+	}
+
+	schema := rows(t, data, 1)
+	if len(schema) != 1 || schema[0][1] != "records" || schema[0][4] != table {
+		t.Fatalf("expected the records table, got %v", schema)
+	}
+
+	return rows(t, data, uint32(schema[0][3].(int64)))
+}
+
+// Test values of unsupported types fail the insert, the rows committed kept
+func TestInsertUnsupported(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rump-records")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := dir + "/records.db"
+
+	d, err := create(path)
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	if err := d.insert("key1", int64(1)); err != nil {
+		t.Error("error: ", err)
+	}
+	if err := d.insert("key2", 1); err == nil || err.Error() != "unsupported value type int" {
+		t.Errorf("expected an unsupported value error, got %v", err)
+	}
+	if err := d.close(); err != nil {
+		t.Error("error: ", err)
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	schema := rows(t, data, 1)
+	if got := rows(t, data, uint32(schema[0][3].(int64))); !reflect.DeepEqual(got, [][]interface{}{{"key1", int64(1)}}) {
+		t.Errorf("expected the valid row only, got %v", got)
+	}
+}
+
+func TestLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rump-records")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := dir + "/records.db"
+
+	// A database per run, truncating the previous one
+	if err := ioutil.WriteFile(path, []byte(strings.Repeat("x", 3*pageSize)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l, err := New(path, "run1")
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	if got := readTable(t, path); len(got) != 0 {
+		t.Errorf("expected an empty table, got %v", got)
+	}
+
+	l.Batch = 2
+	added := []Record{
+		{Key: "user:1", Type: "hash", Size: 10, TTL: 30000, Status: "restored"},
+		{Key: "it's", Status: "failed", Error: "ERR bad"},
+		{Key: "bin\x00\xff", Status: "restored", TTL: -1},
+		{Key: strings.Repeat("k", 3*pageSize), Type: "string", Size: 1 << 40, Status: "restored"},
+	}
+	// Enough records for two levels of interior pages
+	for i := 0; i < 20000; i++ {
+		added = append(added, Record{Key: fmt.Sprintf("key:%d", i), Type: "set", Size: i, TTL: int64(i) * 1000, Status: "restored"})
+	}
+	for i, r := range added {
+		if err := l.Add(r); err != nil {
+			t.Error("error: ", err)
+		}
+		// Committed every Batch records
+		if i == 2 {
+			if got := readTable(t, path); len(got) != 2 {
+				t.Errorf("expected 2 records committed, got %v", got)
+			}
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Error("error: ", err)
+	}
+	// Closed twice, e.g. on exit and by a deferred Close
+	if err := l.Close(); err != nil {
+		t.Error("error: ", err)
+	}
+
+	got := readTable(t, path)
+	if len(got) != len(added) {
+		t.Fatalf("expected %d records, got %d", len(added), len(got))
+	}
+	for i, r := range added {
+		var k interface{} = r.Key
+		if i == 2 {
+			k = []byte(r.Key)
+		}
+		expected := []interface{}{k, r.Type, int64(r.Size), r.TTL, r.Status, r.Error}
+		if !reflect.DeepEqual(got[i][:6], expected) || got[i][7] != "run1" {
+			t.Fatalf("expected record %d %v, got %v", i, expected, got[i])
+		}
+		if _, err := time.Parse(time.RFC3339Nano, got[i][6].(string)); err != nil {
+			t.Errorf("expected record %d time, got %v", i, got[i][6])
+		}
+	}
+}
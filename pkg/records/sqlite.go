@@ -0,0 +1,329 @@
+package records
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// Layout of the SQLite database file, see https://www.sqlite.org/fileformat.html:
+// pages of pageSize bytes, page 1 holding the file header and the schema
+// table, the records table a B-tree of leaf pages, their cells spilling to
+// overflow pages past maxLocal bytes, and interior pages of fanout children.
+const (
+	pageSize   = 4096
+	headerSize = 100
+	maxLocal   = pageSize - 35
+	minLocal   = (pageSize-12)*32/255 - 23
+	fanout     = 256
+
+	leafTable     = 0x0d
+	interiorTable = 0x05
+)
+
+// table is the SQL of the table, stored in the schema table.
+const table = "CREATE TABLE records (key TEXT, type TEXT, size INTEGER, ttl INTEGER, status TEXT, error TEXT, time TEXT, run_id TEXT)"
+
+// child is a page of the B-tree and the largest rowid under it.
+type child struct {
+	page  uint32
+	rowid int64
+}
+
+// database writes the rows of the records table to a SQLite database file,
+// without a SQLite driver: rows are appended to leaf pages, in rowid order,
+// and each commit writes the current leaf, the interior pages above the
+// leaves, reusing those of the previous commit, and page 1, the file a valid
+// database of the rows inserted so far once committed, and until the next.
+type database struct {
+	f        *os.File
+	pages    uint32
+	commits  uint32
+	rowid    int64
+	leaves   []child
+	cells    [][]byte
+	used     int
+	interior []uint32
+}
+
+// create creates the database path, truncating it, committed empty.
+func create(path string) (*database, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	d := &database{f: f, pages: 1}
+	d.leaves = []child{{page: d.alloc()}}
+	if err := d.commit(); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// alloc returns the number of a new page, at the end of the file.
+func (d *database) alloc() uint32 {
+	d.pages++
+	return d.pages
+}
+
+// write writes page n.
+func (d *database) write(n uint32, page []byte) error {
+	_, err := d.f.WriteAt(page, int64(n-1)*pageSize)
+	return err
+}
+
+// insert appends a row of values, nil, int64, string or []byte.
+func (d *database) insert(values ...interface{}) error {
+	payload, err := encode(values)
+	if err != nil {
+		return err
+	}
+	d.rowid++
+	cell, err := d.leafCell(d.rowid, payload)
+	if err != nil {
+		return err
+	}
+
+	// Leaves are written once full, and rewritten by each commit until then
+	if 8+d.used+len(cell)+2 > pageSize {
+		if err := d.write(d.leaves[len(d.leaves)-1].page, btreePage(leafTable, 0, d.cells, 0)); err != nil {
+			return err
+		}
+		d.leaves = append(d.leaves, child{page: d.alloc()})
+		d.cells, d.used = nil, 0
+	}
+	d.cells = append(d.cells, cell)
+	d.used += len(cell) + 2
+	d.leaves[len(d.leaves)-1].rowid = d.rowid
+
+	return nil
+}
+
+// leafCell returns the table leaf cell of payload, its bytes past the local
+// ones written to overflow pages.
+func (d *database) leafCell(rowid int64, payload []byte) ([]byte, error) {
+	cell := append(varint(uint64(len(payload))), varint(uint64(rowid))...)
+	if len(payload) <= maxLocal {
+		return append(cell, payload...), nil
+	}
+
+	local := minLocal + (len(payload)-minLocal)%(pageSize-4)
+	if local > maxLocal {
+		local = minLocal
+	}
+	rest := payload[local:]
+	first := d.alloc()
+	cell = append(cell, payload[:local]...)
+	cell = append(cell, be32(first)...)
+	for n := first; len(rest) > 0; {
+		chunk := rest
+		if len(chunk) > pageSize-4 {
+			chunk = chunk[:pageSize-4]
+		}
+		rest = rest[len(chunk):]
+		var next uint32
+		if len(rest) > 0 {
+			next = d.alloc()
+		}
+		page := make([]byte, pageSize)
+		copy(page, be32(next))
+		copy(page[4:], chunk)
+		if err := d.write(n, page); err != nil {
+			return nil, err
+		}
+		n = next
+	}
+
+	return cell, nil
+}
+
+// commit writes the current leaf, the interior pages above the leaves and
+// page 1, pointing to the root of the records table.
+func (d *database) commit() error {
+	if err := d.write(d.leaves[len(d.leaves)-1].page, btreePage(leafTable, 0, d.cells, 0)); err != nil {
+		return err
+	}
+
+	level, reused := d.leaves, 0
+	for len(level) > 1 {
+		var next []child
+		for i := 0; i < len(level); i += fanout {
+			end := i + fanout
+			if end > len(level) {
+				end = len(level)
+			}
+			var cells [][]byte
+			for _, c := range level[i : end-1] {
+				cells = append(cells, append(be32(c.page), varint(uint64(c.rowid))...))
+			}
+			if reused == len(d.interior) {
+				d.interior = append(d.interior, d.alloc())
+			}
+			page := d.interior[reused]
+			reused++
+			if err := d.write(page, btreePage(interiorTable, 0, cells, level[end-1].page)); err != nil {
+				return err
+			}
+			next = append(next, child{page: page, rowid: level[end-1].rowid})
+		}
+		level = next
+	}
+
+	d.commits++
+	row, err := encode([]interface{}{"table", "records", "records", int64(level[0].page), table})
+	if err != nil {
+		return err
+	}
+	schema := append(append(varint(uint64(len(row))), 1), row...)
+	page := btreePage(leafTable, headerSize, [][]byte{schema}, 0)
+	copy(page, d.header())
+
+	return d.write(1, page)
+}
+
+// header returns the 100 bytes file header.
+func (d *database) header() []byte {
+	h := make([]byte, headerSize)
+	copy(h, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(h[16:], pageSize)
+	// Legacy journal mode, no reserved bytes, the fixed payload fractions
+	h[18], h[19], h[20], h[21], h[22], h[23] = 1, 1, 0, 64, 32, 32
+	binary.BigEndian.PutUint32(h[24:], d.commits)
+	binary.BigEndian.PutUint32(h[28:], d.pages)
+	// Schema cookie, schema format 4 and UTF-8 text
+	binary.BigEndian.PutUint32(h[40:], 1)
+	binary.BigEndian.PutUint32(h[44:], 4)
+	binary.BigEndian.PutUint32(h[56:], 1)
+	binary.BigEndian.PutUint32(h[92:], d.commits)
+	binary.BigEndian.PutUint32(h[96:], 3040001)
+
+	return h
+}
+
+// close commits the database and closes its file.
+func (d *database) close() error {
+	err := d.commit()
+	if cerr := d.f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// btreePage returns a B-tree page of type typ, its header at offset, with
+// cells, and the right-most child of interior pages.
+func btreePage(typ byte, offset int, cells [][]byte, right uint32) []byte {
+	page := make([]byte, pageSize)
+	page[offset] = typ
+	binary.BigEndian.PutUint16(page[offset+3:], uint16(len(cells)))
+	ptr := offset + 8
+	if typ == interiorTable {
+		binary.BigEndian.PutUint32(page[offset+8:], right)
+		ptr = offset + 12
+	}
+
+	content := pageSize
+	for _, cell := range cells {
+		content -= len(cell)
+		copy(page[content:], cell)
+		binary.BigEndian.PutUint16(page[ptr:], uint16(content))
+		ptr += 2
+	}
+	binary.BigEndian.PutUint16(page[offset+5:], uint16(content))
+
+	return page
+}
+
+// encode returns the record of values: the header of their serial types,
+// then their bodies, or an error for values of another type.
+func encode(values []interface{}) ([]byte, error) {
+	var types, body []byte
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+			types = append(types, 0)
+		case int64:
+			typ, b := integer(v)
+			types = append(types, varint(typ)...)
+			body = append(body, b...)
+		case string:
+			types = append(types, varint(uint64(len(v))*2+13)...)
+			body = append(body, v...)
+		case []byte:
+			types = append(types, varint(uint64(len(v))*2+12)...)
+			body = append(body, v...)
+		default:
+			return nil, fmt.Errorf("unsupported value type %T", v)
+		}
+	}
+
+	// The header size counts its own varint
+	size := len(types) + 1
+	for len(varint(uint64(size)))+len(types) != size {
+		size = len(varint(uint64(size))) + len(types)
+	}
+	record := append(varint(uint64(size)), types...)
+
+	return append(record, body...), nil
+}
+
+// integer returns the serial type of v, in the fewest bytes, and its big
+// endian two's complement body.
+func integer(v int64) (uint64, []byte) {
+	switch {
+	case v == 0:
+		return 8, nil
+	case v == 1:
+		return 9, nil
+	}
+
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(v))
+	for _, s := range []struct {
+		typ   uint64
+		bytes uint
+	}{{1, 1}, {2, 2}, {3, 3}, {4, 4}, {5, 6}} {
+		bits := s.bytes*8 - 1
+		if v >= -1<<bits && v < 1<<bits {
+			return s.typ, b[8-s.bytes:]
+		}
+	}
+
+	return 6, b
+}
+
+// varint returns v as a SQLite varint, big endian, 7 bits per byte, the
+// ninth byte holding 8.
+func varint(v uint64) []byte {
+	if v > 1<<56-1 {
+		b := make([]byte, 9)
+		b[8] = byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			b[i] = byte(v&0x7f) | 0x80
+			v >>= 7
+		}
+		return b
+	}
+
+	var b []byte
+	for {
+		b = append([]byte{byte(v&0x7f) | 0x80}, b...)
+		v >>= 7
+		if v == 0 {
+			break
+		}
+	}
+	b[len(b)-1] &^= 0x80
+
+	return b
+}
+
+// be32 returns v big endian.
+func be32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
@@ -0,0 +1,107 @@
+package redis
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mediocregopher/radix/v3"
+)
+
+// ACLKeys returns the ACL user connected as, with ACL WHOAMI, and its key
+// patterns, from the keys of ACL GETUSER and of its selectors, without their
+// ~ or %RW~ permission prefix. Users allowed all keys have the * pattern.
+func (r *Redis) ACLKeys() (string, []string, error) {
+	var user string
+	if err := r.Pool.Do(radix.Cmd(&user, r.cmd("ACL"), "WHOAMI")); err != nil {
+		return "", nil, fmt.Errorf("error calling ACL WHOAMI: %w", err)
+	}
+	var fields []interface{}
+	if err := r.Pool.Do(radix.Cmd(&fields, r.cmd("ACL"), "GETUSER", user)); err != nil {
+		return user, nil, fmt.Errorf("error calling ACL GETUSER %s: %w", user, err)
+	}
+
+	return user, aclPatterns(fields), nil
+}
+
+// aclPatterns returns the key patterns of the ACL GETUSER fields: keys, an
+// array up to Redis 6, a string of space separated patterns since 7, and
+// the keys of selectors, and * for the allkeys flag.
+func aclPatterns(fields []interface{}) []string {
+	var patterns []string
+	for i := 0; i+1 < len(fields); i += 2 {
+		switch aclString(fields[i]) {
+		case "flags":
+			for _, flag := range aclStrings(fields[i+1]) {
+				if flag == "allkeys" {
+					patterns = append(patterns, "*")
+				}
+			}
+		case "keys":
+			for _, keys := range aclStrings(fields[i+1]) {
+				for _, pattern := range strings.Fields(keys) {
+					if j := strings.Index(pattern, "~"); j == 0 || j > 0 && pattern[0] == '%' {
+						pattern = pattern[j+1:]
+					}
+					patterns = append(patterns, pattern)
+				}
+			}
+		case "selectors":
+			selectors, _ := fields[i+1].([]interface{})
+			for _, s := range selectors {
+				selector, _ := s.([]interface{})
+				patterns = append(patterns, aclPatterns(selector)...)
+			}
+		}
+	}
+
+	return patterns
+}
+
+// aclString returns a reply value as a string, empty for arrays.
+func aclString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+
+	return ""
+}
+
+// aclStrings returns a reply value as strings, an array or a single one.
+func aclStrings(v interface{}) []string {
+	values, ok := v.([]interface{})
+	if !ok {
+		return []string{aclString(v)}
+	}
+
+	var s []string
+	for _, value := range values {
+		s = append(s, aclString(value))
+	}
+
+	return s
+}
+
+// KeyPrefix returns the mandatory prefix of the keys of the ACL key
+// patterns, that of a prefix* pattern all the others start with, e.g.
+// tenant: of ~tenant:* and ~tenant:cache:*. It's empty for users allowed all
+// keys, or patterns without such a prefix, e.g. ~a:* and ~b:*.
+func KeyPrefix(patterns []string) string {
+	for _, pattern := range patterns {
+		prefix := strings.TrimSuffix(pattern, "*")
+		if prefix == pattern || prefix == "" || strings.ContainsAny(prefix, `*?[\`) {
+			continue
+		}
+		shared := true
+		for _, other := range patterns {
+			shared = shared && strings.HasPrefix(other, prefix)
+		}
+		if shared {
+			return prefix
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,155 @@
+package redis
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthProvider provides the AUTH credentials, asked on each new connection.
+// An empty user AUTHs with the password only, an empty password with the URI
+// credentials.
+type AuthProvider interface {
+	Auth() (user, password string, err error)
+}
+
+// StaticAuth is an AuthProvider of fixed credentials, the default.
+type StaticAuth struct {
+	User     string
+	Password string
+}
+
+// Auth returns the fixed credentials.
+func (a StaticAuth) Auth() (string, string, error) {
+	return a.User, a.Password, nil
+}
+
+// iamTokenTTL is the validity of IAM auth tokens, set by AWS.
+const iamTokenTTL = 15 * time.Minute
+
+// iamTokenRefresh is the age IAM auth tokens are regenerated at, leaving new
+// connections a margin before expiry.
+const iamTokenRefresh = 10 * time.Minute
+
+// emptySHA256 is the hex SHA-256 of the empty payload of IAM token requests.
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// AWSCredentials are the credentials IAM auth tokens are signed with.
+// SessionToken is set for temporary credentials.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// EnvCredentials reads AWSCredentials off the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+func EnvCredentials() (AWSCredentials, error) {
+	creds := AWSCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return creds, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required for IAM auth")
+	}
+
+	return creds, nil
+}
+
+// IAMAuth is an AuthProvider of ElastiCache and MemoryDB IAM auth tokens,
+// the SigV4 presigned connect requests of User to Cache, a replication group,
+// serverless cache or cluster name. Tokens are valid 15 minutes, they're
+// regenerated every 10, so that reconnections of long runs still
+// authenticate. Service is elasticache or memorydb.
+type IAMAuth struct {
+	User        string
+	Cache       string
+	Region      string
+	Service     string
+	Credentials func() (AWSCredentials, error)
+
+	mu      sync.Mutex
+	token   string
+	created time.Time
+}
+
+// NewIAMAuth creates an IAMAuth signing with the environment credentials.
+func NewIAMAuth(user, cache, region, service string) *IAMAuth {
+	return &IAMAuth{
+		User:        user,
+		Cache:       cache,
+		Region:      region,
+		Service:     service,
+		Credentials: EnvCredentials,
+	}
+}
+
+// Auth returns User and a current token.
+func (a *IAMAuth) Auth() (string, string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	if a.token == "" || now.Sub(a.created) >= iamTokenRefresh {
+		token, err := a.Token(now)
+		if err != nil {
+			return "", "", err
+		}
+		a.token, a.created = token, now
+	}
+
+	return a.User, a.token, nil
+}
+
+// Token generates a token, signed at now.
+func (a *IAMAuth) Token(now time.Time) (string, error) {
+	creds, err := a.Credentials()
+	if err != nil {
+		return "", err
+	}
+
+	now = now.UTC()
+	date := now.Format("20060102")
+	scope := date + "/" + a.Region + "/" + a.Service + "/aws4_request"
+	host := strings.ToLower(a.Cache)
+
+	query := url.Values{}
+	query.Set("Action", "connect")
+	query.Set("User", a.User)
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", creds.AccessKeyID+"/"+scope)
+	query.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	query.Set("X-Amz-Expires", fmt.Sprint(int(iamTokenTTL.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if creds.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+	// SigV4 escapes spaces as %20, and sorts by key as Encode does
+	canonicalQuery := strings.Replace(query.Encode(), "+", "%20", -1)
+
+	request := strings.Join([]string{"GET", "/", canonicalQuery, "host:" + host, "", "host", emptySHA256}, "\n")
+	hash := sha256.Sum256([]byte(request))
+	toSign := strings.Join([]string{"AWS4-HMAC-SHA256", now.Format("20060102T150405Z"), scope, hex.EncodeToString(hash[:])}, "\n")
+
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, part := range []string{date, a.Region, a.Service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	return host + "/?" + canonicalQuery + "&X-Amz-Signature=" + signature, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+
+	return h.Sum(nil)
+}
@@ -0,0 +1,174 @@
+package redis
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mediocregopher/radix/v3"
+
+	"github.com/stickermule/rump/pkg/summary"
+)
+
+// balanceMin is the count of restored keys before Balance warns of skewed
+// nodes, early shares being noise.
+const balanceMin = 1000
+
+// Balance tracks the keys restored per node of a Redis Cluster target,
+// restored through a cluster-aware proxy, hashing each key to its slot as
+// the cluster does. Nodes receiving more than Skew times their share of the
+// slots are warned of once, suggesting a reshard, and with Pace each of
+// their keys is restored Pace later while they stay skewed.
+// It's shared by several writers.
+type Balance struct {
+	Skew float64
+	Pace time.Duration
+
+	mu     sync.Mutex
+	slots  [Slots]string
+	owned  map[string]int
+	order  []string
+	counts map[string]int64
+	total  int64
+	warned map[string]bool
+}
+
+// NewBalance creates a Balance of the cluster node client belongs to,
+// reading the slots of each node with CLUSTER SLOTS.
+func NewBalance(client radix.Client, skew float64, pace time.Duration) (*Balance, error) {
+	var ranges [][]interface{}
+	if err := client.Do(radix.Cmd(&ranges, "CLUSTER", "SLOTS")); err != nil {
+		return nil, fmt.Errorf("error calling CLUSTER SLOTS: %w", err)
+	}
+
+	b := &Balance{
+		Skew:   skew,
+		Pace:   pace,
+		owned:  map[string]int{},
+		counts: map[string]int64{},
+		warned: map[string]bool{},
+	}
+	// [start, end, [ip, port, id], replicas...]
+	for _, r := range ranges {
+		if len(r) < 3 {
+			return nil, fmt.Errorf("error reading CLUSTER SLOTS: unexpected range %v", r)
+		}
+		master, ok := r[2].([]interface{})
+		if !ok || len(master) < 2 {
+			return nil, fmt.Errorf("error reading CLUSTER SLOTS: unexpected node %v", r[2])
+		}
+		start, end, ok := slotRange(r[0], r[1])
+		if !ok {
+			return nil, fmt.Errorf("error reading CLUSTER SLOTS: unexpected slots %v-%v", r[0], r[1])
+		}
+
+		node := fmt.Sprintf("%s:%v", master[0], master[1])
+		if _, ok := b.owned[node]; !ok {
+			b.order = append(b.order, node)
+		}
+		for slot := start; slot <= end; slot++ {
+			b.slots[slot] = node
+		}
+		b.owned[node] += end - start + 1
+	}
+	if len(b.order) == 0 {
+		return nil, fmt.Errorf("error reading CLUSTER SLOTS: no slots assigned, not a cluster node")
+	}
+
+	return b, nil
+}
+
+// slotRange returns the start and end slots of a CLUSTER SLOTS range.
+func slotRange(start, end interface{}) (int, int, bool) {
+	s, ok := start.(int64)
+	e, eok := end.(int64)
+	if !ok || !eok || s < 0 || e < s || e >= Slots {
+		return 0, 0, false
+	}
+
+	return int(s), int(e), true
+}
+
+// node returns the node serving key, empty for unassigned slots.
+func (b *Balance) node(key string) string {
+	return b.slots[radix.ClusterSlot([]byte(key))]
+}
+
+// skewed reports whether node received more than Skew times its share of
+// the slots, once balanceMin keys were restored. Locked by callers.
+func (b *Balance) skewed(node string) bool {
+	if b.total < balanceMin || node == "" {
+		return false
+	}
+	share := float64(b.counts[node]) / float64(b.total)
+
+	return share > b.Skew*float64(b.owned[node])/Slots
+}
+
+// pace waits Pace before restoring key, while its node is skewed, nil-safe.
+func (b *Balance) pace(key string) {
+	if b == nil || b.Pace == 0 {
+		return
+	}
+
+	b.mu.Lock()
+	skewed := b.skewed(b.node(key))
+	b.mu.Unlock()
+	if skewed {
+		time.Sleep(b.Pace)
+	}
+}
+
+// add counts restored key on its node, warning once of the node when skewed,
+// nil-safe.
+func (b *Balance) add(key string) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	node := b.node(key)
+	b.counts[node]++
+	b.total++
+	if b.warned[node] || !b.skewed(node) {
+		return
+	}
+	b.warned[node] = true
+	fmt.Printf("redis: cluster node %s received %.1f%% of the restored keys, for %.1f%% of the slots, consider resharding\n",
+		node, b.percent(node), 100*float64(b.owned[node])/Slots)
+}
+
+// percent returns the percentage of the restored keys node received.
+// Locked by callers.
+func (b *Balance) percent(node string) float64 {
+	if b.total == 0 {
+		return 0
+	}
+
+	return 100 * float64(b.counts[node]) / float64(b.total)
+}
+
+// Report notes the final distribution of the restored keys per node in
+// the Summary, in CLUSTER SLOTS order, nil-safe.
+func (b *Balance) Report(s *summary.Summary) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, node := range b.order {
+		skewed := ""
+		if b.warned[node] {
+			skewed = ", skewed"
+		}
+		s.Note(fmt.Sprintf("cluster node %s keys=%d (%.1f%%) slots=%d (%.1f%%)%s", node, b.counts[node],
+			b.percent(node), b.owned[node], 100*float64(b.owned[node])/Slots, skewed))
+	}
+	if n := b.counts[""]; n > 0 {
+		s.Note(fmt.Sprintf("cluster keys of unassigned slots=%d", n))
+	}
+}
@@ -0,0 +1,115 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/mediocregopher/radix/v3"
+)
+
+// BenchSize is a value size of the synthetic keys of a benchmark, in bytes,
+// drawn in proportion to its Weight.
+type BenchSize struct {
+	Bytes  int
+	Weight int
+}
+
+// seedBatch is the number of keys SET, or DEL, per pipeline by Seed and
+// Unseed.
+const seedBatch = 100
+
+// ParseBenchSizes parses a SIZE[:WEIGHT] list, comma separated, e.g.
+// 128:90,65536:10 for 90% of 128 bytes values and 10% of 64KiB ones.
+// Weights default to 1.
+func ParseBenchSizes(s string) ([]BenchSize, error) {
+	var sizes []BenchSize
+	for _, f := range strings.Split(s, ",") {
+		parts := strings.SplitN(f, ":", 2)
+		size := BenchSize{Weight: 1}
+		var err error
+		if size.Bytes, err = strconv.Atoi(parts[0]); err != nil || size.Bytes < 1 {
+			return nil, fmt.Errorf("invalid size '%s', must be positive bytes", parts[0])
+		}
+		if len(parts) == 2 {
+			if size.Weight, err = strconv.Atoi(parts[1]); err != nil || size.Weight < 1 {
+				return nil, fmt.Errorf("invalid weight '%s' of size %d, must be positive", parts[1], size.Bytes)
+			}
+		}
+		sizes = append(sizes, size)
+	}
+
+	return sizes, nil
+}
+
+// drawSize draws the size of a value from sizes.
+func drawSize(rnd *rand.Rand, sizes []BenchSize) int {
+	weights := make([]int, len(sizes))
+	for i, s := range sizes {
+		weights[i] = s.Weight
+	}
+
+	return sizes[draw(rnd, weights)].Bytes
+}
+
+// draw draws an index of weights, in proportion to them.
+func draw(rnd *rand.Rand, weights []int) int {
+	total := 0
+	for _, w := range weights {
+		total += w
+	}
+	n := rnd.Intn(total)
+	for i, w := range weights {
+		if n < w {
+			return i
+		}
+		n -= w
+	}
+
+	return len(weights) - 1
+}
+
+// Seed writes n synthetic string keys, named prefix and their index, of
+// random values drawn from sizes, pipelined. It returns the keys written,
+// to be Unseeded even on error, and the bytes of their values.
+func (r *Redis) Seed(ctx context.Context, prefix string, n int, sizes []BenchSize, rnd *rand.Rand) ([]string, int64, error) {
+	var keys []string
+	var bytes int64
+	for i := 0; i < n; i += seedBatch {
+		if ctx.Err() != nil {
+			return keys, bytes, ctx.Err()
+		}
+
+		var cmds []radix.CmdAction
+		for j := i; j < n && j < i+seedBatch; j++ {
+			value := make([]byte, drawSize(rnd, sizes))
+			rnd.Read(value)
+			key := prefix + strconv.Itoa(j)
+			cmds = append(cmds, radix.Cmd(nil, r.cmd("SET"), key, string(value)))
+			keys = append(keys, key)
+			bytes += int64(len(value))
+		}
+		if err := r.Pool.Do(radix.Pipeline(cmds...)); err != nil {
+			return keys, bytes, fmt.Errorf("error seeding benchmark keys: %w", err)
+		}
+	}
+
+	return keys, bytes, nil
+}
+
+// Unseed deletes keys, pipelined.
+func (r *Redis) Unseed(keys []string) error {
+	for i := 0; i < len(keys); i += seedBatch {
+		var cmds []radix.CmdAction
+		for j := i; j < len(keys) && j < i+seedBatch; j++ {
+			cmds = append(cmds, radix.Cmd(nil, r.cmd("DEL"), keys[j]))
+		}
+		if err := r.Pool.Do(radix.Pipeline(cmds...)); err != nil {
+			return fmt.Errorf("error deleting benchmark keys: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package redis
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/stickermule/rump/pkg/message"
+	"github.com/stickermule/rump/pkg/summary"
+)
+
+// Breaker aborts ContinueOnError runs after Max consecutive failures,
+// across all writers sharing it, a success of any of them resetting the
+// count. It's shared by several writers.
+type Breaker struct {
+	Max int
+
+	mu         sync.Mutex
+	failures   int
+	lastErrors []string
+}
+
+// NewBreaker creates a Breaker tripping after max consecutive failures.
+func NewBreaker(max int) *Breaker {
+	return &Breaker{Max: max}
+}
+
+// fail counts the failure of key with err. Once tripped, it returns an
+// error aborting the run, with the last errors noted in sum. It's a noop on
+// a nil Breaker.
+func (b *Breaker) fail(key string, err error, sum *summary.Summary) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.lastErrors = append(b.lastErrors, fmt.Sprintf("%s: %s", message.FormatKey(key), err))
+	if len(b.lastErrors) > lastErrors {
+		b.lastErrors = b.lastErrors[1:]
+	}
+	if b.Max == 0 || b.failures < b.Max {
+		return nil
+	}
+
+	sum.Note(fmt.Sprintf("circuit breaker tripped after %d consecutive failures, last errors:", b.failures))
+	for _, e := range b.lastErrors {
+		sum.Note("  " + e)
+	}
+
+	return fmt.Errorf("destination appears unhealthy, %d consecutive failures: %w", b.failures, err)
+}
+
+// succeed resets the consecutive failures count.
+func (b *Breaker) succeed() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.lastErrors = nil
+}
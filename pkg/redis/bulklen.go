@@ -0,0 +1,92 @@
+package redis
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/mediocregopher/radix/v3"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// Policies of the DUMP payloads over the target proto-max-bulk-len, RESTORE
+// refusing them: skipped, the limit raised with CONFIG SET, or failing the
+// run.
+const (
+	BulkSkip  = "skip"
+	BulkRaise = "raise"
+	BulkFail  = "fail"
+)
+
+// BulkPolicies lists the BulkLimit policy names.
+var BulkPolicies = map[string]bool{
+	BulkSkip:  true,
+	BulkRaise: true,
+	BulkFail:  true,
+}
+
+// BulkLimit is the target proto-max-bulk-len, Max, and the Policy of the
+// payloads over it. It can be shared by several writers, Max growing as
+// BulkRaise raises it.
+type BulkLimit struct {
+	Max    int64
+	Policy string
+
+	mu sync.Mutex
+}
+
+// ProtoMaxBulkLen reads the proto-max-bulk-len of the server, the longest
+// bulk string it accepts, with CONFIG GET.
+func (r *Redis) ProtoMaxBulkLen() (int64, error) {
+	var config []string
+	if err := r.Pool.Do(radix.Cmd(&config, r.cmd("CONFIG"), "GET", "proto-max-bulk-len")); err != nil {
+		return 0, fmt.Errorf("error reading proto-max-bulk-len: %w", err)
+	}
+	if len(config) != 2 {
+		return 0, fmt.Errorf("error reading proto-max-bulk-len: not in CONFIG GET")
+	}
+	n, err := strconv.ParseInt(config[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid proto-max-bulk-len \"%s\"", config[1])
+	}
+
+	return n, nil
+}
+
+// overBulkLimit tells whether the payload of p is over the BulkLimit, and
+// skipped, counted as over-bulk-len. With BulkRaise, the limit is raised to
+// the payload size instead, counted as bulk-len-raised, and keys are skipped
+// only when CONFIG SET is denied.
+func (r *Redis) overBulkLimit(p message.Payload) (bool, error) {
+	b := r.BulkLimit
+	if b == nil {
+		return false, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	size := int64(len(p.Value))
+	if size <= b.Max {
+		return false, nil
+	}
+
+	switch b.Policy {
+	case BulkFail:
+		return false, fmt.Errorf("error restoring key %s: its %d bytes payload is over the target proto-max-bulk-len, %d", message.FormatKey(p.Key), size, b.Max)
+	case BulkRaise:
+		err := r.Pool.Do(radix.Cmd(nil, r.cmd("CONFIG"), "SET", "proto-max-bulk-len", strconv.FormatInt(size, 10)))
+		if err == nil {
+			fmt.Printf("redis: raised the target proto-max-bulk-len from %d to %d, for key %s\n", b.Max, size, message.FormatKey(p.Key))
+			b.Max = size
+			r.Summary.Incr("bulk-len-raised")
+			return false, nil
+		}
+		r.logError("redis: error raising the target proto-max-bulk-len for key %s; error=%s\n", message.FormatKey(p.Key), err)
+	}
+
+	r.Summary.Incr("over-bulk-len")
+	r.logError("redis: skipping key %s, size=%d over the target proto-max-bulk-len %d\n", message.FormatKey(p.Key), size, b.Max)
+
+	return true, r.skipped(p, "over-bulk-len")
+}
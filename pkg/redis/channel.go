@@ -0,0 +1,56 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mediocregopher/radix/v3"
+)
+
+// KeysChannel reads the keys to transfer off a pub/sub channel, in place of
+// SCAN, each message a key name, e.g. published by another system each time
+// a key changes. PubSub is the connection subscribing to Name, e.g. a
+// NewPubSub one, resubscribing on connection loss: messages published
+// meanwhile are lost, unlike KeysStream entries.
+type KeysChannel struct {
+	Name   string
+	PubSub radix.PubSubConn
+}
+
+// readChannel dumps the keys of KeysChannel messages as they arrive, until
+// the context is done.
+func (r *Redis) readChannel(ctx context.Context) error {
+	c := r.KeysChannel
+	defer c.PubSub.Close()
+
+	// Buffered not to hold the subscription while keys are read
+	msgs := make(chan radix.PubSubMessage, 100)
+	if err := c.PubSub.Subscribe(msgs, c.Name); err != nil {
+		return fmt.Errorf("error subscribing to keys channel '%s': %w", c.Name, err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("redis: done reading")
+			return nil
+		case m := <-msgs:
+			r.Summary.Incr("channel-messages")
+			key := string(m.Message)
+			switch {
+			case key == "":
+				r.Summary.Incr("invalid")
+				r.logError("redis: skipping empty message of channel \"%s\"\n", c.Name)
+			case r.excluded(key, r.Filter.SelectsRule):
+			default:
+				err := r.readKey(ctx, key)
+				if ctx.Err() != nil {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
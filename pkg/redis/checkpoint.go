@@ -0,0 +1,128 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mediocregopher/radix/v3"
+)
+
+// Checkpoint stops a Read SCANning once Deadline passed, between two SCAN
+// batches, keeping the cursor to resume from: the keys of the batches read
+// before it are all on the Bus, restored once the writers drained it.
+// Reads start from the cursor it was created with, "0" for a full scan.
+type Checkpoint struct {
+	Deadline time.Time
+
+	mu      sync.Mutex
+	cursor  string
+	stopped bool
+}
+
+// NewCheckpoint creates a Checkpoint resuming from cursor, stopping at
+// deadline unless zero.
+func NewCheckpoint(cursor string, deadline time.Time) *Checkpoint {
+	return &Checkpoint{Deadline: deadline, cursor: cursor}
+}
+
+// Cursor returns the cursor to resume from, "0" once the scan completed.
+func (c *Checkpoint) Cursor() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.cursor
+}
+
+// Stopped reports whether Read stopped at Deadline, before the scan
+// completed.
+func (c *Checkpoint) Stopped() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stopped
+}
+
+// next records the cursor of the next batch, "0" once done, reporting
+// whether to SCAN it: false once Deadline passed.
+func (c *Checkpoint) next(cursor string, done bool) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cursor = cursor
+	if !done && !c.Deadline.IsZero() && time.Now().After(c.Deadline) {
+		c.stopped = true
+	}
+
+	return !done && !c.stopped
+}
+
+// cursorSource is the SCAN KeySource of Checkpoint reads, calling SCAN
+// itself to know the cursor of each batch.
+type cursorSource struct {
+	r       *Redis
+	c       *Checkpoint
+	cursor  string
+	keys    []string
+	started bool
+}
+
+// Next returns the next SCANned key, false once the scan completed, or the
+// Checkpoint stopped it.
+func (s *cursorSource) Next(ctx context.Context) (string, bool, error) {
+	for len(s.keys) == 0 {
+		done := s.started && s.cursor == "0"
+		if !s.c.next(s.cursor, done) {
+			if !done {
+				fmt.Printf("redis: checkpoint at cursor %s, stopped scanning\n", s.cursor)
+			}
+			return "", false, nil
+		}
+		s.started = true
+
+		if err := s.scan(); err != nil {
+			return "", false, err
+		}
+	}
+
+	key := s.keys[0]
+	s.keys = s.keys[1:]
+
+	return key, true, nil
+}
+
+// scan reads the batch of the cursor, moving it to the next one.
+func (s *cursorSource) scan() error {
+	opts := s.r.scanOpts()
+	args := []string{s.cursor}
+	if opts.Pattern != "" {
+		args = append(args, "MATCH", opts.Pattern)
+	}
+	if opts.Count > 0 {
+		args = append(args, "COUNT", fmt.Sprint(opts.Count))
+	}
+
+	// [cursor, [key, ...]]
+	var reply []interface{}
+	if err := s.r.Pool.Do(radix.Cmd(&reply, opts.Command, args...)); err != nil {
+		return fmt.Errorf("error scanning from cursor %s: %w", s.cursor, err)
+	}
+	if len(reply) != 2 {
+		return fmt.Errorf("error scanning from cursor %s: unexpected reply %v", s.cursor, reply)
+	}
+	cursor, ok := reply[0].([]byte)
+	keys, kok := reply[1].([]interface{})
+	if !ok || !kok {
+		return fmt.Errorf("error scanning from cursor %s: unexpected reply %v", s.cursor, reply)
+	}
+
+	s.cursor = string(cursor)
+	for _, key := range keys {
+		if k, ok := key.([]byte); ok {
+			s.keys = append(s.keys, string(k))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package redis
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/mediocregopher/radix/v3"
+)
+
+// Clock returns the offset of the server clock, read with TIME, from the
+// local one, taken halfway through the round trip.
+func (r *Redis) Clock() (time.Duration, error) {
+	var reply []string
+	start := time.Now()
+	if err := r.Pool.Do(radix.Cmd(&reply, r.cmd("TIME"))); err != nil {
+		return 0, fmt.Errorf("error calling TIME: %w", err)
+	}
+	local := start.Add(time.Since(start) / 2)
+
+	if len(reply) != 2 {
+		return 0, fmt.Errorf("invalid TIME reply %v", reply)
+	}
+	sec, err := strconv.ParseInt(reply[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid TIME reply %v", reply)
+	}
+	usec, err := strconv.ParseInt(reply[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid TIME reply %v", reply)
+	}
+
+	return time.Unix(sec, usec*int64(time.Microsecond)).Sub(local), nil
+}
+
+// ErrClockSkew is the error of clocks skewed beyond the maximum of
+// CheckSkew.
+var ErrClockSkew = errors.New("clock skew over the maximum")
+
+// CheckSkew returns the skew of the target clock from the source one, read
+// with TIME off both, failing with ErrClockSkew when either way over max,
+// unchecked when 0.
+func CheckSkew(source, target *Redis, max time.Duration) (time.Duration, error) {
+	from, err := source.Clock()
+	if err != nil {
+		return 0, fmt.Errorf("error reading the source clock: %w", err)
+	}
+	to, err := target.Clock()
+	if err != nil {
+		return 0, fmt.Errorf("error reading the target clock: %w", err)
+	}
+
+	skew := to - from
+	if max > 0 && (skew > max || skew < -max) {
+		return skew, fmt.Errorf("%w: target clock skew %s from the source, max %s", ErrClockSkew, skew.Round(time.Millisecond), max)
+	}
+
+	return skew, nil
+}
@@ -0,0 +1,208 @@
+package redis
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mediocregopher/radix/v3"
+	"golang.org/x/sync/errgroup"
+)
+
+// Comparison statuses of a key.
+const (
+	OnlySource   = "only-source"
+	OnlyTarget   = "only-target"
+	Identical    = "identical"
+	Different    = "different"
+	DifferentTTL = "different-ttl"
+)
+
+// DefaultTTLTolerance is the TTLTolerance of New, time passing between the
+// reads of both sides.
+const DefaultTTLTolerance = time.Second
+
+// sameTTL tells if the PTTLs a and b, in milliseconds, negative for keys
+// without expiration, are within tolerance of each other. Keys without
+// expiration on both sides always are.
+func sameTTL(a, b int64, tolerance time.Duration) bool {
+	if a < 0 || b < 0 {
+		return a < 0 && b < 0
+	}
+	d := a - b
+	if d < 0 {
+		d = -d
+	}
+
+	return d <= int64(tolerance/time.Millisecond)
+}
+
+// Diff counts the keys of a comparison, by status.
+type Diff struct {
+	OnlySource   int64 `json:"only_source"`
+	OnlyTarget   int64 `json:"only_target"`
+	Identical    int64 `json:"identical"`
+	Different    int64 `json:"different"`
+	DifferentTTL int64 `json:"different_ttl"`
+}
+
+// KeyDiff is the status of a key not Identical.
+type KeyDiff struct {
+	Key    string `json:"key"`
+	Status string `json:"status"`
+}
+
+// dumpPTTL reads the DUMP payload and PTTL of key, pipelined. The payload is
+// empty for missing keys.
+func (r *Redis) dumpPTTL(key string) (string, int64, error) {
+	var value string
+	var ttl int64
+	dump, pttl := &reply{rcv: &value}, &reply{rcv: &ttl}
+
+	err := r.Pool.Do(radix.Pipeline(
+		radix.Cmd(dump, r.cmd("DUMP"), key),
+		radix.Cmd(pttl, r.cmd("PTTL"), key),
+	))
+	switch {
+	case err != nil:
+		return "", 0, err
+	case dump.err != nil:
+		return "", 0, dump.err
+	}
+
+	return value, ttl, pttl.err
+}
+
+// status compares key on source and target, their TTLs with the target TTL.
+func status(source, target *Redis, key string) (string, error) {
+	sourceValue, sourceTTL, err := source.dumpPTTL(key)
+	if err != nil {
+		return "", err
+	}
+	targetValue, targetTTL, err := target.dumpPTTL(key)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case sourceValue == "":
+		// Deleted since listed
+		return "", nil
+	case targetValue == "":
+		return OnlySource, nil
+	case sourceValue != targetValue:
+		return Different, nil
+	case target.TTL && !sameTTL(sourceTTL, targetTTL, target.TTLTolerance):
+		return DifferentTTL, nil
+	}
+
+	return Identical, nil
+}
+
+// Compare diffs the keys passing the source Filter on source and target,
+// with workers comparing DUMP payloads and TTLs in parallel, within the
+// target TTLTolerance, then scans the target for keys missing on the source.
+// Keys not Identical are passed to report, which must be safe for concurrent
+// use. It only reads.
+func Compare(ctx context.Context, source, target *Redis, workers int, report func(KeyDiff) error) (Diff, error) {
+	var diff Diff
+	var mu sync.Mutex
+	count := func(key, s string) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch s {
+		case OnlySource:
+			diff.OnlySource++
+		case OnlyTarget:
+			diff.OnlyTarget++
+		case Identical:
+			diff.Identical++
+			return nil
+		case Different:
+			diff.Different++
+		case DifferentTTL:
+			diff.DifferentTTL++
+		default:
+			return nil
+		}
+
+		return report(KeyDiff{Key: key, Status: s})
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	// Source keys, compared by the workers
+	g, gctx := errgroup.WithContext(ctx)
+	keys := make(chan string, 100)
+	g.Go(func() error {
+		defer close(keys)
+		return scan(gctx, source, keys)
+	})
+	for i := 0; i < workers; i++ {
+		g.Go(func() error {
+			for key := range keys {
+				s, err := status(source, target, key)
+				if err != nil {
+					return err
+				}
+				if err := count(key, s); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return diff, err
+	}
+
+	// Target keys, missing on the source
+	g, gctx = errgroup.WithContext(ctx)
+	keys = make(chan string, 100)
+	g.Go(func() error {
+		defer close(keys)
+		return scan(gctx, target, keys)
+	})
+	for i := 0; i < workers; i++ {
+		g.Go(func() error {
+			for key := range keys {
+				var exists int
+				if err := source.Pool.Do(radix.Cmd(&exists, source.cmd("EXISTS"), key)); err != nil {
+					return err
+				}
+				if exists == 0 {
+					if err := count(key, OnlyTarget); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+	}
+
+	return diff, g.Wait()
+}
+
+// scan lists the keys of r passing its Filter on keys, until ctx is done.
+func scan(ctx context.Context, r *Redis, keys chan<- string) error {
+	scanner := radix.NewScanner(r.Pool, r.scanOpts())
+
+	var key string
+	for scanner.Next(&key) {
+		if !r.Filter.Keep(key) {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			scanner.Close()
+			return ctx.Err()
+		case keys <- key:
+		}
+	}
+
+	return scanner.Close()
+}
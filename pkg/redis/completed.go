@@ -0,0 +1,198 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/stickermule/rump/pkg/bloom"
+)
+
+// DefaultCompletedBatch is the number of key names buffered per write of the
+// completion manifest.
+const DefaultCompletedBatch = 100
+
+// Completed appends the source name of each key restored, as read, to a
+// completion manifest, a key per line, Go quoted, binary names kept exact,
+// Batch keys per write, each write synced to disk with Fsync. It can be
+// shared by several writers.
+type Completed struct {
+	Batch int
+	Fsync bool
+
+	mu      sync.Mutex
+	f       *os.File
+	w       *bufio.Writer
+	pending int
+	added   int64
+}
+
+// NewCompleted opens the completion manifest path, appending to it when
+// resume, truncating it otherwise.
+func NewCompleted(path string, resume bool) (*Completed, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if resume {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening completion manifest: %w", err)
+	}
+
+	return &Completed{Batch: DefaultCompletedBatch, f: f, w: bufio.NewWriter(f)}, nil
+}
+
+// Add appends key, writing the pending keys once Batch are.
+func (c *Completed) Add(key string) error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := c.w.WriteString(strconv.Quote(key) + "\n"); err != nil {
+		return fmt.Errorf("error writing completion manifest: %w", err)
+	}
+	c.added++
+	c.pending++
+	if c.pending < c.Batch {
+		return nil
+	}
+
+	return c.flush()
+}
+
+// Added returns the number of keys appended.
+func (c *Completed) Added() int64 {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.added
+}
+
+// flush writes the pending keys, syncing them with Fsync, the mutex held.
+func (c *Completed) flush() error {
+	c.pending = 0
+	if err := c.w.Flush(); err != nil {
+		return fmt.Errorf("error writing completion manifest: %w", err)
+	}
+	if c.Fsync {
+		if err := c.f.Sync(); err != nil {
+			return fmt.Errorf("error syncing completion manifest: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Close writes the pending keys and closes the completion manifest.
+func (c *Completed) Close() error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := c.flush()
+	if cerr := c.f.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("error closing completion manifest: %w", cerr)
+	}
+
+	return err
+}
+
+// Done is the set of keys of a completion manifest, skipped by resumed runs:
+// exact, or a Bloom filter of them, bounding the memory of large manifests,
+// its false positives skipped though never completed.
+type Done struct {
+	Keys int64
+
+	keys  map[string]struct{}
+	bloom *bloom.Filter
+}
+
+// ReadDone reads the completion manifest path into a Done set, a Bloom
+// filter at false positive rate fp when above 0. A missing manifest holds
+// no keys. A line cut short, by a run killed mid write, is left out.
+func ReadDone(path string, fp float64) (*Done, error) {
+	d := &Done{keys: map[string]struct{}{}}
+	if fp > 0 {
+		n, err := completedKeys(path)
+		if err != nil {
+			return nil, err
+		}
+		d.keys = nil
+		d.bloom = bloom.New(uint64(n), fp)
+	}
+
+	err := readCompleted(path, func(key string) {
+		d.Keys++
+		if d.bloom != nil {
+			d.bloom.Add(key)
+			return
+		}
+		d.keys[key] = struct{}{}
+	})
+
+	return d, err
+}
+
+// Has reports whether key completed, false on a nil Done.
+func (d *Done) Has(key string) bool {
+	switch {
+	case d == nil:
+		return false
+	case d.bloom != nil:
+		return d.bloom.Test(key)
+	}
+	_, ok := d.keys[key]
+
+	return ok
+}
+
+// completedKeys counts the keys of the completion manifest path, to size the
+// Bloom filter of them.
+func completedKeys(path string) (int64, error) {
+	var n int64
+	err := readCompleted(path, func(string) { n++ })
+
+	return n, err
+}
+
+// readCompleted calls add with each key of the completion manifest path.
+func readCompleted(path string, add func(key string)) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading completion manifest: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		s, err := r.ReadString('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading completion manifest: %w", err)
+		}
+		key, err := strconv.Unquote(strings.TrimSuffix(s, "\n"))
+		if err != nil {
+			return fmt.Errorf("error reading completion manifest, line %d: invalid key %q", line, s)
+		}
+		add(key)
+	}
+}
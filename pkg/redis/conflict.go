@@ -0,0 +1,71 @@
+package redis
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/mediocregopher/radix/v3"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// Conflict resolves a key existing on both sides, reporting whether the
+// source key wins over the target one, given their TTLs in milliseconds.
+// Keys without expiration have a math.MaxInt64 TTL.
+type Conflict func(source, target int64) bool
+
+// SourceAlwaysWins replaces target keys, as without conflict resolution.
+func SourceAlwaysWins(source, target int64) bool {
+	return true
+}
+
+// LongerTTLWins keeps the key expiring last.
+func LongerTTLWins(source, target int64) bool {
+	return source > target
+}
+
+// ShorterTTLWins keeps the key expiring first.
+func ShorterTTLWins(source, target int64) bool {
+	return source < target
+}
+
+// Conflicts maps conflict policy names to their Conflict.
+var Conflicts = map[string]Conflict{
+	"source-always-wins": SourceAlwaysWins,
+	"longer-ttl-wins":    LongerTTLWins,
+	"shorter-ttl-wins":   ShorterTTLWins,
+}
+
+// sourceWins reports whether the Payload key, with ttl, should replace the
+// target key, depending on Conflict. Missing target keys always lose. TTLs
+// within TTLTolerance are equal, as read apart.
+func (r *Redis) sourceWins(key string, ttl int64) (bool, error) {
+	if r.Conflict == nil {
+		return true, nil
+	}
+
+	var target int64
+	err := r.Pool.Do(radix.Cmd(&target, r.cmd("PTTL"), key))
+	if err != nil {
+		return false, fmt.Errorf("error calling PTTL for target key %s: %w", message.FormatKey(key), err)
+	}
+
+	switch target {
+	// Missing key
+	case -2:
+		return true, nil
+	// No expiration
+	case -1:
+		target = math.MaxInt64
+	}
+
+	// Payload TTL 0 is no expiration
+	if ttl == 0 {
+		ttl = math.MaxInt64
+	}
+	if ttl != math.MaxInt64 && target != math.MaxInt64 && sameTTL(ttl, target, r.TTLTolerance) {
+		target = ttl
+	}
+
+	return r.Conflict(ttl, target), nil
+}
@@ -0,0 +1,110 @@
+package redis
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/stickermule/rump/pkg/filter"
+	"github.com/stickermule/rump/pkg/message"
+	"github.com/stickermule/rump/pkg/resp"
+)
+
+// Converter converts keys of one type into another, for schema migrations:
+// they're read by elements and recreated by commands, in place of DUMP and
+// RESTORE. Embedders implement their own, adding them to Converters or to
+// the Conversions of Redis.
+type Converter interface {
+	// From is the TYPE of the keys converted, e.g. list.
+	From() string
+	// To is the TYPE of the converted keys, e.g. zset.
+	To() string
+	// Convert returns the RESP encoded commands recreating key from its
+	// From elements, replacing it.
+	Convert(key string, elems []string) (string, error)
+}
+
+// Converters lists the built-in Converters, by from:to name.
+var Converters = map[string]Converter{
+	"list:zset": ListToZset{},
+	"set:hash":  SetToHash{Value: "1"},
+}
+
+// Conversion converts the keys matching Pattern, a glob as in MATCH, with
+// Converter. Keys of another type are read as is.
+type Conversion struct {
+	Pattern   string
+	Converter Converter
+}
+
+// ListToZset converts lists into sorted sets, scored by position from 0,
+// repeated elements keeping their last position.
+type ListToZset struct{}
+
+// From is list.
+func (ListToZset) From() string { return "list" }
+
+// To is zset.
+func (ListToZset) To() string { return "zset" }
+
+// Convert adds the list elements, scored by position.
+func (ListToZset) Convert(key string, elems []string) (string, error) {
+	var scored []string
+	for i, e := range elems {
+		scored = append(scored, strconv.Itoa(i), e)
+	}
+
+	return resp.Recreate("ZADD", key, scored, 2, batchSize), nil
+}
+
+// SetToHash converts sets into hashes, a field per member set to Value.
+type SetToHash struct {
+	Value string
+}
+
+// From is set.
+func (SetToHash) From() string { return "set" }
+
+// To is hash.
+func (SetToHash) To() string { return "hash" }
+
+// Convert sets a field per set member.
+func (c SetToHash) Convert(key string, elems []string) (string, error) {
+	var fields []string
+	for _, e := range elems {
+		fields = append(fields, e, c.Value)
+	}
+
+	return resp.Recreate("HSET", key, fields, 2, batchSize), nil
+}
+
+// converter returns the Converter of key, of keyType, nil when none of the
+// Conversions matches it, or its type, counted as unconverted then.
+func (r *Redis) converter(key, keyType string) Converter {
+	for _, c := range r.Conversions {
+		if !filter.Glob(c.Pattern, key) {
+			continue
+		}
+		if c.Converter.From() != keyType {
+			r.Summary.Incr("unconverted")
+			return nil
+		}
+		return c.Converter
+	}
+
+	return nil
+}
+
+// convert reads key as the commands recreating it converted by c.
+func (r *Redis) convert(key string, c Converter) (string, error) {
+	elems, err := r.elements(key, c.From())
+	if err != nil {
+		return "", err
+	}
+	value, err := c.Convert(key, elems)
+	if err != nil {
+		return "", fmt.Errorf("error converting key %s from %s to %s: %w", message.FormatKey(key), c.From(), c.To(), err)
+	}
+	r.Summary.Incr("converted")
+
+	return value, nil
+}
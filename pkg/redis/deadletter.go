@@ -0,0 +1,129 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// retryBackoff is the pause before each retry of a failed RESTORE, times the
+// attempt number.
+const retryBackoff = 100 * time.Millisecond
+
+// Letter is a dead-letter file entry, a key failing to restore.
+type Letter struct {
+	Key   string `json:"key"`
+	Error string `json:"error"`
+}
+
+// DeadLetter writes the keys failing to restore past MaxRetries to a file,
+// as JSON lines. It can be shared by several writers.
+type DeadLetter struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// NewDeadLetter creates the dead-letter file path, truncating it.
+func NewDeadLetter(path string) (*DeadLetter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating dead-letter file: %w", err)
+	}
+
+	return &DeadLetter{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Add writes key, with the error it last failed with.
+func (d *DeadLetter) Add(key string, err error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if werr := d.enc.Encode(Letter{Key: key, Error: err.Error()}); werr != nil {
+		return fmt.Errorf("error writing dead-letter file: %w", werr)
+	}
+
+	return nil
+}
+
+// Close closes the dead-letter file.
+func (d *DeadLetter) Close() error {
+	if d == nil {
+		return nil
+	}
+
+	return d.f.Close()
+}
+
+// ReadKeys reads the keys of a dead-letter file, to retry them.
+func ReadKeys(r io.Reader) ([]string, error) {
+	var keys []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var l Letter
+		if err := json.Unmarshal(scanner.Bytes(), &l); err != nil {
+			return nil, fmt.Errorf("error reading dead-letter file, line %d: %w", len(keys)+1, err)
+		}
+		keys = append(keys, l.Key)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading dead-letter file: %w", err)
+	}
+
+	return keys, nil
+}
+
+// readKeys reads Keys, in place of SCAN, applying the Filter client-side.
+func (r *Redis) readKeys(ctx context.Context) error {
+	reads := r.newInFlight(ctx)
+	for _, key := range r.Keys {
+		if r.excluded(key, r.Filter.SelectsRule) {
+			continue
+		}
+
+		if err := reads.read(key); err != nil {
+			return err
+		}
+	}
+
+	return reads.wait()
+}
+
+// retryRestore RESTOREs pd with restoreKey, retrying failures up to
+// MaxRetries times with DeadLetter. Redis Cluster redirections, keys denied
+// by ACL, and keys existing without REPLACE, with SkipExisting or NoReplace,
+// aren't retried. With RetryBudget, keys are given up on once retrying would
+// take longer than the budget, counted as budget-exceeded.
+func (r *Redis) retryRestore(pd *pending) error {
+	return r.retry(pd, r.restoreKey(pd))
+}
+
+// retry retries the RESTORE of pd, failed with err, as retryRestore.
+func (r *Redis) retry(pd *pending, err error) error {
+	key := pd.key
+	start := time.Now()
+	for attempt := 1; r.DeadLetter != nil && attempt <= r.MaxRetries; attempt++ {
+		if err == nil || clusterError(key, err) != nil || hasCode(err, "NOPERM") || r.isOOM(err) || (hasCode(err, "BUSYKEY") && (r.SkipExisting || r.NoReplace)) {
+			return err
+		}
+		backoff := time.Duration(attempt) * retryBackoff
+		if r.RetryBudget > 0 && time.Since(start)+backoff > r.RetryBudget {
+			r.Summary.Incr("budget-exceeded")
+			return fmt.Errorf("retry budget of %s exceeded after %d attempts: %w", r.RetryBudget, attempt, err)
+		}
+
+		r.logError("redis: error restoring key %s, retry %d/%d; error=%s\n", message.FormatKey(key), attempt, r.MaxRetries, err)
+		r.Summary.Incr("retried")
+		time.Sleep(backoff)
+		err = r.restoreKey(pd)
+	}
+
+	return err
+}
@@ -0,0 +1,58 @@
+package redis
+
+import (
+	"container/list"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// Dedup is a bounded set of the last Window keys read, least recently seen
+// evicted first, suppressing the keys SCAN returns more than once, e.g. while
+// the server rehashes. Keys seen again after Window other keys are read
+// again: it bounds the memory held, a full set of a large keyspace isn't.
+type Dedup struct {
+	Window int
+
+	order *list.List
+	keys  map[string]*list.Element
+}
+
+// NewDedup creates a Dedup of the last window keys.
+func NewDedup(window int) *Dedup {
+	return &Dedup{
+		Window: window,
+		order:  list.New(),
+		keys:   make(map[string]*list.Element, window),
+	}
+}
+
+// Seen tells whether key is one of the last Window keys, recording it as
+// the most recently seen either way.
+func (d *Dedup) Seen(key string) bool {
+	if e, ok := d.keys[key]; ok {
+		d.order.MoveToFront(e)
+		return true
+	}
+
+	d.keys[key] = d.order.PushFront(key)
+	if d.order.Len() > d.Window {
+		oldest := d.order.Back()
+		d.order.Remove(oldest)
+		delete(d.keys, oldest.Value.(string))
+	}
+
+	return false
+}
+
+// duplicate tells whether key was just read, with Dedup, counted as
+// duplicates.
+func (r *Redis) duplicate(key string) bool {
+	if r.Dedup == nil || !r.Dedup.Seen(key) {
+		return false
+	}
+
+	r.Summary.Incr("duplicates")
+	r.logKey("redis: skipping duplicate key %s\n", message.FormatKey(key))
+
+	return true
+}
@@ -0,0 +1,55 @@
+package redis
+
+import (
+	"fmt"
+	"time"
+)
+
+// drain restores the Payloads already on the Bus once the context is done,
+// for up to DrainTimeout, counted as drained, then takes the ones left off
+// it without restoring them, counted as drain-dropped. Workers sharing the
+// Bus drain it together, each counting its own.
+func (r *Redis) drain() error {
+	if r.DrainTimeout <= 0 {
+		return nil
+	}
+
+	drained, dropped := 0, 0
+	defer func() {
+		fmt.Printf("redis: drained %d payloads, dropped %d\n", drained, dropped)
+	}()
+
+	deadline := time.Now().Add(r.DrainTimeout)
+	for r.Bus != nil && time.Now().Before(deadline) {
+		select {
+		case p, ok := <-r.Bus:
+			if !ok {
+				r.Bus = nil
+				continue
+			}
+			if err := r.restore(p); err != nil {
+				return r.FailFast.fail(err)
+			}
+			drained++
+			r.Summary.Incr("drained")
+		default:
+			return nil
+		}
+	}
+
+	for r.Bus != nil {
+		select {
+		case _, ok := <-r.Bus:
+			if !ok {
+				r.Bus = nil
+				continue
+			}
+			dropped++
+			r.Summary.Incr("drain-dropped")
+		default:
+			return nil
+		}
+	}
+
+	return nil
+}
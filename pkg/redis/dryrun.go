@@ -0,0 +1,89 @@
+package redis
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/mediocregopher/radix/v3"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// DryRun lists the keys Read would DUMP to its writer, a JSON line per key
+// with its TYPE and TTL, without reading their values or pushing them on
+// the Bus. It's shared by the keys read in flight.
+type DryRun struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewDryRun creates a DryRun listing keys to w.
+func NewDryRun(w io.Writer) *DryRun {
+	return &DryRun{w: w}
+}
+
+// dryRunKey is a DryRun line, TTL in milliseconds, -1 when persistent.
+type dryRunKey struct {
+	Key  string `json:"key"`
+	Type string `json:"type"`
+	TTL  int64  `json:"ttl"`
+}
+
+// add writes the line of k.
+func (d *DryRun) add(k dryRunKey) error {
+	b, err := json.Marshal(k)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, err := d.w.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("error writing dry run: %w", err)
+	}
+
+	return nil
+}
+
+// dryRun lists key in place of DUMPing it, counted as a DUMP would be, with
+// a single TYPE and PTTL round trip.
+func (r *Redis) dryRun(key string) error {
+	k := dryRunKey{Key: key}
+	typ, ttl := &reply{rcv: &k.Type}, &reply{rcv: &k.TTL}
+	err := r.Pool.Do(radix.Pipeline(
+		radix.Cmd(typ, r.cmd("TYPE"), key),
+		radix.Cmd(ttl, r.cmd("PTTL"), key),
+	))
+	for _, e := range []error{typ.err, ttl.err} {
+		if err == nil {
+			err = e
+		}
+	}
+	if cerr := clusterError(key, err); cerr != nil {
+		return cerr
+	}
+	if err != nil {
+		return fmt.Errorf("error reading key %s from redis: %w", message.FormatKey(key), err)
+	}
+
+	// Key deleted since listed, nothing to restore.
+	if k.Type == "none" || k.TTL == -2 {
+		r.Summary.Incr("skipped-empty")
+		r.maybeLog(fmt.Sprintf("redis: skipped empty %s, size=0\n", message.FormatKey(key)))
+		return nil
+	}
+	if k.TTL == 0 {
+		r.skipExpired(key)
+		return nil
+	}
+
+	if err := r.DryRun.add(k); err != nil {
+		return err
+	}
+	r.Summary.Incr("dumped")
+
+	return nil
+}
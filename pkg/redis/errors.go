@@ -0,0 +1,124 @@
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mediocregopher/radix/v3"
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+
+	"github.com/stickermule/rump/pkg/message"
+	"github.com/stickermule/rump/pkg/records"
+)
+
+// hasCode reports whether err is a Redis error reply with code,
+// e.g. "BUSYKEY Target key name already exists.".
+func hasCode(err error, code string) bool {
+	return err != nil && strings.HasPrefix(err.Error(), code+" ")
+}
+
+// ErrCluster is the error of runs aborted by Redis Cluster redirections.
+var ErrCluster = errors.New("redis cluster not supported")
+
+// clusterError returns a single explanatory error for the MOVED, ASK and
+// CROSSSLOT replies of Redis Cluster nodes, nil for other errors. rump has no
+// cluster mode, so every other key would fail the same way: the run is
+// aborted, even with ContinueOnError.
+func clusterError(key string, err error) error {
+	// Replies may be wrapped, e.g. by keyType
+	for errors.Unwrap(err) != nil {
+		err = errors.Unwrap(err)
+	}
+
+	switch {
+	case hasCode(err, "MOVED") || hasCode(err, "ASK"):
+		// MOVED <slot> <host:port>
+		fields := strings.Fields(err.Error())
+		return fmt.Errorf("%w: key %s is served by cluster node %s, this is a Redis Cluster node. "+
+			"Point rump at standalone Redis servers, or at a cluster-aware proxy", ErrCluster, message.FormatKey(key), fields[len(fields)-1])
+	case hasCode(err, "CROSSSLOT"):
+		return fmt.Errorf("%w: keys of the commands for %s hash to different slots, this is a Redis Cluster node. "+
+			"Point rump at standalone Redis servers, or drop -shadow and -rename-atomic", ErrCluster, message.FormatKey(key))
+	}
+
+	return nil
+}
+
+// aclError returns an explanatory error for the NOPERM replies of target
+// users restricted by ACL key patterns, nil for other errors. The user is
+// named when ACL WHOAMI is allowed, asked once.
+func (r *Redis) aclError(key string, err error) error {
+	if !hasCode(err, "NOPERM") {
+		return nil
+	}
+
+	if r.aclUser == "" {
+		r.aclUser = "rump connects as"
+		var user string
+		if werr := r.Pool.Do(radix.Cmd(&user, r.cmd("ACL"), "WHOAMI")); werr == nil && user != "" {
+			r.aclUser = "'" + user + "'"
+		}
+	}
+
+	return fmt.Errorf("key %s is outside the key patterns the ACL user %s may write, "+
+		"list them with ACL GETUSER and restore the keys allowed only, e.g. with -match: %w", message.FormatKey(key), r.aclUser, err)
+}
+
+// reply unmarshals a reply into rcv, keeping Redis error replies in err
+// instead of failing, so that a pipeline reads all of its replies and
+// each error stays with its command.
+type reply struct {
+	rcv interface{}
+	err error
+}
+
+func (r *reply) UnmarshalRESP(br *bufio.Reader) error {
+	err := (resp2.Any{I: r.rcv}).UnmarshalRESP(br)
+	if rerr, ok := err.(resp2.Error); ok {
+		r.err = rerr
+		return nil
+	}
+
+	return err
+}
+
+// lastErrors is the number of errors reported when the breaker trips.
+const lastErrors = 5
+
+// quietSamples is the count of quieted lines noted in the Summary.
+const quietSamples = 5
+
+// logError logs a per-key error or skip line, Silent or not. With
+// QuietErrors, the line is counted as quieted instead, the first
+// quietSamples ones noted in the Summary as samples.
+func (r *Redis) logError(format string, args ...interface{}) {
+	line := fmt.Sprintf(format, args...)
+	if !r.QuietErrors {
+		fmt.Print(line)
+		return
+	}
+
+	r.Summary.Incr("quieted")
+	if r.Summary.Get("quieted") <= quietSamples {
+		r.Summary.Note("quieted: " + strings.TrimSpace(strings.TrimPrefix(line, "redis: ")))
+	}
+}
+
+// failed counts a key failure under ContinueOnError. Once the Breaker
+// tripped, it returns an error aborting the run, with the last errors noted
+// in the Summary.
+func (r *Redis) failed(key string, err error) error {
+	r.Summary.Incr("failed")
+	if rerr := r.Records.Add(records.Record{Key: key, Status: "failed", Error: err.Error()}); rerr != nil {
+		return rerr
+	}
+
+	return r.Breaker.fail(key, err, r.Summary)
+}
+
+// succeeded resets the consecutive failures count of the Breaker.
+func (r *Redis) succeeded() {
+	r.Breaker.succeed()
+}
@@ -0,0 +1,52 @@
+package redis
+
+import (
+	"context"
+	"sync"
+)
+
+// FailFast aborts a run on the first error of its writers: the run is
+// cancelled at once, writers don't take more Payloads, and all of them
+// return the first error, whichever returns first.
+// It's shared by several writers.
+type FailFast struct {
+	cancel context.CancelFunc
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewFailFast creates a FailFast cancelling the run with cancel.
+func NewFailFast(cancel context.CancelFunc) *FailFast {
+	return &FailFast{cancel: cancel}
+}
+
+// fail records err when it's the first one, cancelling the run, and returns
+// the first error. It returns err as is when f is nil.
+func (f *FailFast) fail(err error) error {
+	if f == nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err == nil {
+		f.err = err
+		f.cancel()
+	}
+
+	return f.err
+}
+
+// Err returns the first error, nil until a writer failed.
+func (f *FailFast) Err() error {
+	if f == nil {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.err
+}
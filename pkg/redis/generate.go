@@ -0,0 +1,189 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stickermule/rump/pkg/message"
+	"github.com/stickermule/rump/pkg/resp"
+	"github.com/stickermule/rump/pkg/summary"
+)
+
+// GenerateTypes are the key types a Generator writes.
+var GenerateTypes = []string{"string", "hash", "list", "set", "zset"}
+
+// GenerateType is a key type of the synthetic keys of a Generator, drawn in
+// proportion to its Weight.
+type GenerateType struct {
+	Name   string
+	Weight int
+}
+
+// GenerateTTL is a TTL of the synthetic keys of a Generator, 0 for none,
+// drawn in proportion to its Weight.
+type GenerateTTL struct {
+	TTL    time.Duration
+	Weight int
+}
+
+// parseWeighted parses a VALUE[:WEIGHT] list, comma separated, into values
+// and their weights, defaulting to 1.
+func parseWeighted(s string) ([]string, []int, error) {
+	var values []string
+	var weights []int
+	for _, f := range strings.Split(s, ",") {
+		parts := strings.SplitN(f, ":", 2)
+		weight := 1
+		if len(parts) == 2 {
+			var err error
+			if weight, err = strconv.Atoi(parts[1]); err != nil || weight < 1 {
+				return nil, nil, fmt.Errorf("invalid weight '%s' of %s, must be positive", parts[1], parts[0])
+			}
+		}
+		values = append(values, parts[0])
+		weights = append(weights, weight)
+	}
+
+	return values, weights, nil
+}
+
+// ParseGenerateTypes parses a TYPE[:WEIGHT] list, comma separated, of
+// GenerateTypes, e.g. string:80,hash:20. Weights default to 1.
+func ParseGenerateTypes(s string) ([]GenerateType, error) {
+	names, weights, err := parseWeighted(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var types []GenerateType
+	for i, name := range names {
+		known := false
+		for _, t := range GenerateTypes {
+			known = known || t == name
+		}
+		if !known {
+			return nil, fmt.Errorf("invalid type '%s', must be one of %s", name, strings.Join(GenerateTypes, ", "))
+		}
+		types = append(types, GenerateType{Name: name, Weight: weights[i]})
+	}
+
+	return types, nil
+}
+
+// ParseGenerateTTLs parses a DURATION[:WEIGHT] list, comma separated, e.g.
+// 0:80,1h:20 for 80% of persistent keys and 20% expiring in 1h. Weights
+// default to 1.
+func ParseGenerateTTLs(s string) ([]GenerateTTL, error) {
+	values, weights, err := parseWeighted(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var ttls []GenerateTTL
+	for i, v := range values {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl < 0 || (ttl > 0 && ttl < time.Millisecond) {
+			return nil, fmt.Errorf("invalid TTL '%s', must be 0 or a duration of at least 1ms", v)
+		}
+		ttls = append(ttls, GenerateTTL{TTL: ttl, Weight: weights[i]})
+	}
+
+	return ttls, nil
+}
+
+// Generator sends Keys synthetic keys to the message Bus, as a source reads
+// them, for a Redis target to Write: named Prefix and their index, of Types,
+// with Elements elements each but strings, each value and element of a size
+// drawn from Sizes, expiring per TTLs. Keys are sent as the commands
+// recreating them, their TTL included. Values are random bytes of Rand.
+type Generator struct {
+	Bus      message.Bus
+	Keys     int
+	Prefix   string
+	Types    []GenerateType
+	Sizes    []BenchSize
+	TTLs     []GenerateTTL
+	Elements int
+	Rand     *rand.Rand
+	Summary  *summary.Summary
+}
+
+// Read sends the synthetic keys to the Bus, counted as generated, per type
+// as generated-<type>, and their bytes of values as generated-bytes.
+func (g *Generator) Read(ctx context.Context) error {
+	defer close(g.Bus)
+
+	types := make([]int, len(g.Types))
+	for i, t := range g.Types {
+		types[i] = t.Weight
+	}
+	ttls := make([]int, len(g.TTLs))
+	for i, t := range g.TTLs {
+		ttls[i] = t.Weight
+	}
+
+	for i := 0; i < g.Keys; i++ {
+		key := g.Prefix + strconv.Itoa(i)
+		typ := g.Types[draw(g.Rand, types)].Name
+		ttl := strconv.FormatInt(int64(g.TTLs[draw(g.Rand, ttls)].TTL/time.Millisecond), 10)
+		cmds, size := g.recreate(key, typ)
+
+		p := message.Payload{Key: key, Value: cmds + expireCommand(key, ttl), TTL: ttl, Type: typ, Commands: true}
+		select {
+		case <-ctx.Done():
+			fmt.Println("generate: done")
+			return ctx.Err()
+		case g.Bus <- p:
+			g.Summary.Incr("generated")
+			g.Summary.Incr("generated-" + typ)
+			g.Summary.Add("generated-bytes", int64(size))
+		}
+	}
+
+	return nil
+}
+
+// recreate returns the commands recreating key, of typ, with random values,
+// and the bytes of its values.
+func (g *Generator) recreate(key, typ string) (string, int) {
+	value := func() string {
+		b := make([]byte, drawSize(g.Rand, g.Sizes))
+		g.Rand.Read(b)
+		return string(b)
+	}
+	if typ == "string" {
+		v := value()
+		return resp.Recreate("SET", key, []string{v}, 1, batchSize), len(v)
+	}
+
+	var elems []string
+	size := 0
+	for i := 0; i < g.Elements; i++ {
+		// Members are unique by their index
+		v := strconv.Itoa(i) + ":" + value()
+		size += len(v)
+		switch typ {
+		case "hash":
+			elems = append(elems, "f"+strconv.Itoa(i), v)
+		case "zset":
+			elems = append(elems, strconv.Itoa(i), v)
+		default:
+			elems = append(elems, v)
+		}
+	}
+
+	switch typ {
+	case "hash":
+		return resp.Recreate("HSET", key, elems, 2, batchSize), size
+	case "zset":
+		return resp.Recreate("ZADD", key, elems, 2, batchSize), size
+	case "set":
+		return resp.Recreate("SADD", key, elems, 1, batchSize), size
+	}
+
+	return resp.Recreate("RPUSH", key, elems, 1, batchSize), size
+}
@@ -0,0 +1,32 @@
+package redis
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// hashtag returns key with the first capture group of the Hashtag template
+// wrapped in braces, e.g. {tenant}:user:1 for ^([^:]+): and tenant:user:1,
+// so that Redis Cluster slots the keys of a group together. Keys the
+// template doesn't match are returned as is. Keys it can't give a single
+// balanced hashtag, an empty group or braces of their own, fail.
+func (r *Redis) hashtag(key string) (string, error) {
+	loc := r.Hashtag.FindStringSubmatchIndex(key)
+	if loc == nil {
+		r.Summary.Incr("hashtag-unmatched")
+		return key, nil
+	}
+
+	start, end := loc[2], loc[3]
+	switch {
+	case start < 0 || start == end:
+		return key, fmt.Errorf("error tagging key %s: empty hashtag, ignored by Redis Cluster", message.FormatKey(key))
+	case strings.ContainsAny(key, "{}"):
+		return key, fmt.Errorf("error tagging key %s: it has braces, it would have several hashtags", message.FormatKey(key))
+	}
+	r.Summary.Incr("hashtagged")
+
+	return key[:start] + "{" + key[start:end] + "}" + key[end:], nil
+}
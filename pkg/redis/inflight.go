@@ -0,0 +1,63 @@
+package redis
+
+import (
+	"context"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// inFlight reads keys with readKey, up to MaxInFlight at once: a slot is
+// taken before DUMP, and given back once the Payload is pushed to the Bus,
+// or skipped. Payloads are then pushed in no particular order.
+type inFlight struct {
+	r      *Redis
+	parent context.Context
+	ctx    context.Context
+	g      *errgroup.Group
+	sem    chan struct{}
+}
+
+// newInFlight returns the inFlight reads of r, serial unless MaxInFlight is
+// above 1.
+func (r *Redis) newInFlight(ctx context.Context) *inFlight {
+	f := &inFlight{r: r, parent: ctx, ctx: ctx}
+	if r.MaxInFlight > 1 {
+		f.g, f.ctx = errgroup.WithContext(ctx)
+		f.sem = make(chan struct{}, r.MaxInFlight)
+	}
+
+	return f
+}
+
+// read reads key once a slot is free, returning the error of a failed read,
+// or of the context, while waiting.
+func (f *inFlight) read(key string) error {
+	if f.g == nil {
+		return f.r.readKey(f.ctx, key)
+	}
+
+	select {
+	case f.sem <- struct{}{}:
+	case <-f.ctx.Done():
+		if err := f.wait(); err != nil {
+			return err
+		}
+		return f.parent.Err()
+	}
+
+	f.g.Go(func() error {
+		defer func() { <-f.sem }()
+		return f.r.readKey(f.ctx, key)
+	})
+
+	return nil
+}
+
+// wait waits for the reads left, returning the first error.
+func (f *inFlight) wait() error {
+	if f.g == nil {
+		return nil
+	}
+
+	return f.g.Wait()
+}
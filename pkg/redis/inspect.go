@@ -0,0 +1,250 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/mediocregopher/radix/v3"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// KeyInfo describes a key, without its value.
+// Size is the DUMP payload size, TTL is in milliseconds, -1 when persistent.
+type KeyInfo struct {
+	Key      string `json:"key"`
+	Type     string `json:"type"`
+	Size     int    `json:"size"`
+	TTL      int64  `json:"ttl"`
+	Encoding string `json:"encoding"`
+}
+
+// Inspect gets a key metadata using TYPE, DUMP, PTTL and OBJECT ENCODING.
+// Type is "none" when the key doesn't exist.
+func (r *Redis) Inspect(key string) (KeyInfo, error) {
+	info := KeyInfo{Key: key}
+
+	err := r.Pool.Do(radix.Cmd(&info.Type, r.cmd("TYPE"), key))
+	if err != nil {
+		return info, fmt.Errorf("error calling TYPE for key %s: %w", message.FormatKey(key), err)
+	}
+	if info.Type == "none" {
+		return info, nil
+	}
+
+	var value string
+	err = r.Pool.Do(radix.Cmd(&value, r.cmd("DUMP"), key))
+	if err != nil {
+		return info, fmt.Errorf("error reading key %s from redis: %w", message.FormatKey(key), err)
+	}
+	info.Size = len(value)
+
+	err = r.Pool.Do(radix.Cmd(&info.TTL, r.cmd("PTTL"), key))
+	if err != nil {
+		return info, fmt.Errorf("error calling PTTL for key %s: %w", message.FormatKey(key), err)
+	}
+
+	err = r.Pool.Do(radix.Cmd(&info.Encoding, r.cmd("OBJECT"), "ENCODING", key))
+	if err != nil {
+		return info, fmt.Errorf("error calling OBJECT ENCODING for key %s: %w", message.FormatKey(key), err)
+	}
+
+	return info, nil
+}
+
+// Get reads a key DUMP payload and TTL as a Payload, without SCAN,
+// false when the key doesn't exist.
+func (r *Redis) Get(key string) (message.Payload, bool, error) {
+	value, ttl, err := r.dumpTTL(key)
+	// Missing keys DUMP nil, PTTL -2, or expired since DUMPed
+	if err == errVanished || err == errExpired || (err == nil && ttl == "-2") {
+		return message.Payload{}, false, nil
+	}
+	if err != nil {
+		return message.Payload{}, false, fmt.Errorf("error reading key %s from redis: %w", message.FormatKey(key), err)
+	}
+
+	return message.Payload{Key: key, Value: value, TTL: ttl}, true, nil
+}
+
+// Sample scans until n keys pass the Filter, and inspects them.
+// Keys deleted while sampling are left out.
+func (r *Redis) Sample(ctx context.Context, n int) ([]KeyInfo, error) {
+	scanner := radix.NewScanner(r.Pool, r.scanOpts())
+	infos := []KeyInfo{}
+
+	var key string
+	for len(infos) < n && scanner.Next(&key) {
+		if ctx.Err() != nil {
+			scanner.Close()
+			return infos, ctx.Err()
+		}
+
+		if !r.Filter.Keep(key) {
+			continue
+		}
+
+		info, err := r.Inspect(key)
+		if err != nil {
+			scanner.Close()
+			return infos, err
+		}
+		if info.Type == "none" {
+			continue
+		}
+
+		infos = append(infos, info)
+	}
+
+	return infos, scanner.Close()
+}
+
+// ListKeys writes the names of the keys passing the Filter to w, one per
+// line, without reading their values, returning the count of keys listed.
+// With types, only keys of these types are listed, a TYPE round trip each.
+// Listing stops after max keys, unless 0. Keys SCAN lists twice are listed
+// twice.
+func (r *Redis) ListKeys(ctx context.Context, w io.Writer, types []string, max int) (int, error) {
+	scanner := radix.NewScanner(r.Pool, r.scanOpts())
+	out := bufio.NewWriter(w)
+	wanted := map[string]bool{}
+	for _, t := range types {
+		wanted[t] = true
+	}
+
+	var n int
+	var key string
+	for (max == 0 || n < max) && scanner.Next(&key) {
+		if ctx.Err() != nil {
+			scanner.Close()
+			return n, ctx.Err()
+		}
+		if !r.Filter.Keep(key) {
+			continue
+		}
+
+		if len(types) > 0 {
+			keyType, err := r.keyType(key)
+			if err != nil {
+				scanner.Close()
+				return n, err
+			}
+			if !wanted[keyType] {
+				continue
+			}
+		}
+
+		if _, err := fmt.Fprintln(out, key); err != nil {
+			scanner.Close()
+			return n, fmt.Errorf("error writing keys: %w", err)
+		}
+		n++
+	}
+
+	if err := scanner.Close(); err != nil {
+		return n, err
+	}
+	if err := out.Flush(); err != nil {
+		return n, fmt.Errorf("error writing keys: %w", err)
+	}
+
+	return n, nil
+}
+
+// Estimate is the expected size of a transfer.
+// Bytes is the sum of MEMORY USAGE, memory held by keys on the source,
+// usually close to the memory needed on the target.
+// Types is the keys count by TYPE, nil unless counted.
+type Estimate struct {
+	Keys  int64
+	Bytes int64
+	Types map[string]int64
+}
+
+// Estimate scans the keys passing the Filter and MaxIdle, summing their
+// MEMORY USAGE when sizes, counting their TYPE when types, in the same scan.
+// It's an extra full scan, to be run before Read.
+func (r *Redis) Estimate(ctx context.Context, sizes, types bool) (Estimate, error) {
+	scanner := radix.NewScanner(r.Pool, r.scanOpts())
+	est := Estimate{}
+	if types {
+		est.Types = map[string]int64{}
+	}
+
+	var key string
+	for scanner.Next(&key) {
+		if ctx.Err() != nil {
+			scanner.Close()
+			return est, ctx.Err()
+		}
+
+		if !r.Filter.Keep(key) || r.isIdle(key) {
+			continue
+		}
+
+		// Nil, thus 0, for keys deleted since SCAN.
+		var bytes int64
+		if sizes {
+			err := r.Pool.Do(radix.Cmd(&bytes, r.cmd("MEMORY"), "USAGE", key))
+			if err != nil {
+				scanner.Close()
+				return est, fmt.Errorf("error calling MEMORY USAGE for key %s, requires Redis 4: %w", message.FormatKey(key), err)
+			}
+			if bytes == 0 {
+				continue
+			}
+		}
+
+		// "none" for keys deleted since SCAN.
+		var typ string
+		if types {
+			err := r.Pool.Do(radix.Cmd(&typ, r.cmd("TYPE"), key))
+			if err != nil {
+				scanner.Close()
+				return est, fmt.Errorf("error calling TYPE for key %s: %w", message.FormatKey(key), err)
+			}
+			if typ == "none" {
+				continue
+			}
+		}
+
+		est.Keys++
+		est.Bytes += bytes
+		if types {
+			est.Types[typ]++
+		}
+	}
+
+	return est, scanner.Close()
+}
+
+// DBSize returns the keys count of the database, regardless of the Filter.
+func (r *Redis) DBSize() (int64, error) {
+	var size int64
+	err := r.Pool.Do(radix.Cmd(&size, r.cmd("DBSIZE")))
+	if err != nil {
+		return 0, fmt.Errorf("error calling DBSIZE: %w", err)
+	}
+
+	return size, nil
+}
+
+// Ping checks the connection, with PING.
+func (r *Redis) Ping() error {
+	if err := r.Pool.Do(radix.Cmd(nil, r.cmd("PING"))); err != nil {
+		return fmt.Errorf("error calling PING: %w", err)
+	}
+
+	return nil
+}
+
+// Flush deletes all keys of the database, with FLUSHDB.
+func (r *Redis) Flush() error {
+	if err := r.Pool.Do(radix.Cmd(nil, r.cmd("FLUSHDB"))); err != nil {
+		return fmt.Errorf("error calling FLUSHDB: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package redis
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Jitter adds a random offset, up to Max, to the TTLs of restored keys, so
+// that keys sharing a TTL don't all expire at once.
+// It's safe for concurrent use, shared by writers, and a noop when nil.
+type Jitter struct {
+	Max time.Duration
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewJitter creates a Jitter, its offsets are reproducible for a seed.
+func NewJitter(max time.Duration, seed int64) *Jitter {
+	return &Jitter{Max: max, rand: rand.New(rand.NewSource(seed))}
+}
+
+// Add returns ttl, in ms, plus an offset between 0 and Max.
+// Persistent keys, with a 0 ttl, are left persistent.
+func (j *Jitter) Add(ttl int64) int64 {
+	if j == nil || ttl <= 0 || j.Max < time.Millisecond {
+		return ttl
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return ttl + j.rand.Int63n(int64(j.Max/time.Millisecond)+1)
+}
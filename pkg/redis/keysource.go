@@ -0,0 +1,31 @@
+package redis
+
+import (
+	"context"
+
+	"github.com/mediocregopher/radix/v3"
+)
+
+// KeySource enumerates the keys Read DUMPs, in place of SCAN, e.g. listed
+// in a database table by an embedding program. Keys go through the Filter,
+// client-side, then are read as SCANned keys are.
+type KeySource interface {
+	// Next returns the next key, false once there are none left, or on
+	// errors, which abort the read.
+	Next(ctx context.Context) (key string, ok bool, err error)
+}
+
+// scanSource is the SCAN KeySource, the default one.
+type scanSource struct {
+	scanner radix.Scanner
+}
+
+// Next returns the next SCANned key, and the SCAN error once done.
+func (s *scanSource) Next(ctx context.Context) (string, bool, error) {
+	var key string
+	if s.scanner.Next(&key) {
+		return key, true, nil
+	}
+
+	return "", false, s.scanner.Close()
+}
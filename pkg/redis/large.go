@@ -0,0 +1,41 @@
+package redis
+
+import (
+	"fmt"
+
+	"github.com/mediocregopher/radix/v3"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// warnLarge warns of keys read with values of LargeSize bytes or more, with
+// their type, read with TYPE unless known, and their OBJECT ENCODING with
+// LargeEncoding, counted as large-keys. Keys are still transferred.
+func (r *Redis) warnLarge(key, keyType string, size int) error {
+	if r.LargeSize == 0 || size < r.LargeSize {
+		return nil
+	}
+	r.Summary.Incr("large-keys")
+
+	if keyType == "" {
+		var err error
+		keyType, err = r.keyType(key)
+		if err != nil {
+			return err
+		}
+	}
+
+	encoding := ""
+	if r.LargeEncoding {
+		var enc string
+		err := r.Pool.Do(radix.Cmd(&enc, r.cmd("OBJECT"), "ENCODING", key))
+		if err != nil {
+			return fmt.Errorf("error calling OBJECT ENCODING for key %s: %w", message.FormatKey(key), err)
+		}
+		encoding = " encoding=" + enc
+	}
+
+	fmt.Printf("redis: large key %s, size=%d type=%s%s\n", message.FormatKey(key), size, keyType, encoding)
+
+	return nil
+}
@@ -0,0 +1,299 @@
+package redis
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mediocregopher/radix/v3"
+
+	"github.com/stickermule/rump/pkg/message"
+	"github.com/stickermule/rump/pkg/resp"
+)
+
+// batchSize caps the elements sent in a single logical command,
+// so that large collections don't become a single huge command.
+const batchSize = 1000
+
+// keyType returns the key TYPE, "none" when it doesn't exist.
+func (r *Redis) keyType(key string) (string, error) {
+	var keyType string
+	err := r.Pool.Do(radix.Cmd(&keyType, r.cmd("TYPE"), key))
+	if err != nil {
+		return "", fmt.Errorf("error calling TYPE for key %s: %w", message.FormatKey(key), err)
+	}
+
+	return keyType, nil
+}
+
+// logical reads a key of keyType as the RESP encoded commands recreating it,
+// in place of DUMP. Collections are deleted first, so that replays are
+// idempotent.
+// String values are rewritten by Replace, when set.
+// Returns an empty string when the key doesn't exist anymore.
+func (r *Redis) logical(key, keyType string) (string, error) {
+	var cmd string
+	var step int
+
+	switch keyType {
+	case "none":
+		return "", nil
+	case "string":
+		cmd, step = "SET", 1
+	case "hash":
+		cmd, step = "HSET", 2
+	case "list":
+		cmd, step = "RPUSH", 1
+	case "set":
+		cmd, step = "SADD", 1
+	case "zset":
+		cmd, step = "ZADD", 2
+	case "stream":
+		return r.logicalStream(key)
+	default:
+		return "", fmt.Errorf("unsupported type '%s' for key %s in commands format", keyType, message.FormatKey(key))
+	}
+	elems, err := r.elements(key, keyType)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case keyType == "string" && r.Replace != nil:
+		if elems[0], err = r.replace(key, elems[0]); err != nil {
+			return "", fmt.Errorf("error reading string key %s: %w", message.FormatKey(key), err)
+		}
+	// ZADD takes score then member
+	case keyType == "zset":
+		for i := 0; i+1 < len(elems); i += 2 {
+			elems[i], elems[i+1] = elems[i+1], elems[i]
+		}
+	}
+
+	return resp.Recreate(cmd, key, elems, step, batchSize), nil
+}
+
+// elements reads the elements of a key of keyType: the string value, with
+// GETEX when Refresh is set, hash fields and values, list elements in order,
+// set members, or sorted set members and scores, by score.
+func (r *Redis) elements(key, keyType string) ([]string, error) {
+	var elems []string
+	var err error
+
+	switch keyType {
+	case "string":
+		var value string
+		if r.Refresh > 0 {
+			px := strconv.FormatInt(int64(r.Refresh/time.Millisecond), 10)
+			err = r.Pool.Do(radix.Cmd(&value, r.cmd("GETEX"), key, "PX", px))
+			if err == nil && value != "" {
+				r.Summary.Incr("refreshed")
+			}
+		} else {
+			err = r.Pool.Do(radix.Cmd(&value, r.cmd("GET"), key))
+		}
+		elems = []string{value}
+	case "hash":
+		err = r.Pool.Do(radix.Cmd(&elems, r.cmd("HGETALL"), key))
+	case "list":
+		err = r.Pool.Do(radix.Cmd(&elems, r.cmd("LRANGE"), key, "0", "-1"))
+	case "set":
+		err = r.Pool.Do(radix.Cmd(&elems, r.cmd("SMEMBERS"), key))
+	case "zset":
+		err = r.Pool.Do(radix.Cmd(&elems, r.cmd("ZRANGE"), key, "0", "-1", "WITHSCORES"))
+	default:
+		return nil, fmt.Errorf("unsupported type '%s' for key %s", keyType, message.FormatKey(key))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s key %s: %w", keyType, message.FormatKey(key), err)
+	}
+
+	return elems, nil
+}
+
+// replace applies Replace to a string value, counting changed values.
+// With ReplaceEncoding, changed values are checked with replaceEncoding.
+func (r *Redis) replace(key, value string) (string, error) {
+	replaced := r.Replace.Replace(value)
+	if replaced == value {
+		return value, nil
+	}
+	r.Summary.Incr("replaced")
+
+	if r.ReplaceEncoding {
+		if err := r.replaceEncoding(key, replaced); err != nil {
+			return "", err
+		}
+	}
+
+	return replaced, nil
+}
+
+// sharedRefcount is the OBJECT REFCOUNT of shared objects, e.g. the
+// integers up to 9999 Redis shares between keys.
+const sharedRefcount = 2147483647
+
+// replaceEncoding reads the OBJECT ENCODING and REFCOUNT of key, an int
+// encoded string replaced by replaced, warning when replaced won't be int
+// encoded anymore. SET int encodes canonical integers, e.g. 42 but not 042
+// or +42, values still integers keep their encoding, counted as
+// int-preserved, others take their length in memory, counted as
+// int-decoded. Shared integers are counted as shared-ints too, they're
+// restored as a value of their own, unless shared on the target too.
+func (r *Redis) replaceEncoding(key, replaced string) error {
+	var encoding string
+	var refcount int64
+	enc, ref := &reply{rcv: &encoding}, &reply{rcv: &refcount}
+	err := r.Pool.Do(radix.Pipeline(
+		radix.Cmd(enc, r.cmd("OBJECT"), "ENCODING", key),
+		radix.Cmd(ref, r.cmd("OBJECT"), "REFCOUNT", key),
+	))
+	for _, e := range []error{enc.err, ref.err} {
+		if err == nil {
+			err = e
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error calling OBJECT for key %s: %w", message.FormatKey(key), err)
+	}
+	if encoding != "int" {
+		return nil
+	}
+
+	if refcount == sharedRefcount {
+		r.Summary.Incr("shared-ints")
+	}
+	if n, err := strconv.ParseInt(replaced, 10, 64); err == nil && strconv.FormatInt(n, 10) == replaced {
+		r.Summary.Incr("int-preserved")
+		return nil
+	}
+
+	r.Summary.Incr("int-decoded")
+	r.logError("redis: replace turns int encoded key %s into a %d bytes string, losing its integer encoding\n", message.FormatKey(key), len(replaced))
+
+	return nil
+}
+
+// logicalStream reads a stream key as XADD commands, one per entry,
+// preserving entry IDs and fields order.
+func (r *Redis) logicalStream(key string) (string, error) {
+	var entries [][]interface{}
+	err := r.Pool.Do(radix.Cmd(&entries, r.cmd("XRANGE"), key, "-", "+"))
+	if err != nil {
+		return "", fmt.Errorf("error reading stream key %s: %w", message.FormatKey(key), err)
+	}
+
+	cmds := resp.Encode("DEL", key)
+	for _, e := range entries {
+		if len(e) != 2 {
+			return "", fmt.Errorf("unexpected stream entry for key %s", message.FormatKey(key))
+		}
+		id, _ := e[0].([]byte)
+		fields, _ := e[1].([]interface{})
+
+		args := []string{"XADD", key, string(id)}
+		for _, f := range fields {
+			b, _ := f.([]byte)
+			args = append(args, string(b))
+		}
+		cmds += resp.Encode(args...)
+	}
+
+	if !r.StreamGroups {
+		return cmds, nil
+	}
+	groups, err := r.streamGroups(key, len(entries) > 0)
+	if err != nil {
+		return "", err
+	}
+
+	return cmds + groups, nil
+}
+
+// streamGroups reads the consumer groups of a stream key as the commands
+// recreating them, with their last delivered ID and consumers, and setting
+// the stream last ID, so that consumers resume where they were. Pending
+// entries aren't recreated. Empty streams are only recreated by groups.
+func (r *Redis) streamGroups(key string, entries bool) (string, error) {
+	var info []interface{}
+	if err := r.Pool.Do(radix.Cmd(&info, r.cmd("XINFO"), "STREAM", key)); err != nil {
+		return "", fmt.Errorf("error calling XINFO STREAM for key %s: %w", message.FormatKey(key), err)
+	}
+	var lastID string
+	for i := 0; i+1 < len(info); i += 2 {
+		if name, _ := info[i].([]byte); string(name) == "last-generated-id" {
+			id, _ := info[i+1].([]byte)
+			lastID = string(id)
+		}
+	}
+
+	var groups []map[string]string
+	if err := r.Pool.Do(radix.Cmd(&groups, r.cmd("XINFO"), "GROUPS", key)); err != nil {
+		return "", fmt.Errorf("error calling XINFO GROUPS for key %s: %w", message.FormatKey(key), err)
+	}
+
+	var cmds string
+	for _, g := range groups {
+		cmds += resp.Encode("XGROUP", "CREATE", key, g["name"], g["last-delivered-id"], "MKSTREAM")
+
+		var consumers []map[string]string
+		if err := r.Pool.Do(radix.Cmd(&consumers, r.cmd("XINFO"), "CONSUMERS", key, g["name"])); err != nil {
+			return "", fmt.Errorf("error calling XINFO CONSUMERS for key %s: %w", message.FormatKey(key), err)
+		}
+		for _, c := range consumers {
+			cmds += resp.Encode("XGROUP", "CREATECONSUMER", key, g["name"], c["name"])
+		}
+		r.Summary.Incr("stream-groups")
+	}
+	if lastID != "" && (entries || len(groups) > 0) {
+		cmds += resp.Encode("XSETID", key, lastID)
+	}
+
+	return cmds, nil
+}
+
+// expireCommand is the RESP encoded PEXPIRE restoring a logical key TTL,
+// empty for persistent keys.
+func expireCommand(key, ttl string) string {
+	if ttl == "0" || ttl == "" {
+		return ""
+	}
+
+	return resp.Encode("PEXPIRE", key, ttl)
+}
+
+// replay runs the RESP encoded commands of a Payload, in place of RESTORE.
+func (r *Redis) replay(p message.Payload) error {
+	cmds := resp.NewReader(strings.NewReader(p.Value))
+
+	for {
+		args, err := cmds.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error parsing commands for key %s: %w", message.FormatKey(p.Key), err)
+		}
+
+		err = r.Pool.Do(radix.Cmd(nil, r.cmd(args[0]), args[1:]...))
+		if cerr := clusterError(p.Key, err); cerr != nil {
+			return cerr
+		}
+		switch {
+		case err != nil && r.ContinueOnError:
+			r.logError("redis: error replaying %s %s, continuing; error=%s\n", args[0], message.FormatKey(p.Key), err)
+			if err := r.failed(p.Key, err); err != nil {
+				return err
+			}
+			continue
+		case err != nil:
+			return fmt.Errorf("error replaying %s for key %s: %w", args[0], message.FormatKey(p.Key), err)
+		}
+
+		r.succeeded()
+		r.Summary.Incr("replayed")
+		r.logKey("redis: %s %s\n", args[0], message.FormatKey(p.Key))
+	}
+}
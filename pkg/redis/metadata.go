@@ -0,0 +1,75 @@
+package redis
+
+import (
+	"strconv"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// Metadata policies, for the LRU/LFU metadata of Payloads that RESTORE would
+// refuse: a negative or non integer IDLETIME, a FREQ outside of 0-255.
+const (
+	// MetadataClamp restores out of range values at the closest bound, and
+	// without the non integer ones.
+	MetadataClamp = "clamp"
+	// MetadataDrop restores without invalid values.
+	MetadataDrop = "drop"
+	// MetadataFail sends them as is, the RESTORE failing.
+	MetadataFail = "fail"
+)
+
+// MetadataPolicies lists the Metadata policy names.
+var MetadataPolicies = map[string]bool{
+	MetadataClamp: true,
+	MetadataDrop:  true,
+	MetadataFail:  true,
+}
+
+// maxFreq is the highest LFU counter, the FREQ bound of RESTORE.
+const maxFreq = 255
+
+// metadata returns the RESTORE arguments of the LRU/LFU metadata of p,
+// IDLETIME or FREQ, RESTORE taking one of them, as keys only have the one of
+// the policy. Invalid values are clamped or dropped, logged and counted as
+// metadata-clamped or metadata-dropped, unless the Metadata policy is unset
+// or MetadataFail.
+func (r *Redis) metadata(p message.Payload) []string {
+	name, value, max := "IDLETIME", p.Idle, int64(-1)
+	switch {
+	case p.Idle != "":
+	case p.Freq != "":
+		name, value, max = "FREQ", p.Freq, maxFreq
+	default:
+		return nil
+	}
+	if r.Metadata == "" || r.Metadata == MetadataFail {
+		return []string{name, value}
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	switch {
+	case err != nil:
+		r.dropMetadata(p.Key, name, value, "not an integer")
+		return nil
+	case n >= 0 && (max < 0 || n <= max):
+		return []string{name, value}
+	case r.Metadata == MetadataDrop:
+		r.dropMetadata(p.Key, name, value, "out of range")
+		return nil
+	}
+
+	clamped := int64(0)
+	if n > 0 {
+		clamped = max
+	}
+	r.Summary.Incr("metadata-clamped")
+	r.logError("redis: clamping %s %s of key %s to %d, out of range\n", name, value, message.FormatKey(p.Key), clamped)
+
+	return []string{name, strconv.FormatInt(clamped, 10)}
+}
+
+// dropMetadata logs and counts the metadata of key restored without.
+func (r *Redis) dropMetadata(key, name, value, reason string) {
+	r.Summary.Incr("metadata-dropped")
+	r.logError("redis: restoring key %s without its %s %s, %s\n", message.FormatKey(key), name, value, reason)
+}
@@ -0,0 +1,87 @@
+package redis
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/mediocregopher/radix/v3"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// ModuleTypes maps the TYPE of module keys to the name of their module, in
+// MODULE LIST, for the known modules. Keys of these types only RESTORE on
+// servers loading their module.
+var ModuleTypes = map[string]string{
+	"ReJSON-RL": "ReJSON",
+	"MBbloom--": "bf",
+	"MBbloomCF": "bf",
+	"TopK-TYPE": "bf",
+	"CMSk-TYPE": "bf",
+	"TDIS-TYPE": "bf",
+	"TSDB-TYPE": "timeseries",
+	"graphdata": "graph",
+}
+
+// Modules returns the names of the modules loaded, with MODULE LIST, sorted.
+func (r *Redis) Modules() ([]string, error) {
+	var list []map[string]string
+	if err := r.Pool.Do(radix.Cmd(&list, r.cmd("MODULE"), "LIST")); err != nil {
+		return nil, fmt.Errorf("error calling MODULE LIST: %w", err)
+	}
+
+	var names []string
+	for _, m := range list {
+		names = append(names, m["name"])
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// MissingModules returns the names of the source modules the target lacks.
+func MissingModules(source, target []string) []string {
+	loaded := map[string]bool{}
+	for _, name := range target {
+		loaded[name] = true
+	}
+
+	var missing []string
+	for _, name := range source {
+		if !loaded[name] {
+			missing = append(missing, name)
+		}
+	}
+
+	return missing
+}
+
+// skipType reports whether a key of keyType belongs to one of the
+// SkipModules, counting and logging it as skipped-module, or is one of the
+// SkipTypes, counted as skipped-type. Both are listed to Skipped and, as
+// unsupported-type, to SkipFiles when set.
+func (r *Redis) skipType(key, keyType string) bool {
+	reason := ""
+	if module, ok := ModuleTypes[keyType]; ok && r.SkipModules[module] {
+		r.Summary.Incr("skipped-module")
+		reason = fmt.Sprintf("type %s, module %s missing on the target", keyType, module)
+	} else if r.SkipTypes[keyType] {
+		r.Summary.Incr("skipped-type")
+		reason = fmt.Sprintf("type %s, in skip-types", keyType)
+	} else {
+		return false
+	}
+	r.logError("redis: skipping key %s of %s\n", message.FormatKey(key), reason)
+	if r.Skipped != nil {
+		if err := r.Skipped.Add(key, errors.New("skipped, "+reason)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	if err := r.SkipFiles.Add(SkipUnsupportedType, key, errors.New("skipped, "+reason)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	return true
+}
@@ -0,0 +1,86 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mediocregopher/radix/v3"
+
+	"github.com/stickermule/rump/pkg/message"
+	"github.com/stickermule/rump/pkg/ratelimit"
+)
+
+// moveScript deletes KEYS[1] with ARGV[3], UNLINK, only while ARGV[2], DUMP,
+// of it is still ARGV[1], the payload restored: 1 once deleted, 0 when
+// already gone, -1 when changed since read, kept.
+const moveScript = `local v = redis.call(ARGV[2], KEYS[1])
+if not v then return 0 end
+if v ~= ARGV[1] then return -1 end
+redis.call(ARGV[3], KEYS[1])
+return 1`
+
+// Mover deletes the keys restored from the Source, moving rather than
+// copying them: only once their RESTORE replied OK, verified when Verify is
+// set, and only while the source key still holds the payload read, checked
+// and deleted at once by a script. Limiter paces the keys moved, it can be
+// shared by several writers.
+type Mover struct {
+	Source  *Redis
+	Limiter *ratelimit.Limiter
+}
+
+// NewMover creates a Mover deleting restored keys from source, at most rate
+// keys/sec, unlimited when 0.
+func NewMover(source *Redis, rate float64) *Mover {
+	return &Mover{Source: source, Limiter: ratelimit.New(rate)}
+}
+
+// wait blocks until the next key may be moved, or ctx is done, a noop on a
+// nil Mover.
+func (m *Mover) wait(ctx context.Context) error {
+	if m == nil {
+		return nil
+	}
+
+	return m.Limiter.Wait(ctx)
+}
+
+// move deletes the source key of the restored pd, under its original name
+// when renamed, unless its verify mismatched, verified false, or it changed
+// on the source since read, in which case it's left there, copied.
+func (r *Redis) move(pd *pending, verified bool) error {
+	if r.Move == nil {
+		return nil
+	}
+
+	key := sourceKey(pd.key, pd.original)
+	if !verified {
+		r.Summary.Incr("move-unverified")
+		r.logError("redis: keeping source key %s, its verify mismatched, copied\n", message.FormatKey(key))
+		return nil
+	}
+	s := r.Move.Source
+	var moved int64
+	err := s.Pool.Do(radix.Cmd(&moved, s.cmd("EVAL"), moveScript, "1", key, pd.read, s.cmd("DUMP"), s.cmd("UNLINK")))
+	switch {
+	case err != nil && r.ContinueOnError:
+		r.Summary.Incr("move-failed")
+		r.logError("redis: error moving key %s, left on the source, continuing; error=%s\n", message.FormatKey(key), err)
+		return nil
+	case err != nil:
+		return fmt.Errorf("error moving key %s, left on the source: %w", message.FormatKey(key), err)
+	}
+
+	switch moved {
+	case 1:
+		r.Summary.Incr("moved")
+		r.logKey("redis: UNLINK %s, moved\n", message.FormatKey(key))
+	case 0:
+		r.Summary.Incr("move-missing")
+	default:
+		r.Summary.Incr("move-changed")
+		r.logError("redis: keeping source key %s, changed since read, copied\n", message.FormatKey(key))
+	}
+
+	return nil
+}
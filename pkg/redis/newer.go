@@ -0,0 +1,114 @@
+package redis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mediocregopher/radix/v3"
+
+	"github.com/stickermule/rump/pkg/message"
+	"github.com/stickermule/rump/pkg/rdb"
+)
+
+// Newer resolves a string key existing on both sides from their values,
+// reporting whether the source value is newer than the target one, e.g. by
+// a timestamp embedded in them. Other types aren't compared, the source
+// winning.
+type Newer func(source, target string) bool
+
+// NewerField compares the top level field of JSON values, as numbers, RFC
+// 3339 times, or else strings, e.g. updated_at. Values without it, or not
+// JSON, are older than the ones with it, the source winning when both lack
+// it, or their fields have different types.
+func NewerField(field string) Newer {
+	return func(source, target string) bool {
+		s, sok := jsonField(source, field)
+		t, tok := jsonField(target, field)
+		switch {
+		case !sok || !tok:
+			return sok || !tok
+		case s.number && t.number:
+			return s.float > t.float
+		case s.time && t.time:
+			return s.at.After(t.at)
+		case s.str && t.str:
+			return s.text > t.text
+		}
+
+		return true
+	}
+}
+
+// fieldValue is a decoded JSON field, a number, a time, or a string.
+type fieldValue struct {
+	number bool
+	float  float64
+	time   bool
+	at     time.Time
+	str    bool
+	text   string
+}
+
+// jsonField decodes the top level field of the JSON object value.
+func jsonField(value, field string) (fieldValue, bool) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return fieldValue{}, false
+	}
+	raw, ok := fields[field]
+	if !ok {
+		return fieldValue{}, false
+	}
+
+	var v fieldValue
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var decoded interface{}
+	if err := dec.Decode(&decoded); err != nil {
+		return fieldValue{}, false
+	}
+	switch d := decoded.(type) {
+	case json.Number:
+		f, err := d.Float64()
+		v.number, v.float = err == nil, f
+	case string:
+		at, err := time.Parse(time.RFC3339Nano, d)
+		v.time, v.at = err == nil, at
+		v.str, v.text = true, d
+	default:
+		return fieldValue{}, false
+	}
+
+	return v, v.number || v.str
+}
+
+// newer reports whether the string DUMP payload value should replace the
+// target key, depending on Newer, reading the target value with GET.
+// Missing target keys, other types on either side and values not decoded
+// from the payload always lose to the source.
+func (r *Redis) newer(key, value string) (bool, error) {
+	if r.Newer == nil {
+		return true, nil
+	}
+	source, ok := rdb.DumpString([]byte(value))
+	if !ok {
+		return true, nil
+	}
+
+	var target []byte
+	mn := radix.MaybeNil{Rcv: &target}
+	err := r.Pool.Do(radix.Cmd(&mn, r.cmd("GET"), key))
+	switch {
+	case hasCode(err, "WRONGTYPE"):
+		return true, nil
+	case err != nil:
+		return false, fmt.Errorf("error calling GET for target key %s: %w", message.FormatKey(key), err)
+	case mn.Nil:
+		return true, nil
+	}
+	r.Summary.Incr("newer-compared")
+
+	return r.Newer(source, string(target)), nil
+}
@@ -0,0 +1,76 @@
+package redis
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// OOM policies, for RESTOREs refused with OOM errors once the target used
+// memory is above its maxmemory.
+const (
+	// OOMAbort aborts the run, even with ContinueOnError or DeadLetter.
+	OOMAbort = "abort"
+	// OOMRetry waits OOMBackoff, doubling up to maxOOMBackoff, for eviction
+	// to free memory, then aborts after OOMRetries attempts.
+	OOMRetry = "retry"
+	// OOMSkip skips the key, carrying on with the next ones.
+	OOMSkip = "skip"
+)
+
+// OOMPolicies lists the OOM policy names.
+var OOMPolicies = map[string]bool{
+	OOMAbort: true,
+	OOMRetry: true,
+	OOMSkip:  true,
+}
+
+// maxOOMBackoff caps the wait between OOM retries.
+const maxOOMBackoff = time.Minute
+
+// ErrOOM is the error of runs aborted by the OOM policy.
+var ErrOOM = errors.New("destination out of memory")
+
+// errOOMSkipped is the error of keys skipped by OOMSkip.
+var errOOMSkipped = errors.New("skipped, target out of memory")
+
+// isOOM reports whether err is an OOM reply, handled by the OOM policy.
+func (r *Redis) isOOM(err error) bool {
+	return r.OOM != "" && hasCode(err, "OOM")
+}
+
+// oom applies the OOM policy to the RESTORE of pd, refused with err. It returns nil once restored by a retry, errOOMSkipped for skipped
+// keys, other errors of the retries, and ErrOOM aborting the run otherwise.
+func (r *Redis) oom(pd *pending, err error) error {
+	key := pd.key
+	r.Summary.Incr("oom")
+	if r.Summary.Get("oom") == 1 {
+		r.Summary.Note(fmt.Sprintf("oom: target out of memory at key %s after %d keys restored, policy %s",
+			message.FormatKey(key), r.Summary.Get("restored"), r.OOM))
+	}
+
+	switch r.OOM {
+	case OOMSkip:
+		r.Summary.Incr("oom-skipped")
+		r.logError("redis: skipping key %s, target out of memory; error=%s\n", message.FormatKey(key), err)
+		return errOOMSkipped
+	case OOMRetry:
+		backoff := r.OOMBackoff
+		for attempt := 1; attempt <= r.OOMRetries && r.isOOM(err); attempt++ {
+			r.logError("redis: target out of memory restoring key %s, retry %d/%d in %s; error=%s\n", message.FormatKey(key), attempt, r.OOMRetries, backoff, err)
+			r.Summary.Incr("oom-retried")
+			time.Sleep(backoff)
+			if backoff *= 2; backoff > maxOOMBackoff {
+				backoff = maxOOMBackoff
+			}
+			err = r.restoreKey(pd)
+		}
+		if !r.isOOM(err) {
+			return err
+		}
+	}
+
+	return fmt.Errorf("%w after %d keys restored, at key %s: %s", ErrOOM, r.Summary.Get("restored"), message.FormatKey(key), err)
+}
@@ -0,0 +1,232 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mediocregopher/radix/v3"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// Flush is the policy of pipelined RESTOREs: a pipeline is sent once it
+// holds Keys keys, Bytes of payloads, or Interval after its first key was
+// added, whichever comes first. Zero triggers are off.
+// Slots, for Redis Cluster targets, splits pipelines into one per hash slot.
+type Flush struct {
+	Keys     int
+	Bytes    int
+	Interval time.Duration
+	Slots    bool
+}
+
+// full reports the trigger of a pipeline of keys keys and size bytes, empty
+// while neither limit is reached.
+func (f *Flush) full(keys, size int) string {
+	switch {
+	case f.Keys > 0 && keys >= f.Keys:
+		return "keys"
+	case f.Bytes > 0 && size >= f.Bytes:
+		return "bytes"
+	}
+
+	return ""
+}
+
+// writePipelined restores keys as Write does, in pipelines flushed per the
+// Pipeline policy, the pipeline left being flushed once the Bus is closed or
+// the context done. Payloads restored otherwise, tombstones and commands,
+// flush the pipeline first, keeping their order. Pipelines are counted per
+// trigger, as pipeline-<trigger>.
+func (r *Redis) writePipelined(ctx context.Context) error {
+	var batch []*pending
+	var size int
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	var expired <-chan time.Time
+
+	flush := func(trigger string) error {
+		if len(batch) == 0 {
+			return nil
+		}
+		// Drain the interval already expired, not to flush the next one early
+		if !timer.Stop() && expired != nil {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		expired = nil
+		r.Summary.Incr("pipeline-" + trigger)
+		err := r.restorePipeline(batch)
+		batch, size = nil, 0
+		return err
+	}
+
+	for r.Bus != nil {
+		select {
+		case <-ctx.Done():
+			fmt.Println("redis: done writing")
+			if err := r.FailFast.Err(); err != nil {
+				return err
+			}
+			if err := flush("end"); err != nil {
+				return r.FailFast.fail(err)
+			}
+			if err := r.drain(); err != nil {
+				return err
+			}
+			return fmt.Errorf("error writing to redis: %w", ctx.Err())
+		case <-expired:
+			if err := flush("interval"); err != nil {
+				return r.FailFast.fail(err)
+			}
+		case p, ok := <-r.Bus:
+			if !ok {
+				r.Bus = nil
+				continue
+			}
+
+			// Another writer failed first
+			if err := r.FailFast.Err(); err != nil {
+				return err
+			}
+
+			if err := r.ReplLag.wait(ctx); err != nil {
+				return fmt.Errorf("error writing to redis: %w", err)
+			}
+			if err := r.Move.wait(ctx); err != nil {
+				return fmt.Errorf("error writing to redis: %w", err)
+			}
+			if err := r.Limiter.Wait(ctx); err != nil {
+				return fmt.Errorf("error writing to redis: %w", err)
+			}
+			if err := r.AggregateLimiter.Wait(ctx); err != nil {
+				return fmt.Errorf("error writing to redis: %w", err)
+			}
+			if err := r.ByteLimiter.WaitN(ctx, float64(len(p.Value))); err != nil {
+				return fmt.Errorf("error writing to redis: %w", err)
+			}
+
+			if p.Tombstone || p.Commands {
+				if err := flush("order"); err != nil {
+					return r.FailFast.fail(err)
+				}
+			}
+			pd, err := r.prepare(p)
+			if err != nil {
+				return r.FailFast.fail(err)
+			}
+			if pd == nil {
+				continue
+			}
+
+			batch = append(batch, pd)
+			size += len(pd.value)
+			if len(batch) == 1 && r.Pipeline.Interval > 0 {
+				timer.Reset(r.Pipeline.Interval)
+				expired = timer.C
+			}
+			if trigger := r.Pipeline.full(len(batch), size); trigger != "" {
+				if err := flush(trigger); err != nil {
+					return r.FailFast.fail(err)
+				}
+			}
+		}
+	}
+
+	if err := flush("end"); err != nil {
+		return r.FailFast.fail(err)
+	}
+
+	return nil
+}
+
+// restorePipeline RESTOREs batch in a pipeline, or with Slots in one per
+// hash slot, in the order of their first key, see sendPipeline.
+func (r *Redis) restorePipeline(batch []*pending) error {
+	if !r.Pipeline.Slots {
+		return r.sendPipeline(batch)
+	}
+
+	for _, group := range bySlot(batch) {
+		if err := r.sendPipeline(group); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// bySlot groups batch by the hash slot of the keys, keys keeping their
+// order within their slot.
+func bySlot(batch []*pending) [][]*pending {
+	var groups [][]*pending
+	index := map[uint16]int{}
+	for _, pd := range batch {
+		slot := radix.ClusterSlot([]byte(pd.key))
+		i, ok := index[slot]
+		if !ok {
+			i = len(groups)
+			index[slot] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], pd)
+	}
+
+	return groups
+}
+
+// sendPipeline RESTOREs batch in a single pipeline, following ASKING with
+// Asking, then handles each reply as restore does, failed RESTOREs retried
+// one at a time with DeadLetter. Connection errors fail all keys. Keys
+// replied CROSSSLOT, e.g. by a cluster proxy, are restored again on their
+// own, their pipelines counted as pipeline-fallback.
+func (r *Redis) sendPipeline(batch []*pending) error {
+	cmds := make([]radix.CmdAction, 0, 2*len(batch))
+	replies := make([]*reply, len(batch))
+	for i, pd := range batch {
+		r.Balance.pace(pd.key)
+		if r.Asking {
+			cmds = append(cmds, radix.Cmd(&reply{}, r.cmd("ASKING")))
+		}
+		replies[i] = &reply{}
+		cmds = append(cmds, r.restoreCmd(replies[i], pd))
+	}
+
+	start := time.Now()
+	perr := r.Pool.Do(radix.Pipeline(cmds...))
+	fellBack := false
+	for i, pd := range batch {
+		err := replies[i].err
+		if perr != nil {
+			err = perr
+		}
+		switch {
+		case hasCode(err, "CROSSSLOT"):
+			if !fellBack {
+				r.fallBack(len(batch), pd.key)
+				fellBack = true
+			}
+			err = r.retryRestore(pd)
+		case err != nil && r.DeadLetter != nil:
+			err = r.retry(pd, err)
+		}
+		if err := r.restored(pd, err, start); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fallBack counts a pipeline of size keys replied CROSSSLOT from key on,
+// noting the first one in the Summary.
+func (r *Redis) fallBack(size int, key string) {
+	r.Summary.Incr("pipeline-fallback")
+	if r.Summary.Get("pipeline-fallback") == 1 {
+		r.Summary.Note(fmt.Sprintf("pipeline: CROSSSLOT replied in a pipeline of %d keys at key %s, restoring its keys on their own", size, message.FormatKey(key)))
+	}
+	r.logError("redis: CROSSSLOT replied in a pipeline of %d keys at key %s, restoring its keys on their own\n", size, message.FormatKey(key))
+}
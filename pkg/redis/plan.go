@@ -0,0 +1,102 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mediocregopher/radix/v3"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// Plan is the expected outcome of a transfer, as Estimate, the keys also
+// counted by Patterns, and Existing, the keys already on the target.
+type Plan struct {
+	Estimate
+	Patterns map[string]int64
+	Existing int64
+}
+
+// maxPatterns caps the Patterns of a Plan, further ones being counted
+// together as otherPattern.
+const maxPatterns = 100
+
+// otherPattern counts the Patterns of a Plan past maxPatterns.
+const otherPattern = "other"
+
+// pattern is the pattern counting key in a Plan, its name up to the first
+// colon, e.g. user:*, or * without one.
+func pattern(key string) string {
+	if i := strings.Index(key, ":"); i >= 0 {
+		return key[:i+1] + "*"
+	}
+
+	return "*"
+}
+
+// Plan scans the keys passing the Filter and MaxIdle, as Estimate with sizes
+// and types does, counting their Patterns and, unless target is nil, the
+// ones already on target with EXISTS. It only reads, an extra full scan.
+func (r *Redis) Plan(ctx context.Context, target *Redis) (Plan, error) {
+	scanner := radix.NewScanner(r.Pool, r.scanOpts())
+	plan := Plan{
+		Estimate: Estimate{Types: map[string]int64{}},
+		Patterns: map[string]int64{},
+	}
+
+	var key string
+	for scanner.Next(&key) {
+		if ctx.Err() != nil {
+			scanner.Close()
+			return plan, ctx.Err()
+		}
+
+		if !r.Filter.Keep(key) || r.isIdle(key) {
+			continue
+		}
+
+		var bytes int64
+		var typ string
+		usage, kind := &reply{rcv: &bytes}, &reply{rcv: &typ}
+		err := r.Pool.Do(radix.Pipeline(
+			radix.Cmd(usage, r.cmd("MEMORY"), "USAGE", key),
+			radix.Cmd(kind, r.cmd("TYPE"), key),
+		))
+		for _, e := range []error{usage.err, kind.err} {
+			if err == nil {
+				err = e
+			}
+		}
+		if err != nil {
+			scanner.Close()
+			return plan, fmt.Errorf("error calling MEMORY USAGE and TYPE for key %s, requires Redis 4: %w", message.FormatKey(key), err)
+		}
+		// Deleted since SCAN
+		if typ == "none" {
+			continue
+		}
+
+		if target != nil {
+			exists, err := target.exists(key)
+			if err != nil {
+				scanner.Close()
+				return plan, err
+			}
+			if exists {
+				plan.Existing++
+			}
+		}
+
+		p := pattern(key)
+		if _, ok := plan.Patterns[p]; !ok && len(plan.Patterns) >= maxPatterns {
+			p = otherPattern
+		}
+		plan.Keys++
+		plan.Bytes += bytes
+		plan.Types[typ]++
+		plan.Patterns[p]++
+	}
+
+	return plan, scanner.Close()
+}
@@ -0,0 +1,138 @@
+package redis
+
+import (
+	"crypto/tls"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/mediocregopher/radix/v3"
+)
+
+// NewPool creates a connection pool for a Redis URI.
+// When set, password is used for AUTH in place of the URI one,
+// so that it doesn't have to be passed on the command line.
+// tlsConfig, required by rediss:// URIs, enables TLS.
+// size is the number of connections, at least 1.
+func NewPool(uri, password string, tlsConfig *tls.Config, size int) (*radix.Pool, error) {
+	return NewAuthPool(uri, StaticAuth{Password: password}, tlsConfig, size)
+}
+
+// NewAuthPool creates a connection pool for a Redis URI, as NewPool does,
+// AUTHing new connections with the auth credentials at the time.
+func NewAuthPool(uri string, auth AuthProvider, tlsConfig *tls.Config, size int) (*radix.Pool, error) {
+	return NewProxyPool(uri, auth, tlsConfig, nil, size)
+}
+
+// NewProxyPool creates a connection pool for a Redis URI, as NewAuthPool
+// does, connecting through proxy when set.
+func NewProxyPool(uri string, auth AuthProvider, tlsConfig *tls.Config, proxy *Proxy, size int) (*radix.Pool, error) {
+	return NewDialPool(uri, auth, tlsConfig, proxy, Dialer{}, size)
+}
+
+// Dialer configures the TCP connections of pools, for long running syncs
+// behind load balancers that close idle connections.
+type Dialer struct {
+	// KeepAlive is the TCP keepalive period, below the idle timeout of the
+	// load balancers in between, 10s when unset.
+	KeepAlive time.Duration
+	// IdleTimeout is how long connections wait on a reply, e.g. the DUMP of
+	// a huge key, before erroring. Unset, it's 10s on plain connections and
+	// none on TLS or proxied ones, negative for none.
+	IdleTimeout time.Duration
+	// Protocol, when set, is the RESP version negotiated with HELLO on
+	// connect, per pool: only 2 is supported, the client decoding RESP2
+	// replies only. Servers before Redis 6, without HELLO, speak RESP2.
+	Protocol int
+	// NoTouch enables CLIENT NO-TOUCH on connect, from Redis 7.2, for the
+	// commands of the pool, GET and DUMP included, to leave the LRU/LFU
+	// metadata of the keys they read unchanged.
+	NoTouch bool
+}
+
+// defaultTimeout is the connect timeout, TCP keepalive period and plain
+// connection IdleTimeout, as radix.Dial has them.
+const defaultTimeout = 10 * time.Second
+
+// idleConn errors Reads and Writes waiting past timeout.
+type idleConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c idleConn) Read(b []byte) (int, error) {
+	c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Read(b)
+}
+
+func (c idleConn) Write(b []byte) (int, error) {
+	c.Conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Write(b)
+}
+
+// NewDialPool creates a connection pool for a Redis URI, as NewProxyPool
+// does, its connections configured by dial.
+func NewDialPool(uri string, auth AuthProvider, tlsConfig *tls.Config, proxy *Proxy, dial Dialer, size int) (*radix.Pool, error) {
+	if size < 1 {
+		size = 1
+	}
+
+	return radix.NewPool("tcp", uri, size, radix.PoolConnFunc(connFunc(auth, tlsConfig, proxy, dial)))
+}
+
+// NewPubSub creates a pub/sub connection for a Redis URI, configured as
+// NewDialPool connections are, reconnecting and resubscribing on connection
+// loss, its methods blocking meanwhile.
+func NewPubSub(uri string, auth AuthProvider, tlsConfig *tls.Config, proxy *Proxy, dial Dialer) radix.PubSubConn {
+	return radix.PersistentPubSub("tcp", uri, connFunc(auth, tlsConfig, proxy, dial))
+}
+
+// connFunc dials the connections of NewDialPool and NewPubSub.
+func connFunc(auth AuthProvider, tlsConfig *tls.Config, proxy *Proxy, dial Dialer) radix.ConnFunc {
+	return func(network, addr string) (radix.Conn, error) {
+		user, password, err := auth.Auth()
+		if err != nil {
+			return nil, err
+		}
+
+		if dial != (Dialer{}) && tlsConfig == nil && proxy == nil && dial.IdleTimeout == 0 {
+			dial.IdleTimeout = defaultTimeout
+		}
+		if tlsConfig != nil || proxy != nil || dial != (Dialer{}) {
+			return dialURI(network, addr, user, password, tlsConfig, proxy, dial)
+		}
+		if user == "" {
+			return radix.Dial(network, addr, radix.DialAuthPass(password))
+		}
+
+		conn, err := radix.Dial(network, addr)
+		if err != nil {
+			return nil, err
+		}
+		if err := conn.Do(radix.Cmd(nil, "AUTH", user, password)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+}
+
+// Redact hides the password of a Redis URI, to be used in logs.
+func Redact(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+
+	q := u.Query()
+	if q.Get("password") != "" {
+		q.Set("password", "xxxxx")
+		u.RawQuery = q.Encode()
+	}
+
+	return u.String()
+}
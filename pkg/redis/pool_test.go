@@ -0,0 +1,161 @@
+package redis_test
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mediocregopher/radix/v3"
+
+	"github.com/stickermule/rump/pkg/redis"
+	"github.com/stickermule/rump/pkg/resp"
+)
+
+// slowServer replies +OK to every command after delay, mimicking the DUMP of
+// a huge key.
+func slowServer(t *testing.T, delay time.Duration) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				cmds := resp.NewReader(conn)
+				for {
+					if _, err := cmds.Read(); err != nil {
+						return
+					}
+					time.Sleep(delay)
+					conn.Write([]byte("+OK\r\n"))
+				}
+			}()
+		}
+	}()
+
+	return ln
+}
+
+// Test pools wait on replies up to their Dialer IdleTimeout
+func TestDialPool(t *testing.T) {
+	ln := slowServer(t, 300*time.Millisecond)
+	defer ln.Close()
+
+	uri := "redis://" + ln.Addr().String()
+	dial := redis.Dialer{KeepAlive: time.Minute, IdleTimeout: 5 * time.Second}
+	db, err := redis.NewDialPool(uri, redis.StaticAuth{}, nil, nil, dial, 1)
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	if err := db.Do(radix.Cmd(nil, "DUMP", "huge")); err != nil {
+		t.Error("error: ", err)
+	}
+	db.Close()
+
+	dial.IdleTimeout = 100 * time.Millisecond
+	db, err = redis.NewDialPool(uri, redis.StaticAuth{}, nil, nil, dial, 1)
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	defer db.Close()
+	if err := db.Do(radix.Cmd(nil, "DUMP", "huge")); err == nil {
+		t.Error("replies past the IdleTimeout should time out")
+	}
+}
+
+// helloServer replies to HELLO with hello, +OK to other commands, sending
+// the commands received to cmds.
+func helloServer(t *testing.T, hello string, cmds chan []string) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := resp.NewReader(conn)
+				for {
+					cmd, err := r.Read()
+					if err != nil {
+						return
+					}
+					cmds <- cmd
+					if cmd[0] == "HELLO" {
+						conn.Write([]byte(hello))
+						continue
+					}
+					conn.Write([]byte("+OK\r\n"))
+				}
+			}()
+		}
+	}()
+
+	return ln
+}
+
+// Test pools negotiate their own protocol, servers without HELLO accepted
+// for RESP2, and servers refusing it failing with their address
+func TestDialPoolProtocol(t *testing.T) {
+	cmds := make(chan []string, 10)
+	ln := helloServer(t, "-ERR unknown command 'HELLO'\r\n", cmds)
+	defer ln.Close()
+	uri := "redis://" + ln.Addr().String()
+
+	// Mismatched pools, e.g. of a source left at the server default and a
+	// target pinned to RESP2
+	source, err := redis.NewDialPool(uri, redis.StaticAuth{}, nil, nil, redis.Dialer{}, 1)
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	defer source.Close()
+	if err := source.Do(radix.Cmd(nil, "PING")); err != nil {
+		t.Error("error: ", err)
+	}
+	if cmd := <-cmds; cmd[0] != "PING" {
+		t.Errorf("expected no HELLO on the source, got %v", cmd)
+	}
+
+	target, err := redis.NewDialPool(uri, redis.StaticAuth{}, nil, nil, redis.Dialer{Protocol: 2}, 1)
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	defer target.Close()
+	if cmd := <-cmds; len(cmd) != 2 || cmd[0] != "HELLO" || cmd[1] != "2" {
+		t.Errorf("expected HELLO 2 on the target, got %v", cmd)
+	}
+
+	refusing := helloServer(t, "-NOPROTO unsupported protocol version\r\n", cmds)
+	defer refusing.Close()
+	_, err = redis.NewDialPool("redis://"+refusing.Addr().String(), redis.StaticAuth{}, nil, nil, redis.Dialer{Protocol: 2}, 1)
+	if err == nil || !strings.Contains(err.Error(), refusing.Addr().String()) {
+		t.Errorf("expected a NOPROTO error naming the server, got %v", err)
+	}
+}
+
+// Test no-touch pools enable CLIENT NO-TOUCH on connect
+func TestDialPoolNoTouch(t *testing.T) {
+	cmds := make(chan []string, 10)
+	ln := helloServer(t, "", cmds)
+	defer ln.Close()
+
+	pool, err := redis.NewDialPool("redis://"+ln.Addr().String(), redis.StaticAuth{}, nil, nil, redis.Dialer{NoTouch: true}, 1)
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	defer pool.Close()
+	if cmd := <-cmds; !reflect.DeepEqual(cmd, []string{"CLIENT", "NO-TOUCH", "ON"}) {
+		t.Errorf("expected CLIENT NO-TOUCH ON, got %v", cmd)
+	}
+}
@@ -0,0 +1,182 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mediocregopher/radix/v3"
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+
+	"github.com/stickermule/rump/pkg/filter"
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// Policies of PromoteNamespace for keys already under their final name:
+// replaced by the staged key, kept, the staged key deleted, or failing the
+// promote, the staged key left.
+const (
+	PromoteReplace = "replace"
+	PromoteKeep    = "keep"
+	PromoteFail    = "fail"
+)
+
+// PromotePolicies are the valid PromoteNamespace policies.
+var PromotePolicies = []string{PromoteReplace, PromoteKeep, PromoteFail}
+
+// PromoteNamespace renames the keys under the staging prefix, SCANned off
+// the server, to their final name, without the prefix, passing the Filter.
+// With batch > 0, batch keys are renamed per MULTI transaction, readers
+// seeing all of them promoted at once. Keys already under their final name
+// are handled per policy, RENAME replacing them, RENAMENX otherwise.
+// Staged keys whose final name is itself staged, e.g. staging:staging:a, are
+// left, counted as promote-nested, not to be renamed twice by the SCAN.
+func (r *Redis) PromoteNamespace(ctx context.Context, prefix, policy string, batch int) error {
+	scanner := radix.NewScanner(r.Pool, radix.ScanOpts{
+		Command: r.cmd("SCAN"),
+		Pattern: filter.Escape(prefix) + "*",
+		Count:   r.ScanCount,
+	})
+	defer scanner.Close()
+
+	var pending []string
+	var key string
+	for scanner.Next(&key) {
+		select {
+		case <-ctx.Done():
+			fmt.Println("redis: done promoting")
+			return ctx.Err()
+		default:
+		}
+
+		final := strings.TrimPrefix(key, prefix)
+		switch {
+		case final == "" || !r.Filter.Selects(final):
+			continue
+		case strings.HasPrefix(final, prefix):
+			r.Summary.Incr("promote-nested")
+			r.logError("redis: leaving staged key %s, its final name is staged\n", message.FormatKey(key))
+			continue
+		}
+
+		pending = append(pending, key)
+		if len(pending) < batch {
+			continue
+		}
+		if err := r.promote(prefix, policy, batch, pending); err != nil {
+			return err
+		}
+		pending = pending[:0]
+	}
+	if err := scanner.Close(); err != nil {
+		return fmt.Errorf("error scanning staged keys: %w", err)
+	}
+
+	return r.promote(prefix, policy, batch, pending)
+}
+
+// promote renames the staged keys, in a MULTI transaction with batch > 0,
+// then handles each reply per policy.
+func (r *Redis) promote(prefix, policy string, batch int, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	rename := r.cmd("RENAMENX")
+	if policy == PromoteReplace {
+		rename = r.cmd("RENAME")
+	}
+	// RENAMENX replies 0 for existing keys, RENAME +OK
+	replies := make([]*reply, len(keys))
+	for i := range keys {
+		replies[i] = &reply{}
+		if policy != PromoteReplace {
+			replies[i].rcv = new(int64)
+		}
+	}
+
+	if batch > 0 {
+		// Replies of the queued commands are +QUEUED, theirs come with EXEC
+		cmds := []radix.CmdAction{radix.Cmd(nil, r.cmd("MULTI"))}
+		for _, key := range keys {
+			cmds = append(cmds, radix.Cmd(&reply{}, rename, key, strings.TrimPrefix(key, prefix)))
+		}
+		cmds = append(cmds, radix.Cmd(&execReply{replies: replies}, r.cmd("EXEC")))
+		if err := r.Pool.Do(radix.Pipeline(cmds...)); err != nil {
+			return fmt.Errorf("error promoting %d staged keys from %s: %w", len(keys), message.FormatKey(keys[0]), err)
+		}
+		r.Summary.Incr("promote-transactions")
+	} else {
+		for i, key := range keys {
+			if err := r.Pool.Do(radix.Cmd(replies[i], rename, key, strings.TrimPrefix(key, prefix))); err != nil {
+				return fmt.Errorf("error promoting staged key %s: %w", message.FormatKey(key), err)
+			}
+		}
+	}
+
+	for i, key := range keys {
+		if err := r.promoted(key, strings.TrimPrefix(key, prefix), policy, replies[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// promoted handles the reply of the rename of key to final, per policy.
+func (r *Redis) promoted(key, final, policy string, rep *reply) error {
+	renamed := true
+	if n, ok := rep.rcv.(*int64); ok {
+		renamed = *n == 1
+	}
+
+	switch {
+	// Keys expired or deleted since SCANned
+	case hasCode(rep.err, "ERR") && strings.Contains(rep.err.Error(), "no such key"):
+		r.Summary.Incr("promote-missing")
+		return nil
+	case rep.err != nil:
+		return fmt.Errorf("error promoting staged key %s to %s: %w", message.FormatKey(key), message.FormatKey(final), rep.err)
+	case !renamed && policy == PromoteFail:
+		return fmt.Errorf("error promoting staged key %s: %s exists, the staged key is left", message.FormatKey(key), message.FormatKey(final))
+	case !renamed:
+		if err := r.Pool.Do(radix.Cmd(nil, r.cmd("DEL"), key)); err != nil {
+			return fmt.Errorf("error deleting staged key %s: %w", message.FormatKey(key), err)
+		}
+		r.Summary.Incr("kept-target")
+		r.logError("redis: keeping target key %s, staged key %s deleted\n", message.FormatKey(final), message.FormatKey(key))
+		return nil
+	}
+
+	r.Summary.Incr("promoted")
+	r.logKey("redis: RENAME %s %s\n", message.FormatKey(key), message.FormatKey(final))
+
+	return nil
+}
+
+// execReply unmarshals the reply of EXEC into replies, one per command of
+// the transaction, keeping their errors as reply does.
+type execReply struct {
+	replies []*reply
+}
+
+func (e *execReply) UnmarshalRESP(br *bufio.Reader) error {
+	var head resp2.ArrayHeader
+	if err := head.UnmarshalRESP(br); err != nil {
+		return err
+	}
+	if head.N < 0 {
+		return fmt.Errorf("EXEC aborted")
+	}
+	if head.N != len(e.replies) {
+		return fmt.Errorf("EXEC replied %d replies to %d commands", head.N, len(e.replies))
+	}
+	for _, r := range e.replies {
+		if err := r.UnmarshalRESP(br); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
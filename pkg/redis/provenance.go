@@ -0,0 +1,95 @@
+package redis
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mediocregopher/radix/v3"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// Provenance records when, and by which run Batch, restored keys were
+// migrated: in a companion key per restored key when Template contains
+// {key}, e.g. {key}:migrated, expiring with it, or else in the Template
+// hash, a field per restored key, e.g. rump:provenance:{batch}. {batch} is
+// replaced by Batch in both. Entries are JSON, see provenance.
+type Provenance struct {
+	Template string
+	Batch    string
+}
+
+// provenance is a Provenance entry, Time is RFC 3339 in UTC.
+type provenance struct {
+	Batch string `json:"batch"`
+	Time  string `json:"time"`
+}
+
+// NewBatch returns a batch ID telling runs apart: their UTC start time and
+// process ID, e.g. 20240102T150405Z-4242.
+func NewBatch() string {
+	return fmt.Sprintf("%s-%d", time.Now().UTC().Format("20060102T150405Z"), os.Getpid())
+}
+
+// PerKey reports whether entries are companion keys, rather than hash fields.
+func (p *Provenance) PerKey() bool {
+	return strings.Contains(p.Template, "{key}")
+}
+
+// tag records the Provenance of the restored key, companion keys expiring
+// in ttl milliseconds as it does, nil-safe.
+func (r *Redis) tag(key string, ttl int64) error {
+	p := r.Provenance
+	if p == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(provenance{Batch: p.Batch, Time: time.Now().UTC().Format(time.RFC3339)})
+	if err != nil {
+		return err
+	}
+	name := strings.Replace(strings.Replace(p.Template, "{batch}", p.Batch, -1), "{key}", key, -1)
+
+	switch {
+	case !p.PerKey():
+		err = r.Pool.Do(radix.Cmd(nil, r.cmd("HSET"), name, key, string(b)))
+	case ttl > 0:
+		err = r.Pool.Do(radix.Cmd(nil, r.cmd("SET"), name, string(b), "PX", strconv.FormatInt(ttl, 10)))
+	default:
+		err = r.Pool.Do(radix.Cmd(nil, r.cmd("SET"), name, string(b)))
+	}
+	if cerr := clusterError(key, err); cerr != nil {
+		return cerr
+	}
+	if err != nil {
+		return fmt.Errorf("error recording the provenance of key %s in '%s': %w", message.FormatKey(key), name, err)
+	}
+	r.Summary.Incr("tagged")
+
+	return nil
+}
+
+// run is the entry of MarkRun, Time is RFC 3339 in UTC.
+type run struct {
+	RunID  string `json:"run_id"`
+	Source string `json:"source"`
+	Time   string `json:"time"`
+}
+
+// MarkRun records the ID of the run restoring to the target in key, as JSON
+// with its source and start time, overwriting the one of the previous run.
+func (r *Redis) MarkRun(key, id, source string) error {
+	b, err := json.Marshal(run{RunID: id, Source: source, Time: time.Now().UTC().Format(time.RFC3339)})
+	if err != nil {
+		return err
+	}
+	if err := r.Pool.Do(radix.Cmd(nil, r.cmd("SET"), key, string(b))); err != nil {
+		return fmt.Errorf("error recording the run ID in %s: %w", message.FormatKey(key), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,210 @@
+package redis
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Proxy tunnels connections through a SOCKS5 or HTTP CONNECT proxy,
+// e.g. exposed by a bastion. TLS is negotiated with the Redis server through
+// the tunnel, end-to-end.
+type Proxy struct {
+	Scheme   string
+	Addr     string
+	User     string
+	Password string
+}
+
+// ParseProxy parses a socks5://[user:password@]host:port or
+// http://[user:password@]host:port proxy URI.
+func ParseProxy(uri string) (*Proxy, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %s: %w", uri, err)
+	}
+	if u.Scheme != "socks5" && u.Scheme != "http" {
+		return nil, fmt.Errorf("invalid proxy %s, must be a socks5:// or http:// URI", uri)
+	}
+	if _, port, err := net.SplitHostPort(u.Host); err != nil || port == "" {
+		return nil, fmt.Errorf("invalid proxy %s, must have a host:port address", uri)
+	}
+
+	p := &Proxy{Scheme: u.Scheme, Addr: u.Host}
+	if u.User != nil {
+		p.User = u.User.Username()
+		p.Password, _ = u.User.Password()
+	}
+
+	return p, nil
+}
+
+// Dial connects to addr through the proxy.
+func (p *Proxy) Dial(network, addr string) (net.Conn, error) {
+	return p.dial(network, addr, defaultTimeout)
+}
+
+// dial connects to addr through the proxy, with the TCP keepalive period.
+func (p *Proxy) dial(network, addr string, keepAlive time.Duration) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: defaultTimeout, KeepAlive: keepAlive}
+	conn, err := dialer.Dial(network, p.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("error dialing proxy %s: %w", p.Addr, err)
+	}
+
+	// Handshakes are bounded as the connection is
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if p.Scheme == "socks5" {
+		err = p.socks5(conn, addr)
+	} else {
+		err = p.connect(conn, addr)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error connecting to %s through proxy %s: %w", addr, p.Addr, err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	return conn, nil
+}
+
+// socks5 replies, RFC 1928.
+var socks5Errors = map[byte]string{
+	1: "general failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+// socks5 asks a SOCKS5 proxy to CONNECT to addr, with username/password
+// authentication (RFC 1929) when User is set. The host name is resolved by
+// the proxy, as it may only be known on its side.
+func (p *Proxy) socks5(conn net.Conn, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return fmt.Errorf("invalid port %s", portStr)
+	}
+	if len(host) > 255 {
+		return fmt.Errorf("host name %s too long", host)
+	}
+
+	method := byte(0)
+	if p.User != "" {
+		method = 2
+	}
+	if _, err := conn.Write([]byte{5, 1, method}); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != 5 || reply[1] != method {
+		return errors.New("proxy refused the authentication method")
+	}
+
+	if method == 2 {
+		auth := []byte{1, byte(len(p.User))}
+		auth = append(auth, p.User...)
+		auth = append(auth, byte(len(p.Password)))
+		auth = append(auth, p.Password...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0 {
+			return errors.New("proxy authentication failed")
+		}
+	}
+
+	req := []byte{5, 1, 0}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
+		req = append(append(req, 1), ip.To4()...)
+	} else if ip != nil {
+		req = append(append(req, 4), ip.To16()...)
+	} else {
+		req = append(append(req, 3, byte(len(host))), host...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	// VER REP RSV ATYP, then the bound address, skipped
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return err
+	}
+	if head[1] != 0 {
+		if msg, ok := socks5Errors[head[1]]; ok {
+			return errors.New(msg)
+		}
+		return fmt.Errorf("unknown reply %d", head[1])
+	}
+	var skip int
+	switch head[3] {
+	case 1:
+		skip = net.IPv4len
+	case 4:
+		skip = net.IPv6len
+	case 3:
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(conn, n); err != nil {
+			return err
+		}
+		skip = int(n[0])
+	default:
+		return fmt.Errorf("unknown address type %d", head[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip+2))
+
+	return err
+}
+
+// connect asks an HTTP proxy to CONNECT to addr, with basic authentication
+// when User is set.
+func (p *Proxy) connect(conn net.Conn, addr string) error {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if p.User != "" {
+		creds := base64.StdEncoding.EncodeToString([]byte(p.User + ":" + p.Password))
+		req.Header.Set("Proxy-Authorization", "Basic "+creds)
+	}
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+
+	// Redis servers wait for the client to speak, nothing is buffered past
+	// the proxy response.
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("proxy replied %s", resp.Status)
+	}
+
+	return nil
+}
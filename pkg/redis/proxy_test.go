@@ -0,0 +1,200 @@
+package redis_test
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/mediocregopher/radix/v3"
+
+	"github.com/stickermule/rump/pkg/redis"
+)
+
+// proxyServer is a fake SOCKS5 or HTTP CONNECT proxy, requiring user:secret
+// credentials, tunneling to the requested address and recording it.
+func proxyServer(t *testing.T, scheme string, addrs chan string) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				br := bufio.NewReader(c)
+
+				var addr string
+				if scheme == "socks5" {
+					addr = socks5Handshake(br, c)
+				} else {
+					addr = connectHandshake(br, c)
+				}
+				if addr == "" {
+					return
+				}
+				addrs <- addr
+
+				upstream, err := net.Dial("tcp", addr)
+				if err != nil {
+					return
+				}
+				defer upstream.Close()
+				go io.Copy(upstream, br)
+				io.Copy(c, upstream)
+			}(c)
+		}
+	}()
+
+	return l
+}
+
+// socks5Handshake accepts user:secret and a CONNECT to an IPv4 address.
+func socks5Handshake(br *bufio.Reader, c net.Conn) string {
+	greeting := make([]byte, 3)
+	io.ReadFull(br, greeting)
+	c.Write([]byte{5, 2})
+
+	ver, _ := br.ReadByte()
+	ulen, _ := br.ReadByte()
+	user := make([]byte, ulen)
+	io.ReadFull(br, user)
+	plen, _ := br.ReadByte()
+	pass := make([]byte, plen)
+	io.ReadFull(br, pass)
+	if ver != 1 || string(user) != "user" || string(pass) != "secret" {
+		c.Write([]byte{1, 1})
+		return ""
+	}
+	c.Write([]byte{1, 0})
+
+	req := make([]byte, 10)
+	io.ReadFull(br, req)
+	if req[3] != 1 {
+		c.Write([]byte{5, 8, 0, 1, 0, 0, 0, 0, 0, 0})
+		return ""
+	}
+	c.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0})
+
+	port := int(req[8])<<8 | int(req[9])
+	return net.IP(req[4:8]).String() + ":" + strconv.Itoa(port)
+}
+
+// connectHandshake accepts user:secret basic credentials.
+func connectHandshake(br *bufio.Reader, c net.Conn) string {
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		return ""
+	}
+	creds := base64.StdEncoding.EncodeToString([]byte("user:secret"))
+	if req.Method != http.MethodConnect || req.Header.Get("Proxy-Authorization") != "Basic "+creds {
+		c.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\n\r\n"))
+		return ""
+	}
+	c.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+
+	return req.Host
+}
+
+// Test rediss:// pools negotiate TLS with the server through a SOCKS5 proxy
+func TestSOCKS5Pool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rump-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	serverCert, serverKey := writeCert(t, dir, "server")
+	clientCert, clientKey := writeCert(t, dir, "client")
+	cmds := make(chan []string, 10)
+	l := tlsServer(t, serverCert, serverKey, clientCert, cmds)
+	defer l.Close()
+
+	addrs := make(chan string, 10)
+	p := proxyServer(t, "socks5", addrs)
+	defer p.Close()
+
+	certs, err := redis.NewStaticCert(clientCert, clientKey)
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	tlsConfig, err := redis.NewTLSConfig(certs, serverCert)
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	proxy, err := redis.ParseProxy("socks5://user:secret@" + p.Addr().String())
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	db, err := redis.NewProxyPool("rediss://"+l.Addr().String()+"/2", redis.StaticAuth{Password: "pass"}, tlsConfig, proxy, 1)
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	defer db.Close()
+
+	if err := db.Do(radix.Cmd(nil, "PING")); err != nil {
+		t.Error("error: ", err)
+	}
+
+	if addr := <-addrs; addr != l.Addr().String() {
+		t.Errorf("expected a tunnel to %s, got %s", l.Addr(), addr)
+	}
+	for _, expected := range []string{"AUTH pass", "SELECT 2"} {
+		args := <-cmds
+		if args[0]+" "+args[1] != expected {
+			t.Errorf("expected: %s, result: %v", expected, args)
+		}
+	}
+}
+
+// Test redis:// pools connect through an HTTP CONNECT proxy
+func TestHTTPProxyPool(t *testing.T) {
+	s := newServer(t)
+	defer s.ln.Close()
+
+	addrs := make(chan string, 10)
+	p := proxyServer(t, "http", addrs)
+	defer p.Close()
+
+	proxy, err := redis.ParseProxy("http://user:secret@" + p.Addr().String())
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	db, err := redis.NewProxyPool("redis://"+s.ln.Addr().String()+"/1", redis.StaticAuth{}, nil, proxy, 1)
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	defer db.Close()
+
+	if err := db.Do(radix.Cmd(nil, "SET", "a", "1")); err != nil {
+		t.Error("error: ", err)
+	}
+	if addr := <-addrs; addr != s.ln.Addr().String() {
+		t.Errorf("expected a tunnel to %s, got %s", s.ln.Addr(), addr)
+	}
+
+	// Wrong credentials fail the pool creation
+	proxy.Password = "wrong"
+	if _, err := redis.NewProxyPool("redis://"+s.ln.Addr().String(), redis.StaticAuth{}, nil, proxy, 1); err == nil {
+		t.Error("proxy authentication should fail")
+	}
+}
+
+func TestParseProxy(t *testing.T) {
+	for _, uri := range []string{"bastion:1080", "socks4://bastion:1080", "socks5://bastion", "http://"} {
+		if _, err := redis.ParseProxy(uri); err == nil {
+			t.Errorf("%s should be invalid", uri)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package redis
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mediocregopher/radix/v3"
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+
+	"github.com/stickermule/rump/pkg/summary"
+)
+
+// reconnectBackoff is the wait before the first reconnection attempt,
+// doubled on each attempt, up to maxReconnectBackoff.
+const (
+	reconnectBackoff    = time.Second
+	maxReconnectBackoff = 30 * time.Second
+)
+
+// connError reports whether err is a connection failure, e.g. the server
+// restarted, rather than an error reply.
+func connError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var rerr resp2.Error
+	if errors.As(err, &rerr) {
+		return false
+	}
+	var nerr net.Error
+	return errors.As(err, &nerr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// ReconnectPool is a radix.Client recreating its pool with Dial once
+// commands fail with connection errors, then retrying them, up to Attempts
+// times with an exponential Backoff. Reconnections are counted in the
+// Summary. Pools are recreated once for all the goroutines sharing it.
+type ReconnectPool struct {
+	Dial     func() (*radix.Pool, error)
+	Attempts int
+	Backoff  time.Duration
+	Summary  *summary.Summary
+
+	mu   sync.Mutex
+	pool *radix.Pool
+	gen  int
+}
+
+// NewReconnectPool creates the first pool with dial.
+func NewReconnectPool(dial func() (*radix.Pool, error), attempts int, sum *summary.Summary) (*ReconnectPool, error) {
+	pool, err := dial()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReconnectPool{Dial: dial, Attempts: attempts, Backoff: reconnectBackoff, Summary: sum, pool: pool}, nil
+}
+
+// current returns the current pool and its generation.
+func (p *ReconnectPool) current() (*radix.Pool, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.pool, p.gen
+}
+
+// reconnect replaces the pool of generation gen, unless another goroutine
+// already did.
+func (p *ReconnectPool) reconnect(gen int) (*radix.Pool, int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.gen != gen {
+		return p.pool, p.gen, nil
+	}
+
+	pool, err := p.Dial()
+	if err != nil {
+		return p.pool, p.gen, err
+	}
+	p.pool.Close()
+	p.pool, p.gen = pool, p.gen+1
+	p.Summary.Incr("reconnects")
+
+	return p.pool, p.gen, nil
+}
+
+// Do runs the action, reconnecting and running it again on connection
+// errors. Actions may have been applied before the connection failed, they
+// should be idempotent, e.g. RESTORE REPLACE.
+func (p *ReconnectPool) Do(a radix.Action) error {
+	pool, gen := p.current()
+	err := pool.Do(a)
+
+	backoff := p.Backoff
+	for attempt := 1; connError(err) && attempt <= p.Attempts; attempt++ {
+		fmt.Printf("redis: connection lost, reconnecting in %s, attempt %d/%d; error=%s\n", backoff, attempt, p.Attempts, err)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
+
+		pool, gen, err = p.reconnect(gen)
+		if err != nil {
+			continue
+		}
+		err = pool.Do(a)
+	}
+	if connError(err) && p.Attempts > 0 {
+		return fmt.Errorf("connection lost, %d reconnection attempts failed: %w", p.Attempts, err)
+	}
+
+	return err
+}
+
+// NumAvailConns returns the idle connections of the current pool.
+func (p *ReconnectPool) NumAvailConns() int {
+	pool, _ := p.current()
+	return pool.NumAvailConns()
+}
+
+// Close closes the current pool.
+func (p *ReconnectPool) Close() error {
+	pool, _ := p.current()
+	return pool.Close()
+}
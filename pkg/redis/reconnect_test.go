@@ -0,0 +1,98 @@
+package redis_test
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mediocregopher/radix/v3"
+
+	"github.com/stickermule/rump/pkg/redis"
+	"github.com/stickermule/rump/pkg/resp"
+	"github.com/stickermule/rump/pkg/summary"
+)
+
+// server replies +OK to every command, until its connections are dropped.
+type server struct {
+	ln    net.Listener
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func newServer(t *testing.T) *server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &server{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, conn)
+			s.mu.Unlock()
+			go func() {
+				cmds := resp.NewReader(conn)
+				for {
+					if _, err := cmds.Read(); err != nil {
+						return
+					}
+					conn.Write([]byte("+OK\r\n"))
+				}
+			}()
+		}
+	}()
+
+	return s
+}
+
+// drop closes all connections, as a server restart.
+func (s *server) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+// Test pools are recreated once their connections are lost
+func TestReconnectPool(t *testing.T) {
+	s := newServer(t)
+	defer s.ln.Close()
+
+	sum := summary.New()
+	dial := func() (*radix.Pool, error) {
+		return radix.NewPool("tcp", s.ln.Addr().String(), 1)
+	}
+	pool, err := redis.NewReconnectPool(dial, 3, sum)
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	pool.Backoff = time.Millisecond
+	defer pool.Close()
+
+	if err := pool.Do(radix.Cmd(nil, "SET", "a", "1")); err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	s.drop()
+	if err := pool.Do(radix.Cmd(nil, "SET", "a", "1")); err != nil {
+		t.Fatal("should reconnect: ", err)
+	}
+	if sum.Get("reconnects") != 1 {
+		t.Errorf("wrong reconnects count: %d", sum.Get("reconnects"))
+	}
+
+	// Bounded attempts once the server is gone
+	s.ln.Close()
+	s.drop()
+	if err := pool.Do(radix.Cmd(nil, "SET", "a", "1")); err == nil {
+		t.Error("should fail once attempts are exhausted")
+	}
+}
@@ -3,34 +3,268 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"regexp"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/mediocregopher/radix/v3"
 
+	"github.com/stickermule/rump/pkg/audit"
+	"github.com/stickermule/rump/pkg/bloom"
+	"github.com/stickermule/rump/pkg/filter"
 	"github.com/stickermule/rump/pkg/message"
+	"github.com/stickermule/rump/pkg/ratelimit"
+	"github.com/stickermule/rump/pkg/records"
+	"github.com/stickermule/rump/pkg/summary"
 )
 
 // Redis holds references to a DB pool and a shared message bus.
 // Silent disables verbose mode.
+// LogEvery, when above 1, only logs the DUMP and RESTORE lines of every
+// LogEvery key.
 // TTL enables TTL sync.
+// Commands reads keys as the RESP commands recreating them, in place of DUMP,
+// and writes by replaying the RESP commands of each Payload, in place of RESTORE.
+// TTLOnly reads keys as their TTL only, without DUMP, and writes by updating
+// the TTL of the keys already on the target, in place of RESTORE.
+// Filter selects the keys to read.
+// ValueMatch, when set, only reads string keys whose value, read with GET,
+// matches it, keys of other types only with ValueOthers.
+// ScanCount is the SCAN COUNT hint, the server default when 0.
+// KeysStream, when set, reads the keys off a Redis Stream in place of SCAN.
+// KeysChannel, when set, reads the keys off a pub/sub channel in place of
+// SCAN, at most once.
+// Keys, when set, are read in place of SCAN, e.g. a DeadLetter file keys.
+// KeySource, when set, enumerates the keys read in place of SCAN.
+// Checkpoint, when set, SCANs from its cursor, stopping at its deadline.
+// Dedup, when set, skips the keys SCANned more than once within its window.
+// Done, when set, skips the keys completed by previous runs, before DUMP.
+// Sort reads the SCANned keys sorted, up to MaxKeys of them, see readSorted.
+// Slot, unless NoSlot, reads the keys of a Redis Cluster hash slot in place of
+// SCAN, see readSlot.
+// Replace, when set, rewrites string values, read with GET in place of DUMP.
+// ReplaceEncoding checks the encoding of the int encoded strings Replace
+// changes, see replaceEncoding.
+// Conversions convert the keys they match to another type, read as commands
+// recreating them converted, see Converter.
+// StreamGroups recreates the consumer groups of stream keys, with Commands.
+// Types reads each key type with TYPE, an extra round trip, into Payloads.
+// SkipModules, when set, are the names of modules the keys of which are
+// skipped, read with TYPE, see ModuleTypes, as are the keys of SkipTypes,
+// TYPE names. Skipped, when set, lists their keys, for -keys-from-file.
+// SkipFiles, when set, lists the keys skipped per reason, for follow-up runs
+// of each, see SkipReasons.
+// MaxIdle, when set, skips keys not accessed for longer.
+// Refresh, when set, reads string keys with GETEX, as commands, refreshing
+// their TTL on the source to it, persistent ones included. Other keys are
+// DUMPed.
+// MaxInFlight bounds the keys read concurrently, DUMPed to pushed to the Bus,
+// serially when 0 or 1, see inFlight.
+// MinSize, when set, skips keys whose DUMP payload is shorter, as empty ones
+// always are: keys being deleted while read.
+// LargeSize, when set, warns of keys read with values at least that large,
+// with their OBJECT ENCODING with LargeEncoding, see warnLarge.
+// Existing, when set, is the target: keys it already has are skipped, checked
+// with EXISTS before DUMP.
+// DryRun, when set, lists the keys read in place of DUMPing them.
+// Throttle, when set, paces the keys read to the source load.
+// DB, when set, is the database read, the DB of the Payloads read.
+// Name, when set, identifies the source read, the Source of the Payloads read,
+// restored ones being counted by Source, e.g. restored-from-<name>.
+// Hashtag, when set, wraps the first group it captures in the key names
+// restored in braces, as their Redis Cluster hashtag, see hashtag.
+// RenameAtomic restores the keys renamed, their Original name set, and
+// deletes their Original name in a single Lua script, for a live target not
+// to hold both names, or neither, at any time. See renameScript.
+// Shadow is an optional key template, e.g. "{key}:shadow", keys are
+// COPY'd to after being restored.
+// Script is an optional Lua script, run on keys after being restored.
+// Via, when set, is an intermediate Redis DUMP payloads are re-serialized
+// through before RESTORE, see redump.
+// PersistMinusOne restores the Payloads of TTL -1, the PTTL of persistent
+// keys, e.g. in files of other tools, persistent, in place of skipping them.
+// DefaultTTL, when set, expires persistent keys on the target, keys with a TTL
+// keeping theirs.
+// TTLRules, when set, set the TTL of the keys restored matching them, the
+// first one matching winning over DefaultTTL, see ruleTTL.
+// Jitter, when set, adds a random offset to the TTL of keys expiring.
+// Stage, when set, is a staging hash Payloads are written to, under their
+// key name, in place of RESTORE, for review. See readStaged.
+// Staged, when set, is a staging hash read in place of SCAN by Read, and
+// keys restored from are deleted from by Write, to promote staged keys.
+// Verify, when set, re-DUMPs sampled keys once restored, to compare them.
+// TTLTolerance is the TTL difference of keys expiring at the same time, read
+// apart, in Compare, Verify and Conflict.
+// Audit, when set, gets an entry per restored key.
+// Bloom, when set, gets the name of each restored key added.
+// Completed, when set, gets the name of each restored key appended.
+// Records, when set, gets a record per key restored, skipped or failed.
+// Provenance, when set, records the batch and time each key was restored.
+// Balance, when set, tracks the restored keys per Redis Cluster node.
+// SkipExisting restores without REPLACE, skipping keys already on the target.
+// NoReplace restores without REPLACE too, keys already on the target failing
+// with BUSYKEY errors.
+// Conflict, when set, decides whether keys existing on the target are replaced.
+// Newer, when set, decides it for string keys, from both values, once
+// Conflict let the source win.
+// Asking restores with ASKING, into a cluster node importing the keys slot.
+// DeadLetter, when set, retries failed RESTOREs up to MaxRetries times, then
+// writes the key to it, under its source name, and skips it.
+// RetryBudget, when set, caps the time spent restoring a key across retries.
+// ContinueOnError logs and counts RESTORE errors instead of aborting.
+// QuietErrors counts the per-key error and skip lines in place of logging
+// them, see logError.
+// Metadata, when set, is the policy of LRU/LFU metadata RESTORE would refuse,
+// see MetadataPolicies.
+// OOM, when set, is the policy of RESTOREs refused for lack of memory, see
+// OOMPolicies, retrying up to OOMRetries times from OOMBackoff.
+// DrainTimeout, when set, bounds the time Write keeps restoring the Payloads
+// already on the Bus once the context is done, see drain.
+// BulkLimit, when set, is the target proto-max-bulk-len, payloads over it
+// handled per its Policy, see overBulkLimit.
+// Pipeline, when set, batches RESTOREs in pipelines sent per its Flush
+// policy, see writePipelined.
+// Breaker, when set, aborts ContinueOnError runs after Max consecutive failures of the writers sharing it.
+// FailFast, when set, aborts all writers sharing it on the first error.
+// ReplLag, when set, pauses writes while the target replicas lag behind.
+// Move, when set, deletes the keys restored from the source, paced.
+// Limiter throttles writes, it can be shared by several writers, e.g. those
+// of a destination. AggregateLimiter throttles them too, waited for after
+// Limiter, shared by the writers of all destinations to cap their sum.
+// ByteLimiter throttles writes by payload size, in bytes, as Limiter.
+// Latency times the read and the RESTORE of each key, logged per key and
+// summed up as percentiles in the Summary.
+// Rename maps command names to the names they're renamed to on the server,
+// with rename-command, e.g. DUMP to a random string.
+// Summary collects the run counters.
 type Redis struct {
-	Pool   *radix.Pool
-	Bus    message.Bus
-	Silent bool
-	TTL    bool
+	Pool             radix.Client
+	Bus              message.Bus
+	Silent           bool
+	LogEvery         int
+	TTL              bool
+	Commands         bool
+	TTLOnly          bool
+	Filter           filter.Filter
+	ValueMatch       *regexp.Regexp
+	ValueOthers      bool
+	ScanCount        int
+	KeysStream       *KeysStream
+	KeysChannel      *KeysChannel
+	Keys             []string
+	KeySource        KeySource
+	Checkpoint       *Checkpoint
+	Dedup            *Dedup
+	Done             *Done
+	Sort             bool
+	MaxKeys          int
+	Slot             int
+	Replace          *strings.Replacer
+	ReplaceEncoding  bool
+	Conversions      []Conversion
+	Types            bool
+	SkipModules      map[string]bool
+	SkipTypes        map[string]bool
+	Skipped          *DeadLetter
+	SkipFiles        *SkipFiles
+	StreamGroups     bool
+	MaxIdle          time.Duration
+	Refresh          time.Duration
+	MaxInFlight      int
+	MinSize          int
+	LargeSize        int
+	LargeEncoding    bool
+	Existing         *Redis
+	DryRun           *DryRun
+	Throttle         *Throttle
+	DB               string
+	Name             string
+	Hashtag          *regexp.Regexp
+	RenameAtomic     bool
+	Shadow           string
+	Script           *Script
+	Via              radix.Client
+	PersistMinusOne  bool
+	DefaultTTL       time.Duration
+	TTLRules         []TTLRule
+	Jitter           *Jitter
+	Stage            string
+	Staged           string
+	Verify           *Verifier
+	TTLTolerance     time.Duration
+	Audit            *audit.Log
+	Bloom            *bloom.Filter
+	Completed        *Completed
+	Records          *records.Log
+	Provenance       *Provenance
+	Balance          *Balance
+	SkipExisting     bool
+	NoReplace        bool
+	Conflict         Conflict
+	Newer            Newer
+	Asking           bool
+	DeadLetter       *DeadLetter
+	MaxRetries       int
+	RetryBudget      time.Duration
+	ContinueOnError  bool
+	QuietErrors      bool
+	Metadata         string
+	OOM              string
+	OOMRetries       int
+	OOMBackoff       time.Duration
+	DrainTimeout     time.Duration
+	BulkLimit        *BulkLimit
+	Pipeline         *Flush
+	Breaker          *Breaker
+	FailFast         *FailFast
+	ReplLag          *ReplLag
+	Move             *Mover
+	Limiter          *ratelimit.Limiter
+	AggregateLimiter *ratelimit.Limiter
+	ByteLimiter      *ratelimit.Limiter
+	Rename           map[string]string
+	Latency          bool
+	Summary          *summary.Summary
+
+	// secondsTTL is set to 1 once PTTL failed, TTL is then used instead.
+	// Atomic, keys may be read concurrently, see MaxInFlight.
+	secondsTTL int32
+
+	// scriptLoaded is set once Script is in the target script cache.
+	scriptLoaded bool
+
+	// aclUser names the user of NOPERM errors, see aclError.
+	aclUser string
+
+	// logged counts the keys logKey was called for, atomic.
+	logged int64
 }
 
 // New creates the Redis struct, used to read/write.
-func New(source *radix.Pool, bus message.Bus, silent, ttl bool) *Redis {
+func New(source radix.Client, bus message.Bus, silent, ttl bool) *Redis {
 	return &Redis{
-		Pool:   source,
-		Bus:    bus,
-		Silent: silent,
-		TTL:    ttl,
+		Pool:         source,
+		Bus:          bus,
+		Silent:       silent,
+		TTL:          ttl,
+		Slot:         NoSlot,
+		TTLTolerance: DefaultTTLTolerance,
 	}
 }
 
+// logKey logs a per-key line, unless Silent, for every LogEvery key.
+func (r *Redis) logKey(format string, args ...interface{}) {
+	n := atomic.AddInt64(&r.logged, 1)
+	if r.LogEvery > 1 && n%int64(r.LogEvery) != 0 {
+		return
+	}
+	r.maybeLog(fmt.Sprintf(format, args...))
+}
+
 // maybeLog may log, depending on the Silent flag
 func (r *Redis) maybeLog(s string) {
 	if r.Silent {
@@ -39,6 +273,41 @@ func (r *Redis) maybeLog(s string) {
 	fmt.Print(s)
 }
 
+// cmd returns the name of command on the server, per Rename.
+func (r *Redis) cmd(command string) string {
+	if name, ok := r.Rename[strings.ToUpper(command)]; ok {
+		return name
+	}
+
+	return command
+}
+
+// timed records the time since start of the op on key, with Latency, logged
+// unless Silent.
+func (r *Redis) timed(op, key string, start time.Time) {
+	if !r.Latency {
+		return
+	}
+
+	d := time.Since(start)
+	r.Summary.Time(op, d)
+	r.maybeLog(fmt.Sprintf("redis: %s %s => %s\n", op, message.FormatKey(key), d))
+}
+
+// usesSeconds reports whether PTTL failed, TTL being used instead.
+func (r *Redis) usesSeconds() bool {
+	return atomic.LoadInt32(&r.secondsTTL) == 1
+}
+
+// errVanished is returned by maybeTTL for keys PTTL reports as missing,
+// expired or deleted since read: they're skipped.
+var errVanished = errors.New("key does not exist")
+
+// errExpired is returned by maybeTTL and dumpTTL for keys of an expiration
+// already due, PTTL 0, still listed and read until Redis evicts them: they're
+// skipped, rather than restored without expiration.
+var errExpired = errors.New("key expired")
+
 // maybeTTL may sync the TTL, depending on the TTL flag
 func (r *Redis) maybeTTL(key string) (string, error) {
 	// noop if TTL is disabled, speeds up sync process
@@ -48,21 +317,311 @@ func (r *Redis) maybeTTL(key string) (string, error) {
 
 	var ttl string
 
-	// Try getting key TTL.
-	err := r.Pool.Do(radix.Cmd(&ttl, "PTTL", key))
-	if err != nil {
-		return ttl, fmt.Errorf("error calling PTTL for key '%s': %W", key, err)
+	// Try getting key TTL, unless PTTL already failed.
+	if !r.usesSeconds() {
+		err := r.Pool.Do(radix.Cmd(&ttl, r.cmd("PTTL"), key))
+		if err != nil && atomic.CompareAndSwapInt32(&r.secondsTTL, 0, 1) {
+			fmt.Printf("redis: PTTL failed, falling back to TTL in seconds; error=%s\n", err)
+			r.Summary.Note("PTTL unavailable, TTLs synced with seconds precision")
+		}
+	}
+
+	if r.usesSeconds() {
+		var err error
+		ttl, err = r.secondsToMillis(key)
+		if err != nil {
+			return ttl, err
+		}
 	}
 
 	// When key has no expire PTTL returns "-1".
 	// We set it to 0, default for no expiration time.
-	if ttl == "-1" {
+	// "-2" is a missing key, the payload already read would restore it
+	// with a negative TTL.
+	switch ttl {
+	case "-1":
 		ttl = "0"
+	case "-2":
+		return "", errVanished
+	case "0":
+		return "", errExpired
 	}
 
 	return ttl, nil
 }
 
+// skipExpired counts and logs a key skipped as errExpired.
+func (r *Redis) skipExpired(key string) {
+	r.Summary.Incr("expired-skipped")
+	r.maybeLog(fmt.Sprintf("redis: skipped %s, expired but not yet evicted\n", message.FormatKey(key)))
+}
+
+// dumpTTL reads the key DUMP payload and PTTL, pipelined in a single round
+// trip. PTTL errors go through maybeTTL fallback, DUMP errors are returned.
+func (r *Redis) dumpTTL(key string) (string, string, error) {
+	var value, ttl string
+	dump, pttl := &reply{rcv: &value}, &reply{rcv: &ttl}
+
+	err := r.Pool.Do(radix.Pipeline(
+		radix.Cmd(dump, r.cmd("DUMP"), key),
+		radix.Cmd(pttl, r.cmd("PTTL"), key),
+	))
+	if err == nil {
+		err = dump.err
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	if pttl.err != nil {
+		ttl, err = r.maybeTTL(key)
+		return value, ttl, err
+	}
+
+	// No expiration, and missing keys with a payload, as in maybeTTL. Keys
+	// missing before DUMP have none, and keep "-2".
+	switch {
+	case ttl == "-1":
+		ttl = "0"
+	case ttl == "-2" && value != "":
+		return value, "", errVanished
+	case ttl == "0" && value != "":
+		return value, "", errExpired
+	}
+
+	return value, ttl, nil
+}
+
+// secondsToMillis gets the key TTL in seconds, converted to milliseconds.
+// Used in place of PTTL, when unavailable.
+func (r *Redis) secondsToMillis(key string) (string, error) {
+	var seconds int64
+	err := r.Pool.Do(radix.Cmd(&seconds, r.cmd("TTL"), key))
+	if err != nil {
+		return "", fmt.Errorf("error calling TTL for key %s: %w", message.FormatKey(key), err)
+	}
+
+	// Keep -1 (no expire) and -2 (missing key) as PTTL returns them.
+	if seconds < 0 {
+		return strconv.FormatInt(seconds, 10), nil
+	}
+
+	return strconv.FormatInt(seconds*1000, 10), nil
+}
+
+// shadowKey returns the shadow key name for key, using the Shadow template.
+func (r *Redis) shadowKey(key string) string {
+	return strings.Replace(r.Shadow, "{key}", key, -1)
+}
+
+// maybeShadow may COPY a restored key to its shadow key,
+// depending on the Shadow template.
+// Shadowing is disabled for the rest of the run if COPY isn't supported.
+func (r *Redis) maybeShadow(key string) error {
+	if r.Shadow == "" {
+		return nil
+	}
+
+	shadow := r.shadowKey(key)
+	err := r.Pool.Do(radix.Cmd(nil, r.cmd("COPY"), key, shadow, "REPLACE"))
+	if err != nil && strings.Contains(err.Error(), "unknown command") {
+		fmt.Println("redis: COPY not supported, disabling shadow keys")
+		r.Summary.Note("shadow keys disabled, COPY requires Redis 6.2")
+		r.Shadow = ""
+		return nil
+	}
+	if cerr := clusterError(key, err); cerr != nil {
+		return cerr
+	}
+	if err != nil {
+		return fmt.Errorf("error copying key %s to %s: %w", message.FormatKey(key), message.FormatKey(shadow), err)
+	}
+
+	r.Summary.Incr("shadowed")
+	fmt.Printf("redis: COPY %s => %s\n", message.FormatKey(key), message.FormatKey(shadow))
+
+	return nil
+}
+
+// exists reports whether key exists, with EXISTS.
+func (r *Redis) exists(key string) (bool, error) {
+	var n int
+	if err := r.Pool.Do(radix.Cmd(&n, r.cmd("EXISTS"), key)); err != nil {
+		return false, fmt.Errorf("error calling EXISTS for key %s: %w", message.FormatKey(key), err)
+	}
+
+	return n > 0, nil
+}
+
+// isIdle reports whether key was not accessed for longer than MaxIdle,
+// using OBJECT IDLETIME.
+// IDLETIME isn't tracked with an LFU maxmemory-policy, the filter is then
+// disabled for the rest of the run and all keys are kept.
+func (r *Redis) isIdle(key string) bool {
+	if r.MaxIdle == 0 {
+		return false
+	}
+
+	var seconds int64
+	err := r.Pool.Do(radix.Cmd(&seconds, r.cmd("OBJECT"), "IDLETIME", key))
+	if err != nil {
+		fmt.Printf("redis: OBJECT IDLETIME failed, disabling idle filter; error=%s\n", err)
+		r.Summary.Note("idle filter disabled, OBJECT IDLETIME unavailable")
+		r.MaxIdle = 0
+		return false
+	}
+
+	return time.Duration(seconds)*time.Second > r.MaxIdle
+}
+
+// excluded reports whether key fails rule, the Filter KeepRule or
+// SelectsRule, counting excluded keys in total and by rule.
+func (r *Redis) excluded(key string, rule func(string) string) bool {
+	name := rule(key)
+	if name == "" {
+		return false
+	}
+	r.Summary.Incr("excluded")
+	r.Summary.Incr("excluded-" + name)
+
+	return true
+}
+
+// scanOpts returns the SCAN options, matching the Filter pattern.
+func (r *Redis) scanOpts() radix.ScanOpts {
+	return radix.ScanOpts{
+		Command: r.cmd("SCAN"),
+		Pattern: r.Filter.Pattern(),
+		Count:   r.ScanCount,
+	}
+}
+
+// readKey dumps a key, with its TTL, as a Payload on the message Bus.
+func (r *Redis) readKey(ctx context.Context, key string) error {
+	if r.Done.Has(key) {
+		r.Summary.Incr("skipped-completed")
+		return nil
+	}
+	if r.Existing != nil {
+		exists, err := r.Existing.exists(key)
+		if err != nil {
+			return err
+		}
+		if exists {
+			r.Summary.Incr("skipped-existing")
+			return nil
+		}
+	}
+	// Only fails once ctx is done
+	if err := r.Throttle.wait(ctx); err != nil {
+		return err
+	}
+	if r.ValueMatch != nil {
+		matches, err := r.valueMatches(key)
+		if err != nil || !matches {
+			return err
+		}
+	}
+	if r.DryRun != nil {
+		return r.dryRun(key)
+	}
+	if r.TTLOnly {
+		return r.readTTL(ctx, key)
+	}
+
+	var value string
+	var ttl string
+
+	// With Replace, strings are read as commands too, to be rewritten, or
+	// with GETEX to Refresh them, as are the keys of the Conversions.
+	commands := r.Commands
+	var keyType string
+	var conv Converter
+	var err error
+	if r.Commands || r.Replace != nil || r.Types || r.Refresh > 0 || len(r.Conversions) > 0 || len(r.SkipModules) > 0 || len(r.SkipTypes) > 0 {
+		keyType, err = r.keyType(key)
+		commands = r.Commands || (keyType == "string" && (r.Replace != nil || r.Types || r.Refresh > 0))
+	}
+	if err == nil && r.skipType(key, keyType) {
+		return nil
+	}
+	if err == nil && len(r.Conversions) > 0 {
+		conv = r.converter(key, keyType)
+		commands = commands || conv != nil
+	}
+
+	// With TTL sync, DUMP and PTTL share a round trip.
+	pipelined := !commands && r.TTL && !r.usesSeconds()
+
+	start := time.Now()
+	switch {
+	case err != nil:
+	case conv != nil:
+		value, err = r.convert(key, conv)
+		keyType = conv.To()
+	case commands:
+		value, err = r.logical(key, keyType)
+	case pipelined:
+		value, ttl, err = r.dumpTTL(key)
+	default:
+		err = r.Pool.Do(radix.Cmd(&value, r.cmd("DUMP"), key))
+	}
+	r.timed("read-latency", key, start)
+	if cerr := clusterError(key, err); cerr != nil {
+		return cerr
+	}
+	if err != nil && err != errVanished && err != errExpired {
+		return fmt.Errorf("error reading key %s from redis: %w", message.FormatKey(key), err)
+	}
+
+	// Key deleted since listed, nothing to restore.
+	if value == "" || (!commands && len(value) < r.MinSize) {
+		r.Summary.Incr("skipped-empty")
+		r.maybeLog(fmt.Sprintf("redis: skipped empty %s, size=%d\n", message.FormatKey(key), len(value)))
+		return nil
+	}
+
+	if !pipelined {
+		ttl, err = r.maybeTTL(key)
+	}
+	// Key expired, or deleted, between its read and PTTL.
+	if err == errVanished {
+		r.Summary.Incr("race-deleted")
+		r.maybeLog(fmt.Sprintf("redis: skipped %s, deleted while read\n", message.FormatKey(key)))
+		return nil
+	}
+	if err == errExpired {
+		r.skipExpired(key)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error syncing ttl for key %s: %w", message.FormatKey(key), err)
+	}
+
+	if err := r.warnLarge(key, keyType, len(value)); err != nil {
+		return err
+	}
+
+	if commands {
+		value += expireCommand(key, ttl)
+	}
+
+	select {
+	case <-ctx.Done():
+		fmt.Println("redis: done reading")
+		err := ctx.Err()
+		if err != nil {
+			return fmt.Errorf("error reading from redis: %w", err)
+		}
+		return nil
+	case r.Bus <- message.Payload{Key: key, Value: value, TTL: ttl, Commands: commands, Type: keyType, DB: r.DB, Source: r.Name}:
+		r.Summary.Incr("dumped")
+		r.logKey("redis: DUMP %s => ttl=%s, size=%d\n", message.FormatKey(key), ttl, len(value))
+	}
+
+	return nil
+}
+
 // Read gently scans an entire Redis DB for keys, then dumps
 // the key/value pair (Payload) on the message Bus channel.
 // It leverages implicit pipelining to speedup large DB reads.
@@ -70,52 +629,446 @@ func (r *Redis) maybeTTL(key string) (string, error) {
 func (r *Redis) Read(ctx context.Context) error {
 	defer close(r.Bus)
 
-	scanner := radix.NewScanner(r.Pool, radix.ScanAllKeys)
+	if r.KeysStream != nil {
+		return r.readStream(ctx)
+	}
+	if r.KeysChannel != nil {
+		return r.readChannel(ctx)
+	}
+	if r.Slot != NoSlot {
+		return r.readSlot(ctx)
+	}
+	if r.Keys != nil {
+		return r.readKeys(ctx)
+	}
+	if r.Staged != "" {
+		return r.readStaged(ctx)
+	}
+	if r.Sort {
+		return r.readSorted(ctx)
+	}
 
-	var key string
-	var value string
-	var ttl string
+	// SCAN MATCHes server-side, other sources are filtered client-side.
+	source, rule := r.KeySource, r.Filter.SelectsRule
+	switch {
+	case source == nil && r.Checkpoint != nil:
+		source = &cursorSource{r: r, c: r.Checkpoint, cursor: r.Checkpoint.Cursor()}
+		rule = r.Filter.KeepRule
+	case source == nil:
+		source = &scanSource{radix.NewScanner(r.Pool, r.scanOpts())}
+		rule = r.Filter.KeepRule
+	}
+
+	reads := r.newInFlight(ctx)
 
 	// Scan and push to bus until no keys are left.
 	// If context Done, exit early.
-	for scanner.Next(&key) {
-		err := r.Pool.Do(radix.Cmd(&value, "DUMP", key))
+	for {
+		key, ok, err := source.Next(ctx)
 		if err != nil {
-			return fmt.Errorf("error reading key '%s' from redis: %W", key, err)
+			reads.wait()
+			return err
+		}
+		if !ok {
+			break
 		}
 
-		ttl, err = r.maybeTTL(key)
-		if err != nil {
-			return fmt.Errorf("error syncing ttl for key '%s': %W", key, err)
+		if r.duplicate(key) {
+			continue
+		}
+		if r.excluded(key, rule) {
+			continue
 		}
 
-		select {
-		case <-ctx.Done():
-			fmt.Println("redis: done reading")
-			err := ctx.Err()
+		if r.isIdle(key) {
+			r.Summary.Incr("idle")
+			continue
+		}
+
+		if err := reads.read(key); err != nil {
+			return err
+		}
+	}
+
+	return reads.wait()
+}
+
+// restore restores a single Payload, skipping it if invalid.
+func (r *Redis) restore(p message.Payload) error {
+	pd, err := r.prepare(p)
+	if pd == nil {
+		return err
+	}
+
+	r.Balance.pace(pd.key)
+	start := time.Now()
+	return r.restored(pd, r.retryRestore(pd), start)
+}
+
+// pending is the RESTORE of a Payload, its arguments, the value and the TTL
+// restored, once prepared, and the payload read, before its redump.
+type pending struct {
+	key      string
+	ttl      int64
+	value    string
+	read     string
+	args     []string
+	source   string
+	original string
+	typ      string
+}
+
+// sourceKey is the name on the source of key, its original name when
+// renamed since read, e.g. prefixed or tagged.
+func sourceKey(key, original string) string {
+	if original != "" {
+		return original
+	}
+
+	return key
+}
+
+// prepare returns the RESTORE of p, nil for Payloads skipped or restored
+// otherwise, e.g. tombstones, with the error, if any, of doing so.
+func (r *Redis) prepare(p message.Payload) (*pending, error) {
+	if r.Hashtag != nil {
+		key, err := r.hashtag(p.Key)
+		if err == nil && p.Commands {
+			err = fmt.Errorf("error tagging key %s: its commands hold its name", message.FormatKey(p.Key))
+		}
+		switch {
+		case err != nil && r.ContinueOnError:
+			r.logError("redis: error tagging key %s, continuing; error=%s\n", message.FormatKey(p.Key), err)
+			return nil, r.failed(p.Key, err)
+		case err != nil:
+			return nil, err
+		}
+		if key != p.Key && p.Original == "" {
+			p.Original = p.Key
+		}
+		p.Key = key
+	}
+	r.Summary.Track(p.Key)
+	if r.TTLOnly {
+		return nil, r.restoreTTL(p)
+	}
+
+	// Keys deleted since the base of an incremental dump
+	if p.Tombstone {
+		if err := r.Pool.Do(radix.Cmd(nil, r.cmd("DEL"), p.Key)); err != nil {
+			return nil, fmt.Errorf("error deleting tombstoned key %s: %w", message.FormatKey(p.Key), err)
+		}
+		r.Summary.Incr("tombstoned")
+		r.logKey("redis: DEL %s\n", message.FormatKey(p.Key))
+		return nil, nil
+	}
+
+	if r.Stage != "" {
+		return nil, r.stage(p)
+	}
+
+	if r.Commands {
+		defer r.timed("restore-latency", p.Key, time.Now())
+		if err := r.replay(p); err != nil {
+			return nil, err
+		}
+		r.Balance.add(p.Key)
+		r.Bloom.Add(p.Key)
+		if err := r.Completed.Add(sourceKey(p.Key, p.Original)); err != nil {
+			return nil, err
+		}
+		if err := r.tag(p.Key, parseTTL(p.TTL)); err != nil {
+			return nil, err
+		}
+		return nil, r.audit(p.Key, len(p.Value), p.TTL)
+	}
+
+	// Rewritten string keys
+	if p.Commands {
+		if err := r.replay(p); err != nil {
+			return nil, err
+		}
+		if ttl := r.withDefaultTTL(p.TTL); ttl != p.TTL {
+			err := r.Pool.Do(radix.Cmd(nil, r.cmd("PEXPIRE"), p.Key, ttl))
 			if err != nil {
-				return fmt.Errorf("error reading from redis: %W", err)
+				return nil, fmt.Errorf("error setting default TTL of key %s: %w", message.FormatKey(p.Key), err)
 			}
-			return nil
-		case r.Bus <- message.Payload{Key: key, Value: value, TTL: ttl}:
-			fmt.Printf("redis: DUMP %s => ttl=%s, size=%d\n", key, ttl, len(value))
 		}
+		r.Balance.add(p.Key)
+		r.Bloom.Add(p.Key)
+		if err := r.Completed.Add(sourceKey(p.Key, p.Original)); err != nil {
+			return nil, err
+		}
+		if err := r.tag(p.Key, parseTTL(r.withDefaultTTL(p.TTL))); err != nil {
+			return nil, err
+		}
+		if err := r.audit(p.Key, len(p.Value), r.withDefaultTTL(p.TTL)); err != nil {
+			return nil, err
+		}
+		if err := r.maybeShadow(p.Key); err != nil {
+			return nil, err
+		}
+		if err := r.maybeScript(p.Key); err != nil {
+			return nil, err
+		}
+		return nil, r.unstage(p.Key)
 	}
 
-	return scanner.Close()
+	// RESTORE refuses empty payloads, e.g. of truncated dump records
+	if p.Value == "" {
+		r.Summary.Incr("empty-value")
+		r.logError("redis: skipping key %s with an empty value\n", message.FormatKey(p.Key))
+		return nil, r.skipped(p, "empty-value")
+	}
+	if over, err := r.overBulkLimit(p); over || err != nil {
+		return nil, err
+	}
+
+	// validate and sanitize TTL
+	parsedTTL, err := strconv.ParseInt(p.TTL, 10, 64)
+	if err != nil {
+		r.Summary.Incr("invalid-ttl")
+		r.logError("redis: skipping key %s with invalid TTL \"%s\"; error=%s\n", message.FormatKey(p.Key), p.TTL, err)
+		return nil, r.skipped(p, "invalid-ttl")
+	} else if parsedTTL == -1 && r.PersistMinusOne {
+		r.Summary.Incr("ttl-minus-one-persisted")
+		p.TTL = "0"
+	} else if parsedTTL < 0 {
+		r.Summary.Incr("invalid-ttl")
+		r.logError("redis: skipping key %s with invalid TTL \"%s\"\n", message.FormatKey(p.Key), p.TTL)
+		return nil, r.skipped(p, "invalid-ttl")
+	}
+	if ttl, ok := r.ruleTTL(p.Key, p.TTL); ok {
+		p.TTL = ttl
+	} else {
+		p.TTL = r.withDefaultTTL(p.TTL)
+	}
+	parsedTTL, _ = strconv.ParseInt(p.TTL, 10, 64)
+	if jittered := r.Jitter.Add(parsedTTL); jittered != parsedTTL {
+		parsedTTL, p.TTL = jittered, strconv.FormatInt(jittered, 10)
+		r.Summary.Incr("jittered")
+	}
+
+	wins, err := r.sourceWins(p.Key, parsedTTL)
+	if err == nil && wins {
+		wins, err = r.newer(p.Key, p.Value)
+	}
+	switch {
+	case err != nil && r.ContinueOnError:
+		r.logError("redis: error resolving conflict for key %s, continuing; error=%s\n", message.FormatKey(p.Key), err)
+		return nil, r.failed(p.Key, err)
+	case err != nil:
+		return nil, err
+	case !wins:
+		r.Summary.Incr("kept-target")
+		r.logError("redis: keeping target key %s\n", message.FormatKey(p.Key))
+		return nil, r.skipped(p, "kept-target")
+	}
+
+	value, err := r.redump(p)
+	switch {
+	case err != nil && r.ContinueOnError:
+		r.logError("redis: error re-serializing key %s via the intermediate, continuing; error=%s\n", message.FormatKey(p.Key), err)
+		return nil, r.failed(p.Key, err)
+	case err != nil:
+		return nil, err
+	}
+
+	args := []string{p.Key, p.TTL, value}
+	if !r.SkipExisting && !r.NoReplace {
+		args = append(args, "REPLACE")
+	}
+	args = append(args, r.metadata(p)...)
+
+	return &pending{key: p.Key, ttl: parsedTTL, value: value, read: p.Value, args: args, source: p.Source, original: p.Original, typ: p.Type}, nil
+}
+
+// restored handles the outcome of the RESTORE of pd, err, started at start,
+// its retries, skips and failures, or the follow-ups of restored keys.
+func (r *Redis) restored(pd *pending, err error, start time.Time) error {
+	if r.isOOM(err) {
+		err = r.oom(pd, err)
+	}
+	r.timed("restore-latency", pd.key, start)
+	if cerr := clusterError(pd.key, err); cerr != nil {
+		r.record(pd, "failed", cerr)
+		return cerr
+	}
+	switch {
+	case err == errOOMSkipped:
+		return r.record(pd, "oom-skipped", nil)
+	// A half-migrated target, rather than every other key failing the same way
+	case errors.Is(err, ErrOOM):
+		r.record(pd, "failed", err)
+		return err
+	}
+	denied := hasCode(err, "NOPERM")
+	if denied {
+		err = r.aclError(pd.key, err)
+	}
+	switch {
+	// Without REPLACE, existing keys are expected and skipped.
+	case hasCode(err, "BUSYKEY") && r.SkipExisting:
+		r.Summary.Incr("skipped-existing")
+		r.logError("redis: skipping existing key %s\n", message.FormatKey(pd.key))
+		if err := r.SkipFiles.Add(SkipBusyKey, sourceKey(pd.key, pd.original), err); err != nil {
+			return err
+		}
+		return r.record(pd, "skipped-existing", nil)
+	case err != nil && r.DeadLetter != nil:
+		r.logError("redis: error restoring key %s, dead-lettered; error=%s\n", message.FormatKey(pd.key), err)
+		r.Summary.Incr("dead-lettered")
+		if err := r.record(pd, "dead-lettered", err); err != nil {
+			return err
+		}
+		return r.DeadLetter.Add(sourceKey(pd.key, pd.original), err)
+	// Keys outside the ACL key patterns say nothing of the target health.
+	case denied && r.ContinueOnError:
+		r.logError("redis: skipping key %s, denied by ACL; error=%s\n", message.FormatKey(pd.key), err)
+		r.Summary.Incr("noperm")
+		return r.record(pd, "noperm", err)
+	case err != nil && r.ContinueOnError:
+		r.logError("redis: error restoring key %s, continuing; error=%s\n", message.FormatKey(pd.key), err)
+		return r.failed(pd.key, err)
+	case err != nil:
+		r.record(pd, "failed", err)
+		return fmt.Errorf("error restoring key %s: %w", message.FormatKey(pd.key), err)
+	}
+
+	r.succeeded()
+	r.Summary.Incr("restored")
+	if pd.source != "" {
+		r.Summary.Incr("restored-from-" + pd.source)
+	}
+	if r.RenameAtomic && pd.original != "" && pd.original != pd.key {
+		r.Summary.Incr("renamed-atomically")
+	}
+	if err := r.record(pd, "restored", nil); err != nil {
+		return err
+	}
+	r.Balance.add(pd.key)
+	r.Bloom.Add(pd.key)
+	if err := r.Completed.Add(sourceKey(pd.key, pd.original)); err != nil {
+		return err
+	}
+	r.logKey("redis: RESTORE %s ttl=%d \n", message.FormatKey(pd.key), pd.ttl)
+	if err := r.tag(pd.key, pd.ttl); err != nil {
+		return err
+	}
+	if err := r.Audit.Add(pd.key, len(pd.value), pd.ttl); err != nil {
+		return err
+	}
+
+	verified, err := r.verify(pd.key, pd.value, pd.ttl)
+	if err != nil {
+		return err
+	}
+	if err := r.maybeShadow(pd.key); err != nil {
+		return err
+	}
+	if err := r.maybeScript(pd.key); err != nil {
+		return err
+	}
+	if err := r.unstage(pd.key); err != nil {
+		return err
+	}
+
+	return r.move(pd, verified)
+}
+
+// record adds the Record of pd, with status and err, if any, to Records.
+func (r *Redis) record(pd *pending, status string, err error) error {
+	rec := records.Record{Key: pd.key, Type: pd.typ, Size: len(pd.value), TTL: pd.ttl, Status: status}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+
+	return r.Records.Add(rec)
+}
+
+// skipped adds the Record of p, skipped before RESTORE, to Records.
+func (r *Redis) skipped(p message.Payload, status string) error {
+	if err := r.SkipFiles.addStatus(status, sourceKey(p.Key, p.Original)); err != nil {
+		return err
+	}
+
+	return r.Records.Add(records.Record{Key: p.Key, Type: p.Type, Size: len(p.Value), Status: status})
+}
+
+// audit adds the Audit entry of a replayed key, ttl in milliseconds as in
+// Payloads.
+func (r *Redis) audit(key string, size int, ttl string) error {
+	return r.Audit.Add(key, size, parseTTL(ttl))
+}
+
+// parseTTL parses a Payload TTL in milliseconds, 0 when invalid.
+func parseTTL(ttl string) int64 {
+	parsed, _ := strconv.ParseInt(ttl, 10, 64)
+	return parsed
+}
+
+// viaPrefix prefixes keys on the Via intermediate, to stay clear of its own.
+const viaPrefix = "rump:via:"
+
+// redump returns the DUMP payload of p as serialized by Via: RESTOREd there,
+// DUMPed at the Via RDB version, then deleted. It's the payload itself
+// without Via.
+func (r *Redis) redump(p message.Payload) (string, error) {
+	if r.Via == nil {
+		return p.Value, nil
+	}
+
+	key := viaPrefix + p.Key
+	err := r.Via.Do(radix.Cmd(nil, "RESTORE", key, "0", p.Value, "REPLACE"))
+	if err != nil {
+		return "", fmt.Errorf("error restoring key %s on the intermediate: %w", message.FormatKey(p.Key), err)
+	}
+
+	var value string
+	err = r.Via.Do(radix.Cmd(&value, "DUMP", key))
+	if derr := r.Via.Do(radix.Cmd(nil, "DEL", key)); err == nil {
+		err = derr
+	}
+	if err != nil {
+		return "", fmt.Errorf("error dumping key %s from the intermediate: %w", message.FormatKey(p.Key), err)
+	}
+	r.Summary.Incr("redumped")
+
+	return value, nil
+}
+
+// withDefaultTTL returns DefaultTTL, in ms, for persistent keys when set,
+// and ttl otherwise.
+func (r *Redis) withDefaultTTL(ttl string) string {
+	if r.DefaultTTL <= 0 || ttl != "0" {
+		return ttl
+	}
+	r.Summary.Incr("default-ttl")
+
+	return strconv.FormatInt(int64(r.DefaultTTL/time.Millisecond), 10)
 }
 
 // Write restores keys on the db as they come on the message bus.
 func (r *Redis) Write(ctx context.Context) error {
+	if r.Pipeline != nil {
+		return r.writePipelined(ctx)
+	}
+
 	// Loop until channel is open
 	for r.Bus != nil {
 		select {
 		// Exit early if context done.
 		case <-ctx.Done():
 			fmt.Println("redis: done writing")
+			if err := r.FailFast.Err(); err != nil {
+				return err
+			}
+			if err := r.drain(); err != nil {
+				return err
+			}
 			err := ctx.Err()
 			if err != nil {
-				return fmt.Errorf("error writing to redis: %W", err)
+				return fmt.Errorf("error writing to redis: %w", err)
 			}
 			return nil
 		// Get Messages from Bus
@@ -126,22 +1079,30 @@ func (r *Redis) Write(ctx context.Context) error {
 				continue
 			}
 
-			// validate and sanitize TTL
-			parsedTTL, err := strconv.ParseInt(p.TTL, 10, 64)
-			if err != nil {
-				fmt.Printf("redis: skipping key \"%s\" with invalid TTL \"%s\"; error=%s\n", p.Key, p.TTL, err)
-				continue
-			} else if parsedTTL < 0 {
-				fmt.Printf("redis: skipping key \"%s\" with invalid TTL \"%s\"\n", p.Key, p.TTL)
-				continue
+			// Another writer failed first
+			if err := r.FailFast.Err(); err != nil {
+				return err
 			}
 
-			err = r.Pool.Do(radix.Cmd(nil, "RESTORE", p.Key, p.TTL, p.Value, "REPLACE"))
-			if err != nil {
-				return fmt.Errorf("error restoring key '%s': %W", p.Key, err)
+			if err := r.ReplLag.wait(ctx); err != nil {
+				return fmt.Errorf("error writing to redis: %w", err)
+			}
+			if err := r.Move.wait(ctx); err != nil {
+				return fmt.Errorf("error writing to redis: %w", err)
+			}
+			if err := r.Limiter.Wait(ctx); err != nil {
+				return fmt.Errorf("error writing to redis: %w", err)
+			}
+			if err := r.AggregateLimiter.Wait(ctx); err != nil {
+				return fmt.Errorf("error writing to redis: %w", err)
+			}
+			if err := r.ByteLimiter.WaitN(ctx, float64(len(p.Value))); err != nil {
+				return fmt.Errorf("error writing to redis: %w", err)
 			}
 
-			fmt.Printf("redis: RESTORE %s ttl=%s \n", p.Key, p.TTL)
+			if err := r.restore(p); err != nil {
+				return r.FailFast.fail(err)
+			}
 		}
 	}
 
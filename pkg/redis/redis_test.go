@@ -1,16 +1,40 @@
 package redis_test
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"math/rand"
 	"os"
+	"path/filepath"
 	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/mediocregopher/radix/v3"
+	radixresp "github.com/mediocregopher/radix/v3/resp"
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+	"golang.org/x/sync/errgroup"
 
+	"github.com/stickermule/rump/pkg/audit"
+	"github.com/stickermule/rump/pkg/bloom"
+	"github.com/stickermule/rump/pkg/file"
+	"github.com/stickermule/rump/pkg/filter"
 	"github.com/stickermule/rump/pkg/message"
+	"github.com/stickermule/rump/pkg/ratelimit"
+	"github.com/stickermule/rump/pkg/rdb"
+	"github.com/stickermule/rump/pkg/records"
 	"github.com/stickermule/rump/pkg/redis"
+	"github.com/stickermule/rump/pkg/resp"
+	"github.com/stickermule/rump/pkg/summary"
 )
 
 var db1 *radix.Pool
@@ -18,6 +42,59 @@ var db2 *radix.Pool
 var ch message.Bus
 var expected map[string]string
 
+// stub creates a fake Redis serving a single key,
+// cmds overrides the default replies by command name.
+func stub(cmds map[string]func(args []string) interface{}) radix.Client {
+	return pipelined{radix.Stub("tcp", "stub:6379", func(args []string) interface{} {
+		if fn, ok := cmds[args[0]]; ok {
+			ret := fn(args)
+			// Reply errors as Redis does, rather than failing the whole pipeline.
+			if err, ok := ret.(error); ok {
+				return resp2.Error{E: err}
+			}
+			return ret
+		}
+		switch args[0] {
+		case "SCAN":
+			return []interface{}{"0", []string{"key1"}}
+		case "DUMP":
+			return "value1"
+		case "PTTL":
+			return 30000
+		}
+		return "OK"
+	})}
+}
+
+// pipelined encodes pipelines one command at a time, the radix stub dropping
+// the commands of a pipeline following an error reply.
+type pipelined struct {
+	radix.Conn
+}
+
+func (c pipelined) Do(a radix.Action) error {
+	return a.Run(c)
+}
+
+func (c pipelined) Encode(m radixresp.Marshaler) error {
+	var buf bytes.Buffer
+	if err := m.MarshalRESP(&buf); err != nil {
+		return err
+	}
+	br := bufio.NewReader(&buf)
+	for buf.Len() > 0 || br.Buffered() > 0 {
+		var cmd resp2.RawMessage
+		if err := cmd.UnmarshalRESP(br); err != nil {
+			return err
+		}
+		if err := c.Conn.Encode(cmd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func setup() {
 	db1, _ = radix.NewPool("tcp", "redis://redis:6379/3", 1)
 	db2, _ = radix.NewPool("tcp", "redis://redis:6379/4", 1)
@@ -112,3 +189,4454 @@ func TestReadWriteTTL(t *testing.T) {
 		t.Errorf("expected: %v, result: %v", expected, result)
 	}
 }
+
+// Test db1 to db2 sync with shadow keys
+func TestReadWriteShadow(t *testing.T) {
+	ch = make(message.Bus, 100)
+	sum := summary.New()
+	source := redis.New(db1, ch, false, false)
+	target := redis.New(db2, ch, false, false)
+	target.Shadow = "{key}:shadow"
+	target.Summary = sum
+	ctx := context.Background()
+
+	// Read all keys from db1, push to shared message bus
+	if err := source.Read(ctx); err != nil {
+		t.Error("error: ", err)
+	}
+
+	// Write all keys from message bus to db2
+	if err := target.Write(ctx); err != nil {
+		t.Error("error: ", err)
+	}
+
+	// COPY is only available since Redis 6.2, shadowing is then disabled.
+	if target.Shadow == "" {
+		if sum.Get("shadowed") != 0 {
+			t.Error("shadow copies counted while COPY unsupported")
+		}
+		return
+	}
+
+	// Get all db2 shadow keys
+	result := map[string]string{}
+	var v string
+	for k := range expected {
+		db2.Do(radix.Cmd(&v, "GET", k+":shadow"))
+		result[k] = v
+	}
+
+	// Compare db1 keys with db2 shadow keys
+	if !reflect.DeepEqual(expected, result) {
+		t.Errorf("expected: %v, result: %v", expected, result)
+	}
+
+	if sum.Get("shadowed") != int64(len(expected)) {
+		t.Errorf("wrong shadow count: %d", sum.Get("shadowed"))
+	}
+}
+
+// Test TTL fallback, when PTTL is unavailable
+func TestReadTTLFallback(t *testing.T) {
+	ch = make(message.Bus, 100)
+	sum := summary.New()
+	db := stub(map[string]func(args []string) interface{}{
+		"PTTL": func(args []string) interface{} {
+			return errors.New("ERR unknown command 'PTTL'")
+		},
+		"TTL": func(args []string) interface{} {
+			return 30
+		},
+	})
+	source := redis.New(db, ch, false, true)
+	source.Summary = sum
+
+	if err := source.Read(context.Background()); err != nil {
+		t.Error("error: ", err)
+	}
+
+	p := <-ch
+	if p.TTL != "30000" {
+		t.Errorf("wrong ttl: %s", p.TTL)
+	}
+
+	if !strings.Contains(sum.String(), "seconds precision") {
+		t.Error("TTL fallback should be in the summary")
+	}
+}
+
+// Test exporting a key as RESP commands
+func TestReadCommands(t *testing.T) {
+	ch = make(message.Bus, 100)
+	db := stub(map[string]func(args []string) interface{}{
+		"TYPE": func(args []string) interface{} {
+			return "hash"
+		},
+		"HGETALL": func(args []string) interface{} {
+			return []string{"f1", "v1", "f2", "v2"}
+		},
+	})
+	source := redis.New(db, ch, false, true)
+	source.Commands = true
+
+	if err := source.Read(context.Background()); err != nil {
+		t.Error("error: ", err)
+	}
+
+	p := <-ch
+	expected := resp.Encode("DEL", "key1") +
+		resp.Encode("HSET", "key1", "f1", "v1", "f2", "v2") +
+		resp.Encode("PEXPIRE", "key1", "30000")
+	if p.Value != expected {
+		t.Errorf("wrong commands: %q", p.Value)
+	}
+}
+
+// Test estimating the transfer size, honoring filters
+func TestEstimate(t *testing.T) {
+	db := stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			return []interface{}{"0", []string{"key1", "tmp:1", "gone"}}
+		},
+		"MEMORY": func(args []string) interface{} {
+			if args[2] == "gone" {
+				return nil
+			}
+			return 100
+		},
+	})
+	source := redis.New(db, nil, false, false)
+	source.Filter = filter.Filter{Exclude: []string{"tmp:*"}}
+
+	est, err := source.Estimate(context.Background(), true, false)
+	if err != nil {
+		t.Error("error: ", err)
+	}
+
+	if est.Keys != 1 || est.Bytes != 100 || est.Types != nil {
+		t.Errorf("wrong estimate: %+v", est)
+	}
+}
+
+// Test key types are counted in the estimate scan, without MEMORY USAGE
+func TestEstimateTypes(t *testing.T) {
+	db := stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			return []interface{}{"0", []string{"user:1", "user:2", "queue", "gone"}}
+		},
+		"TYPE": func(args []string) interface{} {
+			switch args[1] {
+			case "queue":
+				return "list"
+			case "gone":
+				return "none"
+			}
+			return "hash"
+		},
+		"MEMORY": func(args []string) interface{} {
+			return fmt.Errorf("ERR unexpected MEMORY USAGE")
+		},
+	})
+	source := redis.New(db, nil, false, false)
+
+	est, err := source.Estimate(context.Background(), false, true)
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	if est.Keys != 3 || est.Bytes != 0 || !reflect.DeepEqual(est.Types, map[string]int64{"hash": 2, "list": 1}) {
+		t.Errorf("wrong estimate: %+v", est)
+	}
+}
+
+// Test planning counts keys by type and pattern, and the ones on the target
+func TestPlan(t *testing.T) {
+	db := stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			return []interface{}{"0", []string{"user:1", "user:2", "queue", "gone"}}
+		},
+		"TYPE": func(args []string) interface{} {
+			switch args[1] {
+			case "queue":
+				return "list"
+			case "gone":
+				return "none"
+			}
+			return "hash"
+		},
+		"MEMORY": func(args []string) interface{} {
+			return 100
+		},
+	})
+	targetDB := stub(map[string]func(args []string) interface{}{
+		"EXISTS": func(args []string) interface{} {
+			if args[1] == "user:1" {
+				return 1
+			}
+			return 0
+		},
+	})
+	source := redis.New(db, nil, false, false)
+	target := redis.New(targetDB, nil, false, false)
+
+	plan, err := source.Plan(context.Background(), target)
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	if plan.Keys != 3 || plan.Bytes != 300 || plan.Existing != 1 {
+		t.Errorf("wrong plan: %+v", plan)
+	}
+	if !reflect.DeepEqual(plan.Types, map[string]int64{"hash": 2, "list": 1}) {
+		t.Errorf("wrong plan types: %v", plan.Types)
+	}
+	if !reflect.DeepEqual(plan.Patterns, map[string]int64{"user:*": 2, "*": 1}) {
+		t.Errorf("wrong plan patterns: %v", plan.Patterns)
+	}
+}
+
+// Test benchmark keys are seeded with values of the sizes drawn, then deleted
+func TestSeed(t *testing.T) {
+	sets := map[string]int{}
+	var deleted []string
+	db := stub(map[string]func(args []string) interface{}{
+		"SET": func(args []string) interface{} {
+			sets[args[1]] = len(args[2])
+			return "OK"
+		},
+		"DEL": func(args []string) interface{} {
+			deleted = append(deleted, args[1])
+			return 1
+		},
+	})
+	source := redis.New(db, nil, false, false)
+
+	sizes, err := redis.ParseBenchSizes("10:3,20")
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	keys, seeded, err := source.Seed(context.Background(), "bench:", 250, sizes, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	var total int64
+	for _, size := range sets {
+		if size != 10 && size != 20 {
+			t.Errorf("wrong value size: %d", size)
+		}
+		total += int64(size)
+	}
+	if len(keys) != 250 || len(sets) != 250 || keys[249] != "bench:249" || seeded != total {
+		t.Errorf("wrong seed: %d keys, %d set, last %s, %d bytes", len(keys), len(sets), keys[len(keys)-1], seeded)
+	}
+
+	if err := source.Unseed(keys); err != nil {
+		t.Fatal("error: ", err)
+	}
+	if !reflect.DeepEqual(deleted, keys) {
+		t.Errorf("wrong keys deleted: %d", len(deleted))
+	}
+
+	for _, s := range []string{"", "0", "10:0", "10:x", "-1"} {
+		if _, err := redis.ParseBenchSizes(s); err == nil {
+			t.Errorf("%q should be invalid", s)
+		}
+	}
+}
+
+// Test DUMP and PTTL are pipelined with TTL sync, and replies not mixed up
+func TestReadTTLPipelined(t *testing.T) {
+	ch = make(message.Bus, 100)
+	db := stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			return []interface{}{"0", []string{"key1", "key2"}}
+		},
+		"DUMP": func(args []string) interface{} {
+			return "value-" + args[1]
+		},
+		"PTTL": func(args []string) interface{} {
+			if args[1] == "key1" {
+				return 1000
+			}
+			return -1
+		},
+	})
+	source := redis.New(db, ch, false, true)
+
+	if err := source.Read(context.Background()); err != nil {
+		t.Error("error: ", err)
+	}
+
+	result := map[string]string{}
+	for p := range ch {
+		result[p.Value] = p.TTL
+	}
+
+	expected := map[string]string{"value-key1": "1000", "value-key2": "0"}
+	if !reflect.DeepEqual(expected, result) {
+		t.Errorf("expected: %v, result: %v", expected, result)
+	}
+}
+
+// Test sampling keys metadata, honoring filters
+func TestSample(t *testing.T) {
+	db := stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			return []interface{}{"0", []string{"tmp:1", "user:1", "user:2"}}
+		},
+		"TYPE": func(args []string) interface{} {
+			return "string"
+		},
+		"OBJECT": func(args []string) interface{} {
+			return "embstr"
+		},
+	})
+	source := redis.New(db, nil, false, true)
+	source.Filter = filter.Filter{Exclude: []string{"tmp:*"}}
+
+	infos, err := source.Sample(context.Background(), 1)
+	if err != nil {
+		t.Error("error: ", err)
+	}
+
+	expected := []redis.KeyInfo{
+		{Key: "user:1", Type: "string", Size: 6, TTL: 30000, Encoding: "embstr"},
+	}
+	if !reflect.DeepEqual(expected, infos) {
+		t.Errorf("expected: %v, result: %v", expected, infos)
+	}
+}
+
+// Test running a script after RESTORE, reloading it when missing
+func TestWriteScript(t *testing.T) {
+	ch = make(message.Bus, 100)
+	loads := 0
+	evals := [][]string{}
+	db := stub(map[string]func(args []string) interface{}{
+		"SCRIPT": func(args []string) interface{} {
+			loads++
+			return "sha"
+		},
+		"EVALSHA": func(args []string) interface{} {
+			evals = append(evals, args)
+			// simulate a flushed script cache on first call
+			if len(evals) == 1 {
+				return errors.New("NOSCRIPT No matching script. Please use EVAL.")
+			}
+			return "OK"
+		},
+	})
+	sum := summary.New()
+	target := redis.New(db, ch, false, false)
+	target.Script = &redis.Script{Source: "return 1", Args: []string{"index"}}
+	target.Summary = sum
+
+	ch <- message.Payload{Key: "key1", Value: "value1", TTL: "0"}
+	close(ch)
+
+	if err := target.Write(context.Background()); err != nil {
+		t.Error("error: ", err)
+	}
+
+	if loads != 2 {
+		t.Errorf("script should be reloaded, loads: %d", loads)
+	}
+
+	sha := "e0e1f9fabfc9d4800c877a703b823ac0578ff8db"
+	expected := []string{"EVALSHA", sha, "1", "key1", "index"}
+	if !reflect.DeepEqual(expected, evals[len(evals)-1]) {
+		t.Errorf("expected: %v, result: %v", expected, evals[len(evals)-1])
+	}
+
+	if sum.Get("scripted") != 1 {
+		t.Error("wrong scripted count")
+	}
+}
+
+// Test skipping idle keys with OBJECT IDLETIME
+func TestReadSince(t *testing.T) {
+	ch = make(message.Bus, 100)
+	db := stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			return []interface{}{"0", []string{"hot", "cold"}}
+		},
+		"OBJECT": func(args []string) interface{} {
+			if args[2] == "cold" {
+				return 7200
+			}
+			return 10
+		},
+	})
+	source := redis.New(db, ch, false, false)
+	source.MaxIdle = time.Hour
+
+	if err := source.Read(context.Background()); err != nil {
+		t.Error("error: ", err)
+	}
+
+	keys := []string{}
+	for p := range ch {
+		keys = append(keys, p.Key)
+	}
+	if !reflect.DeepEqual([]string{"hot"}, keys) {
+		t.Errorf("only hot keys expected, got: %v", keys)
+	}
+}
+
+// Test keeping all keys when IDLETIME isn't tracked
+func TestReadSinceLFU(t *testing.T) {
+	ch = make(message.Bus, 100)
+	db := stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			return []interface{}{"0", []string{"hot", "cold"}}
+		},
+		"OBJECT": func(args []string) interface{} {
+			return errors.New("ERR An LFU maxmemory policy is selected, idle time not tracked.")
+		},
+	})
+	source := redis.New(db, ch, false, false)
+	source.MaxIdle = time.Hour
+
+	if err := source.Read(context.Background()); err != nil {
+		t.Error("error: ", err)
+	}
+
+	if len(ch) != 2 {
+		t.Errorf("all keys expected, got: %d", len(ch))
+	}
+}
+
+// Test keeping keys already on db2
+func TestWriteSkipExisting(t *testing.T) {
+	ch = make(message.Bus, 100)
+	sum := summary.New()
+	source := redis.New(db1, ch, false, false)
+	target := redis.New(db2, ch, false, false)
+	target.SkipExisting = true
+	target.Summary = sum
+	ctx := context.Background()
+
+	// Seed an empty db2 with an existing key
+	db2.Do(radix.Cmd(nil, "FLUSHDB"))
+	db2.Do(radix.Cmd(nil, "SET", "key1", "existing"))
+
+	if err := source.Read(ctx); err != nil {
+		t.Error("error: ", err)
+	}
+
+	if err := target.Write(ctx); err != nil {
+		t.Error("existing keys should be skipped: ", err)
+	}
+
+	var v string
+	db2.Do(radix.Cmd(&v, "GET", "key1"))
+	if v != "existing" {
+		t.Errorf("existing key replaced: %s", v)
+	}
+
+	if sum.Get("skipped-existing") != 1 {
+		t.Errorf("wrong skipped-existing count: %d", sum.Get("skipped-existing"))
+	}
+}
+
+// Test each destination is capped by its own rate, and all of them by the
+// aggregate one
+func TestWriteRateLimits(t *testing.T) {
+	// writes restores 11 keys on each of two destinations, the first token
+	// of each limiter available right away
+	writes := func(aggregate *ratelimit.Limiter) time.Duration {
+		start := time.Now()
+		g, ctx := errgroup.WithContext(context.Background())
+		for d := 0; d < 2; d++ {
+			bus := make(message.Bus, 100)
+			for i := 0; i < 11; i++ {
+				bus <- message.Payload{Key: fmt.Sprintf("key%d", i), Value: "value1", TTL: "0"}
+			}
+			close(bus)
+			target := redis.New(stub(nil), bus, true, false)
+			target.Limiter = ratelimit.New(100)
+			target.AggregateLimiter = aggregate
+			target.Summary = summary.New()
+			g.Go(func() error {
+				return target.Write(ctx)
+			})
+		}
+		if err := g.Wait(); err != nil {
+			t.Fatal("error: ", err)
+		}
+		return time.Since(start)
+	}
+
+	// 100ms per destination, in parallel
+	if elapsed := writes(nil); elapsed < 90*time.Millisecond || elapsed > 180*time.Millisecond {
+		t.Errorf("expected each destination capped at 100/s, took %s", elapsed)
+	}
+	// 210ms for both, the aggregate capping their sum
+	if elapsed := writes(ratelimit.New(100)); elapsed < 190*time.Millisecond {
+		t.Errorf("expected both destinations capped at 100/s combined, took %s", elapsed)
+	}
+}
+
+// Test canceled reads and writes wrap the context error
+func TestCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Neither bus is consumed nor closed, the context ends both
+	source := redis.New(stub(nil), make(message.Bus), true, false)
+	source.Summary = summary.New()
+	if err := source.Read(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a canceled read, got %v", err)
+	}
+	target := redis.New(stub(nil), make(message.Bus), true, false)
+	target.Summary = summary.New()
+	if err := target.Write(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a canceled write, got %v", err)
+	}
+}
+
+// Test RESTORE errors are counted with continue-on-error
+func TestWriteContinueOnError(t *testing.T) {
+	ch = make(message.Bus, 100)
+	sum := summary.New()
+	db := stub(map[string]func(args []string) interface{}{
+		"RESTORE": func(args []string) interface{} {
+			if args[1] == "bad" {
+				return errors.New("ERR DUMP payload version or checksum are wrong")
+			}
+			return "OK"
+		},
+	})
+	target := redis.New(db, ch, false, false)
+	target.ContinueOnError = true
+	target.Summary = sum
+
+	ch <- message.Payload{Key: "bad", Value: "value", TTL: "0"}
+	ch <- message.Payload{Key: "good", Value: "value", TTL: "0"}
+	close(ch)
+
+	if err := target.Write(context.Background()); err != nil {
+		t.Error("error: ", err)
+	}
+
+	if sum.Get("failed") != 1 || sum.Get("restored") != 1 {
+		t.Errorf("wrong counts: %s", sum)
+	}
+}
+
+// Test restored key names get the hashtag of the template, or fail without
+// a single balanced one
+func TestWriteHashtag(t *testing.T) {
+	ch = make(message.Bus, 100)
+	var restored []string
+	db := stub(map[string]func(args []string) interface{}{
+		"RESTORE": func(args []string) interface{} {
+			restored = append(restored, args[1])
+			return "OK"
+		},
+	})
+	target := redis.New(db, ch, false, false)
+	target.Hashtag = regexp.MustCompile(`^([^:]*):`)
+	target.ContinueOnError = true
+	target.Summary = summary.New()
+
+	for _, key := range []string{"acme:user:1", "plain", ":empty", "{x}:braces"} {
+		ch <- message.Payload{Key: key, Value: "value", TTL: "0"}
+	}
+	close(ch)
+
+	if err := target.Write(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	if !reflect.DeepEqual(restored, []string{"{acme}:user:1", "plain"}) {
+		t.Errorf("wrong keys restored: %v", restored)
+	}
+	sum := target.Summary
+	if sum.Get("hashtagged") != 1 || sum.Get("hashtag-unmatched") != 1 || sum.Get("failed") != 2 {
+		t.Errorf("wrong counts: %s", sum)
+	}
+}
+
+// Test renamed keys are restored along the DEL of their former name in a
+// single script, keys not renamed with RESTORE
+func TestWriteRenameAtomic(t *testing.T) {
+	ch = make(message.Bus, 100)
+	var evals, restored [][]string
+	db := stub(map[string]func(args []string) interface{}{
+		"EVAL": func(args []string) interface{} {
+			evals = append(evals, args[2:6])
+			return "OK"
+		},
+		"RESTORE": func(args []string) interface{} {
+			restored = append(restored, args[1:])
+			return "OK"
+		},
+	})
+	target := redis.New(db, ch, true, false)
+	target.Hashtag = regexp.MustCompile(`^([^:]*):`)
+	target.RenameAtomic = true
+	target.Summary = summary.New()
+
+	ch <- message.Payload{Key: "acme:user:1", Value: "value", TTL: "0"}
+	ch <- message.Payload{Key: "plain", Value: "value", TTL: "0"}
+	ch <- message.Payload{Key: "eu:acme:2", Original: "acme:2", Value: "value", TTL: "0"}
+	close(ch)
+
+	if err := target.Write(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	expected := [][]string{{"2", "acme:user:1", "{acme}:user:1", "RESTORE"}, {"2", "acme:2", "{eu}:acme:2", "RESTORE"}}
+	if !reflect.DeepEqual(evals, expected) {
+		t.Errorf("wrong scripts: %v", evals)
+	}
+	if !reflect.DeepEqual(restored, [][]string{{"plain", "0", "value", "REPLACE"}}) {
+		t.Errorf("wrong keys restored: %v", restored)
+	}
+	sum := target.Summary
+	if sum.Get("renamed-atomically") != 2 || sum.Get("restored") != 3 {
+		t.Errorf("wrong counts: %s", sum)
+	}
+}
+
+// Test the server clock offset is read off TIME, invalid replies failing
+func TestClock(t *testing.T) {
+	ahead := time.Now().Add(time.Hour)
+	db := stub(map[string]func(args []string) interface{}{
+		"TIME": func(args []string) interface{} {
+			return []string{strconv.FormatInt(ahead.Unix(), 10), "0"}
+		},
+	})
+	offset, err := redis.New(db, nil, true, false).Clock()
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	if offset < 59*time.Minute || offset > time.Hour {
+		t.Errorf("expected an hour ahead, result: %s", offset)
+	}
+
+	db = stub(map[string]func(args []string) interface{}{
+		"TIME": func(args []string) interface{} { return []string{"x", "0"} },
+	})
+	if _, err := redis.New(db, nil, true, false).Clock(); err == nil {
+		t.Error("expected an invalid reply error")
+	}
+}
+
+// Test clocks skewed over the maximum fail, either way, and unchecked ones
+// when TIME fails
+func TestCheckSkew(t *testing.T) {
+	clock := func(offset time.Duration) *redis.Redis {
+		return redis.New(stub(map[string]func(args []string) interface{}{
+			"TIME": func(args []string) interface{} {
+				now := time.Now().Add(offset)
+				return []string{strconv.FormatInt(now.Unix(), 10), strconv.Itoa(now.Nanosecond() / 1000)}
+			},
+		}), nil, true, false)
+	}
+	source := clock(0)
+
+	skew, err := redis.CheckSkew(source, clock(time.Hour), 0)
+	if err != nil || skew < 59*time.Minute || skew > time.Hour+time.Second {
+		t.Errorf("expected an hour of skew, unchecked, result: %s, %v", skew, err)
+	}
+	if _, err := redis.CheckSkew(source, clock(time.Second), time.Minute); err != nil {
+		t.Error("error: ", err)
+	}
+	for _, offset := range []time.Duration{time.Hour, -time.Hour} {
+		if _, err := redis.CheckSkew(source, clock(offset), time.Minute); !errors.Is(err, redis.ErrClockSkew) {
+			t.Errorf("expected a skew of %s over the maximum, result: %v", offset, err)
+		}
+	}
+
+	denied := redis.New(stub(map[string]func(args []string) interface{}{
+		"TIME": func(args []string) interface{} {
+			return errors.New("NOPERM this user has no permissions to run the 'time' command")
+		},
+	}), nil, true, false)
+	if _, err := redis.CheckSkew(source, denied, time.Minute); err == nil || errors.Is(err, redis.ErrClockSkew) {
+		t.Errorf("expected a TIME error, result: %v", err)
+	}
+}
+
+// Test staged keys are renamed to their final name, existing keys kept per
+// policy, keys whose final name is staged left, and batches transactional
+func TestPromoteNamespace(t *testing.T) {
+	var cmds []string
+	exists := map[string]bool{"b": true}
+	db := stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			if args[3] != `st\*g:*` {
+				return errors.New("ERR wrong pattern " + args[3])
+			}
+			return []interface{}{"0", []string{"st*g:a", "st*g:b", "st*g:st*g:c"}}
+		},
+		"RENAMENX": func(args []string) interface{} {
+			cmds = append(cmds, strings.Join(args, " "))
+			if exists[args[2]] {
+				return 0
+			}
+			return 1
+		},
+		"DEL": func(args []string) interface{} {
+			cmds = append(cmds, strings.Join(args, " "))
+			return 1
+		},
+	})
+	target := redis.New(db, nil, true, false)
+	target.Summary = summary.New()
+	if err := target.PromoteNamespace(context.Background(), "st*g:", redis.PromoteKeep, 0); err != nil {
+		t.Fatal("error: ", err)
+	}
+	expected := []string{"RENAMENX st*g:a a", "RENAMENX st*g:b b", "DEL st*g:b"}
+	if !reflect.DeepEqual(cmds, expected) {
+		t.Errorf("wrong commands: %v", cmds)
+	}
+	sum := target.Summary
+	if sum.Get("promoted") != 1 || sum.Get("kept-target") != 1 || sum.Get("promote-nested") != 1 {
+		t.Errorf("wrong counts: %s", sum)
+	}
+
+	target.Summary = summary.New()
+	if err := target.PromoteNamespace(context.Background(), "st*g:", redis.PromoteFail, 0); err == nil {
+		t.Error("expected an error promoting over an existing key")
+	}
+
+	cmds = nil
+	db = stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			return []interface{}{"0", []string{"staging:a", "staging:b", "staging:c"}}
+		},
+		"MULTI": func(args []string) interface{} {
+			cmds = append(cmds, "MULTI")
+			return "OK"
+		},
+		"RENAME": func(args []string) interface{} {
+			cmds = append(cmds, strings.Join(args, " "))
+			return "QUEUED"
+		},
+		"EXEC": func(args []string) interface{} {
+			cmds = append(cmds, "EXEC")
+			if len(cmds) < 5 {
+				return []interface{}{"OK", resp2.Error{E: errors.New("ERR no such key")}}
+			}
+			return []interface{}{"OK"}
+		},
+	})
+	target = redis.New(db, nil, true, false)
+	target.Summary = summary.New()
+	if err := target.PromoteNamespace(context.Background(), "staging:", redis.PromoteReplace, 2); err != nil {
+		t.Fatal("error: ", err)
+	}
+	expected = []string{"MULTI", "RENAME staging:a a", "RENAME staging:b b", "EXEC", "MULTI", "RENAME staging:c c", "EXEC"}
+	if !reflect.DeepEqual(cmds, expected) {
+		t.Errorf("wrong commands: %v", cmds)
+	}
+	sum = target.Summary
+	if sum.Get("promoted") != 2 || sum.Get("promote-missing") != 1 || sum.Get("promote-transactions") != 2 {
+		t.Errorf("wrong counts: %s", sum)
+	}
+}
+
+// Test payloads over the target proto-max-bulk-len are skipped, or the
+// limit raised, skipping them when denied, or failing the write
+func TestWriteBulkLimit(t *testing.T) {
+	cases := []struct {
+		policy   string
+		denied   bool
+		fails    bool
+		restored int64
+		counter  string
+	}{
+		{policy: redis.BulkSkip, counter: "over-bulk-len"},
+		{policy: redis.BulkRaise, restored: 2, counter: "bulk-len-raised"},
+		{policy: redis.BulkRaise, denied: true, counter: "over-bulk-len"},
+		{policy: redis.BulkFail, fails: true},
+	}
+
+	for _, c := range cases {
+		ch := make(message.Bus, 100)
+		var set []string
+		db := stub(map[string]func(args []string) interface{}{
+			"CONFIG": func(args []string) interface{} {
+				if c.denied {
+					return errors.New("ERR unknown command 'CONFIG'")
+				}
+				set = args[1:]
+				return "OK"
+			},
+		})
+		limit := &redis.BulkLimit{Max: 4, Policy: c.policy}
+		target := redis.New(db, ch, true, false)
+		target.BulkLimit = limit
+		target.Summary = summary.New()
+
+		ch <- message.Payload{Key: "small", Value: "v", TTL: "0"}
+		ch <- message.Payload{Key: "large", Value: "value1", TTL: "0"}
+		close(ch)
+
+		err := target.Write(context.Background())
+		if c.fails {
+			if err == nil || !strings.Contains(err.Error(), "proto-max-bulk-len") {
+				t.Errorf("%s: expected a proto-max-bulk-len error, got %v", c.policy, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: error: %s", c.policy, err)
+		}
+		restored := int64(1)
+		if c.restored > 0 {
+			restored = c.restored
+		}
+		if target.Summary.Get("restored") != restored || target.Summary.Get(c.counter) != 1 {
+			t.Errorf("%s: wrong counts: %s", c.policy, target.Summary)
+		}
+		if c.counter == "bulk-len-raised" && (!reflect.DeepEqual(set, []string{"SET", "proto-max-bulk-len", "6"}) || limit.Max != 6) {
+			t.Errorf("%s: wrong CONFIG SET %v, limit %d", c.policy, set, limit.Max)
+		}
+	}
+}
+
+// Test reading proto-max-bulk-len, and servers denying CONFIG
+func TestProtoMaxBulkLen(t *testing.T) {
+	db := stub(map[string]func(args []string) interface{}{
+		"CONFIG": func(args []string) interface{} {
+			return []string{"proto-max-bulk-len", "536870912"}
+		},
+	})
+	if n, err := redis.New(db, nil, true, false).ProtoMaxBulkLen(); err != nil || n != 536870912 {
+		t.Errorf("wrong proto-max-bulk-len %d, error: %v", n, err)
+	}
+
+	db = stub(map[string]func(args []string) interface{}{
+		"CONFIG": func(args []string) interface{} {
+			return []string{}
+		},
+	})
+	if _, err := redis.New(db, nil, true, false).ProtoMaxBulkLen(); err == nil {
+		t.Error("expected an error without proto-max-bulk-len")
+	}
+}
+
+// Test the keys already on the Bus are restored once interrupted, up to the
+// drain timeout, the others dropped
+func TestWriteDrain(t *testing.T) {
+	for _, timeout := range []time.Duration{time.Minute, time.Nanosecond} {
+		ch := make(message.Bus, 100)
+		target := redis.New(stub(nil), ch, true, false)
+		target.DrainTimeout = timeout
+		target.Summary = summary.New()
+		for i := 0; i < 50; i++ {
+			ch <- message.Payload{Key: fmt.Sprintf("key%d", i), Value: "value1", TTL: "0"}
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := target.Write(ctx); err == nil {
+			t.Errorf("%s: expected a cancellation error", timeout)
+		}
+
+		// The Bus may be read a few times before the done context
+		sum := target.Summary
+		if sum.Get("restored")+sum.Get("drain-dropped") != 50 || len(ch) != 0 {
+			t.Errorf("%s: wrong counts: %s", timeout, sum)
+		}
+		if timeout == time.Minute && sum.Get("drained") == 0 {
+			t.Errorf("%s: expected the keys drained: %s", timeout, sum)
+		}
+		if timeout == time.Nanosecond && sum.Get("drain-dropped") == 0 {
+			t.Errorf("%s: expected the keys dropped: %s", timeout, sum)
+		}
+	}
+}
+
+// Test TTL rules apply in order, the first matching winning, the default
+// TTL applying to keys matching none
+func TestWriteTTLRules(t *testing.T) {
+	ch := make(message.Bus, 100)
+	ttls := map[string]string{}
+	db := stub(map[string]func(args []string) interface{}{
+		"RESTORE": func(args []string) interface{} {
+			ttls[args[1]] = args[2]
+			return "OK"
+		},
+	})
+	target := redis.New(db, ch, true, true)
+	target.DefaultTTL = time.Minute
+	for _, r := range []string{"session:*=keep", "cache:*=1h", "cache:*=persist", "tmp:*=persist"} {
+		rule, err := redis.ParseTTLRule(r)
+		if err != nil {
+			t.Fatal("error: ", err)
+		}
+		target.TTLRules = append(target.TTLRules, rule)
+	}
+	target.Summary = summary.New()
+
+	for _, key := range []string{"session:1", "cache:1", "tmp:1", "user:1"} {
+		ch <- message.Payload{Key: key, Value: "value1", TTL: "5000"}
+	}
+	ch <- message.Payload{Key: "other", Value: "value1", TTL: "0"}
+	close(ch)
+
+	if err := target.Write(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+	expected := map[string]string{"session:1": "5000", "cache:1": "3600000", "tmp:1": "0", "user:1": "5000", "other": "60000"}
+	if !reflect.DeepEqual(ttls, expected) {
+		t.Errorf("wrong TTLs %v", ttls)
+	}
+	sum := target.Summary
+	if sum.Get("ttl-rule-1") != 1 || sum.Get("ttl-rule-2") != 1 || sum.Get("ttl-rule-3") != 0 || sum.Get("ttl-rule-4") != 1 || sum.Get("default-ttl") != 1 {
+		t.Errorf("wrong counts: %s", sum)
+	}
+}
+
+// Test generated keys are sent as the commands recreating them, of the types
+// and TTLs drawn, the same for the same seed
+func TestGenerator(t *testing.T) {
+	types, err := redis.ParseGenerateTypes("string:3,hash,zset")
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	ttls, err := redis.ParseGenerateTTLs("0,1h")
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	generate := func() ([]message.Payload, *summary.Summary) {
+		g := &redis.Generator{
+			Bus:      make(message.Bus, 200),
+			Keys:     100,
+			Prefix:   "gen:",
+			Types:    types,
+			Sizes:    []redis.BenchSize{{Bytes: 8, Weight: 1}},
+			TTLs:     ttls,
+			Elements: 3,
+			Rand:     rand.New(rand.NewSource(1)),
+			Summary:  summary.New(),
+		}
+		if err := g.Read(context.Background()); err != nil {
+			t.Fatal("error: ", err)
+		}
+		var payloads []message.Payload
+		for p := range g.Bus {
+			payloads = append(payloads, p)
+		}
+		return payloads, g.Summary
+	}
+
+	payloads, sum := generate()
+	if len(payloads) != 100 || payloads[99].Key != "gen:99" || sum.Get("generated") != 100 {
+		t.Fatalf("wrong keys generated: %d, %d counted", len(payloads), sum.Get("generated"))
+	}
+	counts := map[string]int64{}
+	for _, p := range payloads {
+		counts[p.Type]++
+		if !p.Commands {
+			t.Errorf("expected %s sent as commands", p.Key)
+		}
+		cmd := map[string]string{"string": "SET", "hash": "HSET", "zset": "ZADD"}[p.Type]
+		if cmd == "" || !strings.Contains(p.Value, cmd) {
+			t.Errorf("wrong commands of %s of type %s: %q", p.Key, p.Type, p.Value)
+		}
+		expires := strings.Contains(p.Value, "PEXPIRE")
+		if (p.TTL == "3600000") != expires || (p.TTL != "0" && p.TTL != "3600000") {
+			t.Errorf("wrong TTL of %s: %s, PEXPIRE %t", p.Key, p.TTL, expires)
+		}
+	}
+	for _, typ := range []string{"string", "hash", "zset"} {
+		if counts[typ] == 0 || sum.Get("generated-"+typ) != counts[typ] {
+			t.Errorf("wrong %s keys: %d, %d counted", typ, counts[typ], sum.Get("generated-"+typ))
+		}
+	}
+	if counts["string"] <= counts["hash"] {
+		t.Errorf("expected strings drawn the most: %v", counts)
+	}
+
+	again, _ := generate()
+	if !reflect.DeepEqual(payloads, again) {
+		t.Error("expected the same keys for the same seed")
+	}
+
+	for _, s := range []string{"", "stream", "string:0", "hash:x"} {
+		if _, err := redis.ParseGenerateTypes(s); err == nil {
+			t.Errorf("%q should be invalid types", s)
+		}
+	}
+	for _, s := range []string{"", "x", "-1h", "1us", "1h:0"} {
+		if _, err := redis.ParseGenerateTTLs(s); err == nil {
+			t.Errorf("%q should be invalid TTLs", s)
+		}
+	}
+}
+
+// Test keys SCANned again within the dedup window are read once, counted as
+// duplicates, keys evicted from the window read again
+func TestReadDedup(t *testing.T) {
+	db := stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			if args[1] == "0" {
+				return []interface{}{"5", []string{"a", "b", "c"}}
+			}
+			return []interface{}{"0", []string{"b", "d", "a"}}
+		},
+	})
+
+	for _, c := range []struct {
+		window     int
+		keys       []string
+		duplicates int64
+	}{
+		{10, []string{"a", "b", "c", "d"}, 2},
+		{2, []string{"a", "b", "c", "d", "a"}, 1},
+	} {
+		ch := make(message.Bus, 100)
+		source := redis.New(db, ch, true, false)
+		source.Dedup = redis.NewDedup(c.window)
+		source.Summary = summary.New()
+		if err := source.Read(context.Background()); err != nil {
+			t.Fatal("error: ", err)
+		}
+
+		var keys []string
+		for p := range ch {
+			keys = append(keys, p.Key)
+		}
+		if !reflect.DeepEqual(keys, c.keys) {
+			t.Errorf("window %d: wrong keys read: %v", c.window, keys)
+		}
+		if n := source.Summary.Get("duplicates"); n != c.duplicates {
+			t.Errorf("window %d: expected %d duplicates, result: %d", c.window, c.duplicates, n)
+		}
+	}
+}
+
+// Test restored keys are added to the Bloom filter, failed ones left out
+func TestWriteBloom(t *testing.T) {
+	db := stub(map[string]func(args []string) interface{}{
+		"RESTORE": func(args []string) interface{} {
+			if args[1] == "key2" {
+				return errors.New("ERR Bad data format")
+			}
+			return "OK"
+		},
+	})
+
+	ch := make(message.Bus, 100)
+	target := redis.New(db, ch, true, false)
+	target.Bloom = bloom.New(100, 0.001)
+	target.ContinueOnError = true
+	target.Summary = summary.New()
+	for _, key := range []string{"key1", "key2", "key3"} {
+		ch <- message.Payload{Key: key, Value: "value1", TTL: "0"}
+	}
+	ch <- message.Payload{Key: "key4", Value: resp.Encode("SET", "key4", "v"), TTL: "0", Commands: true}
+	close(ch)
+	if err := target.Write(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	for key, added := range map[string]bool{"key1": true, "key2": false, "key3": true, "key4": true} {
+		if target.Bloom.Test(key) != added {
+			t.Errorf("expected %s added %t", key, added)
+		}
+	}
+	if target.Bloom.Added != 3 {
+		t.Errorf("expected 3 keys added, result: %d", target.Bloom.Added)
+	}
+}
+
+// Test the restored keys are appended to the completion manifest, binary
+// names kept exact, and skipped before DUMP once resumed, failed keys and a
+// line cut short by a killed run read again
+func TestCompleted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rump-completed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	manifest := filepath.Join(dir, "completed.txt")
+
+	db := stub(map[string]func(args []string) interface{}{
+		"RESTORE": func(args []string) interface{} {
+			if args[1] == "key2" {
+				return errors.New("ERR Bad data format")
+			}
+			return "OK"
+		},
+	})
+	ch := make(message.Bus, 100)
+	target := redis.New(db, ch, true, false)
+	if target.Completed, err = redis.NewCompleted(manifest, false); err != nil {
+		t.Fatal(err)
+	}
+	target.Completed.Batch = 2
+	target.ContinueOnError = true
+	target.Summary = summary.New()
+	for _, key := range []string{"key1", "key2", "nul\x00key\n"} {
+		ch <- message.Payload{Key: key, Value: "value1", TTL: "0"}
+	}
+	close(ch)
+	if err := target.Write(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+	if err := target.Completed.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadFile(manifest)
+	if string(b) != "\"key1\"\n\"nul\\x00key\\n\"\n" || target.Completed.Added() != 2 {
+		t.Fatalf("unexpected manifest %q", b)
+	}
+
+	f, _ := os.OpenFile(manifest, os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString(`"key3`)
+	f.Close()
+	for _, fp := range []float64{0, 0.001} {
+		done, err := redis.ReadDone(manifest, fp)
+		if err != nil || done.Keys != 2 {
+			t.Fatalf("expected 2 keys completed, result: %v, %v", done, err)
+		}
+		for key, completed := range map[string]bool{"key1": true, "nul\x00key\n": true, "key2": false, "key3": false} {
+			if done.Has(key) != completed {
+				t.Errorf("fp=%g: expected %q completed %t", fp, key, completed)
+			}
+		}
+	}
+
+	var dumped []string
+	db = stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			return []interface{}{"0", []interface{}{"key1", "key2", "nul\x00key\n"}}
+		},
+		"DUMP": func(args []string) interface{} {
+			dumped = append(dumped, args[1])
+			return "value1"
+		},
+	})
+	ch = make(message.Bus, 100)
+	source := redis.New(db, ch, true, false)
+	source.Done, _ = redis.ReadDone(manifest, 0)
+	source.Summary = summary.New()
+	if err := source.Read(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+	if !reflect.DeepEqual(dumped, []string{"key2"}) || source.Summary.Get("skipped-completed") != 2 {
+		t.Errorf("expected key2 dumped alone, result: %v, %s", dumped, source.Summary)
+	}
+}
+
+// Test keys renamed since read, tagged or prefixed, complete under their
+// source name, skipped by resumed reads
+func TestCompletedRenamed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rump-completed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	manifest := filepath.Join(dir, "completed.txt")
+
+	ch := make(message.Bus, 100)
+	target := redis.New(stub(nil), ch, true, false)
+	if target.Completed, err = redis.NewCompleted(manifest, false); err != nil {
+		t.Fatal(err)
+	}
+	target.Hashtag = regexp.MustCompile(`^([^:]*):`)
+	target.Summary = summary.New()
+	ch <- message.Payload{Key: "acme:user:1", Value: "value1", TTL: "0"}
+	ch <- message.Payload{Key: "app2:eu:2", Original: "eu:2", Value: "value1", TTL: "0"}
+	close(ch)
+	if err := target.Write(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+	if err := target.Completed.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var dumped []string
+	db := stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			return []interface{}{"0", []interface{}{"acme:user:1", "eu:2", "acme:user:3"}}
+		},
+		"DUMP": func(args []string) interface{} {
+			dumped = append(dumped, args[1])
+			return "value1"
+		},
+	})
+	ch = make(message.Bus, 100)
+	source := redis.New(db, ch, true, false)
+	source.Done, _ = redis.ReadDone(manifest, 0)
+	source.Summary = summary.New()
+	if err := source.Read(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+	if !reflect.DeepEqual(dumped, []string{"acme:user:3"}) || source.Summary.Get("skipped-completed") != 2 {
+		t.Errorf("expected acme:user:3 dumped alone, result: %v, %s", dumped, source.Summary)
+	}
+}
+
+// Test TTLs survive a file round trip: persistent keys, PTTL -1, stay
+// persistent, expiring ones keep their TTL to the millisecond, restored
+// relative, without ABSTTL, and keys already due are left out
+func TestTTLRoundTrip(t *testing.T) {
+	pttls := map[string]int{"persistent": -1, "short": 1, "exact": 86400123, "due": 0}
+	source := stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			return []interface{}{"0", []string{"persistent", "short", "exact", "due"}}
+		},
+		"PTTL": func(args []string) interface{} {
+			return pttls[args[1]]
+		},
+	})
+
+	dir, err := ioutil.TempDir("", "rump-ttl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, c := range []struct{ format, serializer string }{
+		{file.Dump, file.Native},
+		{file.Dump, file.JSONL},
+		{file.Tar, ""},
+	} {
+		path := filepath.Join(dir, c.format+c.serializer+".rump")
+		if c.format == file.Tar {
+			path = filepath.Join(dir, "dump.tar")
+		}
+
+		dumped := make(message.Bus, 100)
+		reader := redis.New(source, dumped, true, true)
+		reader.Summary = summary.New()
+		if err := reader.Read(context.Background()); err != nil {
+			t.Fatal("error: ", err)
+		}
+		if n := reader.Summary.Get("expired-skipped"); n != 1 {
+			t.Errorf("%s: expected the due key skipped, result: %d", path, n)
+		}
+		dump := file.New(path, dumped, true, true, 1024*1024)
+		dump.Format, dump.Serializer = c.format, c.serializer
+		if err := dump.Write(context.Background()); err != nil {
+			t.Fatal("error: ", err)
+		}
+
+		restored := map[string][]string{}
+		target := stub(map[string]func(args []string) interface{}{
+			"RESTORE": func(args []string) interface{} {
+				restored[args[1]] = args[2:]
+				return "OK"
+			},
+		})
+		loaded := make(message.Bus, 100)
+		load := file.New(path, loaded, true, true, 1024*1024)
+		load.Format = c.format
+		if err := load.Read(context.Background()); err != nil {
+			t.Fatal("error: ", err)
+		}
+		writer := redis.New(target, loaded, true, true)
+		writer.Summary = summary.New()
+		if err := writer.Write(context.Background()); err != nil {
+			t.Fatal("error: ", err)
+		}
+
+		for key, ttl := range map[string]string{"persistent": "0", "short": "1", "exact": "86400123"} {
+			args := restored[key]
+			if len(args) < 3 || args[0] != ttl {
+				t.Errorf("%s: expected %s restored with TTL %s, result: %v", path, key, ttl, args)
+			}
+			for _, arg := range args {
+				if arg == "ABSTTL" {
+					t.Errorf("%s: expected %s restored with a relative TTL, result: %v", path, key, args)
+				}
+			}
+		}
+		if _, ok := restored["due"]; ok || len(restored) != 3 {
+			t.Errorf("%s: wrong keys restored: %v", path, restored)
+		}
+	}
+}
+
+// Test payloads of TTL -1 are skipped as invalid, or restored persistent
+// with PersistMinusOne, other negative TTLs skipped either way
+func TestWritePersistMinusOne(t *testing.T) {
+	for _, persist := range []bool{false, true} {
+		var restored []string
+		db := stub(map[string]func(args []string) interface{}{
+			"RESTORE": func(args []string) interface{} {
+				restored = append(restored, args[1]+"="+args[2])
+				return "OK"
+			},
+		})
+		ch := make(message.Bus, 100)
+		target := redis.New(db, ch, true, true)
+		target.PersistMinusOne = persist
+		target.Summary = summary.New()
+		ch <- message.Payload{Key: "a", Value: "v", TTL: "-1"}
+		ch <- message.Payload{Key: "b", Value: "v", TTL: "-2"}
+		ch <- message.Payload{Key: "c", Value: "v", TTL: "0"}
+		close(ch)
+		if err := target.Write(context.Background()); err != nil {
+			t.Fatal("error: ", err)
+		}
+
+		expected, invalid := []string{"c=0"}, int64(2)
+		if persist {
+			expected, invalid = []string{"a=0", "c=0"}, 1
+		}
+		if !reflect.DeepEqual(restored, expected) {
+			t.Errorf("persist %t: expected %v restored, result: %v", persist, expected, restored)
+		}
+		if n := target.Summary.Get("invalid-ttl"); n != invalid {
+			t.Errorf("persist %t: expected %d invalid-ttl, result: %d", persist, invalid, n)
+		}
+	}
+}
+
+// Test writes pause while an online replica lags over the threshold, and
+// resume once it caught up, replicas still syncing left out
+func TestReplLag(t *testing.T) {
+	var reached int64 = 1000
+	db := stub(map[string]func(args []string) interface{}{
+		"INFO": func(args []string) interface{} {
+			return fmt.Sprintf("# Replication\r\nrole:master\r\nconnected_slaves:2\r\n"+
+				"slave0:ip=10.0.0.2,port=6379,state=online,offset=%d,lag=0\r\n"+
+				"slave1:ip=10.0.0.3,port=6379,state=wait_bgsave,offset=0,lag=0\r\n"+
+				"master_repl_offset:5000\r\nrepl_backlog_active:1\r\n", atomic.LoadInt64(&reached))
+		},
+	})
+	monitor := redis.New(db, nil, true, false)
+	monitor.Summary = summary.New()
+	if lag, online, err := monitor.ReplicaLag(); err != nil || lag != 4000 || online != 1 {
+		t.Fatalf("wrong replica lag: %d of %d online replicas, %v", lag, online, err)
+	}
+
+	ch := make(message.Bus, 100)
+	target := redis.New(db, ch, true, false)
+	target.ReplLag = redis.NewReplLag(2000, 5*time.Millisecond)
+	target.Summary = monitor.Summary
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go target.ReplLag.Run(ctx, monitor)
+
+	time.Sleep(50 * time.Millisecond)
+	ch <- message.Payload{Key: "key1", Value: "value1", TTL: "0"}
+	close(ch)
+	done := make(chan error)
+	go func() {
+		done <- target.Write(ctx)
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("expected writes paused, result: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	atomic.StoreInt64(&reached, 4500)
+	if err := <-done; err != nil {
+		t.Fatal("error: ", err)
+	}
+	if n := target.Summary.Get("restored"); n != 1 {
+		t.Errorf("expected 1 restored, result: %d", n)
+	}
+	if target.Summary.Get("repl-lag-pauses") != 1 || target.Summary.Get("repl-lag-paused-ms") < 50 {
+		t.Errorf("expected a pause of at least 50ms, result: %s", target.Summary)
+	}
+}
+
+// Test the key patterns of ACL users, of Redis 6 and 7, and their prefix
+func TestACLKeys(t *testing.T) {
+	for _, keys := range []interface{}{
+		[]string{"tenant:*", "tenant:cache:*"},
+		"~tenant:* %R~tenant:cache:*",
+	} {
+		db := stub(map[string]func(args []string) interface{}{
+			"ACL": func(args []string) interface{} {
+				if args[1] == "WHOAMI" {
+					return "tenant"
+				}
+				return []interface{}{"flags", []string{"on"}, "keys", keys, "selectors", []interface{}{}}
+			},
+		})
+		user, patterns, err := redis.New(db, nil, true, false).ACLKeys()
+		if err != nil {
+			t.Fatal("error: ", err)
+		}
+		if user != "tenant" || !reflect.DeepEqual(patterns, []string{"tenant:*", "tenant:cache:*"}) {
+			t.Errorf("wrong ACL keys: %s %v", user, patterns)
+		}
+	}
+
+	cases := map[string][]string{
+		"tenant:": {"tenant:*", "tenant:cache:*"},
+		"":        {"tenant:*", "team:*"},
+		"app:":    {"app:1", "app:*"},
+	}
+	for expected, patterns := range cases {
+		if prefix := redis.KeyPrefix(patterns); prefix != expected {
+			t.Errorf("expected prefix %q of %v, result: %q", expected, patterns, prefix)
+		}
+	}
+}
+
+// Test keys denied by ACL key patterns are reported, or skipped
+func TestWriteNoPerm(t *testing.T) {
+	db := stub(map[string]func(args []string) interface{}{
+		"RESTORE": func(args []string) interface{} {
+			if !strings.HasPrefix(args[1], "tenant:") {
+				return errors.New("NOPERM No permissions to access a key")
+			}
+			return "OK"
+		},
+		"ACL": func(args []string) interface{} {
+			return "tenant"
+		},
+	})
+
+	ch = make(message.Bus, 100)
+	target := redis.New(db, ch, false, false)
+	ch <- message.Payload{Key: "other:1", Value: "value", TTL: "0"}
+	close(ch)
+	err := target.Write(context.Background())
+	if err == nil || !strings.Contains(err.Error(), `key "other:1" is outside the key patterns the ACL user 'tenant' may write`) {
+		t.Errorf("expected an ACL error, got %v", err)
+	}
+
+	ch = make(message.Bus, 100)
+	sum := summary.New()
+	target = redis.New(db, ch, false, false)
+	target.ContinueOnError = true
+	target.Breaker = redis.NewBreaker(1)
+	target.Summary = sum
+	ch <- message.Payload{Key: "other:1", Value: "value", TTL: "0"}
+	ch <- message.Payload{Key: "other:2", Value: "value", TTL: "0"}
+	ch <- message.Payload{Key: "tenant:1", Value: "value", TTL: "0"}
+	close(ch)
+	if err := target.Write(context.Background()); err != nil {
+		t.Fatal("denied keys shouldn't trip the breaker: ", err)
+	}
+	if sum.Get("noperm") != 2 || sum.Get("failed") != 0 || sum.Get("restored") != 1 {
+		t.Errorf("wrong counts: %s", sum)
+	}
+}
+
+// Test replaying RESP commands in place of RESTORE
+func TestWriteCommands(t *testing.T) {
+	ch = make(message.Bus, 100)
+	var replayed [][]string
+	db := radix.Stub("tcp", "stub:6379", func(args []string) interface{} {
+		replayed = append(replayed, args)
+		return "OK"
+	})
+	target := redis.New(db, ch, false, false)
+	target.Commands = true
+
+	ch <- message.Payload{Key: "key1", Value: resp.Encode("DEL", "key1") + resp.Encode("RPUSH", "key1", "a", "b"), TTL: "0"}
+	close(ch)
+
+	if err := target.Write(context.Background()); err != nil {
+		t.Error("error: ", err)
+	}
+
+	expected := [][]string{{"DEL", "key1"}, {"RPUSH", "key1", "a", "b"}}
+	if !reflect.DeepEqual(expected, replayed) {
+		t.Errorf("expected: %v, result: %v", expected, replayed)
+	}
+}
+
+// Test conflicts are resolved comparing target PTTL with payload TTL
+func TestWriteConflict(t *testing.T) {
+	cases := []struct {
+		conflict redis.Conflict
+		ttl      string
+		restored bool
+	}{
+		{redis.LongerTTLWins, "60000", true},
+		{redis.LongerTTLWins, "10000", false},
+		{redis.LongerTTLWins, "0", true},
+		{redis.ShorterTTLWins, "60000", false},
+		{redis.ShorterTTLWins, "10000", true},
+		{redis.SourceAlwaysWins, "10000", true},
+	}
+
+	for _, c := range cases {
+		ch = make(message.Bus, 100)
+		sum := summary.New()
+		// Target key1 PTTL is 30000
+		target := redis.New(stub(nil), ch, false, true)
+		target.Conflict = c.conflict
+		target.Summary = sum
+
+		ch <- message.Payload{Key: "key1", Value: "value1", TTL: c.ttl}
+		close(ch)
+
+		if err := target.Write(context.Background()); err != nil {
+			t.Error("error: ", err)
+		}
+
+		if (sum.Get("restored") == 1) != c.restored {
+			t.Errorf("ttl %s: restored should be %v, got %s", c.ttl, c.restored, sum)
+		}
+	}
+}
+
+// Test persistent keys get DefaultTTL, keys with a TTL keep theirs
+func TestWriteDefaultTTL(t *testing.T) {
+	ch = make(message.Bus, 100)
+	var ttls []string
+	db := stub(map[string]func(args []string) interface{}{
+		"RESTORE": func(args []string) interface{} {
+			ttls = append(ttls, args[2])
+			return "OK"
+		},
+	})
+	target := redis.New(db, ch, false, true)
+	target.DefaultTTL = time.Hour
+
+	ch <- message.Payload{Key: "persistent", Value: "value1", TTL: "0"}
+	ch <- message.Payload{Key: "expiring", Value: "value1", TTL: "5000"}
+	close(ch)
+
+	if err := target.Write(context.Background()); err != nil {
+		t.Error("error: ", err)
+	}
+
+	expected := []string{"3600000", "5000"}
+	if !reflect.DeepEqual(ttls, expected) {
+		t.Errorf("expected: %v, result: %v", expected, ttls)
+	}
+}
+
+// Test auto-tuning from INFO clients, CONFIG GET maxclients and DBSIZE
+func TestAutoTune(t *testing.T) {
+	db := stub(map[string]func(args []string) interface{}{
+		"INFO": func(args []string) interface{} {
+			return "# Clients\r\nconnected_clients:10\r\nblocked_clients:0\r\n"
+		},
+		"CONFIG": func(args []string) interface{} {
+			return []string{"maxclients", "50"}
+		},
+		"DBSIZE": func(args []string) interface{} {
+			return 2000000
+		},
+	})
+
+	info, err := redis.New(db, nil, false, false).ServerInfo()
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	expected := redis.ServerInfo{ConnectedClients: 10, MaxClients: 50, Keys: 2000000}
+	if info != expected {
+		t.Errorf("expected: %+v, result: %+v", expected, info)
+	}
+
+	tuning := redis.AutoTune(info)
+	if tuning != (redis.Tuning{PoolSize: 10, ScanCount: 200, Workers: 10}) {
+		t.Errorf("wrong tuning: %+v", tuning)
+	}
+
+	// Busy servers still get a connection
+	tuning = redis.AutoTune(redis.ServerInfo{ConnectedClients: 50, MaxClients: 50})
+	if tuning.PoolSize != 1 || tuning.ScanCount != 10 {
+		t.Errorf("wrong tuning: %+v", tuning)
+	}
+}
+
+// Test payloads are restored as re-DUMPed by the intermediate
+func TestWriteVia(t *testing.T) {
+	ch = make(message.Bus, 100)
+	var viaCmds []string
+	via := stub(map[string]func(args []string) interface{}{
+		"RESTORE": func(args []string) interface{} {
+			viaCmds = append(viaCmds, args[0]+" "+args[1])
+			return "OK"
+		},
+		"DUMP": func(args []string) interface{} {
+			return "redumped"
+		},
+		"DEL": func(args []string) interface{} {
+			viaCmds = append(viaCmds, args[0]+" "+args[1])
+			return 1
+		},
+	})
+	var restored string
+	db := stub(map[string]func(args []string) interface{}{
+		"RESTORE": func(args []string) interface{} {
+			restored = args[3]
+			return "OK"
+		},
+	})
+	target := redis.New(db, ch, false, false)
+	target.Via = via
+
+	ch <- message.Payload{Key: "key1", Value: "value1", TTL: "0"}
+	close(ch)
+
+	if err := target.Write(context.Background()); err != nil {
+		t.Error("error: ", err)
+	}
+
+	expected := []string{"RESTORE rump:via:key1", "DEL rump:via:key1"}
+	if !reflect.DeepEqual(viaCmds, expected) || restored != "redumped" {
+		t.Errorf("expected: %v and a redumped payload, result: %v, %s", expected, viaCmds, restored)
+	}
+}
+
+// Test MOVED replies abort, even with ContinueOnError, naming the node
+func TestWriteMoved(t *testing.T) {
+	ch = make(message.Bus, 100)
+	restores := 0
+	db := stub(map[string]func(args []string) interface{}{
+		"RESTORE": func(args []string) interface{} {
+			restores++
+			return errors.New("MOVED 3999 10.0.0.2:6381")
+		},
+	})
+	target := redis.New(db, ch, false, false)
+	target.ContinueOnError = true
+	target.Summary = summary.New()
+
+	ch <- message.Payload{Key: "key1", Value: "value1", TTL: "0"}
+	ch <- message.Payload{Key: "key2", Value: "value1", TTL: "0"}
+	close(ch)
+
+	err := target.Write(context.Background())
+	if !errors.Is(err, redis.ErrCluster) || !strings.Contains(err.Error(), "10.0.0.2:6381") {
+		t.Errorf("expected a cluster error naming the node, got: %v", err)
+	}
+	if restores != 1 {
+		t.Errorf("expected the run to abort after 1 RESTORE, got %d", restores)
+	}
+}
+
+// Test renamed commands are called by their server names
+func TestReadRenamed(t *testing.T) {
+	ch = make(message.Bus, 100)
+	var called []string
+	db := radix.Stub("tcp", "stub:6379", func(args []string) interface{} {
+		called = append(called, args[0])
+		switch args[0] {
+		case "S1":
+			return []interface{}{"0", []string{"key1"}}
+		case "D1":
+			return "value1"
+		}
+		return resp2.Error{E: errors.New("ERR unknown command '" + args[0] + "'")}
+	})
+	source := redis.New(db, ch, false, false)
+	source.Rename = map[string]string{"SCAN": "S1", "DUMP": "D1"}
+
+	if err := source.Read(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+	if p := <-ch; p.Key != "key1" || p.Value != "value1" {
+		t.Errorf("wrong payload: %+v", p)
+	}
+	if !reflect.DeepEqual(called, []string{"S1", "D1"}) {
+		t.Errorf("expected renamed commands, got %v", called)
+	}
+}
+
+// Test reading the keys of a slot, in place of SCAN
+func TestReadSlot(t *testing.T) {
+	ch = make(message.Bus, 100)
+	var listed []string
+	db := stub(map[string]func(args []string) interface{}{
+		"CLUSTER": func(args []string) interface{} {
+			listed = append(listed, strings.Join(args[1:], " "))
+			if args[1] == "COUNTKEYSINSLOT" {
+				return 2
+			}
+			return []string{"{user1}:a", "{user1}:b"}
+		},
+		"SCAN": func(args []string) interface{} {
+			return errors.New("ERR SCAN called")
+		},
+	})
+	source := redis.New(db, ch, false, false)
+	source.Slot = 5474
+
+	if err := source.Read(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	var keys []string
+	for p := range ch {
+		keys = append(keys, p.Key)
+	}
+	expected := []string{"COUNTKEYSINSLOT 5474", "GETKEYSINSLOT 5474 2"}
+	if !reflect.DeepEqual(listed, expected) || !reflect.DeepEqual(keys, []string{"{user1}:a", "{user1}:b"}) {
+		t.Errorf("expected: %v, result: %v, keys %v", expected, listed, keys)
+	}
+}
+
+// Test RESTORE follows ASKING on the same connection
+func TestWriteAsking(t *testing.T) {
+	ch = make(message.Bus, 100)
+	var cmds []string
+	db := stub(map[string]func(args []string) interface{}{
+		"ASKING": func(args []string) interface{} {
+			cmds = append(cmds, args[0])
+			return "OK"
+		},
+		"RESTORE": func(args []string) interface{} {
+			cmds = append(cmds, args[0]+" "+args[1])
+			return "OK"
+		},
+	})
+	target := redis.New(db, ch, false, false)
+	target.Asking = true
+
+	ch <- message.Payload{Key: "key1", Value: "value1", TTL: "0"}
+	close(ch)
+
+	if err := target.Write(context.Background()); err != nil {
+		t.Error("error: ", err)
+	}
+
+	expected := []string{"ASKING", "RESTORE key1"}
+	if !reflect.DeepEqual(cmds, expected) {
+		t.Errorf("expected: %v, result: %v", expected, cmds)
+	}
+}
+
+// Test keys failing past the retries are dead-lettered, under their source
+// name, and read back
+func TestWriteDeadLetter(t *testing.T) {
+	f, err := ioutil.TempFile("", "rump-dead-letter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	ch = make(message.Bus, 100)
+	sum := summary.New()
+	restores := map[string]int{}
+	db := stub(map[string]func(args []string) interface{}{
+		"RESTORE": func(args []string) interface{} {
+			restores[args[1]]++
+			if args[1] == "bad" || args[1] == "app2:bad" {
+				return errors.New("ERR DUMP payload version or checksum are wrong")
+			}
+			return "OK"
+		},
+	})
+	deadLetter, err := redis.NewDeadLetter(f.Name())
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	target := redis.New(db, ch, false, false)
+	target.DeadLetter = deadLetter
+	target.MaxRetries = 1
+	target.Summary = sum
+
+	ch <- message.Payload{Key: "bad", Value: "value", TTL: "0"}
+	ch <- message.Payload{Key: "app2:bad", Original: "bad:2", Value: "value", TTL: "0"}
+	ch <- message.Payload{Key: "good", Value: "value", TTL: "0"}
+	close(ch)
+
+	if err := target.Write(context.Background()); err != nil {
+		t.Error("error: ", err)
+	}
+	deadLetter.Close()
+
+	if restores["bad"] != 2 || sum.Get("dead-lettered") != 2 || sum.Get("restored") != 1 {
+		t.Errorf("wrong counts: %v, %s", restores, sum)
+	}
+
+	letters, err := os.Open(f.Name())
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	defer letters.Close()
+	keys, err := redis.ReadKeys(letters)
+	if err != nil || !reflect.DeepEqual(keys, []string{"bad", "bad:2"}) {
+		t.Errorf("expected the bad keys, got %v, %v", keys, err)
+	}
+}
+
+// Test keys are dead-lettered once retrying would exceed the retry budget
+func TestWriteRetryBudget(t *testing.T) {
+	f, err := ioutil.TempFile("", "rump-dead-letter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	ch = make(message.Bus, 100)
+	sum := summary.New()
+	var restores int
+	db := stub(map[string]func(args []string) interface{}{
+		"RESTORE": func(args []string) interface{} {
+			restores++
+			return errors.New("ERR DUMP payload version or checksum are wrong")
+		},
+	})
+	deadLetter, err := redis.NewDeadLetter(f.Name())
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	target := redis.New(db, ch, false, false)
+	target.DeadLetter = deadLetter
+	target.MaxRetries = 10
+	target.RetryBudget = 150 * time.Millisecond
+	target.Summary = sum
+
+	ch <- message.Payload{Key: "bad", Value: "value", TTL: "0"}
+	close(ch)
+	if err := target.Write(context.Background()); err != nil {
+		t.Error("error: ", err)
+	}
+	deadLetter.Close()
+
+	// Retried after 100ms, the 200ms backoff of the next retry is over budget
+	if restores != 2 || sum.Get("budget-exceeded") != 1 || sum.Get("dead-lettered") != 1 {
+		t.Errorf("wrong counts: restores=%d, %s", restores, sum)
+	}
+	letters, _ := ioutil.ReadFile(f.Name())
+	if !strings.Contains(string(letters), "retry budget of 150ms exceeded") {
+		t.Errorf("dead letter should give the budget, got %s", letters)
+	}
+}
+
+// Test read and RESTORE latencies are summed up
+func TestLatency(t *testing.T) {
+	ch = make(message.Bus, 100)
+	sum := summary.New()
+	db := stub(map[string]func(args []string) interface{}{})
+	source := redis.New(db, ch, false, false)
+	source.Latency = true
+	source.Summary = sum
+	if err := source.Read(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	target := redis.New(db, ch, true, false)
+	target.Latency = true
+	target.Summary = sum
+	if err := target.Write(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	for _, line := range []string{"summary: read-latency n=1", "summary: restore-latency n=1"} {
+		if !strings.Contains(sum.String(), line) {
+			t.Errorf("expected %q in %s", line, sum)
+		}
+	}
+}
+
+// fakeDB serves keys with their DUMP payloads and PTTLs.
+func fakeDB(values map[string]string, ttls map[string]int) radix.Client {
+	return radix.Stub("tcp", "stub:6379", func(args []string) interface{} {
+		switch args[0] {
+		case "SCAN":
+			var keys []string
+			for k := range values {
+				keys = append(keys, k)
+			}
+			return []interface{}{"0", keys}
+		case "DUMP":
+			if v, ok := values[args[1]]; ok {
+				return v
+			}
+			return nil
+		case "PTTL":
+			if _, ok := values[args[1]]; !ok {
+				return -2
+			}
+			return ttls[args[1]]
+		case "EXISTS":
+			if _, ok := values[args[1]]; ok {
+				return 1
+			}
+			return 0
+		}
+		return resp2.Error{E: errors.New("ERR unexpected " + args[0])}
+	})
+}
+
+// Test the keys diff, both ways
+func TestCompare(t *testing.T) {
+	source := redis.New(fakeDB(
+		map[string]string{"same": "v", "changed": "v1", "missing": "v", "expiring": "v"},
+		map[string]int{"same": -1, "changed": -1, "missing": -1, "expiring": 60000},
+	), nil, false, true)
+	target := redis.New(fakeDB(
+		map[string]string{"same": "v", "changed": "v2", "expiring": "v", "extra": "v"},
+		map[string]int{"same": -1, "changed": -1, "expiring": -1, "extra": -1},
+	), nil, false, true)
+
+	var reported []string
+	report := func(d redis.KeyDiff) error {
+		reported = append(reported, d.Key+"="+d.Status)
+		return nil
+	}
+
+	diff, err := redis.Compare(context.Background(), source, target, 1, report)
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	expected := redis.Diff{OnlySource: 1, OnlyTarget: 1, Identical: 1, Different: 1, DifferentTTL: 1}
+	if diff != expected {
+		t.Errorf("expected: %+v, result: %+v", expected, diff)
+	}
+	sort.Strings(reported)
+	keys := []string{"changed=different", "expiring=different-ttl", "extra=only-target", "missing=only-source"}
+	if !reflect.DeepEqual(reported, keys) {
+		t.Errorf("expected: %v, result: %v", keys, reported)
+	}
+}
+
+// Test sampled keys are compared, the same seed sampling as many keys
+func TestSampleVerify(t *testing.T) {
+	values, ttls := map[string]string{}, map[string]int{}
+	for i := 0; i < 100; i++ {
+		values[fmt.Sprintf("key%d", i)], ttls[fmt.Sprintf("key%d", i)] = "v", -1
+	}
+	target := map[string]string{}
+	for k, v := range values {
+		target[k] = v
+	}
+	target["key1"], target["key2"] = "changed", "changed"
+	sample := func(rate float64, seed int64) (redis.Sampled, []string) {
+		source := redis.New(fakeDB(values, ttls), nil, true, true)
+		var reported []string
+		s, err := redis.SampleVerify(context.Background(), source, redis.New(fakeDB(target, ttls), nil, true, true), rate, seed, 1, func(d redis.KeyDiff) error {
+			reported = append(reported, d.Key+"="+d.Status)
+			return nil
+		})
+		if err != nil {
+			t.Fatal("error: ", err)
+		}
+		return s, reported
+	}
+
+	s, reported := sample(1, 42)
+	sort.Strings(reported)
+	if s.Sampled != 100 || s.Mismatches != 2 || s.Rate != 0.02 || s.Upper <= 0.02 || s.Upper > 0.1 {
+		t.Errorf("unexpected sample %+v", s)
+	}
+	if keys := []string{"key1=different", "key2=different"}; !reflect.DeepEqual(reported, keys) {
+		t.Errorf("expected: %v, result: %v", keys, reported)
+	}
+
+	first, _ := sample(0.3, 7)
+	second, _ := sample(0.3, 7)
+	if first.Sampled == 0 || first.Sampled == 100 || first.Sampled != second.Sampled {
+		t.Errorf("expected the same share sampled twice, result: %d and %d", first.Sampled, second.Sampled)
+	}
+}
+
+// Test TTLs are jittered within the range, reproducibly, persistent keys kept
+func TestWriteJitter(t *testing.T) {
+	restore := func() []string {
+		ch = make(message.Bus, 100)
+		var ttls []string
+		db := stub(map[string]func(args []string) interface{}{
+			"RESTORE": func(args []string) interface{} {
+				ttls = append(ttls, args[2])
+				return "OK"
+			},
+		})
+		target := redis.New(db, ch, false, false)
+		target.Jitter = redis.NewJitter(time.Minute, 42)
+
+		ch <- message.Payload{Key: "key1", Value: "value1", TTL: "0"}
+		ch <- message.Payload{Key: "key2", Value: "value2", TTL: "1000"}
+		ch <- message.Payload{Key: "key3", Value: "value3", TTL: "1000"}
+		close(ch)
+
+		if err := target.Write(context.Background()); err != nil {
+			t.Error("error: ", err)
+		}
+		return ttls
+	}
+
+	ttls := restore()
+	if len(ttls) != 3 || ttls[0] != "0" {
+		t.Fatalf("persistent key should stay persistent: %v", ttls)
+	}
+	for _, ttl := range ttls[1:] {
+		ms, _ := strconv.ParseInt(ttl, 10, 64)
+		if ms < 1000 || ms > 61000 {
+			t.Errorf("ttl %s out of the jitter range", ttl)
+		}
+	}
+	if again := restore(); !reflect.DeepEqual(ttls, again) {
+		t.Errorf("same seed should jitter the same: %v, %v", ttls, again)
+	}
+}
+
+// Test keys already on the target are skipped before DUMP
+func TestReadOnlyNew(t *testing.T) {
+	ch = make(message.Bus, 100)
+	var dumped []string
+	db := stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			return []interface{}{"0", []string{"key1", "key2"}}
+		},
+		"DUMP": func(args []string) interface{} {
+			dumped = append(dumped, args[1])
+			return "value"
+		},
+	})
+	target := stub(map[string]func(args []string) interface{}{
+		"EXISTS": func(args []string) interface{} {
+			if args[1] == "key1" {
+				return 1
+			}
+			return 0
+		},
+	})
+	sum := summary.New()
+	source := redis.New(db, ch, false, false)
+	source.Existing = redis.New(target, nil, false, false)
+	source.Summary = sum
+
+	if err := source.Read(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+	if !reflect.DeepEqual(dumped, []string{"key2"}) {
+		t.Errorf("expected only key2 dumped, got %v", dumped)
+	}
+	if sum.Get("skipped-existing") != 1 {
+		t.Errorf("wrong skipped-existing count: %d", sum.Get("skipped-existing"))
+	}
+}
+
+// Test single keys are read without SCAN, missing ones reported
+func TestGet(t *testing.T) {
+	db := stub(map[string]func(args []string) interface{}{
+		"DUMP": func(args []string) interface{} {
+			if args[1] == "missing" {
+				return nil
+			}
+			return "value1"
+		},
+		"PTTL": func(args []string) interface{} {
+			if args[1] == "missing" {
+				return -2
+			}
+			return 5000
+		},
+		"SCAN": func(args []string) interface{} {
+			return errors.New("ERR SCAN called")
+		},
+	})
+	source := redis.New(db, nil, false, true)
+
+	p, ok, err := source.Get("key1")
+	if err != nil || !ok {
+		t.Fatal("error: ", err)
+	}
+	if p.Key != "key1" || p.Value != "value1" || p.TTL != "5000" {
+		t.Errorf("wrong payload: %+v", p)
+	}
+
+	if _, ok, err := source.Get("missing"); err != nil || ok {
+		t.Errorf("missing key should not be found, err=%v", err)
+	}
+}
+
+// Test the three behaviors with keys already on the target: replaced by
+// default, skipped with SkipExisting, reported with NoReplace
+func TestWriteExisting(t *testing.T) {
+	cases := []struct {
+		name         string
+		skipExisting bool
+		noReplace    bool
+		continueOn   bool
+		fails        bool
+		counter      string
+	}{
+		{name: "replace", counter: "restored"},
+		{name: "skip-existing", skipExisting: true, counter: "skipped-existing"},
+		{name: "no-replace", noReplace: true, fails: true},
+		{name: "no-replace continue-on-error", noReplace: true, continueOn: true, counter: "failed"},
+	}
+
+	for _, c := range cases {
+		ch = make(message.Bus, 100)
+		db := stub(map[string]func(args []string) interface{}{
+			"RESTORE": func(args []string) interface{} {
+				if args[len(args)-1] != "REPLACE" {
+					return errors.New("BUSYKEY Target key name already exists.")
+				}
+				return "OK"
+			},
+		})
+		sum := summary.New()
+		target := redis.New(db, ch, false, false)
+		target.SkipExisting = c.skipExisting
+		target.NoReplace = c.noReplace
+		target.ContinueOnError = c.continueOn
+		target.Summary = sum
+
+		ch <- message.Payload{Key: "key1", Value: "value1", TTL: "0"}
+		close(ch)
+
+		err := target.Write(context.Background())
+		if c.fails {
+			if err == nil || !strings.Contains(err.Error(), "BUSYKEY") {
+				t.Errorf("%s: expected a BUSYKEY error, got %v", c.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error: %s", c.name, err)
+		}
+		if sum.Get(c.counter) != 1 {
+			t.Errorf("%s: wrong %s count: %d", c.name, c.counter, sum.Get(c.counter))
+		}
+	}
+}
+
+// Test stream consumer groups are recreated after the entries
+func TestReadStreamGroups(t *testing.T) {
+	ch = make(message.Bus, 100)
+	db := stub(map[string]func(args []string) interface{}{
+		"TYPE": func(args []string) interface{} {
+			return "stream"
+		},
+		"XRANGE": func(args []string) interface{} {
+			return []interface{}{[]interface{}{"1-0", []string{"f", "v"}}}
+		},
+		"XINFO": func(args []string) interface{} {
+			switch args[1] {
+			case "STREAM":
+				return []interface{}{"length", 1, "last-generated-id", "2-0", "first-entry", []interface{}{"1-0", []string{"f", "v"}}}
+			case "GROUPS":
+				return []interface{}{[]interface{}{"name", "g1", "consumers", 1, "pending", 0, "last-delivered-id", "1-0"}}
+			}
+			return []interface{}{[]interface{}{"name", "c1", "pending", 0, "idle", 10}}
+		},
+	})
+	sum := summary.New()
+	source := redis.New(db, ch, false, false)
+	source.Commands = true
+	source.StreamGroups = true
+	source.Summary = sum
+
+	if err := source.Read(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	p := <-ch
+	expected := resp.Encode("DEL", "key1") +
+		resp.Encode("XADD", "key1", "1-0", "f", "v") +
+		resp.Encode("XGROUP", "CREATE", "key1", "g1", "1-0", "MKSTREAM") +
+		resp.Encode("XGROUP", "CREATECONSUMER", "key1", "g1", "c1") +
+		resp.Encode("XSETID", "key1", "2-0")
+	if p.Value != expected {
+		t.Errorf("wrong commands: %q", p.Value)
+	}
+	if sum.Get("stream-groups") != 1 {
+		t.Errorf("wrong stream-groups count: %d", sum.Get("stream-groups"))
+	}
+}
+
+// Test payloads staged in a hash are promoted, then unstaged
+func TestStagePromote(t *testing.T) {
+	hash := map[string]string{}
+	var restored []string
+	db := stub(map[string]func(args []string) interface{}{
+		"HSET": func(args []string) interface{} {
+			hash[args[2]] = args[3]
+			return 1
+		},
+		"HSCAN": func(args []string) interface{} {
+			var fields []string
+			for _, k := range []string{"key1", "key2"} {
+				if v, ok := hash[k]; ok {
+					fields = append(fields, k, v)
+				}
+			}
+			return []interface{}{"0", fields}
+		},
+		"HDEL": func(args []string) interface{} {
+			delete(hash, args[2])
+			return 1
+		},
+		"RESTORE": func(args []string) interface{} {
+			restored = append(restored, args[1]+" "+args[3])
+			return "OK"
+		},
+	})
+
+	ch = make(message.Bus, 100)
+	stage := redis.New(db, ch, false, true)
+	stage.Stage = "rump:staging"
+	ch <- message.Payload{Key: "key1", Value: "value1", TTL: "0"}
+	ch <- message.Payload{Key: "key2", Value: "value2", TTL: "60000"}
+	close(ch)
+	if err := stage.Write(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+	if len(hash) != 2 || len(restored) != 0 {
+		t.Fatalf("expected 2 staged and no restored keys, got %v, %v", hash, restored)
+	}
+
+	ch = make(message.Bus, 100)
+	source := redis.New(db, ch, false, true)
+	source.Staged = "rump:staging"
+	target := redis.New(db, ch, false, true)
+	target.Staged = "rump:staging"
+	if err := source.Read(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+	if err := target.Write(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	if !reflect.DeepEqual(restored, []string{"key1 value1", "key2 value2"}) {
+		t.Errorf("wrong restored keys: %v", restored)
+	}
+	if len(hash) != 0 {
+		t.Errorf("promoted keys should be unstaged: %v", hash)
+	}
+}
+
+// Test empty and too small DUMP payloads are skipped, and counted
+func TestReadMinSize(t *testing.T) {
+	ch = make(message.Bus, 100)
+	db := stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			return []interface{}{"0", []string{"key1", "short", "gone"}}
+		},
+		"DUMP": func(args []string) interface{} {
+			switch args[1] {
+			case "short":
+				return "v"
+			case "gone":
+				return nil
+			}
+			return "value1"
+		},
+	})
+	sum := summary.New()
+	source := redis.New(db, ch, false, false)
+	source.MinSize = 2
+	source.Summary = sum
+
+	if err := source.Read(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+	if len(ch) != 1 || (<-ch).Key != "key1" {
+		t.Error("only key1 should be read")
+	}
+	if sum.Get("skipped-empty") != 2 {
+		t.Errorf("wrong skipped-empty count: %d", sum.Get("skipped-empty"))
+	}
+}
+
+// Test sampled keys are DUMPed once restored, mismatches reported
+func TestWriteVerify(t *testing.T) {
+	db := stub(map[string]func(args []string) interface{}{
+		"DUMP": func(args []string) interface{} {
+			switch args[1] {
+			case "key2":
+				return "re-encoded"
+			case "key3":
+				return nil
+			}
+			return "value1"
+		},
+	})
+
+	f, err := ioutil.TempFile("", "rump-verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	verify, err := redis.NewVerifier(1, f.Name(), false)
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	ch = make(message.Bus, 100)
+	sum := summary.New()
+	target := redis.New(db, ch, false, false)
+	target.Verify = verify
+	target.Summary = sum
+	for _, key := range []string{"key1", "key2", "key3"} {
+		ch <- message.Payload{Key: key, Value: "value1", TTL: "0"}
+	}
+	close(ch)
+	if err := target.Write(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+	verify.Close()
+
+	if sum.Get("verified") != 3 || sum.Get("verify-mismatches") != 2 {
+		t.Errorf("wrong counts: verified=%d mismatches=%d", sum.Get("verified"), sum.Get("verify-mismatches"))
+	}
+	report, _ := ioutil.ReadFile(f.Name())
+	expected := `{"key":"key2","status":"different"}` + "\n" + `{"key":"key3","status":"only-source"}` + "\n"
+	if string(report) != expected {
+		t.Errorf("wrong report: %s", report)
+	}
+
+	// Every other key, aborting on the first mismatch
+	ch = make(message.Bus, 100)
+	target = redis.New(db, ch, false, false)
+	target.Verify, _ = redis.NewVerifier(2, "", true)
+	for _, key := range []string{"key1", "key2", "key3"} {
+		ch <- message.Payload{Key: key, Value: "value1", TTL: "0"}
+	}
+	close(ch)
+	if err := target.Write(context.Background()); err == nil || !strings.Contains(err.Error(), "key3") {
+		t.Errorf("should abort on key3, got %v", err)
+	}
+}
+
+// stubPool is a radix.Client giving each action its own stub connection,
+// for concurrent use, stub connections aren't safe for.
+type stubPool struct {
+	fn func(args []string) interface{}
+}
+
+func (p stubPool) Do(a radix.Action) error {
+	conn := radix.Stub("tcp", "stub:6379", p.fn)
+	defer conn.Close()
+	return a.Run(conn)
+}
+
+func (p stubPool) Close() error {
+	return nil
+}
+
+// Test keys are DUMPed concurrently, up to MaxInFlight at once
+func TestReadMaxInFlight(t *testing.T) {
+	var inFlight, maxInFlight int32
+	var keys []string
+	for i := 0; i < 20; i++ {
+		keys = append(keys, fmt.Sprintf("key%d", i))
+	}
+	db := stubPool{fn: func(args []string) interface{} {
+		switch args[0] {
+		case "SCAN":
+			return []interface{}{"0", keys}
+		case "DUMP":
+			n := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for {
+				max := atomic.LoadInt32(&maxInFlight)
+				if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			return "value-" + args[1]
+		}
+		return 30000
+	}}
+
+	ch = make(message.Bus, 100)
+	source := redis.New(db, ch, true, true)
+	source.MaxInFlight = 4
+	if err := source.Read(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	read := map[string]string{}
+	for p := range ch {
+		read[p.Key] = p.Value
+	}
+	if len(read) != len(keys) || read["key7"] != "value-key7" {
+		t.Errorf("wrong payloads: %v", read)
+	}
+	if maxInFlight < 2 || maxInFlight > 4 {
+		t.Errorf("expected 2 to 4 DUMPs in flight, got %d", maxInFlight)
+	}
+}
+
+// Test the first error aborts all workers, each returning it
+func TestWriteFailFast(t *testing.T) {
+	var restored int32
+	restore := func(args []string) interface{} {
+		if args[1] == "bad" {
+			return errors.New("ERR bad payload")
+		}
+		// Later failures of other workers aren't surfaced
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&restored, 1)
+		return errors.New("ERR later failure")
+	}
+
+	ch = make(message.Bus, 100)
+	ch <- message.Payload{Key: "bad", Value: "value", TTL: "0"}
+	for i := 0; i < 50; i++ {
+		ch <- message.Payload{Key: fmt.Sprintf("key%d", i), Value: "value", TTL: "0"}
+	}
+	close(ch)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	failFast := redis.NewFailFast(cancel)
+
+	// A worker takes the failing key first, the others slow ones
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		target := redis.New(stubPool{fn: func(args []string) interface{} {
+			if args[0] == "RESTORE" {
+				return restore(args)
+			}
+			return "OK"
+		}}, ch, true, false)
+		target.FailFast = failFast
+		go func() {
+			errs <- target.Write(ctx)
+		}()
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := <-errs; err == nil || !strings.Contains(err.Error(), "ERR bad payload") {
+			t.Errorf("expected the first error, got %v", err)
+		}
+	}
+	if failFast.Err() == nil || ctx.Err() == nil {
+		t.Error("the run should be cancelled")
+	}
+	// Only keys in flight when the first error happened are restored
+	if n := atomic.LoadInt32(&restored); n > 2 {
+		t.Errorf("expected at most 2 more restores, got %d", n)
+	}
+}
+
+// Test restored keys get an audit entry, failed ones don't
+func TestWriteAudit(t *testing.T) {
+	db := stub(map[string]func(args []string) interface{}{
+		"RESTORE": func(args []string) interface{} {
+			if args[1] == "key2" {
+				return errors.New("ERR Bad data format")
+			}
+			return "OK"
+		},
+	})
+
+	f, err := ioutil.TempFile("", "rump-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	ledger, err := audit.NewFile(f.Name(), true)
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	ch = make(message.Bus, 100)
+	target := redis.New(db, ch, false, false)
+	target.Audit = ledger
+	target.ContinueOnError = true
+	for _, key := range []string{"key1", "key2", "key3"} {
+		ch <- message.Payload{Key: key, Value: "value1", TTL: "30000"}
+	}
+	close(ch)
+	if err := target.Write(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+	ledger.Close()
+
+	data, _ := ioutil.ReadFile(f.Name())
+	if n, err := audit.Verify(bytes.NewReader(data)); n != 2 || err != nil {
+		t.Errorf("expected 2 chained entries, got %d, %v", n, err)
+	}
+	if !strings.Contains(string(data), `"key":"key1","size":6,"ttl":30000`) || strings.Contains(string(data), "key2") {
+		t.Errorf("wrong entries: %s", data)
+	}
+}
+
+// Test keys get a record of their outcome, restored, failed or skipped
+func TestWriteRecords(t *testing.T) {
+	db := stub(map[string]func(args []string) interface{}{
+		"RESTORE": func(args []string) interface{} {
+			if args[1] == "key2" {
+				return errors.New("ERR Bad data format")
+			}
+			return "OK"
+		},
+	})
+
+	f, err := ioutil.TempFile("", "rump-records")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	l, err := records.New(f.Name(), "run1")
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	ch = make(message.Bus, 100)
+	target := redis.New(db, ch, true, false)
+	target.Records = l
+	target.ContinueOnError = true
+	target.Summary = summary.New()
+	ch <- message.Payload{Key: "key1", Type: "hash", Value: "value1", TTL: "30000"}
+	ch <- message.Payload{Key: "key2", Value: "value1", TTL: "0"}
+	ch <- message.Payload{Key: "key3", Value: "", TTL: "0"}
+	close(ch)
+	if err := target.Write(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+	l.Close()
+
+	// The bodies of the rows, their values back to back, 0 taking no bytes
+	data, _ := ioutil.ReadFile(f.Name())
+	for _, record := range []string{
+		"key1hash\x06\x75\x30restored",
+		"key2failedERR Bad data format",
+		"key3empty-value",
+	} {
+		if !strings.Contains(string(data), record) {
+			t.Errorf("expected %q in %q", record, data)
+		}
+	}
+}
+
+// Test keys expiring between DUMP and PTTL are skipped, and counted
+func TestReadRaceDeleted(t *testing.T) {
+	for _, ttlCmd := range []string{"PTTL", "TTL"} {
+		ch = make(message.Bus, 100)
+		db := stub(map[string]func(args []string) interface{}{
+			"SCAN": func(args []string) interface{} {
+				return []interface{}{"0", []string{"key1", "expired"}}
+			},
+			"PTTL": func(args []string) interface{} {
+				if ttlCmd == "TTL" {
+					return errors.New("ERR unknown command 'PTTL'")
+				}
+				if args[1] == "expired" {
+					return -2
+				}
+				return 30000
+			},
+			"TTL": func(args []string) interface{} {
+				if args[1] == "expired" {
+					return -2
+				}
+				return 30
+			},
+		})
+		sum := summary.New()
+		source := redis.New(db, ch, false, true)
+		source.Summary = sum
+
+		if err := source.Read(context.Background()); err != nil {
+			t.Fatal("error: ", err)
+		}
+		if len(ch) != 1 {
+			t.Fatalf("%s: only key1 should be read, got %d keys", ttlCmd, len(ch))
+		}
+		if p := <-ch; p.Key != "key1" || p.TTL != "30000" {
+			t.Errorf("%s: wrong payload: %+v", ttlCmd, p)
+		}
+		if sum.Get("race-deleted") != 1 {
+			t.Errorf("%s: wrong race-deleted count: %d", ttlCmd, sum.Get("race-deleted"))
+		}
+	}
+}
+
+// sliceSource is a KeySource of a fixed list of keys, failing with err once
+// they're all read, when set.
+type sliceSource struct {
+	keys []string
+	err  error
+}
+
+func (s *sliceSource) Next(ctx context.Context) (string, bool, error) {
+	if len(s.keys) == 0 {
+		return "", false, s.err
+	}
+	key := s.keys[0]
+	s.keys = s.keys[1:]
+
+	return key, true, nil
+}
+
+// Test keys are read off a custom KeySource, filtered client-side, without SCAN
+func TestReadKeySource(t *testing.T) {
+	ch = make(message.Bus, 100)
+	db := stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			return errors.New("ERR SCAN called")
+		},
+	})
+	sum := summary.New()
+	source := redis.New(db, ch, false, false)
+	source.KeySource = &sliceSource{keys: []string{"user:1", "session:1", "user:2"}}
+	source.Filter = filter.Filter{Match: []string{"user:*"}}
+	source.Summary = sum
+
+	if err := source.Read(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+	var keys []string
+	for p := range ch {
+		keys = append(keys, p.Key)
+	}
+	if !reflect.DeepEqual(keys, []string{"user:1", "user:2"}) {
+		t.Errorf("wrong keys read: %v", keys)
+	}
+	if sum.Get("excluded") != 1 {
+		t.Errorf("wrong excluded count: %d", sum.Get("excluded"))
+	}
+
+	// Source errors abort the read
+	ch = make(message.Bus, 100)
+	source = redis.New(db, ch, false, false)
+	source.KeySource = &sliceSource{keys: []string{"user:1"}, err: errors.New("table gone")}
+	if err := source.Read(context.Background()); err == nil || err.Error() != "table gone" {
+		t.Errorf("expected the source error, got %v", err)
+	}
+}
+
+// Test keys are read sorted, once each, up to MaxKeys
+func TestReadSorted(t *testing.T) {
+	ch = make(message.Bus, 100)
+	db := stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			// SCAN may return keys more than once
+			return []interface{}{"0", []string{"key3", "key1", "key2", "key1"}}
+		},
+	})
+	source := redis.New(db, ch, false, false)
+	source.Sort = true
+	source.MaxKeys = 3
+
+	if err := source.Read(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+	var keys []string
+	for p := range ch {
+		keys = append(keys, p.Key)
+	}
+	if !reflect.DeepEqual(keys, []string{"key1", "key2", "key3"}) {
+		t.Errorf("wrong keys order: %v", keys)
+	}
+
+	ch = make(message.Bus, 100)
+	source = redis.New(db, ch, false, false)
+	source.Sort = true
+	source.MaxKeys = 2
+	if err := source.Read(context.Background()); err == nil || !strings.Contains(err.Error(), "more than 2 keys") {
+		t.Errorf("expected the max keys error, got %v", err)
+	}
+}
+
+// Test large keys are counted and still read, with their type and encoding
+func TestReadLargeKeys(t *testing.T) {
+	ch = make(message.Bus, 100)
+	var inspected []string
+	db := stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			return []interface{}{"0", []string{"key1", "big"}}
+		},
+		"DUMP": func(args []string) interface{} {
+			if args[1] == "big" {
+				return strings.Repeat("v", 100)
+			}
+			return "value1"
+		},
+		"TYPE": func(args []string) interface{} {
+			inspected = append(inspected, "TYPE "+args[1])
+			return "hash"
+		},
+		"OBJECT": func(args []string) interface{} {
+			inspected = append(inspected, "OBJECT "+args[2])
+			return "hashtable"
+		},
+	})
+	sum := summary.New()
+	source := redis.New(db, ch, false, false)
+	source.LargeSize = 100
+	source.LargeEncoding = true
+	source.Summary = sum
+
+	if err := source.Read(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+	if len(ch) != 2 {
+		t.Errorf("large keys should still be read, got %d keys", len(ch))
+	}
+	if sum.Get("large-keys") != 1 {
+		t.Errorf("wrong large-keys count: %d", sum.Get("large-keys"))
+	}
+	if !reflect.DeepEqual(inspected, []string{"TYPE big", "OBJECT big"}) {
+		t.Errorf("only the large key should be inspected, got %v", inspected)
+	}
+}
+
+// Test tombstones of incremental dumps delete their keys
+func TestWriteTombstone(t *testing.T) {
+	var cmds []string
+	db := stub(map[string]func(args []string) interface{}{
+		"DEL": func(args []string) interface{} {
+			cmds = append(cmds, "DEL "+args[1])
+			return 1
+		},
+		"RESTORE": func(args []string) interface{} {
+			cmds = append(cmds, "RESTORE "+args[1])
+			return "OK"
+		},
+	})
+	ch = make(message.Bus, 100)
+	sum := summary.New()
+	target := redis.New(db, ch, false, false)
+	target.Summary = sum
+	ch <- message.Payload{Key: "changed", Value: "value1", TTL: "0"}
+	ch <- message.Payload{Key: "deleted", TTL: "0", Tombstone: true}
+	close(ch)
+	if err := target.Write(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	if !reflect.DeepEqual(cmds, []string{"RESTORE changed", "DEL deleted"}) || sum.Get("tombstoned") != 1 {
+		t.Errorf("wrong commands: %v, %s", cmds, sum)
+	}
+}
+
+// Test restored keys are tracked per cluster node, skewed nodes reported
+func TestWriteBalance(t *testing.T) {
+	ch = make(message.Bus, 2000)
+	db := stub(map[string]func(args []string) interface{}{
+		"CLUSTER": func(args []string) interface{} {
+			return []interface{}{
+				[]interface{}{0, 8191, []interface{}{"10.0.0.1", 7000, "id1"}},
+				[]interface{}{8192, 16383, []interface{}{"10.0.0.2", 7000, "id2"}},
+			}
+		},
+	})
+	balance, err := redis.NewBalance(db, 1.5, time.Microsecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := summary.New()
+	target := redis.New(db, ch, true, false)
+	target.Balance = balance
+	target.Summary = sum
+
+	// {a} hashes to slot 15495, on the second node, {b} to 3300
+	for i := 0; i < 1500; i++ {
+		ch <- message.Payload{Key: fmt.Sprintf("{a}:%d", i), Value: "value1", TTL: "0"}
+	}
+	for i := 0; i < 100; i++ {
+		ch <- message.Payload{Key: fmt.Sprintf("{b}:%d", i), Value: "value1", TTL: "0"}
+	}
+	close(ch)
+
+	if err := target.Write(context.Background()); err != nil {
+		t.Error("error: ", err)
+	}
+	balance.Report(sum)
+
+	for _, note := range []string{
+		"summary: cluster node 10.0.0.1:7000 keys=100 (6.2%) slots=8192 (50.0%)\n",
+		"summary: cluster node 10.0.0.2:7000 keys=1500 (93.8%) slots=8192 (50.0%), skewed",
+	} {
+		if !strings.Contains(sum.String(), note) {
+			t.Errorf("expected %q in: %s", note, sum)
+		}
+	}
+}
+
+// Test quieted error lines are counted, the first ones noted
+func TestWriteQuietErrors(t *testing.T) {
+	ch = make(message.Bus, 100)
+	db := stub(map[string]func(args []string) interface{}{
+		"RESTORE": func(args []string) interface{} {
+			return errors.New("ERR target unavailable")
+		},
+	})
+	sum := summary.New()
+	target := redis.New(db, ch, true, false)
+	target.ContinueOnError = true
+	target.QuietErrors = true
+	target.Summary = sum
+
+	for i := 1; i <= 7; i++ {
+		ch <- message.Payload{Key: fmt.Sprintf("key%d", i), Value: "value1", TTL: "0"}
+	}
+	ch <- message.Payload{Key: "key8", Value: "value1", TTL: "-5"}
+	close(ch)
+
+	if err := target.Write(context.Background()); err != nil {
+		t.Error("error: ", err)
+	}
+
+	if sum.Get("quieted") != 8 || sum.Get("failed") != 7 || sum.Get("invalid-ttl") != 1 {
+		t.Errorf("expected 8 quieted, 7 failed and 1 invalid-ttl, result: %s", sum)
+	}
+	s := sum.String()
+	if !strings.Contains(s, `summary: quieted: error restoring key "key1", continuing; error=ERR target unavailable`) ||
+		!strings.Contains(s, `key5"`) || strings.Contains(s, `key6"`) {
+		t.Errorf("expected the first 5 quieted lines noted, result: %s", s)
+	}
+}
+
+// Test key names are listed without DUMP, filtered by TYPE, up to max
+func TestListKeys(t *testing.T) {
+	var dumped bool
+	db := stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			return []interface{}{"0", []string{"user:1", "user:2", "session:1", "user:3", "user:4"}}
+		},
+		"TYPE": func(args []string) interface{} {
+			if args[1] == "user:2" {
+				return "string"
+			}
+			return "hash"
+		},
+		"DUMP": func(args []string) interface{} {
+			dumped = true
+			return "value1"
+		},
+	})
+	source := redis.New(db, nil, false, false)
+	source.Filter = filter.Filter{Match: []string{"user:*", "session:*"}, Exclude: []string{"session:*"}}
+
+	var out bytes.Buffer
+	n, err := source.ListKeys(context.Background(), &out, []string{"hash"}, 2)
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	if n != 2 || out.String() != "user:1\nuser:3\n" || dumped {
+		t.Errorf("expected user:1 and user:3 without DUMP, result: %d %q", n, out.String())
+	}
+
+	out.Reset()
+	if n, err := source.ListKeys(context.Background(), &out, nil, 0); err != nil || n != 4 {
+		t.Errorf("expected 4 keys, result: %d %q %v", n, out.String(), err)
+	}
+}
+
+// Test the LRU/LFU metadata of Payloads is restored with IDLETIME or FREQ
+func TestWriteIdleFreq(t *testing.T) {
+	ch = make(message.Bus, 100)
+	restored := map[string][]string{}
+	db := stub(map[string]func(args []string) interface{}{
+		"RESTORE": func(args []string) interface{} {
+			restored[args[1]] = args[4:]
+			return "OK"
+		},
+	})
+	target := redis.New(db, ch, true, false)
+
+	ch <- message.Payload{Key: "a", Value: "value1", TTL: "0", Idle: "120"}
+	ch <- message.Payload{Key: "b", Value: "value1", TTL: "0", Freq: "5"}
+	ch <- message.Payload{Key: "c", Value: "value1", TTL: "0"}
+	close(ch)
+
+	if err := target.Write(context.Background()); err != nil {
+		t.Error("error: ", err)
+	}
+
+	expected := map[string][]string{
+		"a": {"REPLACE", "IDLETIME", "120"},
+		"b": {"REPLACE", "FREQ", "5"},
+		"c": {"REPLACE"},
+	}
+	if !reflect.DeepEqual(restored, expected) {
+		t.Errorf("expected: %v, result: %v", expected, restored)
+	}
+}
+
+// Test keys expired but not yet evicted, PTTL 0, are skipped, not restored
+// without expiration, with PTTL or its TTL fallback
+func TestReadExpired(t *testing.T) {
+	for _, seconds := range []bool{false, true} {
+		ch = make(message.Bus, 100)
+		ttls := map[string]int{"live": 5000, "zombie": 0, "persistent": -1}
+		db := stub(map[string]func(args []string) interface{}{
+			"SCAN": func(args []string) interface{} {
+				return []interface{}{"0", []string{"live", "zombie", "persistent"}}
+			},
+			"PTTL": func(args []string) interface{} {
+				if seconds {
+					return errors.New("ERR unknown command 'PTTL'")
+				}
+				return ttls[args[1]]
+			},
+			"TTL": func(args []string) interface{} {
+				if ttls[args[1]] > 0 {
+					return ttls[args[1]] / 1000
+				}
+				return ttls[args[1]]
+			},
+		})
+		source := redis.New(db, ch, true, true)
+		source.Summary = summary.New()
+		if err := source.Read(context.Background()); err != nil {
+			t.Fatal("error: ", err)
+		}
+
+		read := map[string]string{}
+		for p := range ch {
+			read[p.Key] = p.TTL
+		}
+		expected := map[string]string{"live": "5000", "persistent": "0"}
+		if !reflect.DeepEqual(read, expected) {
+			t.Errorf("seconds %v expected: %v, result: %v", seconds, expected, read)
+		}
+		if n := source.Summary.Get("expired-skipped"); n != 1 {
+			t.Errorf("seconds %v wrong expired-skipped count: %d", seconds, n)
+		}
+	}
+}
+
+// Test TTL only syncs read PTTLs without DUMP, and update target TTLs
+func TestTTLOnly(t *testing.T) {
+	ch = make(message.Bus, 100)
+	source := redis.New(stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			return []interface{}{"0", []string{"changed", "same", "persisted", "missing"}}
+		},
+		"DUMP": func(args []string) interface{} {
+			t.Errorf("ttl only reads shouldn't DUMP %s", args[1])
+			return "value1"
+		},
+		"PTTL": func(args []string) interface{} {
+			return map[string]int{"changed": 60000, "same": 30000, "persisted": -1, "missing": 5000}[args[1]]
+		},
+	}), ch, true, true)
+	source.TTLOnly = true
+	source.Summary = summary.New()
+	if err := source.Read(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	var updates []string
+	target := redis.New(stub(map[string]func(args []string) interface{}{
+		"PTTL": func(args []string) interface{} {
+			return map[string]int{"changed": 1000, "same": 29500, "persisted": 1000, "missing": -2}[args[1]]
+		},
+		"PEXPIRE": func(args []string) interface{} {
+			updates = append(updates, strings.Join(args, " "))
+			return 1
+		},
+		"PERSIST": func(args []string) interface{} {
+			updates = append(updates, strings.Join(args, " "))
+			return 1
+		},
+		"RESTORE": func(args []string) interface{} {
+			t.Errorf("ttl only writes shouldn't RESTORE %s", args[1])
+			return "OK"
+		},
+	}), ch, true, true)
+	target.TTLOnly = true
+	target.Summary = summary.New()
+	if err := target.Write(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	expected := []string{"PEXPIRE changed 60000", "PERSIST persisted"}
+	if !reflect.DeepEqual(updates, expected) {
+		t.Errorf("expected: %v, result: %v", expected, updates)
+	}
+	for name, n := range map[string]int64{"ttl-updated": 2, "ttl-unchanged": 1, "ttl-missing": 1} {
+		if target.Summary.Get(name) != n {
+			t.Errorf("wrong %s count: %d", name, target.Summary.Get(name))
+		}
+	}
+}
+
+// Test MODULE LIST parsing, and keys of modules missing on the target skipped
+func TestModules(t *testing.T) {
+	source := stub(map[string]func(args []string) interface{}{
+		"MODULE": func(args []string) interface{} {
+			return []interface{}{
+				[]interface{}{"name", "ReJSON", "ver", 20609},
+				[]interface{}{"name", "bf", "ver", 20612},
+			}
+		},
+	})
+	target := stub(map[string]func(args []string) interface{}{
+		"MODULE": func(args []string) interface{} {
+			return []interface{}{[]interface{}{"name", "bf", "ver", 20612}}
+		},
+	})
+	sourceModules, err := redis.New(source, nil, true, false).Modules()
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	targetModules, err := redis.New(target, nil, true, false).Modules()
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	if !reflect.DeepEqual(sourceModules, []string{"ReJSON", "bf"}) {
+		t.Errorf("wrong source modules: %v", sourceModules)
+	}
+	missing := redis.MissingModules(sourceModules, targetModules)
+	if !reflect.DeepEqual(missing, []string{"ReJSON"}) {
+		t.Errorf("wrong missing modules: %v", missing)
+	}
+
+	ch = make(message.Bus, 100)
+	db := stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			return []interface{}{"0", []string{"doc:1", "bloom:1", "user:1"}}
+		},
+		"TYPE": func(args []string) interface{} {
+			return map[string]string{"doc:1": "ReJSON-RL", "bloom:1": "MBbloom--", "user:1": "hash"}[args[1]]
+		},
+	})
+	r := redis.New(db, ch, true, false)
+	r.SkipModules = map[string]bool{"ReJSON": true}
+	r.QuietErrors = true
+	r.Summary = summary.New()
+	if err := r.Read(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+	var keys []string
+	for p := range ch {
+		keys = append(keys, p.Key)
+	}
+	if !reflect.DeepEqual(keys, []string{"bloom:1", "user:1"}) || r.Summary.Get("skipped-module") != 1 {
+		t.Errorf("wrong keys read: %v, %s", keys, r.Summary)
+	}
+}
+
+// Test keys of SkipTypes are skipped, and listed to Skipped
+func TestReadSkipTypes(t *testing.T) {
+	f, err := ioutil.TempFile("", "rump-skipped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	ch = make(message.Bus, 100)
+	db := stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			return []interface{}{"0", []string{"doc:1", "bloom:1", "user:1"}}
+		},
+		"TYPE": func(args []string) interface{} {
+			return map[string]string{"doc:1": "ReJSON-RL", "bloom:1": "MBbloom--", "user:1": "hash"}[args[1]]
+		},
+	})
+	skipped, err := redis.NewDeadLetter(f.Name())
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	r := redis.New(db, ch, true, false)
+	r.SkipModules = map[string]bool{"ReJSON": true}
+	r.SkipTypes = map[string]bool{"MBbloom--": true}
+	r.Skipped = skipped
+	r.QuietErrors = true
+	r.Summary = summary.New()
+	if err := r.Read(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+	skipped.Close()
+	var keys []string
+	for p := range ch {
+		keys = append(keys, p.Key)
+	}
+	if !reflect.DeepEqual(keys, []string{"user:1"}) || r.Summary.Get("skipped-module") != 1 || r.Summary.Get("skipped-type") != 1 {
+		t.Errorf("wrong keys read: %v, %s", keys, r.Summary)
+	}
+
+	f, err = os.Open(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	listed, err := redis.ReadKeys(f)
+	if err != nil || !reflect.DeepEqual(listed, []string{"doc:1", "bloom:1"}) {
+		t.Errorf("wrong keys listed: %v, error: %v", listed, err)
+	}
+}
+
+// Test only string keys of matching values are read, other types optionally
+func TestReadValueMatch(t *testing.T) {
+	for _, others := range []bool{false, true} {
+		ch = make(message.Bus, 100)
+		db := stub(map[string]func(args []string) interface{}{
+			"SCAN": func(args []string) interface{} {
+				return []interface{}{"0", []string{"s:42", "s:7", "h:1"}}
+			},
+			"GET": func(args []string) interface{} {
+				switch args[1] {
+				case "s:42":
+					return `{"user_id":42}`
+				case "s:7":
+					return `{"user_id":7}`
+				}
+				return errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+			},
+		})
+		source := redis.New(db, ch, true, false)
+		source.ValueMatch = regexp.MustCompile(`"user_id":42\b`)
+		source.ValueOthers = others
+		source.Summary = summary.New()
+		if err := source.Read(context.Background()); err != nil {
+			t.Fatal("error: ", err)
+		}
+
+		var keys []string
+		for p := range ch {
+			keys = append(keys, p.Key)
+		}
+		expected := []string{"s:42"}
+		if others {
+			expected = append(expected, "h:1")
+		}
+		if !reflect.DeepEqual(keys, expected) {
+			t.Errorf("others %v expected: %v, result: %v", others, expected, keys)
+		}
+		if n := source.Summary.Get("value-unmatched"); n != 1 {
+			t.Errorf("wrong value-unmatched count: %d", n)
+		}
+	}
+}
+
+// Test merged sources tag their Payloads, restored ones counted by source
+func TestMergeSourceTallies(t *testing.T) {
+	sum := summary.New()
+	payloads := make(message.Bus, 100)
+	sources := map[string]string{}
+	read := func(name string, keys []string) {
+		bus := make(message.Bus, 100)
+		db := stub(map[string]func(args []string) interface{}{
+			"SCAN": func(args []string) interface{} {
+				return []interface{}{"0", keys}
+			},
+		})
+		source := redis.New(db, bus, true, false)
+		source.Name = name
+		source.Summary = sum
+		if err := source.Read(context.Background()); err != nil {
+			t.Fatal("error: ", err)
+		}
+		for p := range bus {
+			sources[p.Key] = p.Source
+			payloads <- p
+		}
+	}
+	read("redis://a:6379/0", []string{"a1", "a2"})
+	read("redis://b:6379/0", []string{"b1"})
+	close(payloads)
+	expected := map[string]string{"a1": "redis://a:6379/0", "a2": "redis://a:6379/0", "b1": "redis://b:6379/0"}
+	if !reflect.DeepEqual(sources, expected) {
+		t.Errorf("expected: %v, result: %v", expected, sources)
+	}
+
+	target := redis.New(stub(nil), payloads, true, false)
+	target.Summary = sum
+	if err := target.Write(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+	for name, n := range map[string]int64{"restored": 3, "restored-from-redis://a:6379/0": 2, "restored-from-redis://b:6379/0": 1} {
+		if sum.Get(name) != n {
+			t.Errorf("wrong %s count: %d", name, sum.Get(name))
+		}
+	}
+}
+
+// Test empty values, that RESTORE refuses, are skipped without aborting
+func TestWriteEmptyValue(t *testing.T) {
+	ch = make(message.Bus, 100)
+	var restored []string
+	db := stub(map[string]func(args []string) interface{}{
+		"RESTORE": func(args []string) interface{} {
+			if args[3] == "" {
+				return errors.New("ERR Bad data format")
+			}
+			restored = append(restored, args[1])
+			return "OK"
+		},
+	})
+	target := redis.New(db, ch, true, false)
+	target.QuietErrors = true
+	target.Summary = summary.New()
+
+	ch <- message.Payload{Key: "empty", Value: "", TTL: "0"}
+	ch <- message.Payload{Key: "key1", Value: "value1", TTL: "0"}
+	close(ch)
+
+	if err := target.Write(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+	if !reflect.DeepEqual(restored, []string{"key1"}) {
+		t.Errorf("expected: [key1], result: %v", restored)
+	}
+	if n := target.Summary.Get("empty-value"); n != 1 {
+		t.Errorf("wrong empty-value count: %d", n)
+	}
+}
+
+// Test out of range LRU/LFU metadata is clamped, or dropped, at the bounds
+// RESTORE takes, or sent as is to fail
+func TestWriteInvalidMetadata(t *testing.T) {
+	payloads := []message.Payload{
+		{Key: "idle0", Idle: "0"},
+		{Key: "idle-1", Idle: "-1"},
+		{Key: "idle-x", Idle: "1.5"},
+		{Key: "idle-huge", Idle: "99999999999999999999"},
+		{Key: "freq0", Freq: "0"},
+		{Key: "freq255", Freq: "255"},
+		{Key: "freq256", Freq: "256"},
+		{Key: "freq-1", Freq: "-1"},
+	}
+	cases := map[string]map[string][]string{
+		redis.MetadataClamp: {
+			"idle0":     {"REPLACE", "IDLETIME", "0"},
+			"idle-1":    {"REPLACE", "IDLETIME", "0"},
+			"idle-x":    {"REPLACE"},
+			"idle-huge": {"REPLACE"},
+			"freq0":     {"REPLACE", "FREQ", "0"},
+			"freq255":   {"REPLACE", "FREQ", "255"},
+			"freq256":   {"REPLACE", "FREQ", "255"},
+			"freq-1":    {"REPLACE", "FREQ", "0"},
+		},
+		redis.MetadataDrop: {
+			"idle0":     {"REPLACE", "IDLETIME", "0"},
+			"idle-1":    {"REPLACE"},
+			"idle-x":    {"REPLACE"},
+			"idle-huge": {"REPLACE"},
+			"freq0":     {"REPLACE", "FREQ", "0"},
+			"freq255":   {"REPLACE", "FREQ", "255"},
+			"freq256":   {"REPLACE"},
+			"freq-1":    {"REPLACE"},
+		},
+	}
+	for policy, expected := range cases {
+		ch = make(message.Bus, 100)
+		restored := map[string][]string{}
+		db := stub(map[string]func(args []string) interface{}{
+			"RESTORE": func(args []string) interface{} {
+				restored[args[1]] = args[4:]
+				return "OK"
+			},
+		})
+		target := redis.New(db, ch, true, false)
+		target.Metadata = policy
+		target.QuietErrors = true
+		target.Summary = summary.New()
+
+		for _, p := range payloads {
+			p.Value, p.TTL = "value1", "0"
+			ch <- p
+		}
+		close(ch)
+
+		if err := target.Write(context.Background()); err != nil {
+			t.Fatal("error: ", err)
+		}
+		if !reflect.DeepEqual(restored, expected) {
+			t.Errorf("%s expected: %v, result: %v", policy, expected, restored)
+		}
+		if n := target.Summary.Get("restored"); n != int64(len(payloads)) {
+			t.Errorf("%s expected every key restored, result: %d", policy, n)
+		}
+	}
+
+	// Failing restores, without changing the metadata
+	ch = make(message.Bus, 100)
+	db := stub(map[string]func(args []string) interface{}{
+		"RESTORE": func(args []string) interface{} {
+			if args[len(args)-1] == "256" {
+				return errors.New("ERR Invalid FREQ value, must be >= 0 and <= 255")
+			}
+			return "OK"
+		},
+	})
+	target := redis.New(db, ch, true, false)
+	target.Metadata = redis.MetadataFail
+	ch <- message.Payload{Key: "freq256", Value: "value1", TTL: "0", Freq: "256"}
+	close(ch)
+	if err := target.Write(context.Background()); err == nil {
+		t.Error("expected the invalid FREQ to fail the restore")
+	}
+}
+
+// Test checkpoint reads SCAN from their cursor, stopping between batches
+// once their deadline passed
+func TestReadCheckpoint(t *testing.T) {
+	pages := map[string][]interface{}{
+		"0": {"5", []string{"a", "b"}},
+		"5": {"9", []string{"c"}},
+		"9": {"0", []string{"d"}},
+	}
+	db := stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			if args[1] == "5" {
+				time.Sleep(100 * time.Millisecond)
+			}
+			return pages[args[1]]
+		},
+	})
+
+	read := func(c *redis.Checkpoint) []string {
+		ch := make(message.Bus, 100)
+		source := redis.New(db, ch, true, false)
+		source.Checkpoint = c
+		if err := source.Read(context.Background()); err != nil {
+			t.Fatal("error: ", err)
+		}
+		var keys []string
+		for p := range ch {
+			keys = append(keys, p.Key)
+		}
+		return keys
+	}
+
+	c := redis.NewCheckpoint("0", time.Now().Add(50*time.Millisecond))
+	if keys := read(c); !reflect.DeepEqual(keys, []string{"a", "b", "c"}) || !c.Stopped() || c.Cursor() != "9" {
+		t.Errorf("expected a stop at cursor 9 after a, b and c, result: %v, stopped=%v, cursor=%s", keys, c.Stopped(), c.Cursor())
+	}
+
+	c = redis.NewCheckpoint("9", time.Time{})
+	if keys := read(c); !reflect.DeepEqual(keys, []string{"d"}) || c.Stopped() || c.Cursor() != "0" {
+		t.Errorf("expected d read resumed from cursor 9, result: %v, stopped=%v, cursor=%s", keys, c.Stopped(), c.Cursor())
+	}
+}
+
+// Test keys excluded are counted by the rule they failed
+func TestReadExcludedRules(t *testing.T) {
+	ch = make(message.Bus, 100)
+	db := stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			return []interface{}{"0", []string{"user:1", "user:tmp", "user:abc", "u:1", "order:1"}}
+		},
+	})
+	sum := summary.New()
+	source := redis.New(db, ch, true, false)
+	source.Filter = filter.Filter{
+		Match:        []string{"user:*", "u:*"},
+		Regex:        []*regexp.Regexp{regexp.MustCompile(`:[0-9]+$`)},
+		ExcludeRegex: []*regexp.Regexp{regexp.MustCompile(`tmp`)},
+		MinLength:    4,
+	}
+	source.Summary = sum
+
+	if err := source.Read(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+	var keys []string
+	for p := range ch {
+		keys = append(keys, p.Key)
+	}
+
+	if !reflect.DeepEqual(keys, []string{"user:1"}) {
+		t.Errorf("expected user:1 only, result: %v", keys)
+	}
+	if sum.Get("excluded") != 4 || sum.Get("excluded-exclude-regex") != 1 || sum.Get("excluded-regex") != 1 ||
+		sum.Get("excluded-length") != 1 || sum.Get("excluded-match") != 1 {
+		t.Errorf("expected 4 excluded keys, 1 per rule, result: %s", sum)
+	}
+}
+
+// Test the OOM policies of RESTOREs refused for lack of memory
+func TestWriteOOM(t *testing.T) {
+	oom := errors.New("OOM command not allowed when used memory > 'maxmemory'.")
+	write := func(policy string, restore func(args []string) interface{}) (*summary.Summary, error) {
+		ch = make(message.Bus, 100)
+		db := stub(map[string]func(args []string) interface{}{"RESTORE": restore})
+		sum := summary.New()
+		target := redis.New(db, ch, true, false)
+		target.ContinueOnError = true
+		target.OOM = policy
+		target.OOMRetries = 3
+		target.OOMBackoff = time.Millisecond
+		target.Summary = sum
+		for _, key := range []string{"a", "b", "c"} {
+			ch <- message.Payload{Key: key, Value: "value1", TTL: "0"}
+		}
+		close(ch)
+		return sum, target.Write(context.Background())
+	}
+
+	// Aborted even with ContinueOnError, after the keys restored
+	sum, err := write(redis.OOMAbort, func(args []string) interface{} {
+		if args[1] == "b" {
+			return oom
+		}
+		return "OK"
+	})
+	if !errors.Is(err, redis.ErrOOM) || !strings.Contains(err.Error(), `after 1 keys restored, at key "b"`) {
+		t.Errorf("expected an out of memory error at b, result: %v", err)
+	}
+	if sum.Get("oom") != 1 || !strings.Contains(sum.String(), "policy abort") {
+		t.Errorf("expected the OOM noted, result: %s", sum)
+	}
+
+	sum, err = write(redis.OOMSkip, func(args []string) interface{} {
+		if args[1] == "b" {
+			return oom
+		}
+		return "OK"
+	})
+	if err != nil || sum.Get("oom-skipped") != 1 || sum.Get("restored") != 2 {
+		t.Errorf("expected b skipped, result: %s, error: %v", sum, err)
+	}
+
+	// Retried until eviction frees memory
+	var attempts int
+	sum, err = write(redis.OOMRetry, func(args []string) interface{} {
+		if args[1] == "b" {
+			if attempts++; attempts <= 2 {
+				return oom
+			}
+		}
+		return "OK"
+	})
+	if err != nil || sum.Get("oom-retried") != 2 || sum.Get("restored") != 3 {
+		t.Errorf("expected b restored after 2 retries, result: %s, error: %v", sum, err)
+	}
+
+	// Then aborted once out of retries
+	_, err = write(redis.OOMRetry, func(args []string) interface{} {
+		return oom
+	})
+	if !errors.Is(err, redis.ErrOOM) {
+		t.Errorf("expected an out of memory error, result: %v", err)
+	}
+}
+
+// Test pipelines are flushed by keys count, bytes and interval, whichever
+// comes first, and the last partial pipeline once the bus is closed
+func TestWritePipelined(t *testing.T) {
+	for _, c := range []struct {
+		flush    redis.Flush
+		expected map[string]int64
+	}{
+		{redis.Flush{Keys: 2}, map[string]int64{"pipeline-keys": 2, "pipeline-end": 1}},
+		{redis.Flush{Bytes: 18}, map[string]int64{"pipeline-bytes": 1, "pipeline-end": 1}},
+		{redis.Flush{Keys: 4, Bytes: 12}, map[string]int64{"pipeline-bytes": 2, "pipeline-end": 1}},
+	} {
+		ch = make(message.Bus, 100)
+		var restored []string
+		db := stub(map[string]func(args []string) interface{}{
+			"RESTORE": func(args []string) interface{} {
+				if args[1] == "c" {
+					return errors.New("BUSYKEY Target key name already exists.")
+				}
+				restored = append(restored, args[1])
+				return "OK"
+			},
+		})
+		target := redis.New(db, ch, true, false)
+		target.SkipExisting = true
+		flush := c.flush
+		target.Pipeline = &flush
+		target.Summary = summary.New()
+
+		for _, key := range []string{"a", "b", "c", "d", "e"} {
+			ch <- message.Payload{Key: key, Value: "value1", TTL: "0"}
+		}
+		close(ch)
+
+		if err := target.Write(context.Background()); err != nil {
+			t.Error("error: ", err)
+		}
+		if strings.Join(restored, ",") != "a,b,d,e" {
+			t.Errorf("%v: expected a,b,d,e restored in order, result: %v", c.flush, restored)
+		}
+		if n := target.Summary.Get("skipped-existing"); n != 1 {
+			t.Errorf("%v: expected 1 skipped-existing, result: %d", c.flush, n)
+		}
+		for name, n := range c.expected {
+			if got := target.Summary.Get(name); got != n {
+				t.Errorf("%v: expected %d %s, result: %d", c.flush, n, name, got)
+			}
+		}
+	}
+
+	// A pipeline short of its limits is flushed after the interval
+	ch = make(message.Bus, 100)
+	restored := make(chan string, 1)
+	db := stub(map[string]func(args []string) interface{}{
+		"RESTORE": func(args []string) interface{} {
+			restored <- args[1]
+			return "OK"
+		},
+	})
+	target := redis.New(db, ch, true, false)
+	target.Pipeline = &redis.Flush{Keys: 100, Interval: 10 * time.Millisecond}
+	target.Summary = summary.New()
+	done := make(chan error)
+	go func() { done <- target.Write(context.Background()) }()
+
+	ch <- message.Payload{Key: "a", Value: "value1", TTL: "0"}
+	select {
+	case key := <-restored:
+		if key != "a" {
+			t.Errorf("expected a restored, result: %s", key)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected the pipeline flushed after the interval")
+	}
+	close(ch)
+	if err := <-done; err != nil {
+		t.Error("error: ", err)
+	}
+	if n := target.Summary.Get("pipeline-interval"); n != 1 {
+		t.Errorf("expected 1 pipeline-interval, result: %d", n)
+	}
+}
+
+// Test pipelines are split by hash slot, and keys replied CROSSSLOT are
+// restored again on their own
+func TestWritePipelinedSlots(t *testing.T) {
+	ch = make(message.Bus, 100)
+	var restored []string
+	crossed := false
+	db := stub(map[string]func(args []string) interface{}{
+		"RESTORE": func(args []string) interface{} {
+			if args[1] == "{b}1" && !crossed {
+				crossed = true
+				return errors.New("CROSSSLOT Keys in request don't hash to the same slot")
+			}
+			restored = append(restored, args[1])
+			return "OK"
+		},
+	})
+	target := redis.New(db, ch, true, false)
+	target.Pipeline = &redis.Flush{Keys: 4, Slots: true}
+	target.Summary = summary.New()
+
+	for _, key := range []string{"{a}1", "{b}1", "{a}2", "{b}2"} {
+		ch <- message.Payload{Key: key, Value: "value1", TTL: "0"}
+	}
+	close(ch)
+
+	if err := target.Write(context.Background()); err != nil {
+		t.Error("error: ", err)
+	}
+	// {b}1 is restored again once the replies of its pipeline are read
+	if strings.Join(restored, ",") != "{a}1,{a}2,{b}2,{b}1" {
+		t.Errorf("expected keys restored by slot, result: %v", restored)
+	}
+	if n := target.Summary.Get("restored"); n != 4 {
+		t.Errorf("expected 4 restored, result: %d", n)
+	}
+	if n := target.Summary.Get("pipeline-fallback"); n != 1 {
+		t.Errorf("expected 1 pipeline-fallback, result: %d", n)
+	}
+}
+
+// Test provenance is recorded for restored keys only, in companion keys
+// expiring with them, or in a batch hash
+func TestWriteProvenance(t *testing.T) {
+	for _, template := range []string{"{key}:migrated", "rump:provenance:{batch}"} {
+		ch = make(message.Bus, 100)
+		tagged := map[string][]string{}
+		db := stub(map[string]func(args []string) interface{}{
+			"RESTORE": func(args []string) interface{} {
+				if args[1] == "c" {
+					return errors.New("BUSYKEY Target key name already exists.")
+				}
+				return "OK"
+			},
+			"SET": func(args []string) interface{} {
+				tagged[args[1]] = args[2:]
+				return "OK"
+			},
+			"HSET": func(args []string) interface{} {
+				tagged[args[1]+" "+args[2]] = args[3:]
+				return 1
+			},
+		})
+		target := redis.New(db, ch, true, false)
+		target.SkipExisting = true
+		target.Provenance = &redis.Provenance{Template: template, Batch: "b1"}
+		target.Summary = summary.New()
+
+		ch <- message.Payload{Key: "a", Value: "value1", TTL: "0"}
+		ch <- message.Payload{Key: "b", Value: "value1", TTL: "5000"}
+		ch <- message.Payload{Key: "c", Value: "value1", TTL: "0"}
+		close(ch)
+
+		if err := target.Write(context.Background()); err != nil {
+			t.Error("error: ", err)
+		}
+
+		expected := map[string]int{"a:migrated": 1, "b:migrated": 3}
+		if template != "{key}:migrated" {
+			expected = map[string]int{"rump:provenance:b1 a": 1, "rump:provenance:b1 b": 1}
+		}
+		if len(tagged) != len(expected) {
+			t.Errorf("%s: expected: %v, result: %v", template, expected, tagged)
+		}
+		for name, n := range expected {
+			args := tagged[name]
+			if len(args) != n || !strings.HasPrefix(args[0], `{"batch":"b1","time":"`) {
+				t.Errorf("%s: unexpected %s entry %v", template, name, args)
+			}
+		}
+		if v := tagged["b:migrated"]; len(v) == 3 && (v[1] != "PX" || v[2] != "5000") {
+			t.Errorf("expected b:migrated to expire with b, result: %v", v)
+		}
+		if n := target.Summary.Get("tagged"); n != 2 {
+			t.Errorf("expected 2 tagged, result: %d", n)
+		}
+	}
+}
+
+// Test the run ID is SET as JSON with the source
+func TestMarkRun(t *testing.T) {
+	var set []string
+	db := stub(map[string]func(args []string) interface{}{
+		"SET": func(args []string) interface{} {
+			set = args
+			return "OK"
+		},
+	})
+	target := redis.New(db, nil, true, false)
+
+	if err := target.MarkRun("rump:last-run", "job-42", "redis://s:6379"); err != nil {
+		t.Error("error: ", err)
+	}
+	if len(set) != 3 || set[1] != "rump:last-run" || !strings.HasPrefix(set[2], `{"run_id":"job-42","source":"redis://s:6379","time":"`) {
+		t.Errorf("unexpected SET %v", set)
+	}
+}
+
+// Test keys matching conversions are read as commands recreating them
+// converted, others as is
+func TestReadConvert(t *testing.T) {
+	ch = make(message.Bus, 100)
+	db := stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			return []interface{}{"0", []string{"queue:1", "tags:1", "queue:2", "other"}}
+		},
+		"TYPE": func(args []string) interface{} {
+			switch args[1] {
+			case "queue:1":
+				return "list"
+			case "tags:1":
+				return "set"
+			}
+			return "hash"
+		},
+		"LRANGE": func(args []string) interface{} {
+			return []string{"a", "b", "a"}
+		},
+		"SMEMBERS": func(args []string) interface{} {
+			return []string{"x", "y"}
+		},
+	})
+	source := redis.New(db, ch, true, false)
+	source.Summary = summary.New()
+	source.Conversions = []redis.Conversion{
+		{Pattern: "queue:*", Converter: redis.Converters["list:zset"]},
+		{Pattern: "tags:*", Converter: redis.Converters["set:hash"]},
+	}
+
+	if err := source.Read(context.Background()); err != nil {
+		t.Error("error: ", err)
+	}
+
+	expected := map[string]message.Payload{
+		"queue:1": {Key: "queue:1", Value: resp.Encode("DEL", "queue:1") + resp.Encode("ZADD", "queue:1", "0", "a", "1", "b", "2", "a"), TTL: "0", Commands: true, Type: "zset"},
+		"tags:1":  {Key: "tags:1", Value: resp.Encode("DEL", "tags:1") + resp.Encode("HSET", "tags:1", "x", "1", "y", "1"), TTL: "0", Commands: true, Type: "hash"},
+		"queue:2": {Key: "queue:2", Value: "value1", TTL: "0", Type: "hash"},
+		"other":   {Key: "other", Value: "value1", TTL: "0", Type: "hash"},
+	}
+	for p := range ch {
+		if !reflect.DeepEqual(p, expected[p.Key]) {
+			t.Errorf("expected: %v, result: %v", expected[p.Key], p)
+		}
+	}
+	if n := source.Summary.Get("converted"); n != 2 {
+		t.Errorf("expected 2 converted, result: %d", n)
+	}
+	if n := source.Summary.Get("unconverted"); n != 1 {
+		t.Errorf("expected 1 unconverted, result: %d", n)
+	}
+}
+
+// Test dry runs list keys with their type and TTL, counted as DUMPed,
+// without DUMP or the Bus
+func TestReadDryRun(t *testing.T) {
+	ch = make(message.Bus, 100)
+	db := stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			return []interface{}{"0", []string{"a", "b", "gone", "skipped"}}
+		},
+		"TYPE": func(args []string) interface{} {
+			if args[1] == "gone" {
+				return "none"
+			}
+			return "hash"
+		},
+		"PTTL": func(args []string) interface{} {
+			switch args[1] {
+			case "a":
+				return 30000
+			case "gone":
+				return -2
+			}
+			return -1
+		},
+		"DUMP": func(args []string) interface{} {
+			t.Errorf("unexpected DUMP %s", args[1])
+			return "value1"
+		},
+	})
+	var out bytes.Buffer
+	source := redis.New(db, ch, true, true)
+	source.Filter = filter.Filter{Exclude: []string{"skipped"}}
+	source.DryRun = redis.NewDryRun(&out)
+	source.Summary = summary.New()
+
+	if err := source.Read(context.Background()); err != nil {
+		t.Error("error: ", err)
+	}
+
+	for p := range ch {
+		t.Errorf("unexpected payload %v", p)
+	}
+	expected := `{"key":"a","type":"hash","ttl":30000}` + "\n" + `{"key":"b","type":"hash","ttl":-1}` + "\n"
+	if out.String() != expected {
+		t.Errorf("expected: %q, result: %q", expected, out.String())
+	}
+	for name, n := range map[string]int64{"dumped": 2, "skipped-empty": 1, "excluded": 1} {
+		if got := source.Summary.Get(name); got != n {
+			t.Errorf("expected %d %s, result: %d", n, name, got)
+		}
+	}
+}
+
+// Test string keys are only restored when newer than the target value,
+// other types and missing target keys being restored
+func TestWriteNewer(t *testing.T) {
+	ch = make(message.Bus, 100)
+	targets := map[string]interface{}{
+		"older":   `{"updated_at":5}`,
+		"newer":   `{"updated_at":50}`,
+		"missing": nil,
+	}
+	var restored []string
+	db := stub(map[string]func(args []string) interface{}{
+		"GET": func(args []string) interface{} {
+			return targets[args[1]]
+		},
+		"RESTORE": func(args []string) interface{} {
+			restored = append(restored, args[1])
+			return "OK"
+		},
+	})
+	target := redis.New(db, ch, true, false)
+	target.Newer = redis.NewerField("updated_at")
+	target.Summary = summary.New()
+
+	value := `{"updated_at":10}`
+	payload := string(rdb.Dump(append([]byte{0, byte(len(value))}, value...), 9))
+	for _, key := range []string{"older", "newer", "missing"} {
+		ch <- message.Payload{Key: key, Value: payload, TTL: "0"}
+	}
+	ch <- message.Payload{Key: "list", Value: "value1", TTL: "0"}
+	close(ch)
+
+	if err := target.Write(context.Background()); err != nil {
+		t.Error("error: ", err)
+	}
+
+	expected := []string{"older", "missing", "list"}
+	if !reflect.DeepEqual(restored, expected) {
+		t.Errorf("expected: %v, result: %v", expected, restored)
+	}
+	if n := target.Summary.Get("kept-target"); n != 1 {
+		t.Errorf("expected 1 kept-target, result: %d", n)
+	}
+}
+
+func TestNewerField(t *testing.T) {
+	newer := redis.NewerField("updated_at")
+	cases := []struct {
+		source, target string
+		wins           bool
+	}{
+		{`{"updated_at":10}`, `{"updated_at":9.5}`, true},
+		{`{"updated_at":10}`, `{"updated_at":10}`, false},
+		{`{"updated_at":"2024-05-01T10:00:00Z"}`, `{"updated_at":"2024-05-01T11:00:00+02:00"}`, true},
+		{`{"updated_at":"2024-05-01T09:00:00Z"}`, `{"updated_at":"2024-05-01T10:00:00Z"}`, false},
+		{`{"updated_at":"b"}`, `{"updated_at":"a"}`, true},
+		{`{"id":1}`, `{"updated_at":1}`, false},
+		{`{"updated_at":1}`, `not json`, true},
+		{`plain`, `text`, true},
+		{`{"updated_at":1}`, `{"updated_at":"2024-05-01T10:00:00Z"}`, true},
+	}
+	for _, c := range cases {
+		if wins := newer(c.source, c.target); wins != c.wins {
+			t.Errorf("%s over %s: expected: %v, result: %v", c.source, c.target, c.wins, wins)
+		}
+	}
+}
+
+// Test TTLs within TTLTolerance match in verify and conflict resolution
+func TestTTLTolerance(t *testing.T) {
+	// Target key PTTL is 30000
+	verify, _ := redis.NewVerifier(1, "", false)
+	ch = make(message.Bus, 100)
+	sum := summary.New()
+	target := redis.New(stub(nil), ch, false, true)
+	target.Verify = verify
+	target.Summary = sum
+	ch <- message.Payload{Key: "key1", Value: "value1", TTL: "30500"}
+	ch <- message.Payload{Key: "key2", Value: "value1", TTL: "40000"}
+	close(ch)
+	if err := target.Write(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+	if sum.Get("verified") != 2 || sum.Get("verify-mismatches") != 1 {
+		t.Errorf("wrong counts: verified=%d mismatches=%d", sum.Get("verified"), sum.Get("verify-mismatches"))
+	}
+
+	for _, c := range []struct {
+		tolerance time.Duration
+		restored  bool
+	}{
+		{redis.DefaultTTLTolerance, false},
+		{0, true},
+	} {
+		ch = make(message.Bus, 100)
+		sum := summary.New()
+		target := redis.New(stub(nil), ch, false, true)
+		target.Conflict = redis.LongerTTLWins
+		target.TTLTolerance = c.tolerance
+		target.Summary = sum
+		ch <- message.Payload{Key: "key1", Value: "value1", TTL: "30500"}
+		close(ch)
+		if err := target.Write(context.Background()); err != nil {
+			t.Fatal("error: ", err)
+		}
+		if (sum.Get("restored") == 1) != c.restored {
+			t.Errorf("tolerance %s: restored should be %v, got %s", c.tolerance, c.restored, sum)
+		}
+	}
+}
+
+// Test reading keys off a stream with a consumer group, acking entries
+func TestReadKeysStream(t *testing.T) {
+	ch = make(message.Bus, 100)
+	sum := summary.New()
+	var acked []string
+	served := false
+	db := stub(map[string]func(args []string) interface{}{
+		"XREADGROUP": func(args []string) interface{} {
+			if served {
+				return nil
+			}
+			served = true
+			return []interface{}{
+				[]interface{}{"changes", []interface{}{
+					[]interface{}{"1-0", []string{"key", "key1"}},
+					[]interface{}{"2-0", []string{"other", "x"}},
+					[]interface{}{"3-0", []string{"key", "tmp:1"}},
+				}},
+			}
+		},
+		"XACK": func(args []string) interface{} {
+			acked = append(acked, args[3])
+			return 1
+		},
+	})
+	source := redis.New(db, ch, false, false)
+	source.Filter = filter.Filter{Exclude: []string{"tmp:*"}}
+	source.KeysStream = &redis.KeysStream{Name: "changes", Field: "key", Group: "rump", Consumer: "test"}
+	source.Summary = sum
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- source.Read(ctx)
+	}()
+
+	p := <-ch
+	if p.Key != "key1" || p.Value != "value1" {
+		t.Errorf("wrong payload: %v", p)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Error("error: ", err)
+	}
+
+	if !reflect.DeepEqual(acked, []string{"1-0", "2-0", "3-0"}) {
+		t.Errorf("wrong acked entries: %v", acked)
+	}
+	if sum.Get("invalid") != 1 || sum.Get("excluded") != 1 {
+		t.Errorf("wrong counts: %s", sum)
+	}
+	if !strings.Contains(sum.String(), "last read ID 3-0") {
+		t.Errorf("last read ID should be noted: %s", sum)
+	}
+}
+
+// subscribedPubSub signals its subscription, messages published before
+// being lost.
+type subscribedPubSub struct {
+	radix.PubSubConn
+	subscribed chan struct{}
+}
+
+func (s subscribedPubSub) Subscribe(msgCh chan<- radix.PubSubMessage, channels ...string) error {
+	defer close(s.subscribed)
+	return s.PubSubConn.Subscribe(msgCh, channels...)
+}
+
+// Test reading keys off pub/sub channel messages, filtered
+func TestReadKeysChannel(t *testing.T) {
+	ch = make(message.Bus, 100)
+	sum := summary.New()
+	conn, publish := radix.PubSubStub("tcp", "127.0.0.1:6379", nil)
+	pubsub := subscribedPubSub{PubSubConn: radix.PubSub(conn), subscribed: make(chan struct{})}
+	source := redis.New(stub(nil), ch, false, false)
+	source.Filter = filter.Filter{Exclude: []string{"tmp:*"}}
+	source.KeysChannel = &redis.KeysChannel{Name: "changes", PubSub: pubsub}
+	source.Summary = sum
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- source.Read(ctx)
+	}()
+
+	<-pubsub.subscribed
+	for _, key := range []string{"tmp:1", "", "key1"} {
+		publish <- radix.PubSubMessage{Type: "message", Channel: "changes", Message: []byte(key)}
+	}
+	p := <-ch
+	if p.Key != "key1" || p.Value != "value1" {
+		t.Errorf("wrong payload: %v", p)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Error("error: ", err)
+	}
+
+	if sum.Get("channel-messages") != 3 || sum.Get("invalid") != 1 || sum.Get("excluded") != 1 {
+		t.Errorf("wrong counts: %s", sum)
+	}
+}
+
+// Test string values are rewritten as SET commands, other types DUMP'd
+func TestReadReplace(t *testing.T) {
+	ch = make(message.Bus, 100)
+	db := stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			return []interface{}{"0", []string{"url", "hash"}}
+		},
+		"TYPE": func(args []string) interface{} {
+			if args[1] == "url" {
+				return "string"
+			}
+			return "hash"
+		},
+		"GET": func(args []string) interface{} {
+			return "http://old.example.com/path"
+		},
+	})
+	source := redis.New(db, ch, false, true)
+	source.Replace = strings.NewReplacer("old.example.com", "new.example.com")
+
+	if err := source.Read(context.Background()); err != nil {
+		t.Error("error: ", err)
+	}
+
+	p := <-ch
+	expected := resp.Encode("SET", "url", "http://new.example.com/path") +
+		resp.Encode("PEXPIRE", "url", "30000")
+	if !p.Commands || p.Value != expected {
+		t.Errorf("wrong string payload: %v", p)
+	}
+
+	p = <-ch
+	if p.Commands || p.Value != "value1" {
+		t.Errorf("wrong hash payload: %v", p)
+	}
+}
+
+// Test string keys are read with GETEX to refresh their TTL, others DUMPed
+func TestReadRefresh(t *testing.T) {
+	ch = make(message.Bus, 100)
+	var getex []string
+	db := stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			return []interface{}{"0", []string{"session", "hash"}}
+		},
+		"TYPE": func(args []string) interface{} {
+			if args[1] == "session" {
+				return "string"
+			}
+			return "hash"
+		},
+		"GETEX": func(args []string) interface{} {
+			getex = args
+			return "v1"
+		},
+		"GET": func(args []string) interface{} {
+			return fmt.Errorf("ERR unexpected GET")
+		},
+	})
+	source := redis.New(db, ch, false, true)
+	source.Refresh = time.Hour
+	source.Summary = summary.New()
+
+	if err := source.Read(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	if !reflect.DeepEqual(getex, []string{"GETEX", "session", "PX", "3600000"}) {
+		t.Errorf("wrong GETEX: %v", getex)
+	}
+	p := <-ch
+	expected := resp.Encode("SET", "session", "v1") + resp.Encode("PEXPIRE", "session", "30000")
+	if !p.Commands || p.Value != expected {
+		t.Errorf("wrong string payload: %v", p)
+	}
+	p = <-ch
+	if p.Commands || p.Value != "value1" {
+		t.Errorf("wrong hash payload: %v", p)
+	}
+	if n := source.Summary.Get("refreshed"); n != 1 {
+		t.Errorf("expected 1 refreshed, result: %d", n)
+	}
+}
+
+// Test replaced int encoded strings are checked with OBJECT ENCODING
+func TestReadReplaceEncoding(t *testing.T) {
+	ch = make(message.Bus, 100)
+	values := map[string]string{"count": "42", "shared": "7", "id": "1000", "text": "v1"}
+	db := stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			return []interface{}{"0", []string{"count", "shared", "id", "text"}}
+		},
+		"TYPE": func(args []string) interface{} {
+			return "string"
+		},
+		"GET": func(args []string) interface{} {
+			return values[args[1]]
+		},
+		"OBJECT": func(args []string) interface{} {
+			switch {
+			case args[1] == "REFCOUNT" && args[2] == "shared":
+				return 2147483647
+			case args[1] == "REFCOUNT":
+				return 1
+			case args[2] == "text":
+				return "embstr"
+			}
+			return "int"
+		},
+	})
+	sum := summary.New()
+	source := redis.New(db, ch, true, false)
+	// 42 stays an integer, 7 and 1000 don't, v1 isn't int encoded
+	source.Replace = strings.NewReplacer("42", "43", "7", "007", "1000", "1000 ms", "v1", "v2")
+	source.ReplaceEncoding = true
+	source.Summary = sum
+
+	if err := source.Read(context.Background()); err != nil {
+		t.Error("error: ", err)
+	}
+
+	for name, n := range map[string]int64{"replaced": 4, "int-preserved": 1, "int-decoded": 2, "shared-ints": 1} {
+		if got := sum.Get(name); got != n {
+			t.Errorf("expected %s=%d, result: %s", name, n, sum)
+		}
+	}
+}
+
+// Test rewritten string payloads are replayed by a DUMP target
+func TestWriteReplaced(t *testing.T) {
+	ch = make(message.Bus, 100)
+	var cmds []string
+	db := stub(map[string]func(args []string) interface{}{
+		"SET": func(args []string) interface{} {
+			cmds = append(cmds, strings.Join(args, " "))
+			return "OK"
+		},
+		"RESTORE": func(args []string) interface{} {
+			cmds = append(cmds, strings.Join(args, " "))
+			return "OK"
+		},
+	})
+	target := redis.New(db, ch, false, false)
+
+	ch <- message.Payload{Key: "url", Value: resp.Encode("SET", "url", "new"), TTL: "0", Commands: true}
+	ch <- message.Payload{Key: "hash", Value: "value1", TTL: "0"}
+	close(ch)
+
+	if err := target.Write(context.Background()); err != nil {
+		t.Error("error: ", err)
+	}
+
+	expected := []string{"SET url new", "RESTORE hash 0 value1 REPLACE"}
+	if !reflect.DeepEqual(expected, cmds) {
+		t.Errorf("expected: %v, result: %v", expected, cmds)
+	}
+}
+
+// Test consecutive failures trip the breaker, successes reset it
+func TestWriteMaxFailures(t *testing.T) {
+	ch = make(message.Bus, 100)
+	sum := summary.New()
+	db := stub(map[string]func(args []string) interface{}{
+		"RESTORE": func(args []string) interface{} {
+			if strings.HasPrefix(args[1], "bad") {
+				return errors.New("ERR DUMP payload version or checksum are wrong")
+			}
+			return "OK"
+		},
+	})
+	target := redis.New(db, ch, false, false)
+	target.ContinueOnError = true
+	target.Breaker = redis.NewBreaker(2)
+	target.Summary = sum
+
+	for _, key := range []string{"bad1", "good", "bad2", "bad3", "bad4"} {
+		ch <- message.Payload{Key: key, Value: "value", TTL: "0"}
+	}
+	close(ch)
+
+	err := target.Write(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "unhealthy") {
+		t.Errorf("breaker should trip, got %v", err)
+	}
+
+	if sum.Get("failed") != 3 || sum.Get("restored") != 1 {
+		t.Errorf("wrong counts: %s", sum)
+	}
+	if !strings.Contains(sum.String(), `"bad3": ERR DUMP payload`) {
+		t.Errorf("last errors should be noted: %s", sum)
+	}
+
+	// Workers sharing the breaker count their failures together
+	breaker := redis.NewBreaker(4)
+	sum = summary.New()
+	for i, keys := range [][]string{{"bad1", "bad2"}, {"bad3", "bad4"}} {
+		ch := make(message.Bus, 2)
+		worker := redis.New(db, ch, false, false)
+		worker.ContinueOnError = true
+		worker.Breaker = breaker
+		worker.Summary = sum
+		for _, key := range keys {
+			ch <- message.Payload{Key: key, Value: "value", TTL: "0"}
+		}
+		close(ch)
+		err := worker.Write(context.Background())
+		switch {
+		case i == 0 && err != nil:
+			t.Errorf("breaker shouldn't trip yet, got %v", err)
+		case i == 1 && (err == nil || !strings.Contains(err.Error(), "4 consecutive failures")):
+			t.Errorf("breaker should trip across workers, got %v", err)
+		}
+	}
+}
+
+// Test replicas are waited for until caught up with the source offset
+func TestWaitOffset(t *testing.T) {
+	source := stub(map[string]func(args []string) interface{}{
+		"INFO": func(args []string) interface{} {
+			return "# Replication\r\nrole:master\r\nmaster_repl_offset:1200\r\n"
+		},
+	})
+	offset, err := redis.New(source, nil, true, false).ReplOffset()
+	if err != nil || offset != 1200 {
+		t.Fatalf("expected offset 1200, result: %d, error: %v", offset, err)
+	}
+
+	replies := []string{
+		"role:slave\r\nmaster_link_status:down\r\nslave_repl_offset:1300\r\n",
+		"role:slave\r\nmaster_link_status:up\r\nslave_repl_offset:1100\r\n",
+		"role:slave\r\nmaster_link_status:up\r\nslave_repl_offset:1250\r\n",
+	}
+	var detached []string
+	replica := stub(map[string]func(args []string) interface{}{
+		"INFO": func(args []string) interface{} {
+			reply := replies[0]
+			if len(replies) > 1 {
+				replies = replies[1:]
+			}
+			return reply
+		},
+		"REPLICAOF": func(args []string) interface{} {
+			detached = args
+			return "OK"
+		},
+	})
+	r := redis.New(replica, nil, true, false)
+	reached, err := r.WaitOffset(context.Background(), offset, time.Millisecond)
+	if err != nil || reached != 1250 {
+		t.Errorf("expected offset 1250, result: %d, error: %v", reached, err)
+	}
+	if err := r.Detach(); err != nil || !reflect.DeepEqual(detached, []string{"REPLICAOF", "NO", "ONE"}) {
+		t.Errorf("expected REPLICAOF NO ONE, result: %v, error: %v", detached, err)
+	}
+
+	// Lagging replicas time out, primaries aren't waited for
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := r.WaitOffset(ctx, 5000, time.Millisecond); err == nil || !strings.Contains(err.Error(), "at offset 1250 of 5000") {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+	if _, err := redis.New(source, nil, true, false).WaitOffset(ctx, 0, time.Millisecond); err == nil {
+		t.Error("primaries should be errors")
+	}
+}
+
+// Test snapshots waiting for a BGSAVE already in progress, then their own
+func TestSnapshot(t *testing.T) {
+	persistence := func(inProgress, lastSave int, status string) string {
+		return fmt.Sprintf("# Persistence\r\nrdb_bgsave_in_progress:%d\r\nrdb_last_save_time:%d\r\nrdb_last_bgsave_status:%s\r\n", inProgress, lastSave, status)
+	}
+	run := func(infos []string) (string, int, error) {
+		bgsaves := 0
+		db := stub(map[string]func(args []string) interface{}{
+			"CONFIG": func(args []string) interface{} {
+				if args[2] == "dir" {
+					return []string{"dir", "/data"}
+				}
+				return []string{"dbfilename", "dump.rdb"}
+			},
+			"INFO": func(args []string) interface{} {
+				info := infos[0]
+				if len(infos) > 1 {
+					infos = infos[1:]
+				}
+				return info
+			},
+			"BGSAVE": func(args []string) interface{} {
+				bgsaves++
+				if bgsaves == 1 {
+					return errors.New("ERR Background save already in progress")
+				}
+				return "Background saving started"
+			},
+		})
+		path, err := redis.New(db, nil, true, false).Snapshot(context.Background(), time.Millisecond)
+		return path, bgsaves, err
+	}
+
+	path, bgsaves, err := run([]string{
+		persistence(1, 100, "ok"),
+		persistence(1, 100, "ok"),
+		persistence(0, 101, "ok"),
+		persistence(1, 101, "ok"),
+		persistence(0, 102, "ok"),
+	})
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	if path != "/data/dump.rdb" || bgsaves != 2 {
+		t.Errorf("wrong snapshot: %s after %d BGSAVE", path, bgsaves)
+	}
+
+	// Saves finishing within the second of the previous one
+	if _, _, err := run([]string{
+		persistence(1, 100, "ok"),
+		persistence(1, 100, "ok"),
+		persistence(0, 100, "ok"),
+		persistence(1, 100, "ok"),
+		persistence(0, 100, "ok"),
+	}); err != nil {
+		t.Error("error: ", err)
+	}
+
+	if _, _, err := run([]string{
+		persistence(1, 100, "ok"),
+		persistence(0, 101, "ok"),
+		persistence(0, 102, "err"),
+	}); err == nil || !strings.Contains(err.Error(), "rdb_last_bgsave_status:err") {
+		t.Errorf("failed saves should error: %v", err)
+	}
+}
+
+// Test restored keys are deleted from the source while unchanged since read,
+// keys failed, skipped or mismatched on verify left there
+func TestMove(t *testing.T) {
+	values := map[string]string{"moved": "v1", "renamed": "v1", "changed": "v3 since"}
+	var evals []string
+	source := stub(map[string]func(args []string) interface{}{
+		"EVAL": func(args []string) interface{} {
+			evals = append(evals, args[3])
+			v, ok := values[args[3]]
+			switch {
+			case !ok:
+				return 0
+			case v != args[4]:
+				return -1
+			}
+			delete(values, args[3])
+			return 1
+		},
+	})
+	db := stub(map[string]func(args []string) interface{}{
+		"RESTORE": func(args []string) interface{} {
+			switch args[1] {
+			case "failed":
+				return errors.New("ERR Bad data format")
+			case "existing":
+				return errors.New("BUSYKEY Target key name already exists.")
+			}
+			return "OK"
+		},
+		"DUMP": func(args []string) interface{} {
+			if args[1] == "mismatched" {
+				return "other"
+			}
+			return "v1"
+		},
+	})
+
+	ch := make(message.Bus, 100)
+	target := redis.New(db, ch, true, false)
+	target.Summary = summary.New()
+	target.Move = redis.NewMover(redis.New(source, nil, true, false), 0)
+	target.ContinueOnError = true
+	target.SkipExisting = true
+	target.Verify, _ = redis.NewVerifier(1, "", false)
+	for _, p := range []message.Payload{
+		{Key: "moved", Value: "v1"},
+		{Key: "tenant:renamed", Original: "renamed", Value: "v1"},
+		{Key: "changed", Value: "v1"},
+		{Key: "gone", Value: "v1"},
+		{Key: "failed", Value: "v1"},
+		{Key: "existing", Value: "v1"},
+		{Key: "mismatched", Value: "v1"},
+	} {
+		p.TTL = "0"
+		ch <- p
+	}
+	close(ch)
+	if err := target.Write(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	if !reflect.DeepEqual(evals, []string{"moved", "renamed", "changed", "gone"}) {
+		t.Errorf("wrong keys moved: %v", evals)
+	}
+	if _, ok := values["changed"]; !ok || len(values) != 1 {
+		t.Errorf("wrong source keys left: %v", values)
+	}
+	sum := target.Summary
+	if sum.Get("moved") != 2 || sum.Get("move-changed") != 1 || sum.Get("move-missing") != 1 || sum.Get("move-unverified") != 1 || sum.Get("restored") != 5 {
+		t.Errorf("wrong counts: %s", sum)
+	}
+
+	// Source errors fail the key, left on the source, unless ContinueOnError
+	source = stub(map[string]func(args []string) interface{}{
+		"EVAL": func(args []string) interface{} {
+			return errors.New("READONLY You can't write against a read only replica.")
+		},
+	})
+	for _, continueOnError := range []bool{false, true} {
+		ch := make(message.Bus, 1)
+		target := redis.New(db, ch, true, false)
+		target.Summary = summary.New()
+		target.Move = redis.NewMover(redis.New(source, nil, true, false), 0)
+		target.ContinueOnError = continueOnError
+		ch <- message.Payload{Key: "moved", Value: "v1", TTL: "0"}
+		close(ch)
+		err := target.Write(context.Background())
+		switch {
+		case continueOnError && (err != nil || target.Summary.Get("move-failed") != 1):
+			t.Errorf("expected move-failed counted, result: %v %s", err, target.Summary)
+		case !continueOnError && (err == nil || !strings.Contains(err.Error(), "left on the source")):
+			t.Errorf("expected a move error, result: %v", err)
+		}
+	}
+}
+
+// Test the keys skipped are listed per reason, each file read back as keys
+func TestSkipFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rump-skipped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	paths := map[string]string{}
+	for _, reason := range redis.SkipReasons {
+		paths[reason] = filepath.Join(dir, redis.SkipFileName(reason))
+	}
+	paths[redis.SkipOversize] = filepath.Join(dir, "large", "oversize.jsonl")
+	skipFiles, err := redis.NewSkipFiles(paths)
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	ch = make(message.Bus, 100)
+	db := stub(map[string]func(args []string) interface{}{
+		"SCAN": func(args []string) interface{} {
+			return []interface{}{"0", []string{"bloom:1", "user:1"}}
+		},
+		"TYPE": func(args []string) interface{} {
+			return map[string]string{"bloom:1": "MBbloom--", "user:1": "hash"}[args[1]]
+		},
+	})
+	source := redis.New(db, ch, true, false)
+	source.SkipTypes = map[string]bool{"MBbloom--": true}
+	source.SkipFiles = skipFiles
+	source.Summary = summary.New()
+	if err := source.Read(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	ch = make(message.Bus, 100)
+	db = stub(map[string]func(args []string) interface{}{
+		"RESTORE": func(args []string) interface{} {
+			if args[1] == "app2:existing" {
+				return errors.New("BUSYKEY Target key name already exists.")
+			}
+			return "OK"
+		},
+	})
+	target := redis.New(db, ch, true, false)
+	target.SkipExisting = true
+	target.BulkLimit = &redis.BulkLimit{Max: 6, Policy: redis.BulkSkip}
+	target.SkipFiles = skipFiles
+	target.Summary = summary.New()
+	ch <- message.Payload{Key: "bad-ttl", Value: "value", TTL: "soon"}
+	ch <- message.Payload{Key: "negative-ttl", Value: "value", TTL: "-5"}
+	ch <- message.Payload{Key: "large", Value: "large value", TTL: "0"}
+	ch <- message.Payload{Key: "app2:existing", Original: "existing", Value: "value", TTL: "0"}
+	ch <- message.Payload{Key: "app2:large", Original: "large:2", Value: "large value", TTL: "0"}
+	ch <- message.Payload{Key: "restored", Value: "value", TTL: "0"}
+	close(ch)
+	if err := target.Write(context.Background()); err != nil {
+		t.Fatal("error: ", err)
+	}
+	if err := skipFiles.Close(); err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	expected := map[string][]string{
+		redis.SkipInvalidTTL:      {"bad-ttl", "negative-ttl"},
+		redis.SkipOversize:        {"large", "large:2"},
+		redis.SkipBusyKey:         {"existing"},
+		redis.SkipUnsupportedType: {"bloom:1"},
+	}
+	for reason, keys := range expected {
+		f, err := os.Open(paths[reason])
+		if err != nil {
+			t.Fatal(err)
+		}
+		listed, err := redis.ReadKeys(f)
+		f.Close()
+		if err != nil || !reflect.DeepEqual(listed, keys) {
+			t.Errorf("wrong %s keys listed: %v, error: %v", reason, listed, err)
+		}
+	}
+
+	// Reasons without a file aren't listed
+	skipFiles, err = redis.NewSkipFiles(map[string]string{redis.SkipBusyKey: filepath.Join(dir, "busy.jsonl")})
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	defer skipFiles.Close()
+	if err := skipFiles.Add(redis.SkipOversize, "large", errors.New("skipped")); err != nil {
+		t.Error("error: ", err)
+	}
+}
@@ -0,0 +1,28 @@
+package redis
+
+import (
+	"github.com/mediocregopher/radix/v3"
+)
+
+// renameScript RESTOREs KEYS[2], with the RESTORE command name ARGV[1] and
+// its arguments from ARGV[3] on, then deletes KEYS[1], its former name, with
+// the DEL command name ARGV[2], as a single transaction. RESTORE errors, e.g.
+// BUSYKEY, are replied as is, the former name kept.
+const renameScript = `local reply = redis.pcall(ARGV[1], KEYS[2], unpack(ARGV, 3))
+if type(reply) == 'table' and reply.err then
+	return reply
+end
+redis.call(ARGV[2], KEYS[1])
+return reply`
+
+// restoreCmd returns the RESTORE of pd, replied into rcv. With RenameAtomic,
+// keys renamed since read are restored by renameScript, deleting their
+// Original name at once.
+func (r *Redis) restoreCmd(rcv interface{}, pd *pending) radix.CmdAction {
+	if !r.RenameAtomic || pd.original == "" || pd.original == pd.key {
+		return radix.Cmd(rcv, r.cmd("RESTORE"), pd.args...)
+	}
+
+	args := []string{renameScript, "2", pd.original, pd.key, r.cmd("RESTORE"), r.cmd("DEL")}
+	return radix.Cmd(rcv, r.cmd("EVAL"), append(args, pd.args[1:]...)...)
+}
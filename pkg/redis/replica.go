@@ -0,0 +1,71 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/mediocregopher/radix/v3"
+)
+
+// replication reads the fields of INFO replication.
+func (r *Redis) replication() (map[string]string, error) {
+	var info string
+	if err := r.Pool.Do(radix.Cmd(&info, r.cmd("INFO"), "replication")); err != nil {
+		return nil, fmt.Errorf("error calling INFO replication: %w", err)
+	}
+
+	return parseInfo(info), nil
+}
+
+// ReplOffset returns the master_repl_offset of INFO replication, the
+// offset of the writes of a primary.
+func (r *Redis) ReplOffset() (int64, error) {
+	fields, err := r.replication()
+	if err != nil {
+		return 0, err
+	}
+	offset, err := strconv.ParseInt(fields["master_repl_offset"], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid master_repl_offset %q in INFO replication", fields["master_repl_offset"])
+	}
+
+	return offset, nil
+}
+
+// WaitOffset polls INFO replication every interval until the replica, its
+// link to its primary up, has processed its writes up to offset, and returns
+// the slave_repl_offset reached. Servers that aren't replicas are errors.
+func (r *Redis) WaitOffset(ctx context.Context, offset int64, interval time.Duration) (int64, error) {
+	for {
+		fields, err := r.replication()
+		if err != nil {
+			return 0, err
+		}
+		if role := fields["role"]; role != "slave" {
+			return 0, fmt.Errorf("not a replica, INFO replication role:%s", role)
+		}
+		reached, _ := strconv.ParseInt(fields["slave_repl_offset"], 10, 64)
+		if fields["master_link_status"] == "up" && reached >= offset {
+			return reached, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return reached, fmt.Errorf("replica at offset %d of %d, link %s: %w", reached, offset, fields["master_link_status"], ctx.Err())
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Detach stops the replication of the replica, with REPLICAOF NO ONE, its
+// keys no longer changing. It's a primary afterwards, until made a replica
+// again.
+func (r *Redis) Detach() error {
+	if err := r.Pool.Do(radix.Cmd(nil, r.cmd("REPLICAOF"), "NO", "ONE")); err != nil {
+		return fmt.Errorf("error calling REPLICAOF NO ONE: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReplLag pauses the writers sharing it while the replicas of the target lag
+// behind it, polling INFO replication every Interval: writes pause once the
+// most lagging online replica is over Max bytes behind the
+// master_repl_offset, and resume once it's back under half of it.
+type ReplLag struct {
+	Max      int64
+	Interval time.Duration
+
+	mu      sync.Mutex
+	resumed chan struct{}
+	since   time.Time
+}
+
+// NewReplLag creates a ReplLag pausing writes past max bytes of lag.
+func NewReplLag(max int64, interval time.Duration) *ReplLag {
+	return &ReplLag{Max: max, Interval: interval}
+}
+
+// ReplicaLag returns the bytes the most lagging online replica of the
+// primary is behind its master_repl_offset, and the replicas online, from
+// INFO replication. Replicas syncing, not online yet, are left out.
+func (r *Redis) ReplicaLag() (int64, int, error) {
+	fields, err := r.replication()
+	if err != nil {
+		return 0, 0, err
+	}
+	offset, err := strconv.ParseInt(fields["master_repl_offset"], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid master_repl_offset %q in INFO replication", fields["master_repl_offset"])
+	}
+
+	var lag int64
+	online := 0
+	for name, value := range fields {
+		if !strings.HasPrefix(name, "slave") || strings.Contains(name, "_") {
+			continue
+		}
+		// slave0:ip=10.0.0.2,port=6379,state=online,offset=1234,lag=0
+		replica := map[string]string{}
+		for _, f := range strings.Split(value, ",") {
+			if kv := strings.SplitN(f, "=", 2); len(kv) == 2 {
+				replica[kv[0]] = kv[1]
+			}
+		}
+		if replica["state"] != "online" {
+			continue
+		}
+		reached, err := strconv.ParseInt(replica["offset"], 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid offset of %s %q in INFO replication", name, value)
+		}
+		online++
+		if offset-reached > lag {
+			lag = offset - reached
+		}
+	}
+
+	return lag, online, nil
+}
+
+// wait waits for the writes to resume, nil-safe.
+func (l *ReplLag) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	resumed := l.resumed
+	l.mu.Unlock()
+	if resumed == nil {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-resumed:
+		return nil
+	}
+}
+
+// Run polls the replication lag of target every Interval, pausing and
+// resuming writes, until ctx is done. Pauses are counted as repl-lag-pauses,
+// their time as repl-lag-paused-ms. Polling errors are logged, and leave
+// writes as they are.
+func (l *ReplLag) Run(ctx context.Context, target *Redis) error {
+	ticker := time.NewTicker(l.Interval)
+	defer ticker.Stop()
+	defer l.resume(target, 0)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		lag, online, err := target.ReplicaLag()
+		if err != nil {
+			fmt.Printf("repl-lag: error reading the target replication lag, writes unchanged; error=%s\n", err)
+			continue
+		}
+		switch {
+		case lag > l.Max:
+			l.pause(target, lag, online)
+		case lag <= l.Max/2:
+			l.resume(target, lag)
+		}
+	}
+}
+
+// pause pauses the writes, unless paused.
+func (l *ReplLag) pause(target *Redis, lag int64, online int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.resumed != nil {
+		return
+	}
+
+	l.resumed = make(chan struct{})
+	l.since = time.Now()
+	target.Summary.Incr("repl-lag-pauses")
+	fmt.Printf("repl-lag: %d replicas, lagging up to %d bytes, over %d, pausing writes\n", online, lag, l.Max)
+}
+
+// resume resumes the writes, if paused.
+func (l *ReplLag) resume(target *Redis, lag int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.resumed == nil {
+		return
+	}
+
+	close(l.resumed)
+	l.resumed = nil
+	paused := time.Since(l.since)
+	target.Summary.Add("repl-lag-paused-ms", int64(paused/time.Millisecond))
+	fmt.Printf("repl-lag: replicas lagging %d bytes, resuming writes after %s\n", lag, paused.Round(time.Millisecond))
+}
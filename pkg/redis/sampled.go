@@ -0,0 +1,110 @@
+package redis
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Sampled is the outcome of SampleVerify: the Sampled keys compared, the
+// Mismatches among them, their Rate, and Upper, the upper bound of the
+// mismatch rate of all keys at 95% confidence.
+type Sampled struct {
+	Sampled    int64   `json:"sampled"`
+	Mismatches int64   `json:"mismatches"`
+	Rate       float64 `json:"mismatch_rate"`
+	Upper      float64 `json:"mismatch_rate_upper"`
+}
+
+// SampleVerify compares a random share of the keys passing the source
+// Filter, rate between 0 and 1, picked from seed, on source and target, as
+// Compare does, with workers in parallel. Keys not Identical are passed to
+// report, which must be safe for concurrent use. It only reads.
+func SampleVerify(ctx context.Context, source, target *Redis, rate float64, seed int64, workers int, report func(KeyDiff) error) (Sampled, error) {
+	var s Sampled
+	var mu sync.Mutex
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	// Source keys sampled as SCANned, for the seed to pick the same keys of
+	// the same keyspace
+	g, gctx := errgroup.WithContext(ctx)
+	keys := make(chan string, 100)
+	sampled := make(chan string, 100)
+	g.Go(func() error {
+		defer close(keys)
+		return scan(gctx, source, keys)
+	})
+	g.Go(func() error {
+		defer close(sampled)
+		rnd := rand.New(rand.NewSource(seed))
+		for key := range keys {
+			if rnd.Float64() >= rate {
+				continue
+			}
+			select {
+			case <-gctx.Done():
+				return gctx.Err()
+			case sampled <- key:
+			}
+		}
+		return nil
+	})
+	for i := 0; i < workers; i++ {
+		g.Go(func() error {
+			for key := range sampled {
+				status, err := status(source, target, key)
+				if err != nil {
+					return err
+				}
+				// Deleted since listed
+				if status == "" {
+					continue
+				}
+
+				mu.Lock()
+				s.Sampled++
+				if status != Identical {
+					s.Mismatches++
+				}
+				mu.Unlock()
+				if status != Identical {
+					if err := report(KeyDiff{Key: key, Status: status}); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return s, err
+	}
+
+	if s.Sampled > 0 {
+		s.Rate = float64(s.Mismatches) / float64(s.Sampled)
+	}
+	s.Upper = wilsonUpper(s.Mismatches, s.Sampled)
+
+	return s, nil
+}
+
+// wilsonUpper returns the upper bound of the Wilson score interval at 95%
+// confidence of m mismatches in n keys, 1 without keys.
+func wilsonUpper(m, n int64) float64 {
+	if n == 0 {
+		return 1
+	}
+
+	const z = 1.96
+	p, total := float64(m)/float64(n), float64(n)
+	center := p + z*z/(2*total)
+	margin := z * math.Sqrt(p*(1-p)/total+z*z/(4*total*total))
+
+	return math.Min(1, (center+margin)/(1+z*z/total))
+}
@@ -0,0 +1,68 @@
+package redis
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/mediocregopher/radix/v3"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// Script is a Lua script run on the target after each RESTORE,
+// with the restored key as KEYS[1] and Args as ARGV.
+// It's loaded once with SCRIPT LOAD, then called with EVALSHA.
+type Script struct {
+	Source string
+	Args   []string
+}
+
+// sha returns the script SHA1 digest, as used by EVALSHA.
+func (s *Script) sha() string {
+	sum := sha1.Sum([]byte(s.Source))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadScript loads the script into the Redis script cache.
+func (r *Redis) loadScript() error {
+	err := r.Pool.Do(radix.Cmd(nil, r.cmd("SCRIPT"), "LOAD", r.Script.Source))
+	if err != nil {
+		return fmt.Errorf("error loading script: %w", err)
+	}
+
+	r.scriptLoaded = true
+
+	return nil
+}
+
+// maybeScript may run the Script on a restored key, depending on Script.
+// The script is reloaded when missing from the cache, e.g. after a
+// SCRIPT FLUSH or a target restart.
+func (r *Redis) maybeScript(key string) error {
+	if r.Script == nil {
+		return nil
+	}
+
+	if !r.scriptLoaded {
+		if err := r.loadScript(); err != nil {
+			return err
+		}
+	}
+
+	args := append([]string{r.Script.sha(), "1", key}, r.Script.Args...)
+	err := r.Pool.Do(radix.Cmd(nil, r.cmd("EVALSHA"), args...))
+	if hasCode(err, "NOSCRIPT") {
+		if err := r.loadScript(); err != nil {
+			return err
+		}
+		err = r.Pool.Do(radix.Cmd(nil, r.cmd("EVALSHA"), args...))
+	}
+	if err != nil {
+		return fmt.Errorf("error running script on key %s: %w", message.FormatKey(key), err)
+	}
+
+	r.Summary.Incr("scripted")
+
+	return nil
+}
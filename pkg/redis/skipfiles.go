@@ -0,0 +1,98 @@
+package redis
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Reasons of the keys skipped listed by SkipFiles: an invalid TTL, a payload
+// over the target proto-max-bulk-len, existing on the target with
+// SkipExisting, or of a module missing on the target or a skip-types TYPE.
+const (
+	SkipInvalidTTL      = "invalid-ttl"
+	SkipOversize        = "oversize"
+	SkipBusyKey         = "busykey"
+	SkipUnsupportedType = "unsupported-type"
+)
+
+// SkipReasons are the valid SkipFiles reasons.
+var SkipReasons = []string{SkipInvalidTTL, SkipOversize, SkipBusyKey, SkipUnsupportedType}
+
+// skipStatuses maps the Record statuses of skipped keys to their reason.
+var skipStatuses = map[string]string{
+	"invalid-ttl":   SkipInvalidTTL,
+	"over-bulk-len": SkipOversize,
+}
+
+// SkipFileName is the file name of the keys skipped for reason in a skip
+// files directory.
+func SkipFileName(reason string) string {
+	return reason + ".jsonl"
+}
+
+// SkipFiles list the keys skipped to a dead-letter file per reason, under
+// their source name when renamed since read, each read back by
+// -keys-from-file for a follow-up run of those keys only, with other
+// settings. Reasons without a file aren't listed. It can be shared by several
+// readers and writers.
+type SkipFiles struct {
+	files map[string]*DeadLetter
+}
+
+// NewSkipFiles creates the file of each reason of paths, truncating them,
+// their directories included.
+func NewSkipFiles(paths map[string]string) (*SkipFiles, error) {
+	s := &SkipFiles{files: map[string]*DeadLetter{}}
+	for reason, path := range paths {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			s.Close()
+			return nil, fmt.Errorf("error creating %s skip file: %w", reason, err)
+		}
+		d, err := NewDeadLetter(path)
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("error creating %s skip file: %w", reason, err)
+		}
+		s.files[reason] = d
+	}
+
+	return s, nil
+}
+
+// Add lists key, skipped for reason with err, a noop on a nil SkipFiles or
+// reasons without a file.
+func (s *SkipFiles) Add(reason, key string, err error) error {
+	if s == nil || s.files[reason] == nil {
+		return nil
+	}
+
+	return s.files[reason].Add(key, err)
+}
+
+// addStatus lists key, skipped with the Record status, per its reason.
+func (s *SkipFiles) addStatus(status, key string) error {
+	reason, ok := skipStatuses[status]
+	if !ok {
+		return nil
+	}
+
+	return s.Add(reason, key, errors.New("skipped, "+status))
+}
+
+// Close closes the skip files.
+func (s *SkipFiles) Close() error {
+	if s == nil {
+		return nil
+	}
+
+	var err error
+	for _, d := range s.files {
+		if cerr := d.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,73 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mediocregopher/radix/v3"
+)
+
+// NoSlot is the Slot of Redis reading all keys, with SCAN.
+const NoSlot = -1
+
+// Slots is the number of Redis Cluster hash slots.
+const Slots = 16384
+
+// readSlot reads the keys of Slot, listed with CLUSTER GETKEYSINSLOT in
+// place of SCAN, off the cluster node serving it. Keys are listed at once,
+// since DUMP leaves them in the slot.
+func (r *Redis) readSlot(ctx context.Context) error {
+	slot := fmt.Sprint(r.Slot)
+
+	var count int
+	err := r.Pool.Do(radix.Cmd(&count, r.cmd("CLUSTER"), "COUNTKEYSINSLOT", slot))
+	if err != nil {
+		return fmt.Errorf("error calling CLUSTER COUNTKEYSINSLOT for slot %s: %w", slot, err)
+	}
+
+	var keys []string
+	err = r.Pool.Do(radix.Cmd(&keys, r.cmd("CLUSTER"), "GETKEYSINSLOT", slot, fmt.Sprint(count)))
+	if err != nil {
+		return fmt.Errorf("error calling CLUSTER GETKEYSINSLOT for slot %s: %w", slot, err)
+	}
+
+	for _, key := range keys {
+		if r.excluded(key, r.Filter.KeepRule) {
+			continue
+		}
+
+		if r.isIdle(key) {
+			r.Summary.Incr("idle")
+			continue
+		}
+
+		if err := r.readKey(ctx, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restoreKey calls RESTORE with the args of pd, see restoreCmd. With Asking,
+// RESTORE follows ASKING in a pipeline, on the same connection, for a node
+// importing the slot of the key to accept it instead of replying ASK.
+func (r *Redis) restoreKey(pd *pending) error {
+	if !r.Asking {
+		return r.Pool.Do(r.restoreCmd(nil, pd))
+	}
+
+	asking, restore := &reply{}, &reply{}
+	err := r.Pool.Do(radix.Pipeline(
+		radix.Cmd(asking, r.cmd("ASKING")),
+		r.restoreCmd(restore, pd),
+	))
+	switch {
+	case err != nil:
+		return err
+	case asking.err != nil:
+		return fmt.Errorf("error calling ASKING: %w", asking.err)
+	}
+
+	return restore.err
+}
@@ -0,0 +1,86 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mediocregopher/radix/v3"
+)
+
+// persistence reads the rdb_ fields of INFO persistence: whether a BGSAVE
+// is in progress, the time of the last save, and its status.
+func (r *Redis) persistence() (inProgress bool, lastSave, status string, err error) {
+	var info string
+	if err := r.Pool.Do(radix.Cmd(&info, r.cmd("INFO"), "persistence")); err != nil {
+		return false, "", "", fmt.Errorf("error calling INFO persistence: %w", err)
+	}
+	fields := parseInfo(info)
+
+	return fields["rdb_bgsave_in_progress"] == "1", fields["rdb_last_save_time"], fields["rdb_last_bgsave_status"], nil
+}
+
+// Snapshot saves the source to its RDB file with BGSAVE, polling INFO
+// persistence every interval until done, and returns the file path, from
+// CONFIG GET dir and dbfilename. A BGSAVE already in progress is waited for,
+// then another one started, of the keys from now on.
+func (r *Redis) Snapshot(ctx context.Context, interval time.Duration) (string, error) {
+	var config []string
+	if err := r.Pool.Do(radix.Cmd(&config, r.cmd("CONFIG"), "GET", "dir")); err != nil || len(config) != 2 {
+		return "", fmt.Errorf("error calling CONFIG GET dir, the RDB file is unknown: %v", err)
+	}
+	dir := config[1]
+	if err := r.Pool.Do(radix.Cmd(&config, r.cmd("CONFIG"), "GET", "dbfilename")); err != nil || len(config) != 2 {
+		return "", fmt.Errorf("error calling CONFIG GET dbfilename, the RDB file is unknown: %v", err)
+	}
+	path := filepath.Join(dir, config[1])
+
+	// Saves are done once no longer in progress, their last save time, in
+	// seconds, changed, or seen in progress before.
+	wait := func(started string) (string, error) {
+		seen := false
+		for {
+			inProgress, lastSave, status, err := r.persistence()
+			done := !inProgress && (lastSave != started || seen)
+			seen = seen || inProgress
+			switch {
+			case err != nil:
+				return "", err
+			case done && status != "ok":
+				return "", fmt.Errorf("BGSAVE failed, rdb_last_bgsave_status:%s", status)
+			case done:
+				return lastSave, nil
+			}
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(interval):
+			}
+		}
+	}
+
+	_, before, _, err := r.persistence()
+	if err != nil {
+		return "", err
+	}
+	for attempt := 0; ; attempt++ {
+		err = r.Pool.Do(radix.Cmd(nil, r.cmd("BGSAVE")))
+		if err == nil || attempt > 0 || !strings.Contains(err.Error(), "Background save already in progress") {
+			break
+		}
+		fmt.Println("redis: BGSAVE already in progress, waiting for it")
+		if before, err = wait(before); err != nil {
+			return "", err
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("error calling BGSAVE: %w", err)
+	}
+	if _, err := wait(before); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
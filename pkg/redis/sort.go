@@ -0,0 +1,59 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/mediocregopher/radix/v3"
+)
+
+// DefaultMaxKeys caps the keys readSorted holds in memory.
+const DefaultMaxKeys = 1000000
+
+// readSorted SCANs all keys first, then reads them sorted, for dumps stable
+// across runs: SCAN order isn't, and may return a key more than once. Reads
+// are serial, so Payloads are pushed in order. It fails past MaxKeys keys.
+func (r *Redis) readSorted(ctx context.Context) error {
+	scanner := radix.NewScanner(r.Pool, r.scanOpts())
+
+	seen := map[string]bool{}
+	var key string
+	for scanner.Next(&key) {
+		if r.excluded(key, r.Filter.KeepRule) {
+			continue
+		}
+		if seen[key] {
+			continue
+		}
+
+		seen[key] = true
+		if len(seen) > r.MaxKeys {
+			scanner.Close()
+			return fmt.Errorf("more than %d keys to sort, narrow them down with match, or raise sort-max-keys", r.MaxKeys)
+		}
+	}
+	if err := scanner.Close(); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	r.maybeLog(fmt.Sprintf("redis: sorted %d keys\n", len(keys)))
+
+	for _, key := range keys {
+		if r.isIdle(key) {
+			r.Summary.Incr("idle")
+			continue
+		}
+
+		if err := r.readKey(ctx, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package redis
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/mediocregopher/radix/v3"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// staged is a Payload stashed in a staging hash, under its key name.
+// Value is base64 encoded, ExpireAt is in ms since epoch, 0 for persistent
+// keys, so that TTLs keep running until promoted.
+type staged struct {
+	Value    string `json:"value"`
+	ExpireAt int64  `json:"expire_at"`
+}
+
+// nowMillis returns the current time in ms since epoch.
+func nowMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+// stage stashes a Payload in the Stage hash, in place of RESTORE.
+func (r *Redis) stage(p message.Payload) error {
+	s := staged{Value: base64.StdEncoding.EncodeToString([]byte(p.Value))}
+	if ttl, _ := strconv.ParseInt(p.TTL, 10, 64); ttl > 0 {
+		s.ExpireAt = nowMillis() + ttl
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	if err := r.Pool.Do(radix.Cmd(nil, r.cmd("HSET"), r.Stage, p.Key, string(b))); err != nil {
+		return fmt.Errorf("error staging key %s in '%s': %w", message.FormatKey(p.Key), r.Stage, err)
+	}
+	r.Summary.Incr("staged")
+	r.logKey("redis: HSET %s %s\n", r.Stage, message.FormatKey(p.Key))
+
+	return nil
+}
+
+// readStaged reads the Payloads of the Staged hash with HSCAN, in place of
+// SCAN, honoring the Filter. Keys expired since staged are skipped.
+func (r *Redis) readStaged(ctx context.Context) error {
+	scanner := radix.NewScanner(r.Pool, radix.ScanOpts{
+		Command: r.cmd("HSCAN"),
+		Key:     r.Staged,
+		Pattern: r.Filter.Pattern(),
+		Count:   r.ScanCount,
+	})
+
+	// HSCAN returns fields and values in turn
+	var key, record string
+	for scanner.Next(&key) && scanner.Next(&record) {
+		if r.excluded(key, r.Filter.KeepRule) {
+			continue
+		}
+
+		var s staged
+		if err := json.Unmarshal([]byte(record), &s); err != nil {
+			scanner.Close()
+			return fmt.Errorf("error reading staged key %s from '%s': %w", message.FormatKey(key), r.Staged, err)
+		}
+		value, err := base64.StdEncoding.DecodeString(s.Value)
+		if err != nil {
+			scanner.Close()
+			return fmt.Errorf("error reading staged key %s from '%s': %w", message.FormatKey(key), r.Staged, err)
+		}
+
+		ttl := "0"
+		if s.ExpireAt > 0 {
+			left := s.ExpireAt - nowMillis()
+			if left <= 0 {
+				r.Summary.Incr("expired")
+				continue
+			}
+			ttl = strconv.FormatInt(left, 10)
+		}
+
+		select {
+		case <-ctx.Done():
+			scanner.Close()
+			fmt.Println("redis: done reading")
+			return ctx.Err()
+		case r.Bus <- message.Payload{Key: key, Value: string(value), TTL: ttl}:
+			r.Summary.Incr("dumped")
+			r.logKey("redis: HSCAN %s %s => ttl=%s, size=%d\n", r.Staged, message.FormatKey(key), ttl, len(value))
+		}
+	}
+
+	return scanner.Close()
+}
+
+// unstage deletes a key restored from the Staged hash, so that promoting
+// again only restores the keys left.
+func (r *Redis) unstage(key string) error {
+	if r.Staged == "" {
+		return nil
+	}
+	if err := r.Pool.Do(radix.Cmd(nil, r.cmd("HDEL"), r.Staged, key)); err != nil {
+		return fmt.Errorf("error unstaging key %s from '%s': %w", message.FormatKey(key), r.Staged, err)
+	}
+	r.Summary.Incr("unstaged")
+
+	return nil
+}
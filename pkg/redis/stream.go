@@ -0,0 +1,140 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mediocregopher/radix/v3"
+)
+
+// KeysStream reads the keys to transfer off a Redis Stream, in place of SCAN,
+// e.g. published by another system each time a key changes.
+// Field is the entry field holding the key name.
+// Start is the entry ID to read after, "$" (default) for new entries only.
+// With Group, entries are read with XREADGROUP as Consumer instead, and
+// acknowledged with XACK once their key is on the message Bus.
+type KeysStream struct {
+	Name     string
+	Field    string
+	Start    string
+	Group    string
+	Consumer string
+}
+
+// parseStreamID parses a <ms>-<seq> stream entry ID, "<ms>" alone meaning
+// sequence 0.
+func parseStreamID(s string) (*radix.StreamEntryID, error) {
+	parts := strings.SplitN(s, "-", 2)
+	if len(parts) == 1 {
+		parts = append(parts, "0")
+	}
+
+	ms, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stream ID '%s'", s)
+	}
+	seq, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stream ID '%s'", s)
+	}
+
+	return &radix.StreamEntryID{Time: ms, Seq: seq}, nil
+}
+
+// createGroup creates the KeysStream consumer group, reading new entries,
+// unless it already exists.
+func (r *Redis) createGroup() error {
+	s := r.KeysStream
+	err := r.Pool.Do(radix.Cmd(nil, r.cmd("XGROUP"), "CREATE", s.Name, s.Group, "$", "MKSTREAM"))
+	if err != nil && !hasCode(err, "BUSYGROUP") {
+		return fmt.Errorf("error creating group '%s' on stream '%s': %w", s.Group, s.Name, err)
+	}
+
+	return nil
+}
+
+// streamReader creates the KeysStream reader. Blocking reads are kept short,
+// under the connections timeout, and to check the context regularly.
+func (r *Redis) streamReader() (radix.StreamReader, error) {
+	s := r.KeysStream
+	opts := radix.StreamReaderOpts{
+		Streams: map[string]*radix.StreamEntryID{s.Name: nil},
+		Block:   time.Second,
+		Count:   100,
+	}
+
+	switch {
+	case s.Group != "":
+		if err := r.createGroup(); err != nil {
+			return nil, err
+		}
+		opts.Group, opts.Consumer = s.Group, s.Consumer
+	case s.Start != "" && s.Start != "$":
+		id, err := parseStreamID(s.Start)
+		if err != nil {
+			return nil, err
+		}
+		opts.Streams[s.Name] = id
+	}
+
+	return radix.NewStreamReader(r.Pool, opts), nil
+}
+
+// readStream dumps the keys of KeysStream entries as they arrive, until the
+// context is done. The last read entry ID is noted in the Summary, to resume
+// from with Start.
+func (r *Redis) readStream(ctx context.Context) error {
+	s := r.KeysStream
+	reader, err := r.streamReader()
+	if err != nil {
+		return err
+	}
+
+	var lastID string
+	defer func() {
+		if lastID != "" {
+			r.Summary.Note(fmt.Sprintf("keys stream %s last read ID %s", s.Name, lastID))
+		}
+	}()
+
+	for ctx.Err() == nil {
+		_, entries, ok := reader.Next()
+		if !ok {
+			return fmt.Errorf("error reading keys stream '%s': %w", s.Name, reader.Err())
+		}
+
+		for _, e := range entries {
+			key, ok := e.Fields[s.Field]
+			switch {
+			case !ok:
+				r.Summary.Incr("invalid")
+				r.logError("redis: skipping stream entry %s without field \"%s\"\n", e.ID, s.Field)
+			case r.excluded(key, r.Filter.SelectsRule):
+			default:
+				err := r.readKey(ctx, key)
+				// Unread entries aren't acked
+				if ctx.Err() != nil {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+			}
+
+			if s.Group != "" {
+				err := r.Pool.Do(radix.Cmd(nil, r.cmd("XACK"), s.Name, s.Group, e.ID.String()))
+				if err != nil {
+					return fmt.Errorf("error acking stream entry %s: %w", e.ID, err)
+				}
+			}
+			lastID = e.ID.String()
+		}
+	}
+
+	fmt.Println("redis: done reading")
+
+	return nil
+}
@@ -0,0 +1,175 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/mediocregopher/radix/v3"
+
+	"github.com/stickermule/rump/pkg/ratelimit"
+)
+
+// Throttle paces the keys read off a source to its load, sampling its INFO
+// and LATENCY LATEST every Interval: the rate of Limiter is halved, down to
+// Min keys/sec, while the source is stressed, and raised by a quarter, up to
+// Max, while it's idle. The source is stressed once its CPU usage, in
+// percent of a core, exceeds MaxCPU, its instantaneous ops/sec MaxOps, or
+// its latest latency spike MaxLatency, each unless 0, and idle while all of
+// them are below half their threshold.
+type Throttle struct {
+	Limiter    *ratelimit.Limiter
+	MaxCPU     float64
+	MaxOps     int64
+	MaxLatency time.Duration
+	Min        float64
+	Max        float64
+	Interval   time.Duration
+}
+
+// NewThrottle creates a Throttle starting at max keys/sec.
+func NewThrottle(min, max float64, interval time.Duration) *Throttle {
+	return &Throttle{Limiter: ratelimit.New(max), Min: min, Max: max, Interval: interval}
+}
+
+// idleShare is the share of the thresholds under which sources are idle.
+const idleShare = 0.5
+
+// errNoLatency is the error of sources without LATENCY, disabled on some
+// managed services.
+var errNoLatency = errors.New("LATENCY LATEST unavailable")
+
+// load is a sample of the source load, sampled at At.
+type load struct {
+	At      time.Time
+	CPU     float64
+	Seconds float64
+	Ops     int64
+	Latency time.Duration
+}
+
+// wait waits for the next key read, nil-safe.
+func (t *Throttle) wait(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+
+	return t.Limiter.Wait(ctx)
+}
+
+// Run samples the load of source every Interval, adjusting the rate, until
+// ctx is done. Sampling errors are logged, and skip the adjustment.
+func (t *Throttle) Run(ctx context.Context, source *Redis) error {
+	ticker := time.NewTicker(t.Interval)
+	defer ticker.Stop()
+
+	latency := t.MaxLatency > 0
+	var last load
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		l, err := source.load()
+		if err == nil && latency {
+			l.Latency, err = source.latency(last.At)
+			if errors.Is(err, errNoLatency) {
+				fmt.Printf("throttle: throttling on CPU and ops/sec only; error=%s\n", err)
+				latency, err = false, nil
+			}
+		}
+		if err != nil {
+			fmt.Printf("throttle: error sampling the source load, rate unchanged; error=%s\n", err)
+			continue
+		}
+		if !last.At.IsZero() {
+			l.CPU = 100 * (l.Seconds - last.Seconds) / l.At.Sub(last.At).Seconds()
+			t.adjust(l, source)
+		}
+		last = l
+	}
+}
+
+// adjust adjusts the rate to the load l, logging changes.
+func (t *Throttle) adjust(l load, source *Redis) {
+	rate := t.Limiter.Rate()
+	next := rate
+	switch {
+	case t.exceeds(l, 1):
+		if next = rate / 2; next < t.Min {
+			next = t.Min
+		}
+	case !t.exceeds(l, idleShare):
+		if next = rate * 1.25; next > t.Max {
+			next = t.Max
+		}
+	}
+	if next == rate {
+		return
+	}
+	if next < rate {
+		source.Summary.Incr("throttled-down")
+	} else {
+		source.Summary.Incr("throttled-up")
+	}
+
+	t.Limiter.SetRate(next)
+	fmt.Printf("throttle: source cpu=%.1f%% ops=%d latency=%s, rate %.0f -> %.0f keys/s\n",
+		l.CPU, l.Ops, l.Latency, rate, next)
+}
+
+// exceeds reports whether any metric of l exceeds share of its threshold.
+func (t *Throttle) exceeds(l load, share float64) bool {
+	return (t.MaxCPU > 0 && l.CPU > share*t.MaxCPU) ||
+		(t.MaxOps > 0 && float64(l.Ops) > share*float64(t.MaxOps)) ||
+		(t.MaxLatency > 0 && float64(l.Latency) > share*float64(t.MaxLatency))
+}
+
+// load samples the CPU seconds and ops/sec of INFO.
+func (r *Redis) load() (load, error) {
+	l := load{At: time.Now()}
+
+	var info string
+	if err := r.Pool.Do(radix.Cmd(&info, r.cmd("INFO"))); err != nil {
+		return l, fmt.Errorf("error calling INFO: %w", err)
+	}
+	fields := parseInfo(info)
+	sys, _ := strconv.ParseFloat(fields["used_cpu_sys"], 64)
+	user, _ := strconv.ParseFloat(fields["used_cpu_user"], 64)
+	l.Seconds = sys + user
+	l.Ops, _ = strconv.ParseInt(fields["instantaneous_ops_per_sec"], 10, 64)
+
+	return l, nil
+}
+
+// latency returns the worst latest spike of LATENCY LATEST since, to the
+// second, the events over the server latency-monitor-threshold only.
+func (r *Redis) latency(since time.Time) (time.Duration, error) {
+	// [[event, timestamp, latest ms, max ms], ...]
+	var events [][]interface{}
+	err := r.Pool.Do(radix.Cmd(&events, r.cmd("LATENCY"), "LATEST"))
+	if hasCode(err, "ERR") {
+		return 0, fmt.Errorf("%w: %s", errNoLatency, err)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error calling LATENCY LATEST: %w", err)
+	}
+
+	var worst time.Duration
+	for _, e := range events {
+		if len(e) < 3 {
+			continue
+		}
+		at, _ := e[1].(int64)
+		ms, _ := e[2].(int64)
+		if d := time.Duration(ms) * time.Millisecond; at >= since.Unix() && d > worst {
+			worst = d
+		}
+	}
+
+	return worst, nil
+}
@@ -0,0 +1,52 @@
+package redis_test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stickermule/rump/pkg/message"
+	"github.com/stickermule/rump/pkg/redis"
+	"github.com/stickermule/rump/pkg/summary"
+)
+
+// Test Throttle halves the rate while the source CPU is above its
+// threshold, down to Min, and raises it back up to Max once idle
+func TestThrottle(t *testing.T) {
+	var busy int32 = 1
+	var cpu int64
+	db := stub(map[string]func(args []string) interface{}{
+		"INFO": func(args []string) interface{} {
+			// A full second of CPU per sample while busy
+			if atomic.LoadInt32(&busy) == 1 {
+				atomic.AddInt64(&cpu, 1)
+			}
+			return fmt.Sprintf("# CPU\r\nused_cpu_sys:%d.000000\r\nused_cpu_user:0.000000\r\n", atomic.LoadInt64(&cpu))
+		},
+	})
+	source := redis.New(db, make(message.Bus, 1), true, false)
+	source.Summary = summary.New()
+
+	throttle := redis.NewThrottle(100, 1000, 10*time.Millisecond)
+	throttle.MaxCPU = 50
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	throttle.Run(ctx, source)
+	cancel()
+	if rate := throttle.Limiter.Rate(); rate != 100 {
+		t.Errorf("expected the min rate 100, result: %.0f", rate)
+	}
+
+	atomic.StoreInt32(&busy, 0)
+	ctx, cancel = context.WithTimeout(context.Background(), 250*time.Millisecond)
+	throttle.Run(ctx, source)
+	cancel()
+	if rate := throttle.Limiter.Rate(); rate != 1000 {
+		t.Errorf("expected the max rate 1000, result: %.0f", rate)
+	}
+	if source.Summary.Get("throttled-down") == 0 || source.Summary.Get("throttled-up") == 0 {
+		t.Errorf("expected throttled-down and throttled-up, result: %s", source.Summary)
+	}
+}
@@ -0,0 +1,238 @@
+package redis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mediocregopher/radix/v3"
+)
+
+// CertSource provides the TLS client certificate, asked on each handshake.
+type CertSource interface {
+	Certificate() (*tls.Certificate, error)
+}
+
+// StaticCert is a CertSource loaded once, the default.
+type StaticCert struct {
+	cert *tls.Certificate
+}
+
+// NewStaticCert loads a PEM certificate and key pair.
+func NewStaticCert(certFile, keyFile string) (*StaticCert, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading client certificate %s: %w", certFile, err)
+	}
+
+	return &StaticCert{cert: &cert}, nil
+}
+
+// Certificate returns the loaded certificate.
+func (c *StaticCert) Certificate() (*tls.Certificate, error) {
+	return c.cert, nil
+}
+
+// FileCert is a CertSource reloading its PEM certificate and key pair when
+// they change on disk, e.g. rotated by spiffe-helper or cert-manager, so that
+// reconnections of long runs present the current certificate.
+type FileCert struct {
+	CertFile string
+	KeyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewFileCert loads a PEM certificate and key pair, to be reloaded on change.
+func NewFileCert(certFile, keyFile string) (*FileCert, error) {
+	c := &FileCert{CertFile: certFile, KeyFile: keyFile}
+	if _, err := c.Certificate(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// modified returns the latest modification time of the pair.
+func (c *FileCert) modified() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{c.CertFile, c.KeyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+// Certificate returns the certificate, reloaded when its files changed.
+// While a rotation is half written, the previous certificate is kept.
+func (c *FileCert) Certificate() (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	modTime, err := c.modified()
+	if err == nil && c.cert != nil && modTime.Equal(c.modTime) {
+		return c.cert, nil
+	}
+	if err == nil {
+		var cert tls.Certificate
+		cert, err = tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err == nil {
+			c.cert, c.modTime = &cert, modTime
+			return c.cert, nil
+		}
+	}
+
+	if c.cert == nil {
+		return nil, fmt.Errorf("error loading client certificate %s: %w", c.CertFile, err)
+	}
+	fmt.Printf("redis: client certificate %s reload failed, keeping the previous one; error=%s\n", c.CertFile, err)
+
+	return c.cert, nil
+}
+
+// NewTLSConfig creates a client TLS config, verifying the server against the
+// PEM caFile when set (the system roots otherwise), and presenting the certs
+// certificate when the server asks for one.
+func NewTLSConfig(certs CertSource, caFile string) (*tls.Config, error) {
+	cfg := &tls.Config{}
+
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA %s: %w", caFile, err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in CA %s", caFile)
+		}
+	}
+
+	if certs != nil {
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return certs.Certificate()
+		}
+	}
+
+	return cfg, nil
+}
+
+// dialURI dials a Redis URI, over TLS when cfg is set, through proxy when
+// set, then AUTHs, as user when set, and SELECTs the db as radix.Dial does
+// for redis:// URIs.
+func dialURI(network, uri, user, password string, cfg *tls.Config, proxy *Proxy, dial Dialer) (radix.Conn, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if password == "" {
+		password, _ = u.User.Password()
+	}
+	if password == "" {
+		password = u.Query().Get("password")
+	}
+	db := strings.TrimPrefix(u.Path, "/")
+	if db == "" {
+		db = u.Query().Get("db")
+	}
+
+	keepAlive := dial.KeepAlive
+	if keepAlive == 0 {
+		keepAlive = defaultTimeout
+	}
+	var netConn net.Conn
+	if proxy != nil {
+		netConn, err = proxy.dial(network, u.Host, keepAlive)
+	} else {
+		dialer := &net.Dialer{Timeout: defaultTimeout, KeepAlive: keepAlive}
+		netConn, err = dialer.Dial(network, u.Host)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The handshake is with the server, through the proxy tunnel
+	if cfg != nil {
+		if cfg.ServerName == "" {
+			cfg = cfg.Clone()
+			cfg.ServerName = u.Hostname()
+		}
+		tlsConn := tls.Client(netConn, cfg)
+		tlsConn.SetDeadline(time.Now().Add(10 * time.Second))
+		if err := tlsConn.Handshake(); err != nil {
+			netConn.Close()
+			return nil, err
+		}
+		tlsConn.SetDeadline(time.Time{})
+		netConn = tlsConn
+	}
+
+	if dial.IdleTimeout > 0 {
+		netConn = idleConn{Conn: netConn, timeout: dial.IdleTimeout}
+	}
+	conn := radix.NewConn(netConn)
+
+	auth := []string{password}
+	if user != "" {
+		auth = []string{user, password}
+	}
+	if password != "" {
+		if err := conn.Do(radix.Cmd(nil, "AUTH", auth...)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	if db != "" {
+		if err := conn.Do(radix.Cmd(nil, "SELECT", db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	if dial.Protocol > 0 {
+		if err := hello(conn, dial.Protocol); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("error negotiating RESP%d with %s: %w", dial.Protocol, u.Host, err)
+		}
+	}
+
+	if dial.NoTouch {
+		if err := conn.Do(radix.Cmd(nil, "CLIENT", "NO-TOUCH", "ON")); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("error enabling CLIENT NO-TOUCH on %s, from Redis 7.2: %w", u.Host, err)
+		}
+	}
+
+	return conn, nil
+}
+
+// hello negotiates protocol on conn with HELLO. Servers without HELLO,
+// before Redis 6, are accepted for RESP2, the only protocol they speak.
+func hello(conn radix.Conn, protocol int) error {
+	err := conn.Do(radix.Cmd(nil, "HELLO", strconv.Itoa(protocol)))
+	if err != nil && protocol == 2 && hasCode(err, "ERR") && strings.Contains(strings.ToLower(err.Error()), "unknown command") {
+		return nil
+	}
+	if hasCode(err, "NOPROTO") {
+		return fmt.Errorf("protocol unavailable on this server: %w", err)
+	}
+
+	return err
+}
@@ -0,0 +1,191 @@
+package redis_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mediocregopher/radix/v3"
+
+	"github.com/stickermule/rump/pkg/redis"
+	"github.com/stickermule/rump/pkg/resp"
+)
+
+// writeCert writes a self-signed PEM certificate and key for localhost,
+// valid as both server and client certificate.
+func writeCert(t *testing.T, dir, name string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+
+	return certFile, keyFile
+}
+
+func commonName(t *testing.T, cert *tls.Certificate) string {
+	c, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.Subject.CommonName
+}
+
+// Test rotated certificate files are reloaded, and broken ones ignored
+func TestFileCertReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rump-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeCert(t, dir, "first")
+	certs, err := redis.NewFileCert(certFile, keyFile)
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	// Rotate, moving mtime forward as coarse filesystem clocks may not
+	newCert, newKey := writeCert(t, dir, "second")
+	os.Rename(newCert, certFile)
+	os.Rename(newKey, keyFile)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+
+	cert, err := certs.Certificate()
+	if err != nil || commonName(t, cert) != "second" {
+		t.Errorf("rotated certificate should be loaded, error: %v", err)
+	}
+
+	// Half written rotation
+	ioutil.WriteFile(certFile, []byte("garbage"), 0600)
+	later = later.Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+
+	cert, err = certs.Certificate()
+	if err != nil || commonName(t, cert) != "second" {
+		t.Errorf("previous certificate should be kept, error: %v", err)
+	}
+}
+
+// tlsServer is a fake Redis over TLS, requiring a client certificate signed
+// by ca, and recording the received commands.
+func tlsServer(t *testing.T, certFile, keyFile, caFile string, cmds chan []string) net.Listener {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pem, _ := ioutil.ReadFile(caFile)
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(pem)
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				r := resp.NewReader(c)
+				for {
+					args, err := r.Read()
+					if err != nil {
+						return
+					}
+					cmds <- args
+					c.Write([]byte("+OK\r\n"))
+				}
+			}(c)
+		}
+	}()
+
+	return l
+}
+
+// Test rediss:// pools authenticate with a client certificate, then AUTH and SELECT
+func TestTLSPool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rump-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	serverCert, serverKey := writeCert(t, dir, "server")
+	clientCert, clientKey := writeCert(t, dir, "client")
+	cmds := make(chan []string, 10)
+	l := tlsServer(t, serverCert, serverKey, clientCert, cmds)
+	defer l.Close()
+
+	certs, err := redis.NewStaticCert(clientCert, clientKey)
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	tlsConfig, err := redis.NewTLSConfig(certs, serverCert)
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	db, err := redis.NewPool("rediss://"+l.Addr().String()+"/2", "secret", tlsConfig, 1)
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	defer db.Close()
+
+	if err := db.Do(radix.Cmd(nil, "PING")); err != nil {
+		t.Error("error: ", err)
+	}
+
+	for _, expected := range []string{"AUTH secret", "SELECT 2"} {
+		args := <-cmds
+		if args[0]+" "+args[1] != expected {
+			t.Errorf("expected: %s, result: %v", expected, args)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/mediocregopher/radix/v3"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// readTTL sends the key and its TTL, without value, on the message Bus, for
+// TTLOnly targets.
+func (r *Redis) readTTL(ctx context.Context, key string) error {
+	ttl, err := r.maybeTTL(key)
+	if err == errVanished {
+		r.Summary.Incr("race-deleted")
+		r.maybeLog(fmt.Sprintf("redis: skipped %s, deleted while read\n", message.FormatKey(key)))
+		return nil
+	}
+	if err == errExpired {
+		r.skipExpired(key)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error syncing ttl for key %s: %w", message.FormatKey(key), err)
+	}
+
+	select {
+	case <-ctx.Done():
+		fmt.Println("redis: done reading")
+		return fmt.Errorf("error reading from redis: %w", ctx.Err())
+	case r.Bus <- message.Payload{Key: key, TTL: ttl, DB: r.DB, Source: r.Name}:
+		r.Summary.Incr("ttl-read")
+		r.logKey("redis: PTTL %s => %s\n", message.FormatKey(key), ttl)
+	}
+
+	return nil
+}
+
+// restoreTTL applies the TTL of p to the target key, with PEXPIRE, or
+// PERSIST for persistent ones, counted as ttl-updated. Keys already expiring
+// within TTLTolerance of it are ttl-unchanged, and keys missing on the
+// target ttl-missing, never created.
+func (r *Redis) restoreTTL(p message.Payload) error {
+	ttl, err := strconv.ParseInt(p.TTL, 10, 64)
+	if err != nil || ttl < 0 {
+		r.Summary.Incr("invalid-ttl")
+		r.logError("redis: skipping key %s with invalid TTL \"%s\"\n", message.FormatKey(p.Key), p.TTL)
+		return r.SkipFiles.addStatus("invalid-ttl", sourceKey(p.Key, p.Original))
+	}
+
+	var current int64
+	if err := r.Pool.Do(radix.Cmd(&current, r.cmd("PTTL"), p.Key)); err != nil {
+		return fmt.Errorf("error calling PTTL for target key %s: %w", message.FormatKey(p.Key), err)
+	}
+	source := ttl
+	if source == 0 {
+		source = -1
+	}
+	switch {
+	case current == -2:
+		r.Summary.Incr("ttl-missing")
+		r.maybeLog(fmt.Sprintf("redis: skipped %s, missing on the target\n", message.FormatKey(p.Key)))
+		return nil
+	case sameTTL(source, current, r.TTLTolerance):
+		r.Summary.Incr("ttl-unchanged")
+		return nil
+	}
+
+	var applied int
+	cmd := radix.Cmd(&applied, r.cmd("PEXPIRE"), p.Key, p.TTL)
+	if ttl == 0 {
+		cmd = radix.Cmd(&applied, r.cmd("PERSIST"), p.Key)
+	}
+	if err := r.Pool.Do(cmd); err != nil {
+		return fmt.Errorf("error updating the TTL of key %s: %w", message.FormatKey(p.Key), err)
+	}
+	if applied == 0 {
+		// Deleted, or expired, since its PTTL
+		r.Summary.Incr("ttl-missing")
+		return nil
+	}
+	r.Summary.Incr("ttl-updated")
+	r.logKey("redis: TTL %s %d => %s\n", message.FormatKey(p.Key), current, p.TTL)
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package redis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stickermule/rump/pkg/filter"
+)
+
+// Actions of TTLRules, keeping the source TTL, or removing it.
+const (
+	TTLKeep    = "keep"
+	TTLPersist = "persist"
+)
+
+// TTLRule sets the TTL of the keys matching Pattern, a glob as in MATCH, as
+// restored: Action is TTLKeep, TTLPersist, or empty for TTL, a fixed one.
+type TTLRule struct {
+	Pattern string
+	Action  string
+	TTL     time.Duration
+}
+
+// ParseTTLRule parses a pattern=action TTLRule, action being keep, persist
+// or a duration, e.g. cache:*=1h.
+func ParseTTLRule(s string) (TTLRule, error) {
+	i := strings.LastIndex(s, "=")
+	if i < 1 {
+		return TTLRule{}, fmt.Errorf("ttl-rule must be pattern=keep|persist|<duration>, got %s", s)
+	}
+
+	rule := TTLRule{Pattern: s[:i]}
+	switch action := s[i+1:]; action {
+	case TTLKeep, TTLPersist:
+		rule.Action = action
+	default:
+		ttl, err := time.ParseDuration(action)
+		if err != nil || ttl < time.Millisecond {
+			return TTLRule{}, fmt.Errorf("invalid ttl-rule action %s, in %s: keep, persist or a duration of at least 1ms", action, s)
+		}
+		rule.TTL = ttl
+	}
+
+	return rule, nil
+}
+
+// ruleTTL returns the TTL key is restored with, in ms as in Payloads, per
+// the first of the TTLRules matching it, counted as ttl-rule-<n> from 1, and
+// whether one did.
+func (r *Redis) ruleTTL(key, ttl string) (string, bool) {
+	for i, rule := range r.TTLRules {
+		if !filter.Glob(rule.Pattern, key) {
+			continue
+		}
+		r.Summary.Incr(fmt.Sprintf("ttl-rule-%d", i+1))
+
+		switch rule.Action {
+		case TTLKeep:
+			return ttl, true
+		case TTLPersist:
+			return "0", true
+		}
+		return strconv.FormatInt(int64(rule.TTL/time.Millisecond), 10), true
+	}
+
+	return ttl, false
+}
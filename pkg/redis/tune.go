@@ -0,0 +1,97 @@
+package redis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mediocregopher/radix/v3"
+)
+
+// defaultMaxClients is the Redis maxclients default, assumed when the server
+// doesn't tell, e.g. with CONFIG disabled by a managed service.
+const defaultMaxClients = 10000
+
+// maxTunedPoolSize caps auto-tuned connections and workers, past which
+// throughput barely improves while the server load does.
+const maxTunedPoolSize = 16
+
+// ServerInfo is the server load auto-tuning is based on.
+type ServerInfo struct {
+	ConnectedClients int64
+	MaxClients       int64
+	Keys             int64
+}
+
+// Tuning is a set of auto-tuned options.
+type Tuning struct {
+	PoolSize  int
+	ScanCount int
+	Workers   int
+}
+
+// parseInfo returns the field values of an INFO reply.
+func parseInfo(info string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(info, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), ":", 2)
+		if len(parts) == 2 {
+			fields[parts[0]] = parts[1]
+		}
+	}
+
+	return fields
+}
+
+// ServerInfo reads the clients INFO, maxclients and DBSIZE. maxclients is
+// in INFO from Redis 7, read with CONFIG GET before.
+func (r *Redis) ServerInfo() (ServerInfo, error) {
+	var s ServerInfo
+
+	var info string
+	if err := r.Pool.Do(radix.Cmd(&info, r.cmd("INFO"), "clients")); err != nil {
+		return s, fmt.Errorf("error calling INFO: %w", err)
+	}
+	fields := parseInfo(info)
+	s.ConnectedClients, _ = strconv.ParseInt(fields["connected_clients"], 10, 64)
+	s.MaxClients, _ = strconv.ParseInt(fields["maxclients"], 10, 64)
+
+	if s.MaxClients == 0 {
+		var config []string
+		err := r.Pool.Do(radix.Cmd(&config, r.cmd("CONFIG"), "GET", "maxclients"))
+		if err == nil && len(config) == 2 {
+			s.MaxClients, _ = strconv.ParseInt(config[1], 10, 64)
+		}
+	}
+	if s.MaxClients == 0 {
+		s.MaxClients = defaultMaxClients
+	}
+
+	var err error
+	s.Keys, err = r.DBSize()
+
+	return s, err
+}
+
+// AutoTune picks options for a server: connections and workers use up to a
+// quarter of its free clients, capped to 16, and SCAN COUNT grows with the
+// keyspace, from 10 to 1000.
+func AutoTune(s ServerInfo) Tuning {
+	size := int((s.MaxClients - s.ConnectedClients) / 4)
+	switch {
+	case size > maxTunedPoolSize:
+		size = maxTunedPoolSize
+	case size < 1:
+		size = 1
+	}
+
+	count := int(s.Keys / 10000)
+	switch {
+	case count > 1000:
+		count = 1000
+	case count < 10:
+		count = 10
+	}
+
+	return Tuning{PoolSize: size, ScanCount: count, Workers: size}
+}
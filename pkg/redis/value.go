@@ -0,0 +1,38 @@
+package redis
+
+import (
+	"fmt"
+
+	"github.com/mediocregopher/radix/v3"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// valueMatches reports whether key passes ValueMatch, its value read with
+// GET matching it, counting the keys skipped as value-unmatched. Keys of
+// other types pass with ValueOthers, skipped as value-other-type otherwise,
+// and keys deleted since listed fail.
+func (r *Redis) valueMatches(key string) (bool, error) {
+	var value []byte
+	mn := radix.MaybeNil{Rcv: &value}
+	err := r.Pool.Do(radix.Cmd(&mn, r.cmd("GET"), key))
+	switch {
+	case hasCode(err, "WRONGTYPE") && r.ValueOthers:
+		return true, nil
+	case hasCode(err, "WRONGTYPE"):
+		r.Summary.Incr("value-other-type")
+		r.maybeLog(fmt.Sprintf("redis: skipped %s, not a string\n", message.FormatKey(key)))
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("error calling GET for key %s: %w", message.FormatKey(key), err)
+	case mn.Nil:
+		r.Summary.Incr("race-deleted")
+		return false, nil
+	case !r.ValueMatch.Match(value):
+		r.Summary.Incr("value-unmatched")
+		r.maybeLog(fmt.Sprintf("redis: skipped %s, its value doesn't match\n", message.FormatKey(key)))
+		return false, nil
+	}
+
+	return true, nil
+}
@@ -0,0 +1,120 @@
+package redis
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// Verifier re-DUMPs every Nth restored key on the target, comparing it with
+// the restored payload, as RESTOREs go. Mismatches are written to a report,
+// as compare KeyDiff JSON lines, and abort the run with Abort.
+// It can be shared by several writers.
+type Verifier struct {
+	Every int
+	Abort bool
+
+	count int64
+	mu    sync.Mutex
+	f     *os.File
+	enc   *json.Encoder
+}
+
+// NewVerifier creates a Verifier of every Nth key, writing mismatches to the
+// path report when set, truncating it.
+func NewVerifier(every int, path string, abort bool) (*Verifier, error) {
+	v := &Verifier{Every: every, Abort: abort}
+	if path == "" {
+		return v, nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating verify report: %w", err)
+	}
+	v.f, v.enc = f, json.NewEncoder(f)
+
+	return v, nil
+}
+
+// sampled reports whether the next restored key is verified, nil-safe.
+func (v *Verifier) sampled() bool {
+	if v == nil {
+		return false
+	}
+
+	return (atomic.AddInt64(&v.count, 1)-1)%int64(v.Every) == 0
+}
+
+// report writes a mismatching key.
+func (v *Verifier) report(d KeyDiff) error {
+	if v.enc == nil {
+		return nil
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.enc.Encode(d); err != nil {
+		return fmt.Errorf("error writing verify report: %w", err)
+	}
+
+	return nil
+}
+
+// Close closes the report.
+func (v *Verifier) Close() error {
+	if v == nil || v.f == nil {
+		return nil
+	}
+
+	return v.f.Close()
+}
+
+// verify DUMPs key on the target when sampled by the Verifier, comparing it
+// with the restored value and, with TTL, its PTTL with the restored ttl in
+// milliseconds, within TTLTolerance. Mismatches are counted and reported,
+// errors only with Abort, and tell false, keys not sampled true.
+func (r *Redis) verify(key, value string, ttl int64) (bool, error) {
+	if !r.Verify.sampled() {
+		return true, nil
+	}
+
+	restored, restoredTTL, err := r.dumpPTTL(key)
+	if err != nil {
+		return false, fmt.Errorf("error verifying key %s: %w", message.FormatKey(key), err)
+	}
+	r.Summary.Incr("verified")
+
+	// RESTORE TTL 0 is no expiration
+	if ttl == 0 {
+		ttl = -1
+	}
+	var status string
+	switch {
+	case restored == "":
+		// Expired, or deleted, since restored
+		status = OnlySource
+	case restored != value:
+		status = Different
+	case r.TTL && !sameTTL(ttl, restoredTTL, r.TTLTolerance):
+		status = DifferentTTL
+	default:
+		return true, nil
+	}
+
+	r.Summary.Incr("verify-mismatches")
+	r.logError("redis: verify mismatch for key %s, %s\n", message.FormatKey(key), status)
+	if err := r.Verify.report(KeyDiff{Key: key, Status: status}); err != nil {
+		return false, err
+	}
+	if r.Verify.Abort {
+		return false, fmt.Errorf("verification failed for key %s, %s on the target", message.FormatKey(key), status)
+	}
+
+	return false, nil
+}
@@ -0,0 +1,50 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mediocregopher/radix/v3"
+)
+
+// warmInterval is how often Warm checks the connections open.
+const warmInterval = 10 * time.Millisecond
+
+// availConns is a pool telling its idle connections, as radix.Pool does.
+type availConns interface {
+	NumAvailConns() int
+}
+
+// Warm waits for the size connections of client to be open, dialed,
+// authenticated and on their database: radix opens all but the first in the
+// background, slowing the first reads down, TLS handshakes especially.
+// It returns the connections open, with an error once timeout elapsed
+// first. Clients not telling their connections are returned at once.
+func Warm(ctx context.Context, client radix.Client, size int, timeout time.Duration) (int, error) {
+	pool, ok := client.(availConns)
+	if !ok {
+		return 0, nil
+	}
+	if size < 1 {
+		size = 1
+	}
+
+	ticker := time.NewTicker(warmInterval)
+	defer ticker.Stop()
+	expired := time.After(timeout)
+	for {
+		n := pool.NumAvailConns()
+		if n >= size {
+			return n, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return n, ctx.Err()
+		case <-expired:
+			return n, fmt.Errorf("%d of %d connections open after %s", n, size, timeout)
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package redis_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mediocregopher/radix/v3"
+
+	"github.com/stickermule/rump/pkg/redis"
+)
+
+// halfPool never opens more than one connection.
+type halfPool struct {
+	radix.Client
+}
+
+func (halfPool) NumAvailConns() int {
+	return 1
+}
+
+// Test Warm waits for all the connections of a pool to open
+func TestWarm(t *testing.T) {
+	s := newServer(t)
+	defer s.ln.Close()
+
+	pool, err := radix.NewPool("tcp", s.ln.Addr().String(), 4)
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+	defer pool.Close()
+
+	if n, err := redis.Warm(context.Background(), pool, 4, time.Second); n != 4 || err != nil {
+		t.Errorf("expected 4 connections open, result: %d, error: %v", n, err)
+	}
+
+	// Carrying on with the connections open on timeout
+	n, err := redis.Warm(context.Background(), halfPool{pool}, 4, 50*time.Millisecond)
+	if n != 1 || err == nil {
+		t.Errorf("expected 1 connection open and a timeout, result: %d, error: %v", n, err)
+	}
+
+	// Clients not telling their connections aren't waited for
+	if n, err := redis.Warm(context.Background(), stub(nil), 4, time.Second); n != 0 || err != nil {
+		t.Errorf("expected a stub not to be waited for, result: %d, error: %v", n, err)
+	}
+}
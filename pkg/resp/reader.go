@@ -0,0 +1,238 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// monitorPrefix matches the timestamp and client of MONITOR output lines,
+// e.g. `1339518083.107412 [0 127.0.0.1:60866] "SET" "key" "value"`.
+var monitorPrefix = regexp.MustCompile(`^\d+\.\d+ \[[^\]]*\] `)
+
+// maxPrealloc caps the arguments allocated upfront per multibulk header,
+// the rest as read: a corrupt header allocates nothing it doesn't hold.
+const maxPrealloc = 1024
+
+// ParseError is a malformed command, at Line (1-based) starting at
+// byte Offset of the stream.
+type ParseError struct {
+	Line   int
+	Offset int64
+	Msg    string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("resp: line %d, offset %d: %s", e.Line, e.Offset, e.Msg)
+}
+
+// Reader parses a command stream, as sent by redis-cli --pipe,
+// in either multibulk or inline framing.
+type Reader struct {
+	r      *bufio.Reader
+	line   int
+	offset int64
+}
+
+// NewReader creates a Reader parsing commands from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// readLine reads the next line, without its line terminator,
+// returning the line number and offset it starts at.
+func (r *Reader) readLine() (string, int, int64, error) {
+	s, err := r.r.ReadString('\n')
+	line, offset := r.line+1, r.offset
+	r.offset += int64(len(s))
+	if len(s) > 0 {
+		r.line++
+	}
+
+	// Last line may lack its terminator.
+	if err == io.EOF && len(s) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return "", line, offset, err
+	}
+
+	s = strings.TrimSuffix(s, "\n")
+	s = strings.TrimSuffix(s, "\r")
+
+	return s, line, offset, nil
+}
+
+// Read returns the next command and its arguments,
+// and io.EOF at the end of the stream.
+func (r *Reader) Read() ([]string, error) {
+	for {
+		s, line, offset, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		// Blank lines are ignored, as by the Redis server.
+		case strings.TrimSpace(s) == "":
+			continue
+		case s[0] == '*':
+			return r.readMultibulk(s, line, offset)
+		}
+
+		args, msg := splitArgs(monitorPrefix.ReplaceAllString(s, ""))
+		if msg != "" {
+			return nil, &ParseError{Line: line, Offset: offset, Msg: msg}
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		return args, nil
+	}
+}
+
+// readMultibulk reads the bulk strings of a *<n> multibulk header.
+func (r *Reader) readMultibulk(header string, line int, offset int64) ([]string, error) {
+	n, err := strconv.Atoi(header[1:])
+	if err != nil || n < 1 {
+		return nil, &ParseError{Line: line, Offset: offset, Msg: fmt.Sprintf("invalid multibulk length %q", header)}
+	}
+
+	prealloc := n
+	if prealloc > maxPrealloc {
+		prealloc = maxPrealloc
+	}
+	args := make([]string, 0, prealloc)
+	for i := 0; i < n; i++ {
+		s, line, offset, err := r.readLine()
+		if err == io.EOF {
+			return nil, &ParseError{Line: line, Offset: offset, Msg: "unexpected end of stream"}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if !strings.HasPrefix(s, "$") {
+			return nil, &ParseError{Line: line, Offset: offset, Msg: fmt.Sprintf("expected '$', got %q", s)}
+		}
+		size, err := strconv.Atoi(s[1:])
+		if err != nil || size < 0 || int64(size) > math.MaxInt64-2 {
+			return nil, &ParseError{Line: line, Offset: offset, Msg: fmt.Sprintf("invalid bulk length %q", s)}
+		}
+
+		arg, err := r.readBulk(size, line, offset)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+
+	return args, nil
+}
+
+// readBulk reads a bulk string of size bytes and its CRLF terminator,
+// errors refer to the $<size> header at line and offset. The buffer grows
+// with the bytes read, not the size announced.
+func (r *Reader) readBulk(size int, line int, offset int64) (string, error) {
+	var b bytes.Buffer
+	n, err := io.CopyN(&b, r.r, int64(size)+2)
+	buf := b.Bytes()
+	r.offset += n
+	r.line += bytes.Count(buf, []byte("\n"))
+
+	if err == io.EOF {
+		return "", &ParseError{Line: line, Offset: offset, Msg: "unexpected end of stream"}
+	}
+	if err != nil {
+		return "", err
+	}
+	if string(buf[size:]) != "\r\n" {
+		return "", &ParseError{Line: line, Offset: offset, Msg: fmt.Sprintf("bulk string not terminated by CRLF after %d bytes", size)}
+	}
+
+	return string(buf[:size]), nil
+}
+
+// splitArgs splits an inline command in arguments, honoring quotes
+// and escapes the way redis-cli does. Returns a message when malformed.
+func splitArgs(s string) ([]string, string) {
+	var args []string
+
+	i := 0
+	for {
+		for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+			i++
+		}
+		if i == len(s) {
+			return args, ""
+		}
+
+		var b strings.Builder
+		var quote byte
+		if s[i] == '"' || s[i] == '\'' {
+			quote = s[i]
+			i++
+		}
+
+	arg:
+		for {
+			switch {
+			case i == len(s) && quote != 0:
+				return nil, "unbalanced quotes"
+			case i == len(s):
+				break arg
+			case quote == 0 && (s[i] == ' ' || s[i] == '\t'):
+				break arg
+			case s[i] == quote:
+				i++
+				// Closing quote must be followed by a space.
+				if i < len(s) && s[i] != ' ' && s[i] != '\t' {
+					return nil, "closing quote must be followed by a space"
+				}
+				break arg
+			case quote == '"' && s[i] == '\\' && i+3 < len(s) && s[i+1] == 'x' && isHex(s[i+2]) && isHex(s[i+3]):
+				c, _ := strconv.ParseUint(s[i+2:i+4], 16, 8)
+				b.WriteByte(byte(c))
+				i += 4
+			case quote == '"' && s[i] == '\\' && i+1 < len(s):
+				b.WriteByte(unescape(s[i+1]))
+				i += 2
+			case quote == '\'' && s[i] == '\\' && i+1 < len(s) && s[i+1] == '\'':
+				b.WriteByte('\'')
+				i += 2
+			default:
+				b.WriteByte(s[i])
+				i++
+			}
+		}
+
+		args = append(args, b.String())
+	}
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// unescape maps double quoted backslash escapes to their byte.
+func unescape(c byte) byte {
+	switch c {
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'b':
+		return '\b'
+	case 'a':
+		return '\a'
+	}
+	return c
+}
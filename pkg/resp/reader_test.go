@@ -0,0 +1,78 @@
+package resp
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readAll(s string) ([][]string, error) {
+	r := NewReader(strings.NewReader(s))
+
+	var cmds [][]string
+	for {
+		args, err := r.Read()
+		if err == io.EOF {
+			return cmds, nil
+		}
+		if err != nil {
+			return cmds, err
+		}
+		cmds = append(cmds, args)
+	}
+}
+
+func TestRead(t *testing.T) {
+	stream := Encode("SET", "key", "va\r\nlue") +
+		"\r\n" +
+		"HSET hash \"f 1\" 'v\\'1' \"\\x41\\n\"\n" +
+		`1339518083.107412 [0 127.0.0.1:60866] "PEXPIRE" "key" "1000"` + "\n" +
+		"PING"
+
+	cmds, err := readAll(stream)
+	if err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	expected := [][]string{
+		{"SET", "key", "va\r\nlue"},
+		{"HSET", "hash", "f 1", "v'1", "A\n"},
+		{"PEXPIRE", "key", "1000"},
+		{"PING"},
+	}
+	if !reflect.DeepEqual(cmds, expected) {
+		t.Errorf("expected: %q, result: %q", expected, cmds)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	cases := []struct {
+		stream string
+		line   int
+		offset int64
+	}{
+		{"PING\r\n*x\r\n", 2, 6},
+		{"PING\r\n*2\r\n$3\r\nGET\r\n$5\r\nkey\r\n", 5, 19},
+		{"*2\r\n$3\r\nGET\r\nkey\r\n", 4, 13},
+		{"*2\r\n$3\r\nGET\r\n", 4, 13},
+		{"PING\nSET key \"value\n", 2, 5},
+		// Corrupt lengths, allocating nothing upfront
+		{"*9223372036854775807\r\n", 2, 22},
+		{"*1\r\n$9223372036854775807\r\n", 2, 4},
+		{"*000000100000000", 2, 16},
+		{"*1\r\n$1000000000\r\nGET\r\n", 2, 4},
+	}
+
+	for _, c := range cases {
+		_, err := readAll(c.stream)
+		perr, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("%q: expected a parse error, got %v", c.stream, err)
+			continue
+		}
+		if perr.Line != c.line || perr.Offset != c.offset {
+			t.Errorf("%q: expected line %d offset %d, got %v", c.stream, c.line, c.offset, perr)
+		}
+	}
+}
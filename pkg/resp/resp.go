@@ -0,0 +1,45 @@
+// Package resp encodes and parses Redis commands using the RESP protocol,
+// as replayed by redis-cli --pipe.
+package resp
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Encode encodes a command, and its arguments, as a RESP multibulk.
+func Encode(args ...string) string {
+	var b strings.Builder
+
+	b.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		b.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n")
+		b.WriteString(arg)
+		b.WriteString("\r\n")
+	}
+
+	return b.String()
+}
+
+// Recreate encodes the commands recreating key with cmd, e.g. RPUSH, taking
+// its elements step arguments each, in commands of at most size arguments
+// so that large collections aren't a single huge command.
+// Collections are deleted first, so that replays are idempotent.
+func Recreate(cmd, key string, elems []string, step, size int) string {
+	// SET replaces any existing key, without DEL leaving it missing meanwhile.
+	var cmds string
+	if cmd != "SET" {
+		cmds = Encode("DEL", key)
+	}
+
+	batch := size - size%step
+	for start := 0; start < len(elems); start += batch {
+		end := start + batch
+		if end > len(elems) {
+			end = len(elems)
+		}
+		cmds += Encode(append([]string{cmd, key}, elems[start:end]...)...)
+	}
+
+	return cmds
+}
@@ -0,0 +1,23 @@
+package resp
+
+import (
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	s := Encode("SET", "key", "va\r\nlue")
+	expected := "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$7\r\nva\r\nlue\r\n"
+
+	if s != expected {
+		t.Errorf("expected: %q, result: %q", expected, s)
+	}
+}
+
+func TestRecreate(t *testing.T) {
+	s := Recreate("HSET", "key", []string{"a", "1", "b", "2"}, 2, 3)
+	expected := Encode("DEL", "key") + Encode("HSET", "key", "a", "1") + Encode("HSET", "key", "b", "2")
+
+	if s != expected {
+		t.Errorf("expected: %q, result: %q", expected, s)
+	}
+}
@@ -0,0 +1,49 @@
+package run
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/stickermule/rump/pkg/config"
+	"github.com/stickermule/rump/pkg/redis"
+	"github.com/stickermule/rump/pkg/summary"
+)
+
+// aclPrefix returns the prefix of the source key names for -acl-prefix: the
+// one the target ACL user is confined to, unless -from-prefix is set, warned
+// of when outside of it. Targets denying ACL introspection keep -from-prefix.
+// The effective prefix is logged and noted in the summary.
+func aclPrefix(cfg config.Config, sum *summary.Summary) string {
+	prefix := cfg.Source.Prefix
+	defer func() {
+		fmt.Printf("acl: effective key prefix %q\n", prefix)
+		sum.Note(fmt.Sprintf("key names prefixed with %q, per -acl-prefix", prefix))
+	}()
+
+	db, err := newPool(cfg.Target, cfg.CertReload, 1)
+	if err != nil {
+		exit(fmt.Errorf("error creating new redis pool for %s: %w", redis.Redact(cfg.Target.URI), err))
+	}
+	target := redis.New(db, nil, cfg.Silent, cfg.TTL)
+	target.Rename = cfg.Target.Rename
+	user, patterns, err := target.ACLKeys()
+	db.Close()
+	if err != nil {
+		fmt.Printf("acl: %v, keeping the configured prefix\n", err)
+		return prefix
+	}
+
+	required := redis.KeyPrefix(patterns)
+	switch {
+	case required == "":
+		fmt.Printf("acl: user %s may write %s, no key prefix required\n", user, strings.Join(patterns, " "))
+	case prefix == "":
+		fmt.Printf("acl: user %s may only write keys under %s, applying it\n", user, required)
+		prefix = required
+	case !strings.HasPrefix(prefix, required):
+		fmt.Printf("WARNING: -from-prefix %s is outside the %s prefix the ACL user %s may write, RESTOREs fail with NOPERM\n", prefix, required, user)
+		sum.Note(fmt.Sprintf("from-prefix %s conflicts with the ACL required prefix %s", prefix, required))
+	}
+
+	return prefix
+}
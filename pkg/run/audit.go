@@ -0,0 +1,75 @@
+package run
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mediocregopher/radix/v3"
+
+	"github.com/stickermule/rump/pkg/audit"
+	"github.com/stickermule/rump/pkg/config"
+	"github.com/stickermule/rump/pkg/records"
+	"github.com/stickermule/rump/pkg/redis"
+)
+
+// newAudit creates the audit Log of the restored keys, to the file or the
+// target stream, nil when neither is configured.
+func newAudit(cfg config.Config, db radix.Client) (*audit.Log, error) {
+	var l *audit.Log
+	var err error
+	switch {
+	case cfg.Audit.Log != "":
+		l, err = audit.NewFile(cfg.Audit.Log, cfg.Audit.Chain)
+	case cfg.Audit.Stream != "":
+		l, err = audit.NewStream(db, cfg.Audit.Stream, cfg.Audit.Chain)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	l.Source, l.Target = redis.Redact(cfg.Source.URI), redis.Redact(cfg.Target.URI)
+
+	return l, nil
+}
+
+// VerifyAudit checks the hash chain of the audit log, exiting on the first
+// edited or missing entry.
+func VerifyAudit(cfg config.Config) {
+	f, err := os.Open(cfg.Audit.Log)
+	if err != nil {
+		exit(fmt.Errorf("error opening audit log: %w", err))
+	}
+	defer f.Close()
+
+	n, err := audit.Verify(f)
+	if err != nil {
+		exit(err)
+	}
+
+	fmt.Printf("verify-audit: %d entries verified\n", n)
+}
+
+// closeRecords commits the per-key records of newRecords before exiting, a
+// noop otherwise.
+var closeRecords = func() {}
+
+// newRecords creates the per-key records of the run, nil when not
+// configured, setting closeRecords.
+func newRecords(cfg config.Config, runID string) (*records.Log, error) {
+	if cfg.Records == "" {
+		return nil, nil
+	}
+
+	l, err := records.New(cfg.Records, runID)
+	if err != nil {
+		return nil, err
+	}
+	closeRecords = func() {
+		if err := l.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+
+	return l, nil
+}
@@ -0,0 +1,108 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/stickermule/rump/pkg/config"
+	"github.com/stickermule/rump/pkg/message"
+	"github.com/stickermule/rump/pkg/redis"
+	"github.com/stickermule/rump/pkg/signal"
+	"github.com/stickermule/rump/pkg/summary"
+)
+
+// benchPrefix prefixes the synthetic keys of a benchmark, followed by its
+// start time, to stay clear of other keys and benchmarks.
+const benchPrefix = "rump:bench:"
+
+// Bench seeds synthetic keys on the source, times their DUMP and RESTORE to
+// the target, the source read by key name in place of SCAN, then reports the
+// throughput and latency percentiles. The synthetic keys are deleted from
+// both once done, failed or interrupted.
+func Bench(cfg config.Config) {
+	workers := cfg.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	sdb, err := newPool(cfg.Source, cfg.CertReload, cfg.PoolSize)
+	if err != nil {
+		exit(fmt.Errorf("error creating new redis pool for %s: %w", redis.Redact(cfg.Source.URI), err))
+	}
+	defer sdb.Close()
+	tdb, err := newPool(cfg.Target, cfg.CertReload, cfg.PoolSize)
+	if err != nil {
+		exit(fmt.Errorf("error creating new redis pool for %s: %w", redis.Redact(cfg.Target.URI), err))
+	}
+	defer tdb.Close()
+
+	// Interrupted benchmarks still clean up
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go signal.Run(ctx, cancel)
+
+	sum := summary.New()
+	ch := make(message.Bus, 100)
+	source := redis.New(sdb, ch, cfg.Silent, cfg.TTL)
+	source.Rename = cfg.Source.Rename
+	source.MaxInFlight = cfg.MaxInFlight
+	source.Latency = true
+	source.Summary = sum
+	targets := make([]*redis.Redis, workers)
+	for i := range targets {
+		targets[i] = redis.New(tdb, ch, cfg.Silent, cfg.TTL)
+		targets[i].Rename = cfg.Target.Rename
+		targets[i].Latency = true
+		targets[i].Summary = sum
+	}
+
+	prefix := fmt.Sprintf("%s%d:", benchPrefix, time.Now().UnixNano())
+	fmt.Printf("bench: seeding %d keys %s* on the source\n", cfg.Bench.Keys, prefix)
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	keys, bytes, err := source.Seed(ctx, prefix, cfg.Bench.Keys, cfg.Bench.Distribution, rnd)
+	if err == nil {
+		source.Keys = keys
+		err = transfer(ctx, source, targets, sum, bytes)
+	}
+
+	for _, r := range []*redis.Redis{source, targets[0]} {
+		if cerr := r.Unseed(keys); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		exit(fmt.Errorf("error benchmarking: %w", err))
+	}
+	fmt.Printf("bench: deleted the %d keys from the source and target\n", len(keys))
+}
+
+// transfer times the transfer of the keys of source to its targets, printing
+// its throughput, bytes being the size of their values.
+func transfer(ctx context.Context, source *redis.Redis, targets []*redis.Redis, sum *summary.Summary, bytes int64) error {
+	g, gctx := errgroup.WithContext(ctx)
+	start := time.Now()
+	g.Go(func() error {
+		return source.Read(gctx)
+	})
+	for _, target := range targets {
+		target := target
+		g.Go(func() error {
+			return target.Write(gctx)
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+
+	keys := sum.Get("restored")
+	fmt.Printf("bench: keys=%d bytes=%d elapsed=%s keys/s=%.1f bytes/s=%.1f\n", keys, bytes,
+		elapsed.Truncate(time.Millisecond), float64(keys)/elapsed.Seconds(), float64(bytes)/elapsed.Seconds())
+	fmt.Println(sum)
+
+	return nil
+}
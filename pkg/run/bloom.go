@@ -0,0 +1,58 @@
+package run
+
+import (
+	"fmt"
+
+	"github.com/stickermule/rump/pkg/bloom"
+	"github.com/stickermule/rump/pkg/config"
+	"github.com/stickermule/rump/pkg/redis"
+)
+
+// newBloom creates the Bloom filter of the restored key names, sized for
+// bloom-keys keys, or the DBSIZE of the source and the merged ones, nil
+// without bloom-file.
+func newBloom(cfg config.Config) (*bloom.Filter, error) {
+	if cfg.Bloom.File == "" {
+		return nil, nil
+	}
+
+	keys := cfg.Bloom.Keys
+	if keys == 0 {
+		for _, r := range append([]config.Resource{cfg.Source}, cfg.Merge...) {
+			db, err := newPool(r, cfg.CertReload, 1)
+			if err != nil {
+				return nil, fmt.Errorf("error creating new redis pool for %s: %w", redis.Redact(r.URI), err)
+			}
+			source := redis.New(db, nil, true, false)
+			source.Rename = r.Rename
+			size, err := source.DBSize()
+			db.Close()
+			if err != nil {
+				return nil, fmt.Errorf("error sizing the bloom filter: %w", err)
+			}
+			keys += size
+		}
+	}
+
+	f := bloom.New(uint64(keys), cfg.Bloom.FP)
+	fmt.Printf("bloom: sized for %d keys at fp=%g, %d bytes\n", f.N, f.FP, (f.M+7)/8)
+
+	return f, nil
+}
+
+// writeBloom writes the Bloom filter of the run, failed or interrupted runs
+// included, holding the keys restored until then.
+func writeBloom(cfg config.Config, f *bloom.Filter) {
+	if f == nil {
+		return
+	}
+
+	if err := f.WriteFile(cfg.Bloom.File); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("bloom: %d keys written to %s\n", f.Added, cfg.Bloom.File)
+	if f.Added > f.N {
+		fmt.Printf("WARNING: bloom: %d keys over the %d it's sized for, false positives above fp=%g, raise bloom-keys\n", f.Added, f.N, f.FP)
+	}
+}
@@ -0,0 +1,45 @@
+package run
+
+import (
+	"fmt"
+
+	"github.com/mediocregopher/radix/v3"
+
+	"github.com/stickermule/rump/pkg/config"
+	"github.com/stickermule/rump/pkg/redis"
+)
+
+// bulkLimit reads the proto-max-bulk-len of the target, on db, RESTORE
+// refusing larger payloads, and of a redis source, logging when the source
+// accepts larger values. Targets denying CONFIG, e.g. managed services,
+// leave payloads unchecked, nil returned.
+func bulkLimit(cfg config.Config, db radix.Client) *redis.BulkLimit {
+	policy := cfg.OverBulkLen
+	if policy == "" {
+		policy = redis.BulkSkip
+	}
+
+	target := redis.New(db, nil, cfg.Silent, cfg.TTL)
+	target.Rename = cfg.Target.Rename
+	max, err := target.ProtoMaxBulkLen()
+	if err != nil {
+		fmt.Printf("bulk-len: payload sizes unchecked, %s %v\n", redis.Redact(cfg.Target.URI), err)
+		return nil
+	}
+
+	if cfg.Source.IsRedis && !cfg.SourceSnapshot {
+		pool, err := newPool(cfg.Source, cfg.CertReload, 1)
+		if err != nil {
+			exit(fmt.Errorf("error creating new redis pool for %s: %w", redis.Redact(cfg.Source.URI), err))
+		}
+		source := redis.New(pool, nil, cfg.Silent, cfg.TTL)
+		source.Rename = cfg.Source.Rename
+		// Sources denying CONFIG are left unreported
+		if from, err := source.ProtoMaxBulkLen(); err == nil && from > max {
+			fmt.Printf("bulk-len: source proto-max-bulk-len %d over the target %d, larger keys: %s\n", from, max, policy)
+		}
+		pool.Close()
+	}
+
+	return &redis.BulkLimit{Max: max, Policy: policy}
+}
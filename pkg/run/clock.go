@@ -0,0 +1,43 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/stickermule/rump/pkg/config"
+	"github.com/stickermule/rump/pkg/redis"
+)
+
+// reportSkew logs the clock skew of the target from the source, read with
+// TIME. rump RESTOREs relative TTLs, without ABSTTL: expirations follow the
+// target clock, whatever the skew, which is reported for operators
+// comparing expiration times across servers. Servers denying TIME leave it
+// unreported. With MaxClockSkew, skews over it, or left unchecked, abort the
+// run before any TTL is written.
+func reportSkew(cfg config.Config) {
+	var clients []*redis.Redis
+	for _, resource := range []config.Resource{cfg.Source, cfg.Target} {
+		db, err := newPool(resource, cfg.CertReload, 1)
+		if err != nil {
+			exit(fmt.Errorf("error creating new redis pool for %s: %w", redis.Redact(resource.URI), err))
+		}
+		defer db.Close()
+		client := redis.New(db, nil, cfg.Silent, cfg.TTL)
+		client.Rename = resource.Rename
+		clients = append(clients, client)
+	}
+
+	skew, err := redis.CheckSkew(clients[0], clients[1], cfg.MaxClockSkew)
+	switch {
+	case errors.Is(err, redis.ErrClockSkew):
+		exit(fmt.Errorf("ttl: %w, aborting before restoring any TTL", err))
+	case err != nil && cfg.MaxClockSkew > 0:
+		exit(fmt.Errorf("ttl: clock skew unchecked, required by max-clock-skew: %w", err))
+	case err != nil:
+		fmt.Printf("ttl: clock skew unchecked, %v\n", err)
+		return
+	}
+
+	fmt.Printf("ttl: target clock skew %s from the source, TTLs restored relative, expiring per the target clock\n", skew.Round(time.Millisecond))
+}
@@ -0,0 +1,69 @@
+package run
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/stickermule/rump/pkg/config"
+	"github.com/stickermule/rump/pkg/redis"
+)
+
+// Compare prints the diff of the source and target keys, and writes the
+// keys not identical to the Report file. It never writes to either Redis,
+// and differences aren't errors.
+func Compare(cfg config.Config) {
+	workers := cfg.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	pools := make([]*redis.Redis, 2)
+	for i, r := range []config.Resource{cfg.Source, cfg.Target} {
+		db, err := newPool(r, cfg.CertReload, workers)
+		if err != nil {
+			exit(fmt.Errorf("error creating new redis pool for %s: %w", redis.Redact(r.URI), err))
+		}
+		defer db.Close()
+
+		pools[i] = redis.New(db, nil, cfg.Silent, true)
+		pools[i].Filter = cfg.Filter
+		pools[i].ScanCount = cfg.ScanCount
+		pools[i].Rename = r.Rename
+		pools[i].TTLTolerance = cfg.TTLTolerance
+	}
+
+	var mu sync.Mutex
+	report := func(redis.KeyDiff) error { return nil }
+	if cfg.Report != "" {
+		f, err := os.Create(cfg.Report)
+		if err != nil {
+			exit(fmt.Errorf("error creating report: %w", err))
+		}
+		defer f.Close()
+
+		enc := json.NewEncoder(f)
+		report = func(d redis.KeyDiff) error {
+			mu.Lock()
+			defer mu.Unlock()
+			return enc.Encode(d)
+		}
+	}
+
+	diff, err := redis.Compare(context.Background(), pools[0], pools[1], workers, report)
+	if err != nil {
+		exit(fmt.Errorf("error comparing: %w", err))
+	}
+
+	if cfg.Sample.JSON {
+		if err := json.NewEncoder(os.Stdout).Encode(diff); err != nil {
+			exit(err)
+		}
+		return
+	}
+
+	fmt.Printf("compare: only-source=%d only-target=%d identical=%d different=%d different-ttl=%d\n",
+		diff.OnlySource, diff.OnlyTarget, diff.Identical, diff.Different, diff.DifferentTTL)
+}
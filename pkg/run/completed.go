@@ -0,0 +1,65 @@
+package run
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/stickermule/rump/pkg/config"
+	"github.com/stickermule/rump/pkg/redis"
+	"github.com/stickermule/rump/pkg/summary"
+)
+
+// closeCompleted writes the pending keys of the completion manifest of
+// newCompleted before exiting, a noop otherwise.
+var closeCompleted = func() {}
+
+// newCompleted reads the keys completed by the previous runs with Resume,
+// then opens the completion manifest of the run, both nil when not
+// configured, setting closeCompleted.
+func newCompleted(cfg config.Config) (*redis.Completed, *redis.Done, error) {
+	if cfg.Completed.Manifest == "" {
+		return nil, nil, nil
+	}
+
+	var done *redis.Done
+	if cfg.Resume {
+		var err error
+		if done, err = redis.ReadDone(cfg.Completed.Manifest, cfg.Completed.FP); err != nil {
+			return nil, nil, err
+		}
+		fmt.Printf("completed: resuming, %d keys completed per %s\n", done.Keys, cfg.Completed.Manifest)
+	}
+
+	c, err := redis.NewCompleted(cfg.Completed.Manifest, cfg.Resume)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.Batch = cfg.Completed.Batch
+	c.Fsync = cfg.Completed.Fsync
+	var once sync.Once
+	closeCompleted = func() {
+		once.Do(func() {
+			if err := c.Close(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		})
+	}
+
+	return c, done, nil
+}
+
+// reportCompleted closes the completion manifest of the run, failed or
+// interrupted runs included, and notes the keys skipped as completed by the
+// previous runs, or restored anew.
+func reportCompleted(cfg config.Config, sum *summary.Summary, c *redis.Completed) {
+	if c == nil {
+		return
+	}
+
+	closeCompleted()
+	line := fmt.Sprintf("completed: %d keys restored anew, %d skipped as completed by previous runs, per %s",
+		c.Added(), sum.Get("skipped-completed"), cfg.Completed.Manifest)
+	fmt.Println(line)
+	sum.Note(line)
+}
@@ -0,0 +1,64 @@
+package run
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/stickermule/rump/pkg/config"
+	"github.com/stickermule/rump/pkg/redis"
+)
+
+// interactive reports whether stdin is a terminal.
+func interactive() bool {
+	stat, err := os.Stdin.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// confirm previews the keys count of target, asking to confirm their
+// deletion on in when interactive, or requiring yes otherwise. Restores
+// replacing target keys aren't confirmed, see the -flush caveat in the docs.
+func confirm(target *redis.Redis, uri string, in io.Reader, interactive, yes bool) error {
+	size, err := target.DBSize()
+	if err != nil {
+		return err
+	}
+
+	preview := fmt.Sprintf("flush: %s holds %d keys, all deleted before restoring", redis.Redact(uri), size)
+	fmt.Fprintln(os.Stderr, preview)
+	switch {
+	case size == 0 || yes:
+		return nil
+	case !interactive:
+		return fmt.Errorf("flush requires -yes when stdin isn't a terminal")
+	}
+
+	fmt.Fprint(os.Stderr, "flush: continue? [y/N] ")
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer != "y" && answer != "yes" {
+		return fmt.Errorf("flush: aborted")
+	}
+
+	return nil
+}
+
+// flush deletes all target keys, once confirmed.
+func flush(cfg config.Config) {
+	db, err := newPool(cfg.Target, cfg.CertReload, 1)
+	if err != nil {
+		exit(fmt.Errorf("error creating new redis pool for %s: %w", redis.Redact(cfg.Target.URI), err))
+	}
+	defer db.Close()
+
+	target := redis.New(db, nil, cfg.Silent, cfg.TTL)
+	target.Rename = cfg.Target.Rename
+	if err := confirm(target, cfg.Target.URI, os.Stdin, interactive(), cfg.Yes); err != nil {
+		exit(err)
+	}
+	if err := target.Flush(); err != nil {
+		exit(err)
+	}
+}
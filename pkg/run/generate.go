@@ -0,0 +1,78 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/stickermule/rump/pkg/config"
+	"github.com/stickermule/rump/pkg/message"
+	"github.com/stickermule/rump/pkg/redis"
+	"github.com/stickermule/rump/pkg/signal"
+	"github.com/stickermule/rump/pkg/summary"
+)
+
+// Generate writes synthetic keys to the target, through the message Bus and
+// the target Write as a sync does, then reports them by type.
+func Generate(cfg config.Config) {
+	workers := cfg.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	db, err := newPool(cfg.Target, cfg.CertReload, cfg.PoolSize)
+	if err != nil {
+		exit(fmt.Errorf("error creating new redis pool for %s: %w", redis.Redact(cfg.Target.URI), err))
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go signal.Run(ctx, cancel)
+
+	seed := cfg.Generate.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	sum := summary.New()
+	ch := make(message.Bus, 100)
+	g := &redis.Generator{
+		Bus:      ch,
+		Keys:     cfg.Generate.Keys,
+		Prefix:   cfg.Generate.Prefix,
+		Types:    cfg.Generate.KeyTypes,
+		Sizes:    cfg.Generate.Distribution,
+		TTLs:     cfg.Generate.ExpireIn,
+		Elements: cfg.Generate.Elements,
+		Rand:     rand.New(rand.NewSource(seed)),
+		Summary:  sum,
+	}
+	fmt.Printf("generate: writing %d keys %s* to %s, seed %d\n", g.Keys, g.Prefix, redis.Redact(cfg.Target.URI), seed)
+
+	eg, gctx := errgroup.WithContext(ctx)
+	eg.Go(func() error {
+		return g.Read(gctx)
+	})
+	for i := 0; i < workers; i++ {
+		target := redis.New(db, ch, cfg.Silent, true)
+		target.Rename = cfg.Target.Rename
+		target.Summary = sum
+		eg.Go(func() error {
+			return target.Write(gctx)
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		fmt.Println(sum)
+		exit(fmt.Errorf("error generating keys: %w", err))
+	}
+
+	fmt.Printf("generate: keys=%d", sum.Get("generated"))
+	for _, typ := range redis.GenerateTypes {
+		fmt.Printf(" %s=%d", typ, sum.Get("generated-"+typ))
+	}
+	fmt.Printf(" bytes=%d\n", sum.Get("generated-bytes"))
+	fmt.Println(sum)
+}
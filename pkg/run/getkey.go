@@ -0,0 +1,105 @@
+package run
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/stickermule/rump/pkg/config"
+	"github.com/stickermule/rump/pkg/message"
+	"github.com/stickermule/rump/pkg/redis"
+)
+
+// GetKey prints the metadata of a single source key, read without SCAN,
+// with its DUMP payload when an encoding is set, and restores it to the
+// target when set.
+func GetKey(cfg config.Config) {
+	db, err := newPool(cfg.Source, cfg.CertReload, 1)
+	if err != nil {
+		exit(fmt.Errorf("error creating new redis pool for %s: %w", redis.Redact(cfg.Source.URI), err))
+	}
+	defer db.Close()
+
+	source := redis.New(db, nil, cfg.Silent, true)
+	source.Rename = cfg.Source.Rename
+
+	info, err := source.Inspect(cfg.Get.Key)
+	if err != nil {
+		exit(err)
+	}
+	if info.Type == "none" {
+		exit(fmt.Errorf("key %s not found", message.FormatKey(cfg.Get.Key)))
+	}
+
+	var p message.Payload
+	if cfg.Get.Encoding != "" || cfg.Target.URI != "" {
+		var ok bool
+		p, ok, err = source.Get(cfg.Get.Key)
+		if err != nil {
+			exit(err)
+		}
+		if !ok {
+			exit(fmt.Errorf("key %s deleted while reading it", message.FormatKey(cfg.Get.Key)))
+		}
+	}
+
+	var dump string
+	switch cfg.Get.Encoding {
+	case "hex":
+		dump = hex.EncodeToString([]byte(p.Value))
+	case "base64":
+		dump = base64.StdEncoding.EncodeToString([]byte(p.Value))
+	}
+
+	if cfg.Sample.JSON {
+		out := struct {
+			redis.KeyInfo
+			Dump string `json:"dump,omitempty"`
+		}{info, dump}
+		if err := json.NewEncoder(os.Stdout).Encode(out); err != nil {
+			exit(err)
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tTYPE\tSIZE\tTTL\tENCODING")
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", message.FormatKey(info.Key), info.Type, info.Size, info.TTL, info.Encoding)
+		w.Flush()
+		if dump != "" {
+			fmt.Printf("dump (%s): %s\n", cfg.Get.Encoding, dump)
+		}
+	}
+
+	if cfg.Target.URI == "" {
+		return
+	}
+	restoreKey(cfg, p)
+}
+
+// restoreKey restores a single Payload on the target, as a sync would.
+func restoreKey(cfg config.Config, p message.Payload) {
+	db, err := newPool(cfg.Target, cfg.CertReload, 1)
+	if err != nil {
+		exit(fmt.Errorf("error creating new redis pool for %s: %w", redis.Redact(cfg.Target.URI), err))
+	}
+	defer db.Close()
+
+	if !cfg.TTL {
+		p.TTL = "0"
+	}
+	bus := make(message.Bus, 1)
+	bus <- p
+	close(bus)
+
+	target := redis.New(db, bus, cfg.Silent, cfg.TTL)
+	target.Rename = cfg.Target.Rename
+	target.SkipExisting = cfg.SkipExisting
+	target.NoReplace = cfg.NoReplace
+	if err := target.Write(context.Background()); err != nil {
+		exit(err)
+	}
+	fmt.Fprintf(os.Stderr, "restored key %s to %s\n", message.FormatKey(p.Key), redis.Redact(cfg.Target.URI))
+}
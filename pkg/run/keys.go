@@ -0,0 +1,44 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/stickermule/rump/pkg/config"
+	"github.com/stickermule/rump/pkg/redis"
+)
+
+// Keys writes the names of the source keys to the target file, or stdout,
+// without reading their values.
+func Keys(cfg config.Config) {
+	db, err := newPool(cfg.Source, cfg.CertReload, 1)
+	if err != nil {
+		exit(fmt.Errorf("error creating new redis pool for %s: %w", redis.Redact(cfg.Source.URI), err))
+	}
+	defer db.Close()
+
+	source := redis.New(db, nil, cfg.Silent, false)
+	source.Filter = cfg.Filter
+	source.ScanCount = cfg.ScanCount
+	source.Rename = cfg.Source.Rename
+
+	var w io.Writer = os.Stdout
+	if cfg.Target.URI != "" {
+		f, err := os.Create(cfg.Target.URI)
+		if err != nil {
+			exit(fmt.Errorf("error creating keys file: %w", err))
+		}
+		defer f.Close()
+		w = f
+	}
+
+	n, err := source.ListKeys(context.Background(), w, cfg.Types, cfg.MaxKeys)
+	if err != nil {
+		exit(err)
+	}
+	if cfg.Target.URI != "" {
+		fmt.Printf("keys: %d keys written to %s\n", n, cfg.Target.URI)
+	}
+}
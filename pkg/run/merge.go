@@ -0,0 +1,77 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/stickermule/rump/pkg/message"
+	"github.com/stickermule/rump/pkg/summary"
+)
+
+// mergeSource is a source bus, read concurrently with the others, with the
+// prefix of its key names.
+type mergeSource struct {
+	name   string
+	prefix string
+	bus    message.Bus
+}
+
+// merge forwards the Payloads of all sources onto out, closing it once all
+// sources are read. Unless every source is prefixed, it remembers the key
+// names to count and log the keys read from several sources: their values
+// are restored in turn, the last one wins. Payloads tagged with their Source
+// are counted by source, e.g. read-from-<name>.
+func merge(ctx context.Context, out message.Bus, sources []mergeSource, silent bool, sum *summary.Summary) error {
+	defer close(out)
+
+	track := false
+	for _, s := range sources {
+		track = track || s.prefix == ""
+	}
+
+	var mu sync.Mutex
+	seen := map[string]string{}
+
+	g, gctx := errgroup.WithContext(ctx)
+	for _, s := range sources {
+		s := s
+		g.Go(func() error {
+			for p := range s.bus {
+				if s.prefix != "" && p.Original == "" {
+					p.Original = p.Key
+				}
+				p.Key = s.prefix + p.Key
+				if p.Source != "" {
+					sum.Incr("read-from-" + p.Source)
+				}
+
+				if track {
+					mu.Lock()
+					first, ok := seen[p.Key]
+					if !ok {
+						seen[p.Key] = s.name
+					}
+					mu.Unlock()
+					if ok && first != s.name {
+						sum.Incr("collisions")
+						if !silent {
+							fmt.Printf("merge: key %s read from %s and %s, the last restored wins\n", message.FormatKey(p.Key), first, s.name)
+						}
+					}
+				}
+
+				select {
+				case <-gctx.Done():
+					return gctx.Err()
+				case out <- p:
+				}
+			}
+			return nil
+		})
+	}
+
+	return g.Wait()
+}
@@ -0,0 +1,51 @@
+package run
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/stickermule/rump/pkg/config"
+	"github.com/stickermule/rump/pkg/redis"
+	"github.com/stickermule/rump/pkg/summary"
+)
+
+// checkModules lists the modules of the source and target, warning of the
+// source ones missing on the target, returned to be skipped with
+// -skip-missing-modules. Servers without MODULE LIST, e.g. before Redis 4 or
+// denying it, leave the modules unchecked.
+func checkModules(cfg config.Config, sum *summary.Summary) map[string]bool {
+	modules := map[string][]string{}
+	for _, r := range []struct {
+		name     string
+		resource config.Resource
+	}{{"source", cfg.Source}, {"target", cfg.Target}} {
+		db, err := newPool(r.resource, cfg.CertReload, 1)
+		if err != nil {
+			exit(fmt.Errorf("error creating new redis pool for %s: %w", redis.Redact(r.resource.URI), err))
+		}
+		client := redis.New(db, nil, cfg.Silent, cfg.TTL)
+		client.Rename = r.resource.Rename
+		names, err := client.Modules()
+		db.Close()
+		if err != nil {
+			fmt.Printf("modules: %s %v, modules unchecked\n", r.name, err)
+			sum.Note(fmt.Sprintf("modules unchecked, %s %v", r.name, err))
+			return nil
+		}
+		list := "none"
+		if len(names) > 0 {
+			list = strings.Join(names, ", ")
+		}
+		fmt.Printf("modules: %s %s\n", r.name, list)
+		modules[r.name] = names
+	}
+
+	missing := map[string]bool{}
+	for _, name := range redis.MissingModules(modules["source"], modules["target"]) {
+		fmt.Printf("WARNING: module %s of the source is missing on the target, RESTOREs of its keys fail\n", name)
+		sum.Note(fmt.Sprintf("module %s missing on the target", name))
+		missing[name] = true
+	}
+
+	return missing
+}
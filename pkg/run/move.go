@@ -0,0 +1,63 @@
+package run
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/stickermule/rump/pkg/config"
+	"github.com/stickermule/rump/pkg/redis"
+	"github.com/stickermule/rump/pkg/summary"
+)
+
+// confirmMove warns that the keys restored are deleted from the source uri,
+// asking to confirm on in when interactive, or requiring yes otherwise.
+func confirmMove(uri string, in io.Reader, interactive, yes bool) error {
+	fmt.Fprintf(os.Stderr, "WARNING: -move deletes each key restored to the target from %s, moving rather than copying it\n", redis.Redact(uri))
+	switch {
+	case yes:
+		return nil
+	case !interactive:
+		return fmt.Errorf("move requires -yes when stdin isn't a terminal")
+	}
+
+	fmt.Fprint(os.Stderr, "move: continue? [y/N] ")
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer != "y" && answer != "yes" {
+		return fmt.Errorf("move: aborted")
+	}
+
+	return nil
+}
+
+// newMover creates the Mover of source with Move, once confirmed, nil
+// otherwise.
+func newMover(cfg config.Config, source *redis.Redis, sum *summary.Summary) *redis.Mover {
+	if !cfg.Move {
+		return nil
+	}
+
+	if err := confirmMove(cfg.Source.URI, os.Stdin, interactive(), cfg.Yes); err != nil {
+		exit(err)
+	}
+	sum.Note("move, source keys deleted once restored")
+
+	return redis.NewMover(source, cfg.MoveRate)
+}
+
+// reportMove notes the keys moved, deleted from the source once restored,
+// and those copied, left on the source, with the reasons why.
+func reportMove(cfg config.Config, sum *summary.Summary) {
+	if !cfg.Move {
+		return
+	}
+
+	moved := sum.Get("moved")
+	line := fmt.Sprintf("move: %d keys moved, %d copied: %d changed on the source since read, %d unverified, %d failed, %d already gone",
+		moved, sum.Get("restored")-moved, sum.Get("move-changed"), sum.Get("move-unverified"), sum.Get("move-failed"), sum.Get("move-missing"))
+	fmt.Println(line)
+	sum.Note(line)
+}
@@ -0,0 +1,229 @@
+package run
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/stickermule/rump/pkg/config"
+	"github.com/stickermule/rump/pkg/file"
+	"github.com/stickermule/rump/pkg/redis"
+)
+
+// migrationPlan is the plan written by -plan for review, and checked by
+// -apply: the keys a run would transfer, where to, how they're transformed,
+// and what it would destroy on the target. Fingerprint is the one of the run
+// flags, applied with the same ones.
+type migrationPlan struct {
+	Fingerprint string           `json:"fingerprint"`
+	Created     time.Time        `json:"created"`
+	Source      string           `json:"source"`
+	Target      string           `json:"target"`
+	Format      string           `json:"format,omitempty"`
+	TargetDBs   []int            `json:"target_dbs,omitempty"`
+	Keys        int64            `json:"keys"`
+	Bytes       int64            `json:"bytes"`
+	Types       map[string]int64 `json:"types"`
+	Patterns    map[string]int64 `json:"patterns"`
+	Transforms  []string         `json:"transforms,omitempty"`
+	Destructive []string         `json:"destructive,omitempty"`
+}
+
+// writePlan scans the source, and the target for the keys it already has, to
+// write the plan of the run to cfg.Plan and print it, without writing to
+// either Redis.
+func writePlan(cfg config.Config) {
+	db, err := newPool(cfg.Source, cfg.CertReload, 1)
+	if err != nil {
+		exit(fmt.Errorf("error creating new redis pool for %s: %w", redis.Redact(cfg.Source.URI), err))
+	}
+	defer db.Close()
+
+	source := redis.New(db, nil, cfg.Silent, cfg.TTL)
+	source.Filter = cfg.Filter
+	source.ScanCount = cfg.ScanCount
+	source.MaxIdle = cfg.Since
+	source.Rename = cfg.Source.Rename
+
+	// Keys already on the target, unless spread across remapped databases
+	var target *redis.Redis
+	var size int64
+	if cfg.Target.IsRedis && !remapped(cfg) {
+		tdb, err := newPool(cfg.Target, cfg.CertReload, 1)
+		if err != nil {
+			exit(fmt.Errorf("error creating new redis pool for %s: %w", redis.Redact(cfg.Target.URI), err))
+		}
+		defer tdb.Close()
+
+		target = redis.New(tdb, nil, cfg.Silent, cfg.TTL)
+		target.Rename = cfg.Target.Rename
+		if size, err = target.DBSize(); err != nil {
+			exit(err)
+		}
+	}
+
+	scanned, err := source.Plan(context.Background(), target)
+	if err != nil {
+		exit(fmt.Errorf("error planning: %w", err))
+	}
+
+	p := migrationPlan{
+		Fingerprint: cfg.Fingerprint,
+		Created:     time.Now().UTC(),
+		Source:      redis.Redact(cfg.Source.URI),
+		Target:      redis.Redact(cfg.Target.URI),
+		Keys:        scanned.Keys,
+		Bytes:       scanned.Bytes,
+		Types:       scanned.Types,
+		Patterns:    scanned.Patterns,
+		Transforms:  transforms(cfg),
+		Destructive: destructive(cfg, scanned, size),
+	}
+	switch {
+	case !cfg.Target.IsRedis:
+		p.Format = cfg.Format
+	case remapped(cfg):
+		p.TargetDBs = remapTargets(cfg.Remap)
+	default:
+		p.TargetDBs = []int{uriDB(cfg.Target.URI)}
+	}
+
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		exit(err)
+	}
+	if err := ioutil.WriteFile(cfg.Plan, append(b, '\n'), 0644); err != nil {
+		exit(fmt.Errorf("error writing plan: %w", err))
+	}
+
+	fmt.Printf("plan: %s -> %s\n", p.Source, p.Target)
+	fmt.Printf("plan: %s\n", estimateLine(scanned.Estimate, float64(writeRate(cfg))))
+	fmt.Printf("plan: %s\n", typesLine(scanned.Estimate))
+	fmt.Printf("plan: %s\n", countsLine("patterns", scanned.Keys, scanned.Patterns))
+	if len(p.TargetDBs) > 0 {
+		fmt.Printf("plan: target databases %v\n", p.TargetDBs)
+	}
+	for _, t := range p.Transforms {
+		fmt.Printf("plan: transform: %s\n", t)
+	}
+	for _, d := range p.Destructive {
+		fmt.Printf("plan: destructive: %s\n", d)
+	}
+	fmt.Printf("plan: written to %s, nothing was written to the target; apply with the same flags and -apply %s\n", cfg.Plan, cfg.Plan)
+}
+
+// transforms lists the changes the run makes to the keys restored.
+func transforms(cfg config.Config) []string {
+	var t []string
+	if cfg.TTLOnly {
+		t = append(t, "only the TTLs of keys already on the target updated, no values")
+	}
+	if cfg.Source.Prefix != "" {
+		t = append(t, fmt.Sprintf("key names prefixed with %s", cfg.Source.Prefix))
+	}
+	if cfg.ACLPrefix {
+		t = append(t, "key names prefixed as the target ACL user requires")
+	}
+	if cfg.Hashtag != "" {
+		t = append(t, fmt.Sprintf("key names hashtagged with the group of %s", cfg.Hashtag))
+	}
+	if cfg.RenameAtomic {
+		t = append(t, "former key names deleted atomically with the RESTORE of the renamed keys")
+	}
+	for _, r := range cfg.Replace {
+		t = append(t, fmt.Sprintf("string values rewritten, %s", r))
+	}
+	for _, c := range cfg.Convert {
+		t = append(t, fmt.Sprintf("keys converted, %s", c))
+	}
+	if !cfg.TTL {
+		t = append(t, "keys restored without expiration, -ttl unset")
+	}
+	if cfg.DefaultTTL > 0 {
+		t = append(t, fmt.Sprintf("persistent keys expiring in %s", cfg.DefaultTTL))
+	}
+	for _, r := range cfg.TTLRules {
+		t = append(t, fmt.Sprintf("TTL rule, %s", r))
+	}
+	if cfg.TTLJitter > 0 {
+		t = append(t, fmt.Sprintf("TTLs jittered up to %s", cfg.TTLJitter))
+	}
+	if cfg.CompressAbove > 0 {
+		t = append(t, fmt.Sprintf("values of %d bytes or more compressed with %s", cfg.CompressAbove, cfg.CompressCodec))
+	}
+	if cfg.Format == file.Commands {
+		t = append(t, "keys written as the commands recreating them")
+	}
+	if cfg.Via.URI != "" {
+		t = append(t, fmt.Sprintf("payloads re-serialized via %s", redis.Redact(cfg.Via.URI)))
+	}
+	if cfg.Shadow != "" {
+		t = append(t, fmt.Sprintf("keys copied to %s", cfg.Shadow))
+	}
+	if cfg.ScriptFile != "" {
+		t = append(t, fmt.Sprintf("script %s run on each key", cfg.ScriptFile))
+	}
+	if cfg.Stage != "" {
+		t = append(t, fmt.Sprintf("keys staged in %s, not restored", cfg.Stage))
+	}
+
+	return t
+}
+
+// destructive lists what the run deletes or replaces on the target, size
+// being its DBSIZE.
+func destructive(cfg config.Config, p redis.Plan, size int64) []string {
+	var d []string
+	if cfg.RefreshTTL > 0 {
+		d = append(d, fmt.Sprintf("string keys of the source expire in %s, refreshed with GETEX", cfg.RefreshTTL))
+	}
+	if !cfg.Target.IsRedis {
+		if _, err := os.Stat(cfg.Target.URI); err == nil {
+			d = append(d, fmt.Sprintf("%s overwritten", cfg.Target.URI))
+		}
+		return d
+	}
+	if cfg.Flush {
+		d = append(d, fmt.Sprintf("FLUSHDB deletes the %d keys of the target", size))
+	}
+	if cfg.Stage != "" {
+		return d
+	}
+
+	existing := fmt.Sprintf("%d keys already on the target", p.Existing)
+	if remapped(cfg) {
+		existing = "keys already in the target databases, not counted,"
+	}
+	switch {
+	case cfg.Flush:
+	case cfg.SkipExisting || cfg.OnlyNewKeys:
+		d = append(d, fmt.Sprintf("none, %s are kept", existing))
+	case cfg.NoReplace:
+		d = append(d, fmt.Sprintf("none, %s fail to restore", existing))
+	case cfg.Conflict != "" || cfg.NewerField != "":
+		d = append(d, fmt.Sprintf("%s replaced when the conflict policy lets the source win", existing))
+	default:
+		d = append(d, fmt.Sprintf("%s replaced", existing))
+	}
+
+	return d
+}
+
+// checkPlan exits unless the plan of cfg.Apply was made with the same flags.
+func checkPlan(cfg config.Config) {
+	b, err := ioutil.ReadFile(cfg.Apply)
+	if err != nil {
+		exit(fmt.Errorf("error reading plan: %w", err))
+	}
+	var p migrationPlan
+	if err := json.Unmarshal(b, &p); err != nil {
+		exit(fmt.Errorf("error reading plan %s: %w", cfg.Apply, err))
+	}
+	if p.Fingerprint != cfg.Fingerprint {
+		exit(fmt.Errorf("plan %s was made with other flags, plan again", cfg.Apply))
+	}
+	fmt.Printf("plan: applying %s\n", cfg.Apply)
+}
@@ -0,0 +1,45 @@
+package run
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/stickermule/rump/pkg/config"
+	"github.com/stickermule/rump/pkg/redis"
+	"github.com/stickermule/rump/pkg/signal"
+	"github.com/stickermule/rump/pkg/summary"
+)
+
+// Promote promotes staged keys: the keys of the -stage hash, restored as a
+// sync does, or the keys under the -staging-prefix, renamed in place on the
+// target. Interrupted promotes stop between transactions, and can be run
+// again.
+func Promote(cfg config.Config) {
+	if cfg.StagingPrefix == "" {
+		Run(cfg)
+		return
+	}
+
+	db, err := newPool(cfg.Target, cfg.CertReload, 1)
+	if err != nil {
+		exit(fmt.Errorf("error creating new redis pool for %s: %w", redis.Redact(cfg.Target.URI), err))
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go signal.Run(ctx, cancel)
+
+	sum := summary.New()
+	target := redis.New(db, nil, cfg.Silent, cfg.TTL)
+	target.Rename = cfg.Target.Rename
+	target.Filter = cfg.Filter
+	target.ScanCount = cfg.ScanCount
+	target.LogEvery = cfg.LogEvery
+	target.Summary = sum
+	err = target.PromoteNamespace(ctx, cfg.StagingPrefix, cfg.PromoteConflict, cfg.PromoteBatch)
+	fmt.Printf("promote: %s\n", sum)
+	if err != nil {
+		exit(err)
+	}
+}
@@ -0,0 +1,124 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/stickermule/rump/pkg/config"
+	"github.com/stickermule/rump/pkg/file"
+	"github.com/stickermule/rump/pkg/message"
+	"github.com/stickermule/rump/pkg/summary"
+)
+
+// remapped reports whether cfg writes to several target databases, remapped
+// or spread.
+func remapped(cfg config.Config) bool {
+	return len(cfg.Remap.Table) > 0 || len(cfg.Remap.Spread) > 0
+}
+
+// remapTargets lists the target databases of m, sorted, Default included
+// unless unmapped keys are dropped, or the Spread ones.
+func remapTargets(m config.Remap) []int {
+	seen := map[int]bool{}
+	var dbs []int
+	add := func(db int) {
+		if !seen[db] {
+			seen[db] = true
+			dbs = append(dbs, db)
+		}
+	}
+	for _, db := range m.Table {
+		add(db)
+	}
+	for _, db := range m.Spread {
+		add(db)
+	}
+	if len(m.Table) > 0 && m.Default >= 0 {
+		add(m.Default)
+	}
+	sort.Ints(dbs)
+
+	return dbs
+}
+
+// remap forwards the Payloads of in to the bus of their target database in
+// outs, closing them once in is closed. Payloads of unmapped databases, or
+// without DB, go to m.Default, or are dropped. With Spread, Payloads go to
+// one of its databases instead, per SpreadBy. Keys are counted by target
+// database, e.g. remapped-db5, dropped ones as dropped-unmapped.
+func remap(ctx context.Context, in message.Bus, outs map[int]message.Bus, m config.Remap, silent bool, sum *summary.Summary) error {
+	defer func() {
+		for _, out := range outs {
+			close(out)
+		}
+	}()
+
+	next := 0
+	for p := range in {
+		db := m.Default
+		switch {
+		case len(m.Spread) > 0 && m.SpreadBy == config.SpreadRoundRobin:
+			db = m.Spread[next%len(m.Spread)]
+			next++
+		case len(m.Spread) > 0:
+			db = m.Spread[file.Shard(p.Key, len(m.Spread))]
+		default:
+			if src, err := strconv.Atoi(p.DB); err == nil {
+				if dst, ok := m.Table[src]; ok {
+					db = dst
+				}
+			}
+		}
+		if db < 0 {
+			sum.Incr("dropped-unmapped")
+			if !silent {
+				fmt.Printf("remap: dropped %s of unmapped database '%s'\n", message.FormatKey(p.Key), p.DB)
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case outs[db] <- p:
+			sum.Incr(fmt.Sprintf("remapped-db%d", db))
+		}
+	}
+
+	return nil
+}
+
+// uriDB returns the database of a Redis URI, its path or db parameter, 0
+// when unset.
+func uriDB(uri string) int {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return 0
+	}
+	db := strings.TrimPrefix(u.Path, "/")
+	if db == "" {
+		db = u.Query().Get("db")
+	}
+	n, _ := strconv.Atoi(db)
+
+	return n
+}
+
+// withDB returns r selecting database db in place of its URI one.
+func withDB(r config.Resource, db int) (config.Resource, error) {
+	u, err := url.Parse(r.URI)
+	if err != nil {
+		return r, fmt.Errorf("error parsing %s: %w", r.URI, err)
+	}
+	q := u.Query()
+	q.Del("db")
+	u.RawQuery = q.Encode()
+	u.Path = "/" + strconv.Itoa(db)
+	r.URI = u.String()
+
+	return r, nil
+}
@@ -0,0 +1,63 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/stickermule/rump/pkg/config"
+	"github.com/stickermule/rump/pkg/redis"
+	"github.com/stickermule/rump/pkg/summary"
+)
+
+// replicaPoll is the interval INFO replication of the -from-replica is
+// polled at, until caught up.
+const replicaPoll = time.Second
+
+// catchUp records the replication offset of the source, waits for the
+// -from-replica to reach it within -replica-timeout, detaching it with
+// -replica-detach, and returns the Resource of the replica, read in place of
+// the source. Replicas not caught up fail the run.
+func catchUp(ctx context.Context, cfg config.Config, sum *summary.Summary) config.Resource {
+	db, err := newPool(cfg.Source, cfg.CertReload, 1)
+	if err != nil {
+		exit(fmt.Errorf("error creating new redis pool for %s: %w", redis.Redact(cfg.Source.URI), err))
+	}
+	source := redis.New(db, nil, cfg.Silent, cfg.TTL)
+	source.Rename = cfg.Source.Rename
+	offset, err := source.ReplOffset()
+	db.Close()
+	if err != nil {
+		exit(fmt.Errorf("error reading the source replication offset: %w", err))
+	}
+
+	db, err = newPool(cfg.Replica, cfg.CertReload, 1)
+	if err != nil {
+		exit(fmt.Errorf("error creating new redis pool for %s: %w", redis.Redact(cfg.Replica.URI), err))
+	}
+	defer db.Close()
+	replica := redis.New(db, nil, cfg.Silent, cfg.TTL)
+	replica.Rename = cfg.Replica.Rename
+
+	fmt.Printf("replica: waiting for %s to reach the source offset %d\n", redis.Redact(cfg.Replica.URI), offset)
+	wctx, cancel := context.WithTimeout(ctx, cfg.ReplicaTimeout)
+	defer cancel()
+	reached, err := replica.WaitOffset(wctx, offset, replicaPoll)
+	if err != nil {
+		exit(fmt.Errorf("error waiting for replica %s: %w", redis.Redact(cfg.Replica.URI), err))
+	}
+	note := fmt.Sprintf("source read off replica %s at offset %d, the source at %d at start", redis.Redact(cfg.Replica.URI), reached, offset)
+	if cfg.ReplicaDetach {
+		if err := replica.Detach(); err != nil {
+			exit(err)
+		}
+		note += ", detached"
+	}
+	fmt.Println("replica: " + note)
+	sum.Note(note)
+
+	r := cfg.Replica
+	r.Prefix = cfg.Source.Prefix
+
+	return r
+}
@@ -3,74 +3,972 @@ package run
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/mediocregopher/radix/v3"
 	"golang.org/x/sync/errgroup"
 
+	"github.com/stickermule/rump/pkg/bloom"
 	"github.com/stickermule/rump/pkg/config"
 	"github.com/stickermule/rump/pkg/file"
+	"github.com/stickermule/rump/pkg/health"
 	"github.com/stickermule/rump/pkg/message"
+	"github.com/stickermule/rump/pkg/progress"
+	"github.com/stickermule/rump/pkg/ratelimit"
 	"github.com/stickermule/rump/pkg/redis"
 	"github.com/stickermule/rump/pkg/signal"
+	"github.com/stickermule/rump/pkg/summary"
+	"github.com/stickermule/rump/pkg/webhook"
 )
 
 // Exit helper
 func exit(e error) {
 	fmt.Println(e)
+	closeRecords()
+	closeCompleted()
+	flushLogs()
 	os.Exit(1)
 }
 
+// exitCheckpointed is the exit status of runs stopped at their max runtime,
+// partial and checkpointed, telling them from complete (0) and failed (1)
+// ones.
+const exitCheckpointed = 3
+
+// newPool creates the Resource Redis pool, over TLS for rediss:// URIs,
+// presenting a client certificate reloaded on change with reload, with size
+// connections, AUTHing with IAM tokens when configured.
+func newPool(r config.Resource, reload bool, size int) (*radix.Pool, error) {
+	auth, tlsConfig, proxy, err := dialOptions(r, reload)
+	if err != nil {
+		return nil, err
+	}
+
+	return redis.NewDialPool(r.URI, auth, tlsConfig, proxy, r.Dial, size)
+}
+
+// newPubSub creates the Resource pub/sub connection, configured as newPool
+// connections are.
+func newPubSub(r config.Resource, reload bool) (radix.PubSubConn, error) {
+	auth, tlsConfig, proxy, err := dialOptions(r, reload)
+	if err != nil {
+		return nil, err
+	}
+
+	return redis.NewPubSub(r.URI, auth, tlsConfig, proxy, r.Dial), nil
+}
+
+// dialOptions returns the Resource credentials, TLS and proxy settings, of
+// newPool and newPubSub.
+func dialOptions(r config.Resource, reload bool) (redis.AuthProvider, *tls.Config, *redis.Proxy, error) {
+	var tlsConfig *tls.Config
+	if r.TLS {
+		var certs redis.CertSource
+		var err error
+		switch {
+		case r.CertFile != "" && reload:
+			certs, err = redis.NewFileCert(r.CertFile, r.KeyFile)
+		case r.CertFile != "":
+			certs, err = redis.NewStaticCert(r.CertFile, r.KeyFile)
+		}
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		tlsConfig, err = redis.NewTLSConfig(certs, r.CAFile)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	var auth redis.AuthProvider = redis.StaticAuth{Password: r.Password}
+	if r.IAMUser != "" {
+		auth = redis.NewIAMAuth(r.IAMUser, r.IAMCache, r.IAMRegion, r.IAMService)
+	}
+
+	var proxy *redis.Proxy
+	if r.Proxy != "" {
+		var err error
+		if proxy, err = redis.ParseProxy(r.Proxy); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	return auth, tlsConfig, proxy, nil
+}
+
+// newClient creates the Resource Redis pool as newPool does, recreated on
+// connection loss up to attempts times.
+func newClient(r config.Resource, reload bool, size, attempts int, sum *summary.Summary) (radix.Client, error) {
+	if attempts == 0 {
+		return newPool(r, reload, size)
+	}
+
+	return redis.NewReconnectPool(func() (*radix.Pool, error) {
+		return newPool(r, reload, size)
+	}, attempts, sum)
+}
+
+// writeTextfile writes the final summary of the run, failed with err when
+// set, to the -prometheus-textfile, logging errors without failing the run.
+func writeTextfile(cfg config.Config, sum *summary.Summary, err error) {
+	if cfg.Textfile == "" {
+		return
+	}
+	if werr := progress.WriteTextfile(cfg.Textfile, sum, err); werr != nil {
+		fmt.Fprintln(os.Stderr, werr)
+	}
+}
+
+// warmTimeout bounds the wait for the connections of a pool to open.
+const warmTimeout = 30 * time.Second
+
+// warm waits for the size connections of the name pool to open, noting it
+// in the summary. Runs carry on with the connections open on timeout.
+func warm(ctx context.Context, name string, client radix.Client, size int, sum *summary.Summary) {
+	start := time.Now()
+	n, err := redis.Warm(ctx, client, size, warmTimeout)
+	line := fmt.Sprintf("warm: %s pool, %d connections open in %s", name, n, time.Since(start).Round(time.Millisecond))
+	if err != nil {
+		line = fmt.Sprintf("warm: %s pool, %s, carrying on", name, err)
+	}
+	fmt.Fprintln(os.Stderr, line)
+	sum.Note(line)
+}
+
+// writeRate returns the keys/sec restored at most on all destinations
+// combined, Rate per destination capped by AggregateRate, 0 when unlimited.
+func writeRate(cfg config.Config) int {
+	rate := cfg.Rate
+	if remapped(cfg) {
+		rate *= len(remapTargets(cfg.Remap))
+	}
+	if cfg.AggregateRate > 0 && (rate == 0 || cfg.AggregateRate < rate) {
+		rate = cfg.AggregateRate
+	}
+
+	return rate
+}
+
+// estimateLine formats a transfer Estimate, with its minimal duration
+// when the restore is rate limited.
+func estimateLine(est redis.Estimate, rate float64) string {
+	line := fmt.Sprintf("estimate: keys=%d bytes=%d", est.Keys, est.Bytes)
+	if rate > 0 {
+		d := time.Duration(float64(est.Keys) / rate * float64(time.Second))
+		line += fmt.Sprintf(" duration>=%s", d.Round(time.Second))
+	}
+
+	return line
+}
+
+// typesLine formats the keys count by type of an Estimate, most common
+// types first, with their share of the keys.
+func typesLine(est redis.Estimate) string {
+	return countsLine("types", est.Keys, est.Types)
+}
+
+// countsLine formats the keys count by name of counts, most common first,
+// with their share of the keys.
+func countsLine(name string, keys int64, counts map[string]int64) string {
+	names := make([]string, 0, len(counts))
+	for n := range counts {
+		names = append(names, n)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	line := fmt.Sprintf("%s: keys=%d", name, keys)
+	for _, n := range names {
+		line += fmt.Sprintf(" %s=%d (%.1f%%)", n, counts[n], float64(counts[n])*100/float64(keys))
+	}
+
+	return line
+}
+
+// autoTune sets the pool size, scan count and workers left unset from the
+// source INFO, logging the values picked.
+func autoTune(cfg config.Config, sum *summary.Summary) config.Config {
+	db, err := newPool(cfg.Source, cfg.CertReload, 1)
+	if err != nil {
+		exit(fmt.Errorf("error creating new redis pool for %s: %w", redis.Redact(cfg.Source.URI), err))
+	}
+	defer db.Close()
+
+	source := redis.New(db, nil, cfg.Silent, cfg.TTL)
+	source.Rename = cfg.Source.Rename
+	info, err := source.ServerInfo()
+	if err != nil {
+		exit(fmt.Errorf("error auto-tuning: %w", err))
+	}
+	t := redis.AutoTune(info)
+
+	if cfg.PoolSize == 0 {
+		cfg.PoolSize = t.PoolSize
+	}
+	if cfg.ScanCount == 0 {
+		cfg.ScanCount = t.ScanCount
+	}
+	// Commands are replayed in order, by a single worker
+	if cfg.Workers == 0 && cfg.Target.IsRedis && cfg.Format != file.Commands {
+		cfg.Workers = t.Workers
+	}
+
+	line := fmt.Sprintf("auto-tune: pool-size=%d scan-count=%d workers=%d, for connected_clients=%d maxclients=%d keys=%d",
+		cfg.PoolSize, cfg.ScanCount, cfg.Workers, info.ConnectedClients, info.MaxClients, info.Keys)
+	fmt.Fprintln(os.Stderr, line)
+	sum.Note(line)
+
+	return cfg
+}
+
+// readKeys reads the keys of a dead-letter file, none for an empty one.
+func readKeys(path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		exit(fmt.Errorf("error reading keys from %s: %w", path, err))
+	}
+	defer f.Close()
+
+	keys, err := redis.ReadKeys(f)
+	if err != nil {
+		exit(err)
+	}
+	if keys == nil {
+		keys = []string{}
+	}
+
+	return keys
+}
+
 // Run orchestrate the Reader, Writer and Signal handler.
 func Run(cfg config.Config) {
+	// Plan without writing, or apply a plan made with the same flags
+	if cfg.Plan != "" {
+		writePlan(cfg)
+		return
+	}
+	if cfg.Apply != "" {
+		checkPlan(cfg)
+	}
+
+	// Tell runs apart in their logs, summary and metrics
+	runID := cfg.RunID
+	if runID == "" {
+		runID = newRunID()
+	}
+	if cfg.LogRunID {
+		prefixLogs(runID)
+		defer flushLogs()
+	}
+	fmt.Printf("run: id %s\n", runID)
+
+	// Skip key ranges already completed, per the manifest
+	keyRange := cfg.Filter.Range.String()
+	if cfg.RangeManifest != "" {
+		done, err := progress.RangeDone(cfg.RangeManifest, keyRange, redis.Redact(cfg.Source.URI), redis.Redact(cfg.Target.URI))
+		if err != nil {
+			exit(err)
+		}
+		if done {
+			fmt.Printf("range: %s already completed, per %s\n", keyRange, cfg.RangeManifest)
+			return
+		}
+	}
+
+	// Resume the SCAN of the previous run, stopped at its max runtime
+	var checkpoint *redis.Checkpoint
+	resumed := progress.Checkpoint{Cursor: "0"}
+	if cfg.Checkpoint != "" {
+		if cfg.Resume {
+			var err error
+			resumed, err = progress.ReadCheckpoint(cfg.Checkpoint, redis.Redact(cfg.Source.URI), redis.Redact(cfg.Target.URI))
+			if err != nil {
+				exit(err)
+			}
+			if resumed.Done {
+				fmt.Printf("checkpoint: scan already completed, per %s\n", cfg.Checkpoint)
+				return
+			}
+			fmt.Printf("checkpoint: resuming from cursor %s, %d keys processed\n", resumed.Cursor, resumed.Keys)
+		}
+		var deadline time.Time
+		if cfg.MaxRuntime > 0 {
+			deadline = time.Now().Add(cfg.MaxRuntime)
+		}
+		checkpoint = redis.NewCheckpoint(resumed.Cursor, deadline)
+	}
+
+	// Exit partial runs once deferred closes are done, flushing their files
+	partial := false
+	defer func() {
+		if partial {
+			flushLogs()
+			os.Exit(exitCheckpointed)
+		}
+	}()
+
 	// create ErrGroup to manage goroutines
 	ctx, cancel := context.WithCancel(context.Background())
 	g, gctx := errgroup.WithContext(ctx)
 
-	// Start signal handling goroutine
+	// Consecutive failures of all writers, tripping at max-failures
+	var breaker *redis.Breaker
+	if cfg.MaxFailures > 0 {
+		breaker = redis.NewBreaker(cfg.MaxFailures)
+	}
+
+	// Writers cancel the run on their first error
+	var failFast *redis.FailFast
+	if cfg.FailFast {
+		failFast = redis.NewFailFast(cancel)
+	}
+
+	// Create shared run summary
+	sum := summary.New()
+	sum.SetRunID(runID)
+
+	// Restored keys per cluster node, reported in the summary
+	var balance *redis.Balance
+
+	// Restored key names, written to bloom-file once the run ends
+	var keyBloom *bloom.Filter
+
+	// Restored key names, appended to the completion manifest
+	var completed *redis.Completed
+
+	// Restored keys deleted from the source, with -move
+	var mover *redis.Mover
+
+	// Skipped keys, listed per reason, for follow-up runs of each
+	var skipFiles *redis.SkipFiles
+	if len(cfg.SkipFiles.Paths) > 0 {
+		var err error
+		if skipFiles, err = redis.NewSkipFiles(cfg.SkipFiles.Paths); err != nil {
+			exit(err)
+		}
+		defer skipFiles.Close()
+	}
+
+	// Start signal handling goroutine, interrupted runs aren't complete
+	var interrupted int32
 	g.Go(func() error {
-		return signal.Run(gctx, cancel)
+		err := signal.Run(gctx, cancel)
+		if err == nil {
+			atomic.StoreInt32(&interrupted, 1)
+		}
+		return err
 	})
 
+	// Report progress to stderr on SIGINFO/SIGUSR1, even in silent mode
+	g.Go(func() error {
+		return signal.Info(gctx, func() {
+			fmt.Fprintln(os.Stderr, sum.Progress())
+		})
+	})
+
+	// Write progress for monitoring tools, even in silent mode
+	var prog *progress.File
+	if cfg.ProgressFile != "" {
+		prog = progress.New(cfg.ProgressFile, sum)
+		g.Go(func() error {
+			return prog.Run(gctx, cfg.ProgressInterval)
+		})
+	}
+
+	// Serve liveness and readiness probes, checking connections a few times
+	// per threshold
+	var checker *health.Checker
+	if cfg.HealthAddr != "" {
+		checker = health.New(cfg.HealthThreshold)
+		interval := cfg.HealthThreshold / 3
+		if interval < time.Second {
+			interval = time.Second
+		}
+		g.Go(func() error {
+			return checker.Run(gctx, cfg.HealthAddr, interval)
+		})
+	}
+
+	// Stagger processes launched at once, before they connect
+	if err := waitStart(gctx, cfg.StartDelay, cfg.StartJitter); err != nil {
+		cancel()
+		g.Wait()
+		fmt.Println("start: interrupted before connecting")
+		return
+	}
+
+	// Pick unset pool size, scan count and workers from the source load
+	if cfg.AutoTune {
+		cfg = autoTune(cfg, sum)
+	}
+
+	// Empty the target, once confirmed
+	if cfg.Flush {
+		flush(cfg)
+	}
+
 	// Create shared message bus
 	ch := make(message.Bus, 100)
 
+	// Create the aggregate write limiter, shared by all destinations, each
+	// one getting its own rate limiter.
+	aggregateLimiter := ratelimit.New(float64(cfg.AggregateRate))
+	byteLimiter := ratelimit.New(float64(cfg.ByteRate))
+
+	// Create the TTL jitter, shared by all destinations.
+	var jitter *redis.Jitter
+	if cfg.TTLJitter > 0 {
+		seed := cfg.JitterSeed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		jitter = redis.NewJitter(cfg.TTLJitter, seed)
+	}
+
+	// TTL rules, counted by position in the summary
+	var ttlRules []redis.TTLRule
+	if len(cfg.TTLRules) > 0 {
+		var names []string
+		for i, r := range cfg.TTLRules {
+			rule, _ := redis.ParseTTLRule(r)
+			ttlRules = append(ttlRules, rule)
+			names = append(names, fmt.Sprintf("%d %s", i+1, r))
+		}
+		sum.Note("ttl rules: " + strings.Join(names, ", "))
+	}
+
+	var missingModules map[string]bool
+	if cfg.ListModules || cfg.SkipModules {
+		missingModules = checkModules(cfg, sum)
+	}
+	if cfg.ACLPrefix {
+		cfg.Source.Prefix = aclPrefix(cfg, sum)
+	}
+
+	// Replicas are read in place of the source, once caught up with it
+	if cfg.ReplicaFrom != "" {
+		cfg.Source = catchUp(gctx, cfg, sum)
+	}
+
+	// Absolute expiration times differ across servers by their clock skew
+	if cfg.TTL && cfg.Source.IsRedis && cfg.Target.IsRedis && !cfg.SourceSnapshot {
+		reportSkew(cfg)
+	}
+
+	// Snapshot sources are read as RDB files
+	rdbPath := ""
+	if cfg.SourceSnapshot {
+		rdbPath = snapshot(gctx, cfg, sum)
+	}
+
 	// Create and run either a Redis or File Source reader.
-	if cfg.Source.IsRedis {
-		db, err := radix.NewPool("tcp", cfg.Source.URI, 1)
+	if cfg.Source.IsRedis && rdbPath == "" {
+		db, err := newClient(cfg.Source, cfg.CertReload, cfg.PoolSize, cfg.Reconnect, sum)
 		if err != nil {
-			exit(fmt.Errorf("error creating new redis pool for %s: %W", cfg.Source.URI, err))
+			exit(fmt.Errorf("error creating new redis pool for %s: %w", redis.Redact(cfg.Source.URI), err))
+		}
+		if cfg.WarmPool || cfg.AutoTune {
+			warm(gctx, "source", db, cfg.PoolSize, sum)
 		}
 
-		source := redis.New(db, ch, cfg.Silent, cfg.TTL)
+		// Merged sources each read into their own bus
+		merging := len(cfg.Merge) > 0 || cfg.Source.Prefix != ""
+		bus := ch
+		if merging {
+			bus = make(message.Bus, 100)
+		}
 
-		g.Go(func() error {
-			return source.Read(gctx)
-		})
+		source := redis.New(db, bus, cfg.Silent, cfg.TTL)
+		source.Commands = cfg.Format == file.Commands
+		source.TTLOnly = cfg.TTLOnly
+		if cfg.TTLOnly {
+			sum.Note("ttl only, no key DUMPed or RESTOREd")
+		}
+		source.Filter = cfg.Filter
+		source.ValueMatch = cfg.ValueRegex
+		source.ValueOthers = cfg.ValueOthers
+		if cfg.SkipModules {
+			source.SkipModules = missingModules
+		}
+		if len(cfg.SkipTypes) > 0 {
+			source.SkipTypes = map[string]bool{}
+			for _, t := range cfg.SkipTypes {
+				source.SkipTypes[t] = true
+			}
+		}
+		if cfg.SkippedFile != "" {
+			skipped, err := redis.NewDeadLetter(cfg.SkippedFile)
+			if err != nil {
+				exit(err)
+			}
+			defer skipped.Close()
+			source.Skipped = skipped
+		}
+		source.SkipFiles = skipFiles
+		source.ScanCount = cfg.ScanCount
+		if cfg.DedupWindow > 0 {
+			source.Dedup = redis.NewDedup(cfg.DedupWindow)
+		}
+		if completed, source.Done, err = newCompleted(cfg); err != nil {
+			exit(err)
+		}
+		mover = newMover(cfg, source, sum)
+		source.MaxIdle = cfg.Since
+		if cfg.RefreshTTL > 0 {
+			source.Refresh = cfg.RefreshTTL
+			fmt.Printf("WARNING: -refresh-ttl writes to the source, its string keys read with GETEX now expire in %s, persistent ones included\n", cfg.RefreshTTL)
+			sum.Note(fmt.Sprintf("source string keys refreshed to expire in %s", cfg.RefreshTTL))
+		}
+		source.MinSize = cfg.MinDumpSize
+		source.LargeSize = cfg.LargeKeySize
+		source.LargeEncoding = cfg.LargeKeyEncoding
+		source.MaxInFlight = cfg.MaxInFlight
+		source.Sort = cfg.Sort
+		source.MaxKeys = cfg.SortMaxKeys
+		if len(cfg.Remap.Table) > 0 {
+			source.DB = strconv.Itoa(uriDB(cfg.Source.URI))
+		}
+		if cfg.OnlyNewKeys {
+			existing, err := newPool(cfg.Target, cfg.CertReload, cfg.PoolSize)
+			if err != nil {
+				exit(fmt.Errorf("error creating new redis pool for %s: %w", redis.Redact(cfg.Target.URI), err))
+			}
+			source.Existing = redis.New(existing, nil, cfg.Silent, cfg.TTL)
+			source.Existing.Rename = cfg.Target.Rename
+		}
+		if cfg.Slot != nil {
+			source.Slot = *cfg.Slot
+		}
+		if cfg.KeysFile != "" {
+			source.Keys = readKeys(cfg.KeysFile)
+		}
+		source.Rename = cfg.Source.Rename
+		source.Latency = cfg.Latency
+		source.Types = cfg.PartitionByType
+		source.LogEvery = cfg.LogEvery
+		source.QuietErrors = cfg.QuietErrors
+		source.StreamGroups = cfg.StreamGroups
+		source.Checkpoint = checkpoint
+		if cfg.Command == config.Promote {
+			source.Staged = cfg.Stage
+		}
+		if len(cfg.Replace) > 0 {
+			var pairs []string
+			for _, r := range cfg.Replace {
+				pairs = append(pairs, strings.SplitN(r, "=", 2)...)
+			}
+			source.Replace = strings.NewReplacer(pairs...)
+			source.ReplaceEncoding = cfg.ReplaceEncoding
+		}
+		for _, c := range cfg.Convert {
+			i := strings.LastIndex(c, "=")
+			source.Conversions = append(source.Conversions, redis.Conversion{Pattern: c[:i], Converter: redis.Converters[c[i+1:]]})
+		}
+		if cfg.KeysStream.Name != "" {
+			consumer, _ := os.Hostname()
+			source.KeysStream = &redis.KeysStream{
+				Name:     cfg.KeysStream.Name,
+				Field:    cfg.KeysStream.Field,
+				Start:    cfg.KeysStream.Start,
+				Group:    cfg.KeysStream.Group,
+				Consumer: "rump-" + consumer,
+			}
+		}
+		if cfg.KeysChannel != "" {
+			pubsub, err := newPubSub(cfg.Source, cfg.CertReload)
+			if err != nil {
+				exit(fmt.Errorf("error subscribing to keys channel: %w", err))
+			}
+			source.KeysChannel = &redis.KeysChannel{Name: cfg.KeysChannel, PubSub: pubsub}
+		}
+		if cfg.DryRun {
+			source.DryRun = redis.NewDryRun(os.Stdout)
+			sum.Note("dry run, no key DUMPed or written")
+		}
+		source.Summary = sum
+		checker.Add("source", source.Ping)
+		if cfg.Throttle.On {
+			throttle := redis.NewThrottle(cfg.Throttle.MinRate, cfg.Throttle.MaxRate, cfg.Throttle.Interval)
+			throttle.MaxCPU = cfg.Throttle.CPU
+			throttle.MaxOps = cfg.Throttle.Ops
+			throttle.MaxLatency = cfg.Throttle.Latency
+			source.Throttle = throttle
+			g.Go(func() error {
+				return throttle.Run(gctx, source)
+			})
+		}
+
+		switch {
+		case cfg.Estimate || cfg.TypeCounts:
+			prog.SetPhase(progress.Estimating)
+			est, err := source.Estimate(gctx, cfg.Estimate, cfg.TypeCounts)
+			if err != nil {
+				prog.Finish(err)
+				exit(fmt.Errorf("error estimating transfer: %w", err))
+			}
+			if cfg.Estimate {
+				line := estimateLine(est, float64(writeRate(cfg)))
+				fmt.Println(line)
+				sum.Note(line)
+			}
+			if cfg.TypeCounts {
+				line := typesLine(est)
+				fmt.Println(line)
+				sum.Note(line)
+			}
+			prog.SetTotal(est.Keys)
+			prog.SetPhase(progress.Reading)
+		case prog != nil:
+			// Unfiltered, the total is only an upper bound
+			if size, err := source.DBSize(); err == nil {
+				prog.SetTotal(size)
+			}
+		}
+
+		if !merging {
+			g.Go(func() error {
+				err := source.Read(gctx)
+				if err == nil {
+					prog.SetPhase(progress.Writing)
+				}
+				return err
+			})
+		} else {
+			source.Name = redis.Redact(cfg.Source.URI)
+			sources := []mergeSource{{name: source.Name, prefix: cfg.Source.Prefix, bus: bus}}
+			readers := []*redis.Redis{source}
+			for _, r := range cfg.Merge {
+				db, err := newClient(r, cfg.CertReload, cfg.PoolSize, cfg.Reconnect, sum)
+				if err != nil {
+					exit(fmt.Errorf("error creating new redis pool for %s: %w", redis.Redact(r.URI), err))
+				}
+
+				// Same settings as the -from source
+				extra := *source
+				extra.Pool = db
+				extra.Bus = make(message.Bus, 100)
+				extra.Name = redis.Redact(r.URI)
+				if cfg.DedupWindow > 0 {
+					extra.Dedup = redis.NewDedup(cfg.DedupWindow)
+				}
+				if len(cfg.Remap.Table) > 0 {
+					extra.DB = strconv.Itoa(uriDB(r.URI))
+				}
+				readers = append(readers, &extra)
+				checker.Add(redis.Redact(r.URI), extra.Ping)
+				sources = append(sources, mergeSource{name: extra.Name, prefix: r.Prefix, bus: extra.Bus})
+			}
+
+			for _, reader := range readers {
+				reader := reader
+				g.Go(func() error {
+					return reader.Read(gctx)
+				})
+			}
+			g.Go(func() error {
+				err := merge(gctx, ch, sources, cfg.Silent, sum)
+				if err == nil {
+					prog.SetPhase(progress.Writing)
+				}
+				return err
+			})
+		}
 	} else {
 		source := file.New(cfg.Source.URI, ch, cfg.Silent, cfg.TTL, cfg.MaxBuf)
+		source.Format = cfg.Format
+		source.DB = cfg.RDB.DB
+		if rdbPath != "" {
+			source.Path = rdbPath
+			source.Format = file.RDB
+			source.DB = uriDB(cfg.Source.URI)
+			source.Filter = cfg.Filter
+		}
+		source.TargetVersion = cfg.RDB.TargetVersion
+		source.Types = cfg.Types
+		source.Sort = cfg.Sort
+		source.LogEvery = cfg.LogEvery
+		source.QuietErrors = cfg.QuietErrors
+		source.Summary = sum
 
 		g.Go(func() error {
-			return source.Read(gctx)
+			err := source.Read(gctx)
+			if err == nil {
+				prog.SetPhase(progress.Writing)
+			}
+			return err
 		})
 	}
 
-	// Create and run either a Redis or File Target writer.
-	if cfg.Target.IsRedis {
-		db, err := radix.NewPool("tcp", cfg.Target.URI, 1)
+	// Writers read the bus of the sources, or that of the keys shuffled off it
+	writes := ch
+	if cfg.RandomizeOrder {
+		writes = make(message.Bus, 100)
+		sum.Note(fmt.Sprintf("keys restored shuffled within windows of %d", cfg.RandomizeWindow))
+		g.Go(func() error {
+			return shuffle(gctx, ch, writes, cfg.RandomizeWindow, time.Now().UnixNano())
+		})
+	}
+
+	// Create and run either a Redis or File Target writer, none for dry runs.
+	switch {
+	case cfg.DryRun:
+		g.Go(func() error {
+			defer cancel()
+			for range writes {
+			}
+			return nil
+		})
+	case cfg.Target.IsRedis:
+		workers := cfg.Workers
+		if workers < 1 {
+			workers = 1
+		}
+		size := cfg.PoolSize
+		if size < workers {
+			size = workers
+		}
+		db, err := newClient(cfg.Target, cfg.CertReload, size, cfg.Reconnect, sum)
+		if err != nil {
+			exit(fmt.Errorf("error creating new redis pool for %s: %w", redis.Redact(cfg.Target.URI), err))
+		}
+		if cfg.WarmPool || cfg.AutoTune {
+			warm(gctx, "target", db, size, sum)
+		}
+		if cfg.RunIDKey != "" {
+			marker := redis.New(db, nil, cfg.Silent, cfg.TTL)
+			marker.Rename = cfg.Target.Rename
+			if err := marker.MarkRun(cfg.RunIDKey, runID, redis.Redact(cfg.Source.URI)); err != nil {
+				exit(err)
+			}
+		}
+
+		// RESTORE refuses payloads over the target proto-max-bulk-len
+		var limit *redis.BulkLimit
+		if cfg.Format != file.Commands && !cfg.TTLOnly {
+			limit = bulkLimit(cfg, db)
+		}
+
+		var via *radix.Pool
+		if cfg.Via.URI != "" {
+			via, err = newPool(cfg.Via, false, size)
+			if err != nil {
+				exit(fmt.Errorf("error creating new redis pool for %s: %w", redis.Redact(cfg.Via.URI), err))
+			}
+		}
+
+		var deadLetter *redis.DeadLetter
+		if cfg.DeadLetter != "" {
+			deadLetter, err = redis.NewDeadLetter(cfg.DeadLetter)
+			if err != nil {
+				exit(err)
+			}
+			defer deadLetter.Close()
+		}
+
+		var verify *redis.Verifier
+		if cfg.Verify.Every > 0 {
+			verify, err = redis.NewVerifier(cfg.Verify.Every, cfg.Verify.Report, cfg.Verify.Abort)
+			if err != nil {
+				exit(err)
+			}
+			defer verify.Close()
+		}
+
+		if cfg.Balance.Node != "" {
+			node := config.Resource{URI: cfg.Balance.Node, IsRedis: true, TLS: strings.HasPrefix(cfg.Balance.Node, "rediss://")}
+			pool, err := newPool(node, false, 1)
+			if err != nil {
+				exit(fmt.Errorf("error creating new redis pool for %s: %w", redis.Redact(cfg.Balance.Node), err))
+			}
+			balance, err = redis.NewBalance(pool, cfg.Balance.Skew, cfg.Balance.Pace)
+			pool.Close()
+			if err != nil {
+				exit(err)
+			}
+		}
+
+		auditLog, err := newAudit(cfg, db)
 		if err != nil {
-			exit(fmt.Errorf("error creating new redis pool for %s: %W", cfg.Target.URI, err))
+			exit(err)
 		}
+		defer auditLog.Close()
 
-		target := redis.New(db, ch, cfg.Silent, cfg.TTL)
+		if keyBloom, err = newBloom(cfg); err != nil {
+			exit(err)
+		}
+
+		keyRecords, err := newRecords(cfg, runID)
+		if err != nil {
+			exit(err)
+		}
+		defer keyRecords.Close()
+
+		var provenance *redis.Provenance
+		if cfg.Provenance != "" {
+			provenance = &redis.Provenance{Template: cfg.Provenance, Batch: cfg.BatchID}
+			if provenance.Batch == "" {
+				provenance.Batch = runID
+			}
+			sum.Note(fmt.Sprintf("provenance batch %s", provenance.Batch))
+		}
+
+		var script *redis.Script
+		if cfg.ScriptFile != "" {
+			source, err := ioutil.ReadFile(cfg.ScriptFile)
+			if err != nil {
+				exit(fmt.Errorf("error reading script %s: %w", cfg.ScriptFile, err))
+			}
+			script = &redis.Script{Source: string(source), Args: cfg.ScriptArgs}
+		}
+
+		// Writers pause while the target replicas lag behind
+		var replLag *redis.ReplLag
+		if cfg.ReplLag.Max > 0 {
+			replLag = redis.NewReplLag(cfg.ReplLag.Max, cfg.ReplLag.Interval)
+			monitor := redis.New(db, nil, cfg.Silent, cfg.TTL)
+			monitor.Rename = cfg.Target.Rename
+			monitor.Summary = sum
+			g.Go(func() error {
+				return replLag.Run(gctx, monitor)
+			})
+		}
+
+		// Writers of each target database, a single one unless remapped
+		buses := []message.Bus{writes}
+		pools := []radix.Client{db}
+		if remapped(cfg) {
+			buses, pools = nil, nil
+			outs := map[int]message.Bus{}
+			for _, n := range remapTargets(cfg.Remap) {
+				r, err := withDB(cfg.Target, n)
+				if err != nil {
+					exit(err)
+				}
+				pool, err := newClient(r, cfg.CertReload, size, cfg.Reconnect, sum)
+				if err != nil {
+					exit(fmt.Errorf("error creating new redis pool for %s: %w", redis.Redact(r.URI), err))
+				}
+				outs[n] = make(message.Bus, 100)
+				buses = append(buses, outs[n])
+				pools = append(pools, pool)
+			}
+			g.Go(func() error {
+				return remap(gctx, writes, outs, cfg.Remap, cfg.Silent, sum)
+			})
+		}
+
+		// Workers share the pool and the message bus of their database
+		var wg sync.WaitGroup
+		for j, bus := range buses {
+			limiter := ratelimit.New(float64(cfg.Rate))
+			for i := 0; i < workers; i++ {
+				target := redis.New(pools[j], bus, cfg.Silent, cfg.TTL)
+				target.Commands = cfg.Format == file.Commands
+				target.Shadow = cfg.Shadow
+				target.Hashtag = cfg.HashtagRegex
+				target.RenameAtomic = cfg.RenameAtomic
+				target.ReplLag = replLag
+				target.Limiter = limiter
+				target.AggregateLimiter = aggregateLimiter
+				target.ByteLimiter = byteLimiter
+				target.Rename = cfg.Target.Rename
+				target.Latency = cfg.Latency
+				target.LogEvery = cfg.LogEvery
+				target.PersistMinusOne = cfg.PersistMinusOne
+				target.DefaultTTL = cfg.DefaultTTL
+				target.TTLRules = ttlRules
+				target.Jitter = jitter
+				target.SkipExisting = cfg.SkipExisting
+				target.NoReplace = cfg.NoReplace
+				if cfg.Command == config.Promote {
+					if !cfg.KeepStaged {
+						target.Staged = cfg.Stage
+					}
+				} else {
+					target.Stage = cfg.Stage
+				}
+				target.Conflict = redis.Conflicts[cfg.Conflict]
+				if cfg.NewerField != "" {
+					target.Newer = redis.NewerField(cfg.NewerField)
+				}
+				target.ContinueOnError = cfg.ContinueOnError
+				target.QuietErrors = cfg.QuietErrors
+				target.Metadata = cfg.Metadata
+				target.OOM = cfg.OOM
+				target.BulkLimit = limit
+				target.DrainTimeout = cfg.DrainTimeout
+				target.OOMRetries = cfg.OOMRetries
+				target.OOMBackoff = cfg.OOMBackoff
+				if cfg.Pipeline != (redis.Flush{}) {
+					flush := cfg.Pipeline
+					target.Pipeline = &flush
+				}
+				target.Asking = cfg.Slot != nil
+				target.Breaker = breaker
+				target.FailFast = failFast
+				target.DeadLetter = deadLetter
+				target.SkipFiles = skipFiles
+				target.MaxRetries = cfg.MaxRetries
+				target.RetryBudget = cfg.RetryBudget
+				target.Verify = verify
+				target.TTLTolerance = cfg.TTLTolerance
+				target.TTLOnly = cfg.TTLOnly
+				target.Audit = auditLog
+				target.Bloom = keyBloom
+				target.Completed = completed
+				target.Move = mover
+				target.Records = keyRecords
+				target.Provenance = provenance
+				target.Balance = balance
+				target.Script = script
+				if via != nil {
+					target.Via = via
+				}
+				target.Summary = sum
+				if i == 0 && j == 0 {
+					checker.Add("target", target.Ping)
+				}
+
+				wg.Add(1)
+				g.Go(func() error {
+					defer wg.Done()
+					return target.Write(gctx)
+				})
+			}
+		}
 
 		g.Go(func() error {
-			defer cancel()
-			return target.Write(gctx)
+			wg.Wait()
+			cancel()
+			return nil
 		})
-	} else {
-		target := file.New(cfg.Target.URI, ch, cfg.Silent, cfg.TTL, cfg.MaxBuf)
+	default:
+		target := file.New(cfg.Target.URI, writes, cfg.Silent, cfg.TTL, cfg.MaxBuf)
+		target.Format = cfg.Format
+		target.ChunkSize = cfg.ChunkSize
+		target.Checksums = cfg.Checksums || cfg.IncrementalFrom != ""
+		target.CompressAbove = cfg.CompressAbove
+		target.Codec = cfg.CompressCodec
+		target.Serializer = cfg.Serializer
+		target.Base = cfg.IncrementalFrom
+		target.Shards = cfg.Shards
+		target.PartitionByType = cfg.PartitionByType
+		target.LogEvery = cfg.LogEvery
+		target.Summary = sum
 
 		g.Go(func() error {
 			defer cancel()
@@ -78,11 +976,72 @@ func Run(cfg config.Config) {
 		})
 	}
 
+	// Post the run events, once running
+	var hook *webhook.Hook
+	if cfg.Webhook != "" {
+		hook = webhook.New(cfg.Webhook, redis.Redact(cfg.Source.URI), redis.Redact(cfg.Target.URI), sum)
+		if err := hook.Post(webhook.Started, nil); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+
 	// Block and wait for goroutines
 	err := g.Wait()
+	balance.Report(sum)
+	writeBloom(cfg, keyBloom)
+	reportCompleted(cfg, sum, completed)
+	reportMove(cfg, sum)
+	if ferr := failFast.Err(); ferr != nil {
+		err = ferr
+	}
+	// Sample the synced keys, once complete
+	if (err == nil || err == context.Canceled) && cfg.Verify.SampleRate > 0 && atomic.LoadInt32(&interrupted) == 0 && (checkpoint == nil || !checkpoint.Stopped()) {
+		if verr := verifySample(cfg, sum); verr != nil {
+			err = verr
+		}
+	}
 	if err != nil && err != context.Canceled {
+		prog.Finish(err)
+		if herr := hook.Post(webhook.Failed, err); herr != nil {
+			fmt.Fprintln(os.Stderr, herr)
+		}
+		writeTextfile(cfg, sum, err)
+		fmt.Println(sum)
 		exit(err)
 	} else {
-		fmt.Println("done")
+		if err := prog.Finish(nil); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		writeTextfile(cfg, sum, nil)
+		if err := hook.Post(webhook.Done, nil); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		partial = checkpoint != nil && checkpoint.Stopped()
+		if cfg.RangeManifest != "" && atomic.LoadInt32(&interrupted) == 0 && !partial {
+			keys, _ := sum.Processed()
+			if err := progress.AddRange(cfg.RangeManifest, keyRange, redis.Redact(cfg.Source.URI), redis.Redact(cfg.Target.URI), keys); err != nil {
+				exit(err)
+			}
+		}
+		// Interrupted runs drop the keys left on the bus, their cursor isn't
+		// safe to resume from
+		if checkpoint != nil && atomic.LoadInt32(&interrupted) == 0 {
+			keys, _ := sum.Processed()
+			resumed.Cursor = checkpoint.Cursor()
+			resumed.Done = !partial
+			resumed.Source = redis.Redact(cfg.Source.URI)
+			resumed.Target = redis.Redact(cfg.Target.URI)
+			resumed.Keys += keys
+			if err := progress.WriteCheckpoint(cfg.Checkpoint, resumed); err != nil {
+				exit(err)
+			}
+		}
+		if partial {
+			fmt.Printf("partial, checkpointed at cursor %s to %s after max-runtime %s, rerun with -resume\n",
+				checkpoint.Cursor(), cfg.Checkpoint, cfg.MaxRuntime)
+		} else {
+			fmt.Println("done")
+		}
+		fmt.Println(sum)
 	}
 }
@@ -0,0 +1,74 @@
+package run
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// newRunID returns a run ID: the UTC start time and 4 random bytes, e.g.
+// 20240102T150405Z-9f86d081, telling apart the shards of a distributed run
+// started at once, in containers sharing their process IDs.
+func newRunID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+
+	return fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102T150405Z"), hex.EncodeToString(b))
+}
+
+// flushLogs waits for the lines prefixed by prefixLogs to be written, before
+// exiting, a noop otherwise.
+var flushLogs = func() {}
+
+// prefixLogs prefixes each line written to stdout and stderr with the run
+// ID, e.g. run=20240102T150405Z-9f86d081, through pipes, setting flushLogs,
+// which restores them.
+func prefixLogs(id string) {
+	var wg sync.WaitGroup
+	var restores []func()
+	prefix := func(f **os.File) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error prefixing logs with the run ID: %v\n", err)
+			return
+		}
+		out := *f
+		*f = w
+		restores = append(restores, func() {
+			w.Close()
+			*f = out
+		})
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lines := bufio.NewReader(r)
+			for {
+				line, err := lines.ReadString('\n')
+				if line != "" {
+					io.WriteString(out, "run="+id+" "+line)
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+	}
+	prefix(&os.Stdout)
+	prefix(&os.Stderr)
+
+	var once sync.Once
+	flushLogs = func() {
+		once.Do(func() {
+			for _, restore := range restores {
+				restore()
+			}
+			wg.Wait()
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package run
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/stickermule/rump/pkg/config"
+	"github.com/stickermule/rump/pkg/message"
+	"github.com/stickermule/rump/pkg/redis"
+)
+
+// Sample prints the metadata of a few source keys, without transferring them.
+func Sample(cfg config.Config) {
+	db, err := newPool(cfg.Source, cfg.CertReload, 1)
+	if err != nil {
+		exit(fmt.Errorf("error creating new redis pool for %s: %w", redis.Redact(cfg.Source.URI), err))
+	}
+	defer db.Close()
+
+	source := redis.New(db, nil, cfg.Silent, true)
+	source.Filter = cfg.Filter
+	source.Rename = cfg.Source.Rename
+
+	infos, err := source.Sample(context.Background(), cfg.Sample.Count)
+	if err != nil {
+		exit(err)
+	}
+
+	if cfg.Sample.JSON {
+		if err := json.NewEncoder(os.Stdout).Encode(infos); err != nil {
+			exit(err)
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tTYPE\tSIZE\tTTL\tENCODING")
+	for _, i := range infos {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", message.FormatKey(i.Key), i.Type, i.Size, i.TTL, i.Encoding)
+	}
+	w.Flush()
+}
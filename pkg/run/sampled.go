@@ -0,0 +1,64 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/stickermule/rump/pkg/config"
+	"github.com/stickermule/rump/pkg/redis"
+	"github.com/stickermule/rump/pkg/summary"
+)
+
+// verifySample compares the -verify-sample-rate share of the source keys
+// with the target once synced, printing and noting the mismatch rate, and
+// returns an error when above -verify-sample-max-mismatch.
+func verifySample(cfg config.Config, sum *summary.Summary) error {
+	workers := cfg.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	seed := cfg.Verify.SampleSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	pools := make([]*redis.Redis, 2)
+	for i, r := range []config.Resource{cfg.Source, cfg.Target} {
+		db, err := newPool(r, cfg.CertReload, workers)
+		if err != nil {
+			return fmt.Errorf("error creating new redis pool for %s: %w", redis.Redact(r.URI), err)
+		}
+		defer db.Close()
+
+		pools[i] = redis.New(db, nil, cfg.Silent, cfg.TTL)
+		pools[i].Filter = cfg.Filter
+		pools[i].ScanCount = cfg.ScanCount
+		pools[i].Rename = r.Rename
+		pools[i].TTLTolerance = cfg.TTLTolerance
+	}
+
+	report := func(d redis.KeyDiff) error {
+		if !cfg.Silent {
+			fmt.Printf("verify-sample: key \"%s\" %s\n", d.Key, d.Status)
+		}
+		return nil
+	}
+	fmt.Printf("verify-sample: comparing %g%% of the source keys, seed %d\n", cfg.Verify.SampleRate, seed)
+	s, err := redis.SampleVerify(context.Background(), pools[0], pools[1], cfg.Verify.SampleRate/100, seed, workers, report)
+	if err != nil {
+		return fmt.Errorf("error verifying sampled keys: %w", err)
+	}
+
+	sum.Add("sample-verified", s.Sampled)
+	sum.Add("sample-mismatches", s.Mismatches)
+	note := fmt.Sprintf("verify-sample: %d mismatches in %d keys sampled, %.3f%%, at most %.3f%% of all keys at 95%% confidence, seed %d",
+		s.Mismatches, s.Sampled, 100*s.Rate, 100*s.Upper, seed)
+	fmt.Println(note)
+	sum.Note(note)
+	if 100*s.Rate > cfg.Verify.MaxMismatch {
+		return fmt.Errorf("verification failed, sampled mismatch rate %.3f%% above %g%%", 100*s.Rate, cfg.Verify.MaxMismatch)
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package run
+
+import (
+	"context"
+	"math/rand"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// shuffle forwards the Payloads of in to out in random order, within a
+// window of the last window Payloads read, closing out once in is closed.
+// Each Payload read past the window sends a random one of it, the window
+// left is sent shuffled at the end.
+func shuffle(ctx context.Context, in, out message.Bus, window int, seed int64) error {
+	defer close(out)
+
+	rnd := rand.New(rand.NewSource(seed))
+	send := func(p message.Payload) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case out <- p:
+			return nil
+		}
+	}
+
+	buf := make([]message.Payload, 0, window)
+	for p := range in {
+		if len(buf) < window {
+			buf = append(buf, p)
+			continue
+		}
+		i := rnd.Intn(len(buf))
+		if err := send(buf[i]); err != nil {
+			return err
+		}
+		buf[i] = p
+	}
+
+	rnd.Shuffle(len(buf), func(i, j int) { buf[i], buf[j] = buf[j], buf[i] })
+	for _, p := range buf {
+		if err := send(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/stickermule/rump/pkg/config"
+	"github.com/stickermule/rump/pkg/redis"
+	"github.com/stickermule/rump/pkg/summary"
+)
+
+// snapshotPoll is the interval INFO persistence is polled at, until the
+// BGSAVE of -source-snapshot is done.
+const snapshotPoll = time.Second
+
+// snapshot saves the source with BGSAVE, returning its RDB file path, empty
+// when it can't be saved or read, the run falling back to SCAN, noted in the
+// summary.
+func snapshot(ctx context.Context, cfg config.Config, sum *summary.Summary) string {
+	fallback := func(err error) string {
+		fmt.Printf("snapshot: %v, falling back to SCAN\n", err)
+		sum.Note(fmt.Sprintf("source snapshot unavailable, read with SCAN: %v", err))
+		return ""
+	}
+
+	db, err := newPool(cfg.Source, cfg.CertReload, 1)
+	if err != nil {
+		exit(fmt.Errorf("error creating new redis pool for %s: %w", redis.Redact(cfg.Source.URI), err))
+	}
+	defer db.Close()
+
+	source := redis.New(db, nil, cfg.Silent, cfg.TTL)
+	source.Rename = cfg.Source.Rename
+	fmt.Println("snapshot: BGSAVE of the source")
+	path, err := source.Snapshot(ctx, snapshotPoll)
+	if err != nil {
+		return fallback(err)
+	}
+	if cfg.SnapshotPath != "" {
+		path = cfg.SnapshotPath
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fallback(fmt.Errorf("error opening the RDB file: %w", err))
+	}
+	f.Close()
+
+	fmt.Printf("snapshot: reading the source keys off %s\n", path)
+	sum.Note(fmt.Sprintf("source read off its BGSAVE snapshot %s", path))
+
+	return path
+}
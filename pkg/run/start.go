@@ -0,0 +1,39 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// startDelay returns the delay before connecting: delay plus a random
+// offset up to jitter, different for processes launched at once.
+func startDelay(delay, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return delay
+	}
+	r := rand.New(rand.NewSource(time.Now().UnixNano() ^ int64(os.Getpid())<<32))
+
+	return delay + time.Duration(r.Int63n(int64(jitter)+1))
+}
+
+// waitStart waits the start delay, logged even when silent, returning early
+// with the context error once ctx is done.
+func waitStart(ctx context.Context, delay, jitter time.Duration) error {
+	d := startDelay(delay, jitter)
+	if d == 0 {
+		return nil
+	}
+
+	fmt.Printf("start: waiting %s before connecting\n", d.Round(time.Millisecond))
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
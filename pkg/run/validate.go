@@ -0,0 +1,31 @@
+package run
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/stickermule/rump/pkg/config"
+	"github.com/stickermule/rump/pkg/file"
+)
+
+// Validate prints the records of the source file that wouldn't restore,
+// exiting non-zero when there are any. It never connects to Redis.
+func Validate(cfg config.Config) {
+	source := file.New(cfg.Source.URI, nil, cfg.Silent, cfg.TTL, cfg.MaxBuf)
+	source.Format = cfg.Format
+	source.DB = cfg.RDB.DB
+	source.TargetVersion = cfg.RDB.TargetVersion
+
+	v, err := source.Validate(context.Background())
+	if err != nil {
+		exit(fmt.Errorf("error validating %s: %w", cfg.Source.URI, err))
+	}
+
+	for _, p := range v.Problems {
+		fmt.Println("validate:", p)
+	}
+	fmt.Printf("validate: records=%d bytes=%d problems=%d\n", v.Records, v.Bytes, len(v.Problems))
+	if len(v.Problems) > 0 {
+		exit(fmt.Errorf("%s is corrupted", cfg.Source.URI))
+	}
+}
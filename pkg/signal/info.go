@@ -0,0 +1,30 @@
+package signal
+
+import (
+	"context"
+	"os"
+	"os/signal"
+)
+
+// Info calls report each time an info signal is received (SIGINFO, Ctrl-T,
+// where available, SIGUSR1 elsewhere), without stopping.
+// It will be run in an ErrGroup supervisor.
+func Info(ctx context.Context, report func()) error {
+	if len(infoSignals) == 0 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	infoChannel := make(chan os.Signal, 1)
+	signal.Notify(infoChannel, infoSignals...)
+	defer signal.Stop(infoChannel)
+
+	for {
+		select {
+		case <-infoChannel:
+			report()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package signal
+
+import (
+	"os"
+	"syscall"
+)
+
+// infoSignals trigger a progress report, SIGINFO is sent by Ctrl-T.
+var infoSignals = []os.Signal{syscall.SIGINFO, syscall.SIGUSR1}
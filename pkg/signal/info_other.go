@@ -0,0 +1,11 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package signal
+
+import (
+	"os"
+)
+
+// infoSignals is empty, there's no user signal to trigger a progress report.
+var infoSignals []os.Signal
@@ -0,0 +1,12 @@
+//go:build !darwin && !dragonfly && !freebsd && !netbsd && !openbsd && !windows && !plan9
+// +build !darwin,!dragonfly,!freebsd,!netbsd,!openbsd,!windows,!plan9
+
+package signal
+
+import (
+	"os"
+	"syscall"
+)
+
+// infoSignals trigger a progress report, SIGINFO isn't available.
+var infoSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,259 @@
+// Package summary collects counters and notes during a run,
+// printed once the run is over.
+// All methods are safe for concurrent use, and are noops on a nil Summary.
+package summary
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stickermule/rump/pkg/message"
+)
+
+// Summary holds named counters, in insertion order, notes and named
+// timings, summed up as percentiles.
+// It also tracks the processed keys, for on demand progress reports, and
+// the ID of the run, when set.
+type Summary struct {
+	mu        sync.Mutex
+	runID     string
+	counters  map[string]int64
+	order     []string
+	notes     []string
+	timings   map[string][]time.Duration
+	timed     []string
+	started   time.Time
+	processed int64
+	current   string
+}
+
+// New creates an empty Summary, started now.
+func New() *Summary {
+	return &Summary{
+		counters: make(map[string]int64),
+		timings:  make(map[string][]time.Duration),
+		started:  time.Now(),
+	}
+}
+
+// SetRunID sets the ID of the run, leading the summary line.
+func (s *Summary) SetRunID(id string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.runID = id
+}
+
+// RunID returns the ID of the run, empty unless set.
+func (s *Summary) RunID() string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.runID
+}
+
+// Track records key as the key being processed, and counts it.
+func (s *Summary) Track(key string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.processed++
+	s.current = key
+}
+
+// Processed returns the processed keys count, and the time since start.
+func (s *Summary) Processed() (int64, time.Duration) {
+	if s == nil {
+		return 0, 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.processed, time.Since(s.started)
+}
+
+// Add adds n to the name counter.
+func (s *Summary) Add(name string, n int64) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.counters[name]; !ok {
+		s.order = append(s.order, name)
+	}
+	s.counters[name] += n
+}
+
+// Incr increments the name counter by one.
+func (s *Summary) Incr(name string) {
+	s.Add(name, 1)
+}
+
+// Time records d in the name timings.
+func (s *Summary) Time(name string, d time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.timings[name]; !ok {
+		s.timed = append(s.timed, name)
+	}
+	s.timings[name] = append(s.timings[name], d)
+}
+
+// Percentile returns the pth percentile, from 0 to 100, of the name
+// timings, 0 without any.
+func (s *Summary) Percentile(name string, p float64) time.Duration {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return percentile(s.timings[name], p)
+}
+
+// percentile returns the pth percentile of timings, sorting them,
+// with the nearest rank method.
+func percentile(timings []time.Duration, p float64) time.Duration {
+	if len(timings) == 0 {
+		return 0
+	}
+	sort.Slice(timings, func(i, j int) bool { return timings[i] < timings[j] })
+
+	rank := int(p/100*float64(len(timings))+0.5) - 1
+	switch {
+	case rank < 0:
+		rank = 0
+	case rank >= len(timings):
+		rank = len(timings) - 1
+	}
+
+	return timings[rank]
+}
+
+// Get returns the current value of the name counter.
+func (s *Summary) Get(name string) int64 {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.counters[name]
+}
+
+// Note records a message, duplicates are ignored.
+func (s *Summary) Note(note string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, n := range s.notes {
+		if n == note {
+			return
+		}
+	}
+	s.notes = append(s.notes, note)
+}
+
+// Snapshot is the JSON form of a Summary: the RunID, when set, the
+// processed Keys, the Elapsed seconds since start, the Counters by name and
+// the Notes.
+type Snapshot struct {
+	RunID    string           `json:"run_id,omitempty"`
+	Keys     int64            `json:"keys"`
+	Elapsed  float64          `json:"elapsed"`
+	Counters map[string]int64 `json:"counters"`
+	Notes    []string         `json:"notes,omitempty"`
+}
+
+// Snapshot returns the current counters and notes.
+func (s *Summary) Snapshot() Snapshot {
+	if s == nil {
+		return Snapshot{Counters: map[string]int64{}}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counters := make(map[string]int64, len(s.counters))
+	for name, n := range s.counters {
+		counters[name] = n
+	}
+
+	return Snapshot{
+		RunID:    s.runID,
+		Keys:     s.processed,
+		Elapsed:  time.Since(s.started).Seconds(),
+		Counters: counters,
+		Notes:    append([]string(nil), s.notes...),
+	}
+}
+
+// String formats counters on a single line, followed by notes.
+func (s *Summary) String() string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	line := "summary:"
+	if s.runID != "" {
+		line += " run=" + s.runID
+	}
+	for _, name := range s.order {
+		line += fmt.Sprintf(" %s=%d", name, s.counters[name])
+	}
+
+	lines := []string{line}
+	for _, name := range s.timed {
+		t := s.timings[name]
+		lines = append(lines, fmt.Sprintf("summary: %s n=%d p50=%s p95=%s p99=%s max=%s", name, len(t),
+			percentile(t, 50), percentile(t, 95), percentile(t, 99), percentile(t, 100)))
+	}
+	for _, n := range s.notes {
+		lines = append(lines, "summary: "+n)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Progress formats processed keys, rate since start, current key and
+// counters on a single line.
+func (s *Summary) Progress() string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elapsed := time.Since(s.started)
+	rate := float64(s.processed) / elapsed.Seconds()
+
+	line := fmt.Sprintf("progress: processed=%d rate=%.1f/s elapsed=%s current=%s",
+		s.processed, rate, elapsed.Truncate(time.Second), message.FormatKey(s.current))
+	for _, name := range s.order {
+		line += fmt.Sprintf(" %s=%d", name, s.counters[name])
+	}
+
+	return line
+}
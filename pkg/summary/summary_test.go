@@ -0,0 +1,99 @@
+package summary
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCounters(t *testing.T) {
+	s := New()
+	s.Incr("restored")
+	s.Add("restored", 2)
+	s.Incr("shadowed")
+
+	if s.Get("restored") != 3 {
+		t.Error("wrong restored count")
+	}
+
+	if s.String() != "summary: restored=3 shadowed=1" {
+		t.Errorf("wrong summary: %s", s)
+	}
+
+	s.SetRunID("20240102T150405Z-9f86d081")
+	if s.String() != "summary: run=20240102T150405Z-9f86d081 restored=3 shadowed=1" || s.Snapshot().RunID != "20240102T150405Z-9f86d081" {
+		t.Errorf("wrong summary: %s", s)
+	}
+}
+
+func TestNotes(t *testing.T) {
+	s := New()
+	s.Note("degraded")
+	s.Note("degraded")
+
+	if s.String() != "summary:\nsummary: degraded" {
+		t.Errorf("wrong summary: %q", s)
+	}
+}
+
+func TestTimings(t *testing.T) {
+	s := New()
+	for i := 100; i >= 1; i-- {
+		s.Time("restore", time.Duration(i)*time.Millisecond)
+	}
+
+	if p := s.Percentile("restore", 95); p != 95*time.Millisecond {
+		t.Errorf("wrong p95: %s", p)
+	}
+	if s.Percentile("dump", 50) != 0 {
+		t.Error("percentiles without timings should be 0")
+	}
+
+	expected := "summary:\nsummary: restore n=100 p50=50ms p95=95ms p99=99ms max=100ms"
+	if s.String() != expected {
+		t.Errorf("wrong summary: %q", s)
+	}
+}
+
+func TestNil(t *testing.T) {
+	var s *Summary
+	s.Incr("restored")
+	s.Note("degraded")
+
+	if s.Get("restored") != 0 || s.String() != "" {
+		t.Error("nil summary should be a noop")
+	}
+}
+
+func TestProgress(t *testing.T) {
+	s := New()
+	s.Track("key1")
+	s.Track("key2")
+	s.Incr("restored")
+
+	p := s.Progress()
+	if !strings.HasPrefix(p, "progress: processed=2 ") {
+		t.Errorf("wrong progress: %s", p)
+	}
+	if !strings.HasSuffix(p, `current="key2" restored=1`) {
+		t.Errorf("wrong progress: %s", p)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	s := New()
+	s.Track("a")
+	s.Incr("restored")
+	s.Note("degraded")
+
+	snap := s.Snapshot()
+	s.Incr("restored")
+	if snap.Keys != 1 || snap.Counters["restored"] != 1 || len(snap.Notes) != 1 || snap.Elapsed <= 0 {
+		t.Errorf("wrong snapshot: %+v", snap)
+	}
+
+	var nilSummary *Summary
+	if nilSummary.Snapshot().Counters == nil {
+		t.Error("nil summary snapshot should have empty counters")
+	}
+}
@@ -0,0 +1,121 @@
+// Package webhook posts the run lifecycle events to a webhook, as JSON, for
+// pipelines to react to a run without parsing its logs.
+// Hook methods are noops on a nil Hook.
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/stickermule/rump/pkg/summary"
+)
+
+// Event types, a run posts Started, then Done or Failed.
+const (
+	Started = "started"
+	Done    = "done"
+	Failed  = "failed"
+)
+
+// Defaults of New, short enough not to hold up the run.
+const (
+	DefaultTimeout = 5 * time.Second
+	DefaultRetries = 2
+	DefaultBackoff = time.Second
+)
+
+// Event is the JSON body posted. Source and Target identify the run ends,
+// e.g. redacted URIs, Time is RFC 3339 in UTC, Error is the run error of
+// Failed Events.
+type Event struct {
+	Event   string           `json:"event"`
+	Time    string           `json:"time"`
+	Source  string           `json:"source"`
+	Target  string           `json:"target"`
+	Error   string           `json:"error,omitempty"`
+	Summary summary.Snapshot `json:"summary"`
+}
+
+// Hook posts Events to URL, each POST timing out after Timeout, retried
+// Retries times Backoff apart on network errors, 429 and 5xx replies.
+type Hook struct {
+	URL     string
+	Source  string
+	Target  string
+	Timeout time.Duration
+	Retries int
+	Backoff time.Duration
+	Summary *summary.Summary
+}
+
+// New creates a Hook posting to url the Events of the run from source to
+// target, collecting sum, with the default timeout and retries.
+func New(url, source, target string, sum *summary.Summary) *Hook {
+	return &Hook{
+		URL:     url,
+		Source:  source,
+		Target:  target,
+		Timeout: DefaultTimeout,
+		Retries: DefaultRetries,
+		Backoff: DefaultBackoff,
+		Summary: sum,
+	}
+}
+
+// Post posts the event of type event, Failed with err.
+func (h *Hook) Post(event string, err error) error {
+	if h == nil {
+		return nil
+	}
+
+	e := Event{
+		Event:   event,
+		Time:    time.Now().UTC().Format(time.RFC3339Nano),
+		Source:  h.Source,
+		Target:  h.Target,
+		Summary: h.Summary.Snapshot(),
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: h.Timeout}
+	for attempt := 0; ; attempt++ {
+		retry, err := h.post(client, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= h.Retries {
+			return fmt.Errorf("error posting %s event to webhook: %w", event, err)
+		}
+		time.Sleep(h.Backoff)
+	}
+}
+
+// post posts body once, reporting whether a failed POST can be retried.
+func (h *Hook) post(client *http.Client, body []byte) (bool, error) {
+	resp, err := client.Post(h.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("webhook replied %s", resp.Status)
+	case resp.StatusCode >= 300:
+		return false, fmt.Errorf("webhook replied %s", resp.Status)
+	}
+
+	return false, nil
+}
@@ -0,0 +1,72 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stickermule/rump/pkg/summary"
+)
+
+func TestPost(t *testing.T) {
+	var events []Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Error("error: ", err)
+		}
+		events = append(events, e)
+	}))
+	defer server.Close()
+
+	sum := summary.New()
+	sum.Incr("restored")
+	h := New(server.URL, "redis://s", "/t.rump", sum)
+	if err := h.Post(Started, nil); err != nil {
+		t.Fatal("error: ", err)
+	}
+	if err := h.Post(Failed, errors.New("target down")); err != nil {
+		t.Fatal("error: ", err)
+	}
+
+	if len(events) != 2 || events[0].Event != Started || events[0].Error != "" || events[0].Source != "redis://s" {
+		t.Fatalf("wrong events: %+v", events)
+	}
+	if e := events[1]; e.Event != Failed || e.Error != "target down" || e.Summary.Counters["restored"] != 1 || e.Time == "" {
+		t.Errorf("wrong failed event: %+v", e)
+	}
+}
+
+func TestPostRetries(t *testing.T) {
+	var posts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts++
+		switch {
+		case r.URL.Path == "/invalid":
+			w.WriteHeader(http.StatusBadRequest)
+		case posts < 3:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	h := New(server.URL, "", "", nil)
+	h.Backoff = 0
+	if err := h.Post(Done, nil); err != nil || posts != 3 {
+		t.Errorf("expected success on the last retry, posts: %d, error: %v", posts, err)
+	}
+
+	// Client errors aren't retried
+	posts = 0
+	h.URL = server.URL + "/invalid"
+	if err := h.Post(Done, nil); err == nil || posts != 1 {
+		t.Errorf("expected a single failed post, error: %v", err)
+	}
+
+	var nilHook *Hook
+	if err := nilHook.Post(Done, nil); err != nil {
+		t.Error("nil hook should be a noop: ", err)
+	}
+}